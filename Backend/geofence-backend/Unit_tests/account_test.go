@@ -0,0 +1,227 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUpdateUserProfile(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	user := createUser(t, "editor")
+	createUser(t, "taken")
+
+	rr := callAsUser(handlers.UpdateUserProfile, "PATCH", "/api/auth/me", nil, map[string]string{
+		"bio":        "New bio",
+		"avatar_url": "https://example.com/a.png",
+	}, user.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, "New bio", data["bio"])
+	assert.Equal(t, "editor", data["username"])
+	_, hasPassword := data["password"]
+	assert.False(t, hasPassword)
+
+	// Usernames stay unique
+	rr = callAsUser(handlers.UpdateUserProfile, "PATCH", "/api/auth/me", nil, map[string]string{"username": "taken"}, user.ID)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	// A bad email rejects the whole request, not just the email
+	rr = callAsUser(handlers.UpdateUserProfile, "PATCH", "/api/auth/me", nil, map[string]string{
+		"username": "renamed",
+		"bio":      "Newer bio",
+		"email":    "taken@example.com",
+	}, user.ID)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var stored models.User
+	database.DB.First(&stored, user.ID)
+	assert.Equal(t, "editor", stored.Username)
+	assert.Equal(t, "New bio", stored.Bio)
+}
+
+func TestEmailChangeRequiresVerification(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	user := createUser(t, "mover")
+
+	rr := callAsUser(handlers.UpdateUserProfile, "PATCH", "/api/auth/me", nil, map[string]string{"email": "new@example.com"}, user.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// The old address stays active until verification
+	var reloaded models.User
+	database.DB.First(&reloaded, user.ID)
+	assert.Equal(t, "mover@example.com", reloaded.Email)
+	assert.Equal(t, "new@example.com", reloaded.PendingEmail)
+
+	// A wrong token is rejected
+	rr = callAsUser(handlers.VerifyEmail, "POST", "/api/auth/verify-email", nil, map[string]string{"token": "nope"}, 0)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Swap in a token we know (the real one only goes out by email) and verify with it
+	sum := sha256.Sum256([]byte("known-token"))
+	database.DB.Model(&models.User{}).Where("id = ?", user.ID).
+		Update("email_verification_token_hash", hex.EncodeToString(sum[:]))
+
+	rr = callAsUser(handlers.VerifyEmail, "POST", "/api/auth/verify-email", nil, map[string]string{"token": "known-token"}, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	database.DB.First(&reloaded, user.ID)
+	assert.Equal(t, "new@example.com", reloaded.Email)
+	assert.Empty(t, reloaded.PendingEmail)
+}
+
+func TestEmailVerificationFailsOnceAddressIsTaken(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	user := createUser(t, "mover")
+	rr := callAsUser(handlers.UpdateUserProfile, "PATCH", "/api/auth/me", nil, map[string]string{"email": "new@example.com"}, user.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	sum := sha256.Sum256([]byte("known-token"))
+	database.DB.Model(&models.User{}).Where("id = ?", user.ID).
+		Update("email_verification_token_hash", hex.EncodeToString(sum[:]))
+
+	// Someone else signs up with the address before the link is used
+	squatter := createUser(t, "squatter")
+	database.DB.Model(&squatter).Update("email", "new@example.com")
+
+	rr = callAsUser(handlers.VerifyEmail, "POST", "/api/auth/verify-email", nil, map[string]string{"token": "known-token"}, 0)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	var reloaded models.User
+	database.DB.First(&reloaded, user.ID)
+	assert.Equal(t, "mover@example.com", reloaded.Email)
+	assert.Empty(t, reloaded.PendingEmail)
+	assert.Empty(t, reloaded.EmailVerificationTokenHash)
+}
+
+func TestEmailVerificationLinkNotLogged(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	// The token would let anyone reading the logs verify the change
+	t.Setenv("EMAIL_LOG_LINKS", "")
+	assert.NoError(t, (&services.EmailService{}).SendEmailVerification("new@example.com", "secret-token"))
+	assert.Contains(t, logged.String(), "new@example.com")
+	assert.NotContains(t, logged.String(), "secret-token")
+
+	// Unless it's explicitly turned on for local development
+	t.Setenv("EMAIL_LOG_LINKS", "true")
+	assert.NoError(t, (&services.EmailService{}).SendEmailVerification("new@example.com", "secret-token"))
+	assert.Contains(t, logged.String(), "verify-email?token=secret-token")
+}
+
+func TestChangePassword(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	user := createUser(t, "rotator")
+
+	rr := callAsUser(handlers.ChangePassword, "POST", "/api/auth/me", nil, map[string]string{
+		"current_password": "wrong",
+		"new_password":     "newpassword456",
+	}, user.ID)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = callAsUser(handlers.ChangePassword, "POST", "/api/auth/me", nil, map[string]string{
+		"current_password": "password123",
+		"new_password":     "newpassword456",
+	}, user.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var reloaded models.User
+	database.DB.First(&reloaded, user.ID)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(reloaded.Password), []byte("newpassword456")))
+}
+
+func TestAccountDeletionGracePeriodAndPurge(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	user := createUser(t, "leaver")
+	other := createUser(t, "stayer")
+
+	geofence := models.Geofence{Name: "Leaver Spot", Latitude: 37.7749, Longitude: -122.4194, Radius: 100, UserID: user.ID}
+	database.DB.Create(&geofence)
+	content := models.Content{Title: "Leaver Content", GeofenceID: geofence.ID}
+	database.DB.Create(&content)
+	database.DB.Create(&models.GeofenceShare{GeofenceID: geofence.ID, OwnerID: user.ID, UserID: other.ID, Permission: "view"})
+
+	// The leaver liked someone else's content
+	otherFence := models.Geofence{Name: "Stayer Spot", Latitude: 37.7749, Longitude: -122.4194, Radius: 100, UserID: other.ID}
+	database.DB.Create(&otherFence)
+	otherContent := models.Content{Title: "Stayer Content", GeofenceID: otherFence.ID}
+	database.DB.Create(&otherContent)
+	reactions := &services.ReactionService{}
+	_, err := reactions.AddReaction(user.ID, otherContent.ID, models.InteractionLike)
+	assert.NoError(t, err)
+
+	// Deleting requires the password
+	rr := callAsUser(handlers.DeleteAccount, "DELETE", "/api/auth/me", nil, map[string]string{"password": "wrong"}, user.ID)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = callAsUser(handlers.DeleteAccount, "DELETE", "/api/auth/me", nil, map[string]string{"password": "password123"}, user.ID)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	// Nothing is purged during the grace period
+	accountService := &services.AccountService{}
+	assert.NoError(t, accountService.PurgeDueAccounts())
+	var count int64
+	database.DB.Model(&models.User{}).Where("id = ?", user.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// Once the grace period is over the account and its data are gone
+	database.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("deletion_scheduled_at", time.Now().Add(-time.Minute))
+	assert.NoError(t, accountService.PurgeDueAccounts())
+
+	database.DB.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+	database.DB.Unscoped().Model(&models.Geofence{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+	database.DB.Unscoped().Model(&models.Content{}).Where("id = ?", content.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+	database.DB.Model(&models.GeofenceShare{}).Where("geofence_id = ?", geofence.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// The like on the other user's content is withdrawn
+	var reloaded models.Content
+	database.DB.First(&reloaded, otherContent.ID)
+	assert.Equal(t, int64(0), reloaded.LikeCount)
+}
+
+func TestCancelAccountDeletion(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	user := createUser(t, "waverer")
+
+	rr := callAsUser(handlers.CancelAccountDeletion, "POST", "/api/auth/me", nil, nil, user.ID)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	callAsUser(handlers.DeleteAccount, "DELETE", "/api/auth/me", nil, map[string]string{"password": "password123"}, user.ID)
+	rr = callAsUser(handlers.CancelAccountDeletion, "POST", "/api/auth/me", nil, nil, user.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var reloaded models.User
+	database.DB.First(&reloaded, user.ID)
+	assert.Nil(t, reloaded.DeletionScheduledAt)
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func floatPtr(value float64) *float64 { return &value }
+
+func intPtr(value int) *int { return &value }
+
+func TestAltitudeValidation(t *testing.T) {
+	fence := models.Geofence{Radius: 100, MinAltitude: floatPtr(10), MaxAltitude: floatPtr(50)}
+	assert.NoError(t, services.PrepareGeofence(&fence))
+	assert.Equal(t, models.AltitudeEllipsoid, fence.AltitudeRef)
+
+	fence = models.Geofence{Radius: 100, MinAltitude: floatPtr(50), MaxAltitude: floatPtr(10)}
+	assert.ErrorIs(t, services.PrepareGeofence(&fence), services.ErrInvalidAltitude)
+	fence = models.Geofence{Radius: 100, MinAltitude: floatPtr(1.5), AltitudeRef: models.AltitudeFloor}
+	assert.ErrorIs(t, services.PrepareGeofence(&fence), services.ErrInvalidAltitude)
+	fence = models.Geofence{Radius: 100, MaxAltitude: floatPtr(3), AltitudeRef: "feet"}
+	assert.ErrorIs(t, services.PrepareGeofence(&fence), services.ErrInvalidAltitude)
+
+	// Without a band the reference is dropped
+	fence = models.Geofence{Radius: 100, AltitudeRef: models.AltitudeFloor}
+	assert.NoError(t, services.PrepareGeofence(&fence))
+	assert.Empty(t, fence.AltitudeRef)
+}
+
+func TestWithinAltitude(t *testing.T) {
+	drones := models.Geofence{MinAltitude: floatPtr(100), MaxAltitude: floatPtr(150), AltitudeRef: models.AltitudeEllipsoid}
+	assert.True(t, services.WithinAltitude(drones, services.AltitudeFix{Altitude: floatPtr(120), VerticalAccuracy: floatPtr(5)}))
+	assert.False(t, services.WithinAltitude(drones, services.AltitudeFix{Altitude: floatPtr(20), VerticalAccuracy: floatPtr(5)}))
+	// The accuracy range reaching the band is enough
+	assert.True(t, services.WithinAltitude(drones, services.AltitudeFix{Altitude: floatPtr(90), VerticalAccuracy: floatPtr(15)}))
+	// Altitude without accuracy, or a floor, falls back to 2D
+	assert.True(t, services.WithinAltitude(drones, services.AltitudeFix{Altitude: floatPtr(20)}))
+	assert.True(t, services.WithinAltitude(drones, services.AltitudeFix{Floor: intPtr(3)}))
+
+	thirdFloor := models.Geofence{MinAltitude: floatPtr(3), MaxAltitude: floatPtr(3), AltitudeRef: models.AltitudeFloor}
+	assert.True(t, services.WithinAltitude(thirdFloor, services.AltitudeFix{Floor: intPtr(3)}))
+	assert.False(t, services.WithinAltitude(thirdFloor, services.AltitudeFix{Floor: intPtr(4)}))
+	assert.True(t, services.WithinAltitude(thirdFloor, services.AltitudeFix{Altitude: floatPtr(20), VerticalAccuracy: floatPtr(1)}))
+
+	// An open end
+	rooftop := models.Geofence{MinAltitude: floatPtr(5), AltitudeRef: models.AltitudeFloor}
+	assert.True(t, services.WithinAltitude(rooftop, services.AltitudeFix{Floor: intPtr(40)}))
+}
+
+func TestAltitudeEvents(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	building := models.Geofence{Name: "Office", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	floor := models.Geofence{Name: "Third floor", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID,
+		MinAltitude: floatPtr(3), MaxAltitude: floatPtr(3), AltitudeRef: models.AltitudeFloor}
+	database.DB.Create(&building)
+	database.DB.Create(&floor)
+
+	send := func(update map[string]interface{}) services.LocationResult {
+		rr := callAsUser(handlers.IngestLocation, "POST", "/api/locations", nil, update, owner.ID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response struct {
+			Data services.LocationResult `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	// On the ground floor only the building is entered
+	result := send(map[string]interface{}{"latitude": 0, "longitude": 0, "floor": 0})
+	assert.Equal(t, []uint{building.ID}, result.Inside)
+
+	// Going upstairs enters the floor
+	result = send(map[string]interface{}{"latitude": 0, "longitude": 0, "floor": 3})
+	assert.Equal(t, []uint{building.ID, floor.ID}, result.Inside)
+	assert.Len(t, result.Entered, 1)
+
+	// A fix without a floor is checked in 2D, so they stay inside
+	result = send(map[string]interface{}{"latitude": 0, "longitude": 0})
+	assert.Equal(t, []uint{building.ID, floor.ID}, result.Inside)
+	assert.Empty(t, result.Exited)
+
+	// Going back down leaves it
+	result = send(map[string]interface{}{"latitude": 0, "longitude": 0, "floor": 1})
+	assert.Len(t, result.Exited, 1)
+
+	rr := callAsUser(handlers.LocateGeofences, "GET", "/api/geofences/locate?lat=0&lng=0&floor=3", nil, nil, owner.ID)
+	var located struct {
+		Data []services.GeofenceMatch `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &located))
+	assert.Len(t, located.Data, 2)
+	rr = callAsUser(handlers.LocateGeofences, "GET", "/api/geofences/locate?lat=0&lng=0&floor=2", nil, nil, owner.ID)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &located))
+	assert.Len(t, located.Data, 1)
+	rr = callAsUser(handlers.LocateGeofences, "GET", "/api/geofences/locate?lat=0&lng=0&floor=top", nil, nil, owner.ID)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestAltitudeOverlapsAndHierarchy(t *testing.T) {
+	low := models.Geofence{Latitude: 0, Longitude: 0, Radius: 100, MinAltitude: floatPtr(0), MaxAltitude: floatPtr(50), AltitudeRef: models.AltitudeEllipsoid}
+	high := models.Geofence{Latitude: 0, Longitude: 0, Radius: 50, MinAltitude: floatPtr(60), MaxAltitude: floatPtr(120), AltitudeRef: models.AltitudeEllipsoid}
+	inside := models.Geofence{Latitude: 0, Longitude: 0, Radius: 50, MinAltitude: floatPtr(10), MaxAltitude: floatPtr(20), AltitudeRef: models.AltitudeEllipsoid}
+	flat := models.Geofence{Latitude: 0, Longitude: 0, Radius: 50}
+
+	assert.False(t, services.GeofenceWithin(high, low))
+	assert.True(t, services.GeofenceWithin(inside, low))
+	assert.True(t, services.GeofenceWithin(flat, low))
+
+	// Stacked fences don't overlap
+	setupTestDB()
+	owner := createUser(t, "owner")
+	for _, fence := range []*models.Geofence{&low, &high, &inside} {
+		fence.UserID = owner.ID
+		database.DB.Create(fence)
+	}
+	overlaps, err := (&services.OverlapService{}).Overlaps(low, 0)
+	assert.NoError(t, err)
+	assert.Len(t, overlaps, 1)
+	assert.Equal(t, inside.ID, overlaps[0].GeofenceID)
+}
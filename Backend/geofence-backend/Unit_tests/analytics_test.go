@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getAnalytics calls the analytics endpoint for a geofence as userID
+func getAnalytics(geofenceID, userID uint, query string) *httptest.ResponseRecorder {
+	return callAsUser(handlers.GetGeofenceAnalytics, "GET", "/api/geofences/analytics?"+query, idVars(geofenceID), nil, userID)
+}
+
+func TestGeofenceAnalytics(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	alice := createUser(t, "alice")
+	bob := createUser(t, "bob")
+
+	fence := models.Geofence{Name: "Gallery", Latitude: 1, Longitude: 1, Radius: 50, UserID: owner.ID}
+	database.DB.Create(&fence)
+
+	at := func(day, hour int) time.Time { return time.Date(2026, 3, day, hour, 0, 0, 0, time.UTC) }
+	exit := func(t time.Time, minutes int) *time.Time {
+		exited := t.Add(time.Duration(minutes) * time.Minute)
+		return &exited
+	}
+
+	// 2026-03-02 is a Monday
+	visits := []models.GeofenceVisit{
+		{GeofenceID: fence.ID, UserID: alice.ID, CreatedAt: at(2, 9), ExitedAt: exit(at(2, 9), 10)},
+		{GeofenceID: fence.ID, UserID: alice.ID, CreatedAt: at(3, 9), ExitedAt: exit(at(3, 9), 30)},
+		{GeofenceID: fence.ID, UserID: bob.ID, CreatedAt: at(3, 18), ExitedAt: exit(at(3, 18), 60)},
+		{GeofenceID: fence.ID, UserID: bob.ID, CreatedAt: at(20, 12)}, // outside the range
+	}
+	for i := range visits {
+		database.DB.Create(&visits[i])
+	}
+
+	rr := getAnalytics(fence.ID, owner.ID, "from=2026-03-01&to=2026-03-07")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data services.GeofenceMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	metrics := response.Data
+
+	assert.Equal(t, int64(3), metrics.Visits)
+	assert.Equal(t, int64(2), metrics.UniqueVisitors)
+	assert.Equal(t, 0.5, metrics.ReturnVisitorRate)
+	assert.InDelta(t, 1800, *metrics.MedianDwellSeconds, 0.001)
+	assert.InDelta(t, (600+1800+3600)/3.0, *metrics.AvgDwellSeconds, 0.001)
+	assert.Equal(t, int64(2), metrics.HourOfDay[9])
+	assert.Equal(t, int64(1), metrics.DayOfWeek[time.Monday])
+	assert.Equal(t, int64(2), metrics.DayOfWeek[time.Tuesday])
+	assert.Len(t, metrics.Series, 7)
+	assert.Equal(t, int64(2), metrics.Series[2].Visits)
+	assert.Equal(t, int64(2), metrics.Series[2].UniqueVisitors)
+
+	// Weekly buckets start on Monday
+	rr = getAnalytics(fence.ID, owner.ID, "from=2026-03-01&to=2026-03-31&bucket=week")
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, time.Weekday(time.Monday), response.Data.Series[0].Start.Weekday())
+	assert.Equal(t, int64(4), response.Data.Visits)
+
+	// Only the owner and admins can see analytics
+	rr = getAnalytics(fence.ID, alice.ID, "")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	database.DB.Model(&alice).Update("is_admin", true)
+	rr = getAnalytics(fence.ID, alice.ID, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = getAnalytics(fence.ID, owner.ID, "from=2026-03-07&to=2026-03-01")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
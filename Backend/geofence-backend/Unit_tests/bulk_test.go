@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runBulk sends a batch as userID
+func runBulk(t *testing.T, mode string, operations []map[string]interface{}, userID uint) (*httptest.ResponseRecorder, services.BulkResult) {
+	rr := callAsUser(handlers.BulkGeofenceOperations, "POST", "/api/geofences/bulk", nil, map[string]interface{}{"mode": mode, "operations": operations}, userID)
+	var response struct {
+		Data services.BulkResult `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	return rr, response.Data
+}
+
+func TestBulkTransactional(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	stranger := createUser(t, "stranger")
+	store := models.Geofence{Name: "Store", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	theirs := models.Geofence{Name: "Theirs", Latitude: 1, Longitude: 1, Radius: 100, UserID: stranger.ID}
+	database.DB.Create(&store)
+	database.DB.Create(&theirs)
+
+	// One bad item rejects the whole batch
+	operations := []map[string]interface{}{
+		{"op": "create", "resource": "geofence", "geofence": map[string]interface{}{"name": "Kiosk", "latitude": 0.5, "longitude": 0.5, "radius": 50}},
+		{"op": "update", "resource": "geofence", "id": store.ID, "geofence": map[string]interface{}{"name": "Flagship", "latitude": 0, "longitude": 0, "radius": 200}},
+		{"op": "create", "resource": "geofence", "geofence": map[string]interface{}{"name": "Broken", "latitude": 0, "longitude": 0, "radius": -5}},
+		{"op": "delete", "resource": "geofence", "id": theirs.ID},
+	}
+	rr, result := runBulk(t, "transactional", operations, owner.ID)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, 0, result.Applied)
+	assert.Equal(t, 2, result.Failed)
+	statuses := []string{}
+	for _, item := range result.Results {
+		statuses = append(statuses, item.Status)
+	}
+	assert.Equal(t, []string{"not_applied", "not_applied", "failed", "failed"}, statuses)
+	assert.Equal(t, "geofence radius must be positive", result.Results[2].Error)
+	assert.Equal(t, services.ErrBulkForbidden.Error(), result.Results[3].Error)
+	database.DB.First(&store, store.ID)
+	assert.Equal(t, "Store", store.Name)
+
+	// Without the bad items it's applied
+	rr, result = runBulk(t, "", operations[:2], owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, services.BulkTransactional, result.Mode)
+	assert.Equal(t, 2, result.Applied)
+	database.DB.First(&store, store.ID)
+	assert.Equal(t, "Flagship", store.Name)
+	assert.Equal(t, 2, store.Revision)
+
+	var kiosk models.Geofence
+	assert.NoError(t, database.DB.First(&kiosk, result.Results[0].ID).Error)
+	assert.Equal(t, owner.ID, kiosk.UserID)
+	assert.Equal(t, 1, kiosk.Revision)
+}
+
+func TestBulkBestEffort(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	store := models.Geofence{Name: "Store", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&store)
+	menu := models.Content{Title: "Menu", GeofenceID: store.ID}
+	database.DB.Create(&menu)
+
+	operations := []map[string]interface{}{
+		{"op": "create", "resource": "content", "content": map[string]interface{}{"title": "Hours", "geofence_id": store.ID}},
+		{"op": "update", "resource": "content", "id": menu.ID, "content": map[string]interface{}{"title": "New menu"}},
+		{"op": "create", "resource": "content", "content": map[string]interface{}{"title": "Lost", "geofence_id": 9999}},
+		{"op": "update", "resource": "content", "id": menu.ID, "content": map[string]interface{}{"title": "Again"}},
+		{"op": "rename", "resource": "content", "id": menu.ID},
+	}
+	rr, result := runBulk(t, "best_effort", operations, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 2, result.Applied)
+	assert.Equal(t, 3, result.Failed)
+	assert.Equal(t, services.ErrBulkNotFound.Error(), result.Results[2].Error)
+	assert.Equal(t, services.ErrBulkDuplicateTarget.Error(), result.Results[3].Error)
+	assert.Equal(t, services.ErrUnknownBulkOperation.Error(), result.Results[4].Error)
+
+	database.DB.First(&menu, menu.ID)
+	assert.Equal(t, "New menu", menu.Title)
+	var count int64
+	database.DB.Model(&models.Content{}).Where("geofence_id = ?", store.ID).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	// Deleting a fence in bulk sends it to the trash like a single delete
+	_, result = runBulk(t, "best_effort", []map[string]interface{}{{"op": "delete", "resource": "geofence", "id": store.ID}}, owner.ID)
+	assert.Equal(t, 1, result.Applied)
+	assert.Len(t, getTrash(t, owner.ID), 1)
+}
+
+func TestBulkLimits(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+	owner := createUser(t, "owner")
+
+	operations := make([]map[string]interface{}, services.MaxBulkOperations+1)
+	for i := range operations {
+		operations[i] = map[string]interface{}{"op": "delete", "resource": "content", "id": i + 1}
+	}
+	rr, _ := runBulk(t, "best_effort", operations, owner.ID)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+	rr, _ = runBulk(t, "sometimes", operations[:1], owner.ID)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr, _ = runBulk(t, "best_effort", nil, owner.ID)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
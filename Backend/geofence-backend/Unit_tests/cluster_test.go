@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getClusters calls the cluster endpoint for the Bay Area at zoom
+func getClusters(t *testing.T, zoom int) services.ClusterResult {
+	rr := callAsUser(handlers.GetGeofenceClusters, "GET", "/api/geofences/clusters?bbox=-123,37,-122,38.5&zoom="+strconv.Itoa(zoom), nil, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data services.ClusterResult `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response.Data
+}
+
+func TestGeofenceClusters(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	fences := []models.Geofence{
+		{Name: "Pier 1", Latitude: 37.7970, Longitude: -122.3940, Radius: 10, UserID: 1},
+		{Name: "Pier 3", Latitude: 37.7972, Longitude: -122.3942, Radius: 10, UserID: 1},
+		{Name: "Pier 5", Latitude: 37.7974, Longitude: -122.3944, Radius: 10, UserID: 1},
+		{Name: "Lake Merritt", Latitude: 37.8024, Longitude: -122.2581, Radius: 10, UserID: 1},
+		{Name: "Opera House", Latitude: -33.8568, Longitude: 151.2153, Radius: 10, UserID: 1},
+	}
+	for i := range fences {
+		database.DB.Create(&fences[i])
+	}
+
+	// The piers cluster together; Lake Merritt is across the bay on its own
+	result := getClusters(t, 10)
+	assert.Len(t, result.Clusters, 1)
+	cluster := result.Clusters[0]
+	assert.Equal(t, 3, cluster.Count)
+	assert.InDelta(t, 37.7972, cluster.Latitude, 0.0001)
+	assert.InDelta(t, -122.3942, cluster.Longitude, 0.0001)
+	assert.Equal(t, [4]float64{-122.3944, 37.7970, -122.3940, 37.7974}, cluster.BBox)
+	assert.Len(t, result.Geofences, 1)
+	assert.Equal(t, "Lake Merritt", result.Geofences[0].Name)
+
+	// Zoomed all the way out, everything in view is one cluster
+	result = getClusters(t, 2)
+	assert.Len(t, result.Clusters, 1)
+	assert.Equal(t, 4, result.Clusters[0].Count)
+	assert.Empty(t, result.Geofences)
+
+	// At the expansion zoom the cluster splits
+	result = getClusters(t, cluster.ExpansionZoom)
+	assert.Greater(t, len(result.Clusters)+len(result.Geofences), 2)
+
+	// Past the deepest clustering zoom every fence is on its own
+	result = getClusters(t, services.MaxClusterZoom+1)
+	assert.Empty(t, result.Clusters)
+	assert.Len(t, result.Geofences, 4)
+
+	rr := callAsUser(handlers.GetGeofenceClusters, "GET", "/api/geofences/clusters?zoom=3", nil, nil, 0)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestGeofenceClustersAcrossAntimeridian(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	fences := []models.Geofence{
+		{Name: "Fiji", Latitude: -1, Longitude: 179, Radius: 10, UserID: 1},
+		{Name: "Samoa", Latitude: 1, Longitude: -172, Radius: 10, UserID: 1},
+		{Name: "Hawaii", Latitude: 5, Longitude: -160, Radius: 10, UserID: 1},
+	}
+	for i := range fences {
+		database.DB.Create(&fences[i])
+	}
+
+	rr := callAsUser(handlers.GetGeofenceClusters, "GET", "/api/geofences/clusters?bbox=170,-10,-170,10&zoom="+strconv.Itoa(services.MaxClusterZoom+1), nil, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data services.ClusterResult `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	names := []string{}
+	for _, fence := range response.Data.Geofences {
+		names = append(names, fence.Name)
+	}
+	assert.Equal(t, []string{"Fiji", "Samoa"}, names)
+}
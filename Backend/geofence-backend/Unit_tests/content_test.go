@@ -192,4 +192,9 @@ func TestGetContent(t *testing.T) {
 	if data, ok := response["data"].(map[string]interface{}); ok {
 		assert.Equal(t, "Test Content", data["title"])
 	}
+
+	// Content whose fence is gone isn't found
+	database.DB.Delete(&geofence)
+	rr = callAsUser(handlers.GetContent, "GET", "/api/contents/x", map[string]string{"id": strconv.Itoa(int(content.ID))}, nil, 0)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
\ No newline at end of file
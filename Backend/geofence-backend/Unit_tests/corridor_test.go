@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// routeAlongEquator is a corridor 200 m either side of the equator from 0°
+// to 0.1°E (about 11 km)
+func routeAlongEquator(userID uint) models.Geofence {
+	return models.Geofence{
+		Name:        "Delivery Route",
+		Type:        models.GeofenceTypeCorridor,
+		Path:        models.Polyline{{Latitude: 0, Longitude: 0}, {Latitude: 0, Longitude: 0.05}, {Latitude: 0, Longitude: 0.1}},
+		BufferWidth: 200,
+		UserID:      userID,
+	}
+}
+
+// sendLocation posts a location update as userID
+func sendLocation(t *testing.T, userID uint, lat, lng float64) services.LocationResult {
+	rr := callAsUser(handlers.IngestLocation, "POST", "/api/locations", nil, map[string]float64{"latitude": lat, "longitude": lng}, userID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data services.LocationResult `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response.Data
+}
+
+func TestCorridorGeometry(t *testing.T) {
+	route := routeAlongEquator(1)
+	assert.NoError(t, services.PrepareGeofence(&route))
+
+	// The derived circle encloses the whole corridor
+	assert.InDelta(t, 0.05, route.Longitude, 1e-9)
+	assert.InDelta(t, 5560+200, route.Radius, 5)
+
+	assert.True(t, services.GeofenceContains(route, 0.001, 0.07))
+	assert.False(t, services.GeofenceContains(route, 0.003, 0.07))
+	// Past the end of the path
+	assert.False(t, services.GeofenceContains(route, 0, 0.103))
+	assert.InDelta(t, 111.3, services.DistanceToPath(route.Path, 0.001, 0.03), 0.5)
+
+	// A box the path runs straight through, without a vertex in it
+	assert.True(t, services.GeofenceIntersectsRegion(route, services.Region{MinLat: -0.01, MinLng: 0.02, MaxLat: 0.01, MaxLng: 0.03}))
+	assert.False(t, services.GeofenceIntersectsRegion(route, services.Region{MinLat: 0.01, MinLng: 0.02, MaxLat: 0.02, MaxLng: 0.03}))
+
+	// A path over the antimeridian is centred on it with a radius to match
+	ferry := models.Geofence{
+		Type:        models.GeofenceTypeCorridor,
+		Path:        models.Polyline{{Latitude: 0, Longitude: 179.95}, {Latitude: 0, Longitude: -179.95}},
+		BufferWidth: 200,
+	}
+	assert.NoError(t, services.PrepareGeofence(&ferry))
+	assert.InDelta(t, 180, math.Abs(ferry.Longitude), 1e-9)
+	assert.InDelta(t, 5560+200, ferry.Radius, 5)
+
+	route.Path = route.Path[:1]
+	assert.Equal(t, services.ErrInvalidCorridor, services.PrepareGeofence(&route))
+	assert.Equal(t, services.ErrUnknownGeofenceType, services.PrepareGeofence(&models.Geofence{Type: "polygon"}))
+}
+
+func TestCorridorOffRouteDetection(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	driver := createUser(t, "driver")
+
+	rr := callAsUser(handlers.CreateGeofence, "POST", "/api/geofences", nil, routeAlongEquator(driver.ID), driver.ID)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created struct {
+		Data models.Geofence `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	route := created.Data
+	assert.Equal(t, models.GeofenceTypeCorridor, route.Type)
+	assert.Len(t, route.Path, 3)
+
+	// Joining the route opens a visit
+	result := sendLocation(t, driver.ID, 0.0005, 0.01)
+	assert.Equal(t, []uint{route.ID}, result.Inside)
+	assert.Len(t, result.Entered, 1)
+
+	// Staying on it changes nothing
+	result = sendLocation(t, driver.ID, -0.001, 0.06)
+	assert.Empty(t, result.Entered)
+	assert.Empty(t, result.Exited)
+
+	// Straying 500 m from it is an off-route deviation
+	result = sendLocation(t, driver.ID, 0.0045, 0.06)
+	assert.Empty(t, result.Inside)
+	assert.Len(t, result.Exited, 1)
+	if assert.Len(t, result.OffRoute, 1) {
+		assert.Equal(t, route.ID, result.OffRoute[0].GeofenceID)
+		assert.InDelta(t, 500, result.OffRoute[0].Distance, 5)
+	}
+	var deviations int64
+	database.DB.Model(&models.RouteDeviation{}).Where("user_id = ?", driver.ID).Count(&deviations)
+	assert.Equal(t, int64(1), deviations)
+
+	// Leaving a circle isn't a deviation
+	database.DB.Create(&models.Geofence{Name: "Depot", Type: models.GeofenceTypeCircle, Latitude: 1, Longitude: 1, Radius: 100, UserID: driver.ID})
+	sendLocation(t, driver.ID, 1, 1)
+	result = sendLocation(t, driver.ID, 1.01, 1)
+	assert.Len(t, result.Exited, 1)
+	assert.Empty(t, result.OffRoute)
+
+	// The viewport finds the corridor where only its middle crosses the box
+	_, page := getViewport(t, "bbox=0.02,-0.01,0.03,0.01")
+	assert.Equal(t, []string{"Delivery Route"}, viewportNames(page))
+}
+
+func TestGeoJSONImportExport(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+
+	importGeoJSON := func(body string) *httptest.ResponseRecorder {
+		return callAsUser(handlers.ImportGeofencesGeoJSON, "POST", "/api/geofences/geojson", nil, json.RawMessage(body), owner.ID)
+	}
+
+	rr := importGeoJSON(`{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-122.4269, 37.7596]}, "properties": {"name": "Dolores Park", "radius": 150}},
+		{"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[-122.42, 37.77], [-122.41, 37.78]]}, "properties": {"name": "Market St", "buffer_width": 50}}
+	]}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	// One bad feature and nothing is imported
+	rr = importGeoJSON(`{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "geometry": {"type": "Point", "coordinates": [0, 0]}, "properties": {"name": "Fine", "radius": 10}},
+		{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}, "properties": {"name": "Area"}}
+	]}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "feature 1")
+	var count int64
+	database.DB.Model(&models.Geofence{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	rr = callAsUser(handlers.ExportGeofencesGeoJSON, "GET", "/api/geofences/geojson", nil, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/geo+json", rr.Header().Get("Content-Type"))
+
+	var collection utils.GeoJSONFeatureCollection
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &collection))
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	if assert.Len(t, collection.Features, 2) {
+		assert.Equal(t, utils.GeoJSONPoint, collection.Features[0].Geometry.Type)
+		assert.JSONEq(t, `[-122.4269, 37.7596]`, string(collection.Features[0].Geometry.Coordinates))
+		assert.Equal(t, 150.0, collection.Features[0].Properties["radius"])
+		assert.Equal(t, utils.GeoJSONLineString, collection.Features[1].Geometry.Type)
+		assert.JSONEq(t, `[[-122.42, 37.77], [-122.41, 37.78]]`, string(collection.Features[1].Geometry.Coordinates))
+		assert.Equal(t, 50.0, collection.Features[1].Properties["buffer_width"])
+	}
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"geofence/internal/config"
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitDBDrivers(t *testing.T) {
+	// Put the shared test database back for the tests after this one
+	defer setupTestDB()
+
+	err := database.InitDB(&config.Config{DBDriver: "mysql"})
+	assert.EqualError(t, err, `unknown DB_DRIVER "mysql"`)
+
+	// SQLite is embedded, at the configured path
+	path := filepath.Join(t.TempDir(), "geofence.db")
+	assert.NoError(t, database.InitDB(&config.Config{DBDriver: config.DriverSQLite, DBPath: path}))
+	assert.False(t, database.IsPostgres(database.DB))
+	assert.NoError(t, database.DB.Create(&models.Geofence{Name: "Store", Latitude: 1, Longitude: 2, Radius: 100, UserID: 1}).Error)
+
+	sqlDB, _ := database.DB.DB()
+	sqlDB.Close()
+	assert.NoError(t, database.InitDB(&config.Config{DBDriver: config.DriverSQLite, DBPath: path}))
+	var count int64
+	database.DB.Model(&models.Geofence{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+	sqlDB, _ = database.DB.DB()
+	sqlDB.Close()
+}
+
+func TestLoadConfigDriver(t *testing.T) {
+	t.Setenv("DB_DRIVER", "")
+	t.Setenv("DB_PATH", "")
+	cfg := config.LoadConfig()
+	assert.Equal(t, config.DriverSQLite, cfg.DBDriver)
+	assert.Equal(t, "geofence.db", cfg.DBPath)
+
+	t.Setenv("DB_DRIVER", config.DriverPostgres)
+	t.Setenv("DB_HOST", "db.local")
+	t.Setenv("DB_PORT", "6543")
+	t.Setenv("DB_USER", "geo")
+	t.Setenv("DB_PASSWORD", "secret")
+	t.Setenv("DB_NAME", "fences")
+	t.Setenv("DB_SSLMODE", "require")
+	cfg = config.LoadConfig()
+	assert.Equal(t, config.DriverPostgres, cfg.DBDriver)
+	assert.Equal(t, "host=db.local port=6543 user=geo password=secret dbname=fences sslmode=require", cfg.PostgresDSN())
+}
+
+func TestErrorLogContext(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	entry := models.ErrorLog{ErrorMessage: "boom", SourceFile: "main.go", LineNumber: 12, Context: map[string]interface{}{"geofence_id": "7"}}
+	assert.NoError(t, database.DB.Create(&entry).Error)
+
+	var stored models.ErrorLog
+	assert.NoError(t, database.DB.First(&stored, entry.ID).Error)
+	assert.Equal(t, "7", stored.Context["geofence_id"])
+}
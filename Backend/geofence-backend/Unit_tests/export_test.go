@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportVisits(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	other := createUser(t, "other")
+
+	mine := models.Geofence{Name: "Mine", Latitude: 1, Longitude: 1, Radius: 50, UserID: owner.ID}
+	theirs := models.Geofence{Name: "Theirs", Latitude: 2, Longitude: 2, Radius: 50, UserID: other.ID}
+	database.DB.Create(&mine)
+	database.DB.Create(&theirs)
+
+	entered := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	exited := entered.Add(30 * time.Minute)
+	database.DB.Create(&models.GeofenceVisit{GeofenceID: mine.ID, UserID: other.ID, CreatedAt: entered, ExitedAt: &exited})
+	database.DB.Create(&models.GeofenceVisit{GeofenceID: mine.ID, UserID: other.ID, CreatedAt: entered.AddDate(0, 0, 10)})
+	database.DB.Create(&models.GeofenceVisit{GeofenceID: theirs.ID, UserID: owner.ID, CreatedAt: entered})
+
+	// Only visits to the user's own fences, in the date range
+	rr := callAsUser(handlers.ExportData, "GET", "/api/exports/visits?from=2026-03-01&to=2026-03-05", map[string]string{"dataset": "visits"}, nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/csv")
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "geofence_id", "user_id", "created_at", "exited_at", "revision"}, records[0])
+	assert.Len(t, records, 2)
+	assert.Equal(t, strconv.Itoa(int(mine.ID)), records[1][1])
+	assert.Equal(t, "2026-03-02T09:30:00Z", records[1][4])
+
+	// Open visits have no exit time
+	rr = callAsUser(handlers.ExportData, "GET", "/api/exports/visits?from=2026-03-10", map[string]string{"dataset": "visits"}, nil, owner.ID)
+	records, _ = csv.NewReader(rr.Body).ReadAll()
+	assert.Len(t, records, 2)
+	assert.Equal(t, "", records[1][4])
+
+	// Other people's fences can't be requested
+	rr = callAsUser(handlers.ExportData, "GET", "/api/exports/visits?geofence_id="+strconv.Itoa(int(theirs.ID)), map[string]string{"dataset": "visits"}, nil, owner.ID)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = callAsUser(handlers.ExportData, "GET", "/api/exports/visits?format=xml", map[string]string{"dataset": "visits"}, nil, owner.ID)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Parquet files start and end with the magic bytes and hold the footer length
+	rr = callAsUser(handlers.ExportData, "GET", "/api/exports/geofences?format=parquet", map[string]string{"dataset": "geofences"}, nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	file := rr.Body.Bytes()
+	assert.Equal(t, "PAR1", string(file[:4]))
+	assert.Equal(t, "PAR1", string(file[len(file)-4:]))
+	footerLength := binary.LittleEndian.Uint32(file[len(file)-8:])
+	assert.Less(t, int(footerLength), len(file)-12)
+	assert.Contains(t, string(file[len(file)-8-int(footerLength):]), "latitude")
+}
+
+func TestExportJob(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+	t.Setenv("EXPORT_DIR", t.TempDir())
+
+	owner := createUser(t, "owner")
+	fence := models.Geofence{Name: "Mine", Latitude: 1, Longitude: 1, Radius: 50, UserID: owner.ID}
+	database.DB.Create(&fence)
+	content := models.Content{Title: "Notes", GeofenceID: fence.ID}
+	database.DB.Create(&content)
+	database.DB.Create(&models.ContentInteraction{UserID: owner.ID, ContentID: content.ID, InteractionType: models.InteractionView})
+
+	rr := callAsUser(handlers.CreateExportJob, "POST", "/api/exports", nil, map[string]interface{}{
+		"dataset": "interactions",
+		"format":  "csv",
+	}, owner.ID)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	var created struct {
+		Data models.ExportJob `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	vars := map[string]string{"id": strconv.Itoa(int(created.Data.ID))}
+
+	// Wait for the job to finish
+	var job models.ExportJob
+	for i := 0; i < 100; i++ {
+		database.DB.First(&job, created.Data.ID)
+		if job.Status == models.ExportCompleted || job.Status == models.ExportFailed {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(t, models.ExportCompleted, job.Status)
+	assert.Equal(t, int64(1), job.Rows)
+
+	rr = callAsUser(handlers.GetExportJob, "GET", "/api/exports/jobs", vars, nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = callAsUser(handlers.DownloadExport, "GET", "/api/exports/jobs/download", vars, nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, []string{"ID", "CreatedAt", "UpdatedAt", "DeletedAt", "user_id", "content_id", "interaction_type", "interaction_time"}, records[0])
+	assert.Equal(t, "view", records[1][6])
+
+	// Jobs belong to the user who created them
+	rr = callAsUser(handlers.DownloadExport, "GET", "/api/exports/jobs/download", vars, nil, owner.ID+1)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -24,6 +24,31 @@ func setupTestDB() {
 	}
 	
 	// Clear all tables before each test
+	database.DB.Exec("DELETE FROM geofence_categories")
+	database.DB.Exec("DELETE FROM geofence_tags")
+	database.DB.Exec("DELETE FROM content_tags")
+	database.DB.Exec("DELETE FROM categories")
+	database.DB.Exec("DELETE FROM tags")
+	database.DB.Exec("DELETE FROM geofence_shares")
+	database.DB.Exec("DELETE FROM group_events")
+	database.DB.Exec("DELETE FROM group_subscriptions")
+	database.DB.Exec("DELETE FROM geofence_group_shares")
+	database.DB.Exec("DELETE FROM geofence_group_members")
+	database.DB.Exec("DELETE FROM geofence_groups")
+	database.DB.Exec("DELETE FROM follows")
+	database.DB.Exec("DELETE FROM user_restrictions")
+	database.DB.Exec("DELETE FROM error_logs")
+	database.DB.Exec("DELETE FROM export_jobs")
+	database.DB.Exec("DELETE FROM analytics_rollups")
+	database.DB.Exec("DELETE FROM rollup_watermarks")
+	database.DB.Exec("DELETE FROM popularity_scores")
+	database.DB.Exec("DELETE FROM content_similarities")
+	database.DB.Exec("DELETE FROM geofence_revisions")
+	database.DB.Exec("DELETE FROM geofence_schedules")
+	database.DB.Exec("DELETE FROM route_deviations")
+	database.DB.Exec("DELETE FROM geofence_visits")
+	database.DB.Exec("DELETE FROM user_preferences")
+	database.DB.Exec("DELETE FROM content_interactions")
 	database.DB.Exec("DELETE FROM contents")
 	database.DB.Exec("DELETE FROM geofences")
 	database.DB.Exec("DELETE FROM users")
@@ -348,4 +373,25 @@ func TestGetNearbyGeofences(t *testing.T) {
 		// We should have at least the 2 nearby geofences
 		assert.GreaterOrEqual(t, len(data), 2)
 	}
+}
+
+func TestNearbySearchUsesDistanceAcrossAntimeridian(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	// Both are inside the search box; only one is within the radius
+	across := models.Geofence{Name: "Across The Line", Latitude: 0.05, Longitude: -179.98, Radius: 100, UserID: 1}
+	corner := models.Geofence{Name: "Box Corner", Latitude: 0.09, Longitude: 179.87, Radius: 100, UserID: 1}
+	database.DB.Create(&across)
+	database.DB.Create(&corner)
+
+	rr := callAsUser(handlers.GetNearbyGeofences, "GET", "/api/geofences/nearby?lat=0&lng=179.95", nil, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Across The Line")
+	assert.NotContains(t, rr.Body.String(), "Box Corner")
+
+	rr = callAsUser(handlers.SearchGeofencesAdvanced, "GET", "/api/geofences/search/advanced?lat=0&lng=179.95&radius=12", nil, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Across The Line")
+	assert.NotContains(t, rr.Body.String(), "Box Corner")
 }
\ No newline at end of file
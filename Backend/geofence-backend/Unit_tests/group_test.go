@@ -0,0 +1,277 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeofenceGroups(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	friend := createUser(t, "friend")
+	stranger := createUser(t, "stranger")
+	fences := []models.Geofence{
+		{Name: "Miami Store", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID},
+		{Name: "Tampa Store", Latitude: 0, Longitude: 0.01, Radius: 100, UserID: owner.ID},
+		{Name: "Orlando Store", Latitude: 0, Longitude: 0.02, Radius: 100, UserID: owner.ID},
+		{Name: "Competitor", Latitude: 0, Longitude: 0.03, Radius: 100, UserID: stranger.ID},
+	}
+	for i := range fences {
+		database.DB.Create(&fences[i])
+	}
+	miami, tampa, orlando, competitor := fences[0], fences[1], fences[2], fences[3]
+
+	// Only the owner's own (or editable) fences can be grouped
+	rr := callAsUser(handlers.CreateGroup, "POST", "/api/groups", nil, map[string]interface{}{"name": "Florida", "geofence_ids": []uint{miami.ID, competitor.ID}}, owner.ID)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = callAsUser(handlers.CreateGroup, "POST", "/api/groups", nil, map[string]interface{}{"name": "Florida", "geofence_ids": []uint{miami.ID, 9999}}, owner.ID)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = callAsUser(handlers.CreateGroup, "POST", "/api/groups", nil, map[string]interface{}{"name": "Florida", "geofence_ids": []uint{miami.ID, tampa.ID}}, owner.ID)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created struct {
+		Data models.GeofenceGroup `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	group := created.Data
+	assert.Len(t, group.Geofences, 2)
+
+	// A fence can be in many groups
+	rr = callAsUser(handlers.CreateGroup, "POST", "/api/groups", nil, map[string]interface{}{"name": "Flagships", "geofence_ids": []uint{miami.ID}}, owner.ID)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	// Sharing the group shares its fences, including ones added later
+	rr = callAsUser(handlers.ShareGroup, "POST", "/api/groups/x", idVars(group.ID), map[string]interface{}{"user_id": friend.ID, "permission": "view"}, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = callAsUser(handlers.AddGroupGeofences, "POST", "/api/groups/x", idVars(group.ID), map[string]interface{}{"geofence_ids": []uint{orlando.ID}}, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var shares int64
+	database.DB.Model(&models.GeofenceShare{}).Where("user_id = ? AND permission = ?", friend.ID, "view").Count(&shares)
+	assert.Equal(t, int64(3), shares)
+	assert.NoError(t, (&services.GeofenceAccessService{}).CheckGeofenceAccess(friend.ID, orlando.ID, "view"))
+
+	// The friend sees the group but can't manage it; strangers don't see it
+	rr = callAsUser(handlers.GetGroup, "GET", "/api/groups/x", idVars(group.ID), nil, friend.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = callAsUser(handlers.UpdateGroup, "PUT", "/api/groups/x", idVars(group.ID), map[string]string{"name": "Mine"}, friend.ID)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = callAsUser(handlers.GetGroup, "GET", "/api/groups/x", idVars(group.ID), nil, stranger.ID)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = callAsUser(handlers.GetGroups, "GET", "/api/groups", nil, nil, friend.ID)
+	var listed struct {
+		Data []models.GeofenceGroup `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	assert.Len(t, listed.Data, 1)
+
+	// Disabling the group switches all its fences off
+	rr = callAsUser(handlers.DisableGroup, "POST", "/api/groups/x", idVars(group.ID), nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	database.DB.First(&tampa, tampa.ID)
+	assert.True(t, tampa.Disabled)
+	assert.False(t, services.GeofenceActiveAt(tampa, time.Now()))
+	rr = callAsUser(handlers.EnableGroup, "POST", "/api/groups/x", idVars(group.ID), nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	database.DB.First(&tampa, tampa.ID)
+	assert.False(t, tampa.Disabled)
+
+	// Export
+	rr = callAsUser(handlers.ExportGroupGeoJSON, "GET", "/api/groups/x", idVars(group.ID), nil, friend.ID)
+	assert.Equal(t, "application/geo+json", rr.Header().Get("Content-Type"))
+	var collection utils.GeoJSONFeatureCollection
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &collection))
+	assert.Len(t, collection.Features, 3)
+
+	// Removing a fence and deleting the group leave the fences alone
+	vars := map[string]string{"id": strconv.Itoa(int(group.ID)), "geofenceId": strconv.Itoa(int(orlando.ID))}
+	rr = callAsUser(handlers.RemoveGroupGeofence, "DELETE", "/api/groups/x", vars, nil, owner.ID)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	ids, _ := (&services.GroupService{}).MemberIDs(group.ID)
+	assert.Equal(t, []uint{miami.ID, tampa.ID}, ids)
+	rr = callAsUser(handlers.DeleteGroup, "DELETE", "/api/groups/x", idVars(group.ID), nil, owner.ID)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	var remaining int64
+	database.DB.Model(&models.Geofence{}).Where("user_id = ?", owner.ID).Count(&remaining)
+	assert.Equal(t, int64(3), remaining)
+}
+
+func TestGroupSubscriptionsAndAnalytics(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	friend := createUser(t, "friend")
+	visitor := createUser(t, "visitor")
+	miami := models.Geofence{Name: "Miami Store", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	tampa := models.Geofence{Name: "Tampa Store", Latitude: 0, Longitude: 0.01, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&miami)
+	database.DB.Create(&tampa)
+	group := models.GeofenceGroup{Name: "Florida", UserID: owner.ID}
+	database.DB.Create(&group)
+	assert.NoError(t, (&services.GroupService{}).AddMembers(&group, []uint{miami.ID, tampa.ID}))
+	_, err := (&services.GroupService{}).Share(group, friend.ID, "view")
+	assert.NoError(t, err)
+
+	rr := callAsUser(handlers.SubscribeToGroup, "POST", "/api/groups/x", idVars(group.ID), map[string][]string{"events": {"wave"}}, friend.ID)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = callAsUser(handlers.SubscribeToGroup, "POST", "/api/groups/x", idVars(group.ID), map[string][]string{"events": {"enter"}}, friend.ID)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	rr = callAsUser(handlers.SubscribeToGroup, "POST", "/api/groups/x", idVars(group.ID), map[string][]string{"events": {"enter", "exit"}}, owner.ID)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	rr = callAsUser(handlers.SubscribeToGroup, "POST", "/api/groups/x", idVars(group.ID), map[string][]string{"events": {"enter"}}, visitor.ID)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// The visitor walks through both stores
+	sendLocation(t, visitor.ID, 0, 0)
+	sendLocation(t, visitor.ID, 0, 0.005)
+	sendLocation(t, visitor.ID, 0, 0.01)
+
+	type eventPage struct {
+		Items      []models.GroupEvent `json:"items"`
+		NextCursor string              `json:"next_cursor"`
+	}
+	events := func(userID uint, query string) eventPage {
+		vars := map[string]string{"id": strconv.Itoa(int(group.ID))}
+		rr := callAsUser(handlers.GetGroupEvents, "GET", "/api/groups/x/events"+query, vars, nil, userID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response struct {
+			Data eventPage `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	page := events(owner.ID, "")
+	kinds := []string{}
+	for _, event := range page.Items {
+		kinds = append(kinds, event.Event)
+	}
+	assert.Equal(t, []string{"enter", "exit", "enter"}, kinds)
+	assert.Equal(t, []uint{miami.ID, miami.ID, tampa.ID}, []uint{page.Items[0].GeofenceID, page.Items[1].GeofenceID, page.Items[2].GeofenceID})
+
+	page = events(friend.ID, "?limit=1")
+	assert.Len(t, page.Items, 1)
+	assert.NotEmpty(t, page.NextCursor)
+	page = events(friend.ID, "?limit=1&cursor="+page.NextCursor)
+	assert.Len(t, page.Items, 1)
+	assert.Equal(t, tampa.ID, page.Items[0].GeofenceID)
+	assert.Empty(t, page.NextCursor)
+
+	// Analytics count the visitor once across the group
+	vars := map[string]string{"id": strconv.Itoa(int(group.ID))}
+	rr = callAsUser(handlers.GetGroupAnalytics, "GET", "/api/groups/x/analytics", vars, nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var analytics struct {
+		Data services.GeofenceMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &analytics))
+	assert.Equal(t, int64(2), analytics.Data.Visits)
+	assert.Equal(t, int64(1), analytics.Data.UniqueVisitors)
+	assert.Equal(t, 1.0, analytics.Data.ReturnVisitorRate)
+	assert.Equal(t, []uint{miami.ID, tampa.ID}, analytics.Data.GeofenceIDs)
+
+	rr = callAsUser(handlers.GetGroupAnalytics, "GET", "/api/groups/x/analytics", vars, nil, friend.ID)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestGroupOnlyActsOnFencesTheOwnerCanStillEdit(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	partner := createUser(t, "partner")
+	visitor := createUser(t, "visitor")
+	admin := createUser(t, "admin")
+	database.DB.Model(&admin).Update("is_admin", true)
+	store := models.Geofence{Name: "Store", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	kiosk := models.Geofence{Name: "Partner Kiosk", Latitude: 0, Longitude: 0.01, Radius: 100, UserID: partner.ID}
+	database.DB.Create(&store)
+	database.DB.Create(&kiosk)
+	share := models.GeofenceShare{GeofenceID: kiosk.ID, OwnerID: partner.ID, UserID: owner.ID, Permission: "edit"}
+	database.DB.Create(&share)
+
+	group := models.GeofenceGroup{Name: "Downtown", UserID: owner.ID}
+	database.DB.Create(&group)
+	assert.NoError(t, (&services.GroupService{}).AddMembers(&group, []uint{store.ID, kiosk.ID}))
+
+	sendLocation(t, visitor.ID, 0, 0)
+	sendLocation(t, visitor.ID, 0, 0.005)
+	sendLocation(t, visitor.ID, 0, 0.01)
+
+	// The partner takes back edit access; the kiosk stays in the group
+	database.DB.Delete(&share)
+
+	rr := callAsUser(handlers.DisableGroup, "POST", "/api/groups/x", idVars(group.ID), nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var disabled struct {
+		Data struct {
+			Updated int64 `json:"updated"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &disabled))
+	assert.Equal(t, int64(1), disabled.Data.Updated)
+	database.DB.First(&store, store.ID)
+	database.DB.First(&kiosk, kiosk.ID)
+	assert.True(t, store.Disabled)
+	assert.False(t, kiosk.Disabled)
+
+	analytics := func(userID uint) services.GeofenceMetrics {
+		rr := callAsUser(handlers.GetGroupAnalytics, "GET", "/api/groups/x", idVars(group.ID), nil, userID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response struct {
+			Data services.GeofenceMetrics `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	// The owner only sees visits to their own fence; admins see the group
+	assert.Equal(t, []uint{store.ID}, analytics(owner.ID).GeofenceIDs)
+	assert.Equal(t, int64(1), analytics(owner.ID).Visits)
+	assert.Equal(t, []uint{store.ID, kiosk.ID}, analytics(admin.ID).GeofenceIDs)
+	assert.Equal(t, int64(2), analytics(admin.ID).Visits)
+}
+
+func TestGroupShareNeverDowngradesFenceShares(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	friend := createUser(t, "friend")
+	miami := models.Geofence{Name: "Miami Store", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	tampa := models.Geofence{Name: "Tampa Store", Latitude: 0, Longitude: 0.01, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&miami)
+	database.DB.Create(&tampa)
+	database.DB.Create(&models.GeofenceShare{GeofenceID: miami.ID, OwnerID: owner.ID, UserID: friend.ID, Permission: "admin"})
+	group := models.GeofenceGroup{Name: "Florida", UserID: owner.ID}
+	database.DB.Create(&group)
+	assert.NoError(t, (&services.GroupService{}).AddMembers(&group, []uint{miami.ID, tampa.ID}))
+
+	permission := func(geofenceID uint) string {
+		var share models.GeofenceShare
+		database.DB.Where("geofence_id = ? AND user_id = ?", geofenceID, friend.ID).First(&share)
+		return share.Permission
+	}
+
+	rr := callAsUser(handlers.ShareGroup, "POST", "/api/groups/x", idVars(group.ID), map[string]interface{}{"user_id": friend.ID, "permission": "view"}, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "admin", permission(miami.ID))
+	assert.Equal(t, "view", permission(tampa.ID))
+
+	rr = callAsUser(handlers.ShareGroup, "POST", "/api/groups/x", idVars(group.ID), map[string]interface{}{"user_id": friend.ID, "permission": "edit"}, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "admin", permission(miami.ID))
+	assert.Equal(t, "edit", permission(tampa.ID))
+}
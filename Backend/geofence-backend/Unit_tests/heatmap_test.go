@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getDensity calls the density endpoint anonymously
+func getDensity(t *testing.T, query string) []services.DensityCell {
+	rr := callAsUser(handlers.GetDensity, "GET", "/api/heatmap/density?"+query, nil, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data struct {
+			Cells []services.DensityCell `json:"cells"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response.Data.Cells
+}
+
+func TestTileMath(t *testing.T) {
+	assert.Equal(t, services.Tile{Z: 1, X: 1, Y: 1}, services.TileAt(-10, 10, 1))
+	assert.Equal(t, services.Tile{Z: 10, X: 163, Y: 395}, services.TileAt(37.7749, -122.4194, 10))
+
+	bounds := services.Tile{Z: 1, X: 0, Y: 0}.Bounds()
+	assert.Equal(t, -180.0, bounds.MinLng)
+	assert.Equal(t, 0.0, bounds.MaxLng)
+	assert.InDelta(t, 85.0511, bounds.MaxLat, 0.0001)
+
+	assert.Equal(t, "u4pruydqq", services.Geohash(57.64911, 10.40744, 9))
+	box := services.GeohashBounds("u4pruydqq")
+	assert.True(t, box.MinLat <= 57.64911 && 57.64911 <= box.MaxLat)
+	assert.True(t, box.MinLng <= 10.40744 && 10.40744 <= box.MaxLng)
+}
+
+func TestHeatmapDensityAndTiles(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	fences := []models.Geofence{
+		{Name: "Ferry Building", Latitude: 37.7955, Longitude: -122.3937, Radius: 50, UserID: owner.ID},
+		{Name: "Embarcadero", Latitude: 37.7930, Longitude: -122.3960, Radius: 50, UserID: owner.ID},
+		{Name: "Sydney Opera House", Latitude: -33.8568, Longitude: 151.2153, Radius: 50, UserID: owner.ID},
+	}
+	for i := range fences {
+		database.DB.Create(&fences[i])
+	}
+	for i := 0; i < 3; i++ {
+		database.DB.Create(&models.GeofenceVisit{GeofenceID: fences[0].ID, UserID: owner.ID})
+	}
+	database.DB.Create(&models.GeofenceVisit{GeofenceID: fences[1].ID, UserID: owner.ID})
+	database.DB.Create(&models.GeofenceVisit{GeofenceID: fences[2].ID, UserID: owner.ID})
+
+	// Both San Francisco fences fall in one tile at zoom 10
+	cells := getDensity(t, "layer=visits&zoom=10")
+	assert.Len(t, cells, 2)
+	assert.Equal(t, "10/163/395", cells[0].Cell)
+	assert.Equal(t, int64(4), cells[0].Count)
+	assert.InDelta(t, (3*37.7955+37.7930)/4, cells[0].Latitude, 0.0001)
+
+	cells = getDensity(t, "layer=geofences&grid=geohash&precision=7")
+	assert.Len(t, cells, 3)
+
+	cells = getDensity(t, "layer=geofences&zoom=10&bbox=150,-35,152,-33")
+	assert.Len(t, cells, 1)
+	assert.Equal(t, int64(1), cells[0].Count)
+
+	rr := callAsUser(handlers.GetDensity, "GET", "/api/heatmap/density?grid=hex", nil, nil, 0)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// The tile with the fences in it has heat around them, and none far away
+	tile := services.TileAt(37.7955, -122.3937, 12)
+	rr = getTile(tile)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+
+	img, err := png.Decode(bytes.NewReader(rr.Body.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 256, img.Bounds().Dx())
+
+	px, py := tile.Pixel(37.7955, -122.3937)
+	_, _, _, hot := img.At(int(px), int(py)).RGBA()
+	assert.Greater(t, hot, uint32(0))
+	_, _, _, cold := img.At(int(px+100)%256, int(py+100)%256).RGBA()
+	assert.Equal(t, uint32(0), cold)
+
+	rr = getTile(services.Tile{Z: 3, X: 8, Y: 0})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+// getTile requests a heatmap tile anonymously
+func getTile(tile services.Tile) *httptest.ResponseRecorder {
+	vars := map[string]string{
+		"z": strconv.Itoa(tile.Z),
+		"x": strconv.Itoa(tile.X),
+		"y": strconv.Itoa(tile.Y),
+	}
+	return callAsUser(handlers.GetHeatmapTile, "GET", "/tiles/tile.png", vars, nil, 0)
+}
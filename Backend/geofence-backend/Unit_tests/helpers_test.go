@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// createUser creates a user with a public profile whose password is
+// "password123"
+func createUser(t *testing.T, username string) models.User {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	user := models.User{
+		Username: username,
+		Email:    username + "@example.com",
+		Password: string(hashedPassword),
+		Bio:      "Hi, I'm " + username,
+	}
+	assert.NoError(t, database.DB.Create(&user).Error)
+	return user
+}
+
+// callAsUser invokes a handler with the route vars set and body sent as
+// JSON, authenticated as userID unless it is 0. A nil body sends none.
+func callAsUser(handler http.HandlerFunc, method, path string, vars map[string]string, body interface{}, userID uint) *httptest.ResponseRecorder {
+	var payload io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		payload = bytes.NewBuffer(data)
+	}
+	req, _ := http.NewRequest(method, path, payload)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req = mux.SetURLVars(req, vars)
+	if userID != 0 {
+		req = req.WithContext(context.WithValue(req.Context(), "userID", userID))
+	}
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+// idVars is the route vars for a URL with an {id}
+func idVars(id uint) map[string]string {
+	return map[string]string{"id": strconv.Itoa(int(id))}
+}
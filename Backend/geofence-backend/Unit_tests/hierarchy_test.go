@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createChild creates a fence through the API, nested in parentID
+func createChild(t *testing.T, name string, lng, radius float64, parentID, userID uint) (int, models.Geofence) {
+	fence := models.Geofence{Name: name, Latitude: 0, Longitude: lng, Radius: radius, UserID: userID, ParentID: &parentID}
+	rr := callAsUser(handlers.CreateGeofence, "POST", "/api/geofences", nil, fence, userID)
+
+	var response struct {
+		Data models.Geofence `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	return rr.Code, response.Data
+}
+
+// hierarchyNames calls a hierarchy endpoint and returns the fence names
+func hierarchyNames(t *testing.T, handler http.HandlerFunc, id uint, query string) []string {
+	rr := callAsUser(handler, "GET", "/api/geofences/h"+query, map[string]string{"id": strconv.Itoa(int(id))}, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data []models.Geofence `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	names := []string{}
+	for _, fence := range response.Data {
+		names = append(names, fence.Name)
+	}
+	return names
+}
+
+func TestGeofenceHierarchy(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	campus := models.Geofence{Name: "Campus", Latitude: 0, Longitude: 0, Radius: 1000, UserID: owner.ID}
+	database.DB.Create(&campus)
+
+	code, building := createChild(t, "Library", 300*metresEast, 100, campus.ID, owner.ID)
+	assert.Equal(t, http.StatusCreated, code)
+	code, floor := createChild(t, "Ground Floor", 300*metresEast, 50, building.ID, owner.ID)
+	assert.Equal(t, http.StatusCreated, code)
+
+	// Children have to fit inside their parent
+	code, _ = createChild(t, "Stadium", 950*metresEast, 100, campus.ID, owner.ID)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = createChild(t, "Nowhere", 0, 10, 9999, owner.ID)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	assert.Equal(t, []string{"Campus", "Library"}, hierarchyNames(t, handlers.GetGeofenceAncestors, floor.ID, ""))
+	assert.Equal(t, []string{}, hierarchyNames(t, handlers.GetGeofenceAncestors, campus.ID, ""))
+	assert.Equal(t, []string{"Library", "Ground Floor"}, hierarchyNames(t, handlers.GetGeofenceDescendants, campus.ID, ""))
+	assert.Equal(t, []string{"Library"}, hierarchyNames(t, handlers.GetGeofenceDescendants, campus.ID, "?depth=1"))
+
+	// A point in the floor matches the whole chain, innermost first
+	rr := callAsUser(handlers.LocateGeofences, "GET", "/api/geofences/locate?lat=0&lng="+strconv.FormatFloat(300*metresEast, 'f', -1, 64), nil, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var located struct {
+		Data []services.GeofenceMatch `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &located))
+	if assert.Len(t, located.Data, 3) {
+		assert.Equal(t, floor.ID, located.Data[0].ID)
+		path := []string{}
+		for _, fence := range located.Data[0].Path {
+			path = append(path, fence.Name)
+		}
+		assert.Equal(t, []string{"Campus", "Library", "Ground Floor"}, path)
+	}
+
+	// A fence can't move under its own descendant or shrink past its children
+	update := func(fence models.Geofence) int {
+		vars := map[string]string{"id": strconv.Itoa(int(fence.ID))}
+		return callAsUser(handlers.UpdateGeofence, "PUT", "/api/geofences/"+vars["id"], vars, fence, owner.ID).Code
+	}
+	cyclic := campus
+	cyclic.ParentID = &floor.ID
+	assert.Equal(t, http.StatusBadRequest, update(cyclic))
+	shrunk := building
+	shrunk.Radius = 40
+	assert.Equal(t, http.StatusBadRequest, update(shrunk))
+	building.Radius = 150
+	assert.Equal(t, http.StatusOK, update(building))
+
+	// Deleting a fence moves its children up
+	rr = callAsUser(handlers.DeleteGeofence, "DELETE", "/api/geofences/x", map[string]string{"id": strconv.Itoa(int(building.ID))}, nil, owner.ID)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	database.DB.First(&floor, floor.ID)
+	if assert.NotNil(t, floor.ParentID) {
+		assert.Equal(t, campus.ID, *floor.ParentID)
+	}
+}
+
+func TestHierarchyCascades(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	friend := createUser(t, "friend")
+	stranger := createUser(t, "stranger")
+	city := models.Geofence{Name: "City", Latitude: 0, Longitude: 0, Radius: 5000, UserID: owner.ID}
+	database.DB.Create(&city)
+	district := models.Geofence{Name: "District", Latitude: 0, Longitude: 0, Radius: 1000, UserID: owner.ID, ParentID: &city.ID}
+	database.DB.Create(&district)
+	database.DB.Create(&models.Content{Title: "City guide", GeofenceID: city.ID})
+	database.DB.Create(&models.Content{Title: "District map", GeofenceID: district.ID})
+	database.DB.Create(&models.GeofenceShare{GeofenceID: city.ID, OwnerID: owner.ID, UserID: friend.ID, Permission: "edit"})
+
+	contentTitles := func() []string {
+		rr := callAsUser(handlers.GetContents, "GET", "/api/contents?geofence_id="+strconv.Itoa(int(district.ID)), nil, nil, 0)
+		var response struct {
+			Data []models.Content `json:"data"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		titles := []string{}
+		for _, content := range response.Data {
+			titles = append(titles, content.Title)
+		}
+		return titles
+	}
+	access := &services.GeofenceAccessService{}
+
+	// Nothing cascades unless the parent asks for it
+	assert.Equal(t, []string{"District map"}, contentTitles())
+	assert.Error(t, access.CheckGeofenceAccess(friend.ID, district.ID, "edit"))
+
+	database.DB.Model(&city).Updates(map[string]interface{}{"cascade_content": true, "cascade_permissions": true})
+	assert.ElementsMatch(t, []string{"City guide", "District map"}, contentTitles())
+	assert.NoError(t, access.CheckGeofenceAccess(friend.ID, district.ID, "edit"))
+	assert.Error(t, access.CheckGeofenceAccess(friend.ID, district.ID, "admin"))
+	assert.Error(t, access.CheckGeofenceAccess(stranger.ID, district.ID, "view"))
+
+	// With edit access through the cascade, the friend can nest their own
+	// fences in the district, and the city's owner gets access to them
+	code, block := createChild(t, "Block", 0, 100, district.ID, friend.ID)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.NoError(t, access.CheckGeofenceAccess(owner.ID, block.ID, "admin"))
+	code, _ = createChild(t, "Squat", 0, 100, district.ID, stranger.ID)
+	assert.Equal(t, http.StatusForbidden, code)
+}
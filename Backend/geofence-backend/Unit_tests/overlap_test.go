@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// metresEast is the longitude 100 m east of 0° on the equator, in the
+// projection fence shapes are traced in
+const metresEast = 1 / 111320.0
+
+// combineFences calls a set operation endpoint
+func combineFences(t *testing.T, a, b uint, operation string) services.GeofenceShape {
+	vars := map[string]string{"id": strconv.Itoa(int(a)), "operation": operation}
+	rr := callAsUser(handlers.CombineGeofences, "GET", "/api/geofences/op?with="+strconv.Itoa(int(b)), vars, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data services.GeofenceShape `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response.Data
+}
+
+func TestGeofenceSetOperations(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	// Two 100 m circles 100 m apart, a ring-shaped difference and a far
+	// away circle
+	fences := []models.Geofence{
+		{Name: "West", Latitude: 0, Longitude: 0, Radius: 100, UserID: 1},
+		{Name: "East", Latitude: 0, Longitude: 100 * metresEast, Radius: 100, UserID: 1},
+		{Name: "Park", Latitude: 1, Longitude: 1, Radius: 300, UserID: 1},
+		{Name: "Pond", Latitude: 1, Longitude: 1, Radius: 50, UserID: 1},
+		{Name: "Far", Latitude: 0, Longitude: 0.01, Radius: 100, UserID: 1},
+	}
+	for i := range fences {
+		database.DB.Create(&fences[i])
+	}
+	west, east, park, pond, far := fences[0], fences[1], fences[2], fences[3], fences[4]
+
+	circle := math.Pi * 100 * 100
+	lens := 2*100*100*math.Acos(0.5) - 50*math.Sqrt(4*100*100-100*100)
+
+	shape := combineFences(t, west.ID, east.ID, "intersection")
+	assert.InEpsilon(t, lens, shape.Area, 0.005)
+	assert.Equal(t, utils.GeoJSONPolygon, shape.Geometry.Type)
+	var rings [][][2]float64
+	assert.NoError(t, json.Unmarshal(shape.Geometry.Coordinates, &rings))
+	if assert.Len(t, rings, 1) {
+		assert.Equal(t, rings[0][0], rings[0][len(rings[0])-1])
+	}
+
+	shape = combineFences(t, west.ID, east.ID, "union")
+	assert.InEpsilon(t, 2*circle-lens, shape.Area, 0.005)
+	shape = combineFences(t, west.ID, east.ID, "difference")
+	assert.InEpsilon(t, circle-lens, shape.Area, 0.005)
+
+	// Taking out the middle leaves a hole
+	shape = combineFences(t, park.ID, pond.ID, "difference")
+	assert.InEpsilon(t, math.Pi*(300*300-50*50), shape.Area, 0.005)
+	assert.NoError(t, json.Unmarshal(shape.Geometry.Coordinates, &rings))
+	assert.Len(t, rings, 2)
+
+	// Fences far apart don't intersect, and their union is two polygons
+	shape = combineFences(t, west.ID, far.ID, "intersection")
+	assert.Equal(t, 0.0, shape.Area)
+	assert.Equal(t, utils.GeoJSONMultiPolygon, shape.Geometry.Type)
+	shape = combineFences(t, west.ID, far.ID, "union")
+	var polygons [][][][2]float64
+	assert.NoError(t, json.Unmarshal(shape.Geometry.Coordinates, &polygons))
+	assert.Len(t, polygons, 2)
+
+	rr := callAsUser(handlers.CombineGeofences, "GET", "/api/geofences/op", map[string]string{"id": strconv.Itoa(int(west.ID)), "operation": "union"}, nil, 0)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestOverlapWarningsOnCreate(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	other := createUser(t, "other")
+	existing := models.Geofence{Name: "Office", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&existing)
+	// Someone else's fences don't count
+	database.DB.Create(&models.Geofence{Name: "Neighbour", Latitude: 0, Longitude: 0, Radius: 100, UserID: other.ID})
+
+	create := func(query string, fence models.Geofence) (int, []services.GeofenceOverlap) {
+		rr := callAsUser(handlers.CreateGeofence, "POST", "/api/geofences"+query, nil, fence, owner.ID)
+		var response struct {
+			Data struct {
+				Overlaps []services.GeofenceOverlap `json:"overlaps"`
+			} `json:"data"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr.Code, response.Data.Overlaps
+	}
+
+	// An accidental duplicate is flagged...
+	duplicate := models.Geofence{Name: "Office again", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	code, overlaps := create("", duplicate)
+	assert.Equal(t, http.StatusCreated, code)
+	if assert.Len(t, overlaps, 1) {
+		assert.Equal(t, existing.ID, overlaps[0].GeofenceID)
+		assert.InDelta(t, 1, overlaps[0].Ratio, 0.01)
+	}
+
+	// ...or rejected when asked to
+	code, _ = create("?reject_overlaps=true", duplicate)
+	assert.Equal(t, http.StatusConflict, code)
+
+	// A fence sharing 39% with the office only counts under a lower threshold
+	partial := models.Geofence{Name: "Annex", Latitude: 0, Longitude: 100 * metresEast, Radius: 100, UserID: owner.ID}
+	code, overlaps = create("?reject_overlaps=true", partial)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Empty(t, overlaps)
+	partial.Name = "Annex 2"
+	code, overlaps = create("?overlap_threshold=0.3", partial)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Len(t, overlaps, 3)
+
+	code, _ = create("?overlap_threshold=2", partial)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// A corridor running through the office covers all four fences there
+	corridor := models.Geofence{
+		Name:        "Driveway",
+		Type:        models.GeofenceTypeCorridor,
+		Path:        models.Polyline{{Latitude: 0, Longitude: -0.01}, {Latitude: 0, Longitude: 0.01}},
+		BufferWidth: 100,
+		UserID:      owner.ID,
+	}
+	services.PrepareGeofence(&corridor)
+	found, err := (&services.OverlapService{}).Overlaps(corridor, 0.9)
+	assert.NoError(t, err)
+	assert.Len(t, found, 4)
+}
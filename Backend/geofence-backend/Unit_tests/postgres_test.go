@@ -0,0 +1,121 @@
+//go:build postgres
+
+package tests
+
+import (
+	"geofence/internal/config"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupPostgresDB connects to the local Postgres named by the DB_* settings
+// (database TEST_DB_NAME, geofence_test by default) and empties it. Run with
+// go test -tags postgres ./Unit_tests/ against a server with PostGIS.
+func setupPostgresDB(t *testing.T) {
+	cfg := config.LoadConfig()
+	cfg.DBDriver = config.DriverPostgres
+	cfg.DBName = "geofence_test"
+	if name := os.Getenv("TEST_DB_NAME"); name != "" {
+		cfg.DBName = name
+	}
+	if err := database.InitDB(cfg); err != nil {
+		t.Skipf("No local Postgres to test against: %v", err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := database.DB.DB()
+		sqlDB.Close()
+		setupTestDB()
+	})
+
+	database.DB.Exec("TRUNCATE geofences, geofence_schedules, geofence_revisions, geofence_visits, contents, users RESTART IDENTITY CASCADE")
+}
+
+func TestPostgresLocation(t *testing.T) {
+	setupPostgresDB(t)
+	assert.True(t, database.IsPostgres(database.DB))
+
+	fence := models.Geofence{Name: "Store", Latitude: 10, Longitude: 20, Radius: 100, UserID: 1}
+	assert.NoError(t, database.DB.Create(&fence).Error)
+
+	// The PostGIS location follows the fence's coordinates
+	var lat, lng float64
+	database.DB.Raw("SELECT ST_Y(location::geometry), ST_X(location::geometry) FROM geofences WHERE id = ?", fence.ID).Row().Scan(&lat, &lng)
+	assert.Equal(t, 10.0, lat)
+	assert.Equal(t, 20.0, lng)
+
+	database.DB.Model(&fence).Update("longitude", 21)
+	database.DB.Raw("SELECT ST_X(location::geometry) FROM geofences WHERE id = ?", fence.ID).Row().Scan(&lng)
+	assert.Equal(t, 21.0, lng)
+}
+
+func TestPostgresViewport(t *testing.T) {
+	setupPostgresDB(t)
+
+	fences := []models.Geofence{
+		{Name: "Inside", Latitude: 10, Longitude: 10, Radius: 100, UserID: 1},
+		// Centred about 5.5 km east of the box, but 10 km across
+		{Name: "Overlapping", Latitude: 10, Longitude: 11.05, Radius: 10000, UserID: 1},
+		{Name: "Outside", Latitude: 10, Longitude: 11.05, Radius: 1000, UserID: 1},
+		{Name: "Fiji", Latitude: -17, Longitude: 179.5, Radius: 100, UserID: 1},
+		{Name: "Samoa", Latitude: -14, Longitude: -172, Radius: 100, UserID: 1},
+		// West of the antimeridian, reaching across it
+		{Name: "Date Line", Latitude: 0, Longitude: 179.95, Radius: 20000, UserID: 1},
+	}
+	for i := range fences {
+		database.DB.Create(&fences[i])
+	}
+
+	_, page := getViewport(t, "bbox=9,9,11,11")
+	assert.Equal(t, []string{"Inside", "Overlapping"}, viewportNames(page))
+	_, page = getViewport(t, "bbox=179,-20,-170,-10")
+	assert.Equal(t, []string{"Fiji", "Samoa"}, viewportNames(page))
+	_, page = getViewport(t, "bbox=-179.99,-1,-179,1")
+	assert.Equal(t, []string{"Date Line"}, viewportNames(page))
+
+	// A whole-world box is split up rather than sent as one polygon
+	_, page = getViewport(t, "bbox=-180,-90,180,90")
+	assert.Len(t, page.Items, len(fences))
+
+	// Points use ST_DWithin too, across the antimeridian
+	matches, err := (&services.HierarchyService{}).Locate(0, -179.9, services.AltitudeFix{}, 1, time.Now())
+	assert.NoError(t, err)
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, "Date Line", matches[0].Geofence.Name)
+	}
+}
+
+func TestPostgresNearbySearch(t *testing.T) {
+	setupPostgresDB(t)
+
+	near := models.Geofence{Name: "Corner Cafe", Latitude: 51.5, Longitude: -0.12, Radius: 50, UserID: 1}
+	far := models.Geofence{Name: "Harbour Cafe", Latitude: 51.58, Longitude: -0.12, Radius: 50, UserID: 1}
+	database.DB.Create(&near)
+	database.DB.Create(&far)
+
+	// Search falls back to ILIKE on Postgres, so case doesn't matter
+	results, _, err := (&services.SearchService{}).Search(services.SearchOptions{
+		Text:  "cafe",
+		Types: []string{services.SearchTypeGeofences},
+		Near:  &services.GeoFilter{Latitude: 51.5, Longitude: -0.12, RadiusKm: 2},
+		Limit: 10,
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, near.ID, results[0].ID)
+	}
+
+	// The nearby and advanced search endpoints use ST_DWithin too
+	rr := callAsUser(handlers.GetNearbyGeofences, "GET", "/api/geofences/nearby?lat=51.5&lng=-0.12", nil, nil, 0)
+	assert.Contains(t, rr.Body.String(), "Corner Cafe")
+	assert.Contains(t, rr.Body.String(), "Harbour Cafe")
+	rr = callAsUser(handlers.SearchGeofencesAdvanced, "GET", "/api/geofences/search/advanced?lat=51.5&lng=-0.12&radius=2", nil, nil, 0)
+	assert.Contains(t, rr.Body.String(), "Corner Cafe")
+	assert.NotContains(t, rr.Body.String(), "Harbour Cafe")
+}
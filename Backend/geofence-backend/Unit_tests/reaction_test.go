@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createReactionFixture creates a user, a geofence and a content item to react to
+func createReactionFixture(t *testing.T) (models.User, models.Content) {
+	user := createUser(t, "reactor")
+
+	geofence := models.Geofence{
+		Name:      "Reaction Geofence",
+		Latitude:  37.7749,
+		Longitude: -122.4194,
+		Radius:    100,
+		UserID:    user.ID,
+	}
+	assert.NoError(t, database.DB.Create(&geofence).Error)
+
+	content := models.Content{
+		Title:      "Reaction Content",
+		Type:       "video",
+		GeofenceID: geofence.ID,
+	}
+	assert.NoError(t, database.DB.Create(&content).Error)
+
+	return user, content
+}
+
+// callReaction invokes a reaction handler as the given user
+func callReaction(handler http.HandlerFunc, userID, contentID uint) *httptest.ResponseRecorder {
+	return callAsUser(handler, "POST", "/api/contents/x/like", idVars(contentID), nil, userID)
+}
+
+func TestLikeContentIsIdempotent(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	user, content := createReactionFixture(t)
+
+	// Liking twice should only count once
+	rr := callReaction(handlers.LikeContent, user.ID, content.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = callReaction(handlers.LikeContent, user.ID, content.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, float64(1), data["like_count"])
+	assert.Equal(t, true, data["is_liked"])
+	assert.Equal(t, false, data["is_favorited"])
+
+	// Unliking twice should only decrement once
+	callReaction(handlers.UnlikeContent, user.ID, content.ID)
+	rr = callReaction(handlers.UnlikeContent, user.ID, content.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var reloaded models.Content
+	database.DB.First(&reloaded, content.ID)
+	assert.Equal(t, int64(0), reloaded.LikeCount)
+
+	// Liking again after unliking is allowed
+	callReaction(handlers.LikeContent, user.ID, content.ID)
+	database.DB.First(&reloaded, content.ID)
+	assert.Equal(t, int64(1), reloaded.LikeCount)
+}
+
+func TestReactionsAreCountedSeparately(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	user, content := createReactionFixture(t)
+
+	callReaction(handlers.LikeContent, user.ID, content.ID)
+	callReaction(handlers.FavoriteContent, user.ID, content.ID)
+	callReaction(handlers.RepostContent, user.ID, content.ID)
+	callReaction(handlers.UnrepostContent, user.ID, content.ID)
+
+	var reloaded models.Content
+	database.DB.First(&reloaded, content.ID)
+	assert.Equal(t, int64(1), reloaded.LikeCount)
+	assert.Equal(t, int64(1), reloaded.FavoriteCount)
+	assert.Equal(t, int64(0), reloaded.RepostCount)
+}
+
+func TestConcurrentLikesStayConsistent(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	user, content := createReactionFixture(t)
+
+	// The same user hammering like should still count once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			callReaction(handlers.LikeContent, user.ID, content.ID)
+		}()
+	}
+	wg.Wait()
+
+	var reloaded models.Content
+	database.DB.First(&reloaded, content.ID)
+
+	var rows int64
+	database.DB.Model(&models.ContentInteraction{}).
+		Where("content_id = ? AND interaction_type = ?", content.ID, models.InteractionLike).
+		Count(&rows)
+
+	assert.Equal(t, int64(1), rows)
+	assert.Equal(t, rows, reloaded.LikeCount)
+}
+
+func TestLikeMissingContent(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	rr := callReaction(handlers.LikeContent, 1, 9999)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestGetUserFavorites(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	user, content := createReactionFixture(t)
+	callReaction(handlers.FavoriteContent, user.ID, content.ID)
+
+	rr := callAsUser(handlers.GetUserFavorites, "GET", "/api/users/x/favorites?page=1&per_page=10", idVars(user.ID), nil, 0)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, float64(1), data["total"])
+	items := data["items"].([]interface{})
+	assert.Len(t, items, 1)
+	assert.Equal(t, "Reaction Content", items[0].(map[string]interface{})["title"])
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getRecommendations calls the recommendations endpoint as userID
+func getRecommendations(t *testing.T, userID uint, query string) []services.Recommendation {
+	rr := callAsUser(handlers.GetRecommendations, "GET", "/api/recommendations?"+query, nil, nil, userID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data []services.Recommendation `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response.Data
+}
+
+func TestItemSimilarityRecommendations(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "curator")
+	alice := createUser(t, "alice")
+	bob := createUser(t, "bob")
+
+	fence := models.Geofence{Name: "Museum", Latitude: 40.0, Longitude: -75.0, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&fence)
+	contents := []models.Content{
+		{Title: "Dinosaurs", GeofenceID: fence.ID},
+		{Title: "Fossils", GeofenceID: fence.ID},
+		{Title: "Gift shop", GeofenceID: fence.ID},
+	}
+	for i := range contents {
+		database.DB.Create(&contents[i])
+	}
+
+	// Bob liked both dinosaurs and fossils; Alice only liked dinosaurs
+	reactions := &services.ReactionService{}
+	_, err := reactions.AddReaction(bob.ID, contents[0].ID, models.InteractionLike)
+	assert.NoError(t, err)
+	_, err = reactions.AddReaction(bob.ID, contents[1].ID, models.InteractionLike)
+	assert.NoError(t, err)
+	_, err = reactions.AddReaction(alice.ID, contents[0].ID, models.InteractionLike)
+	assert.NoError(t, err)
+
+	assert.NoError(t, (&services.ContentRecommendationService{}).ComputeSimilarities())
+
+	recommendations := getRecommendations(t, alice.ID, "")
+	assert.NotEmpty(t, recommendations)
+	assert.Equal(t, "Fossils", recommendations[0].Content.Title)
+	assert.Equal(t, `Because you liked "Dinosaurs"`, recommendations[0].Reason)
+
+	// Content Alice already engaged with isn't recommended back
+	for _, rec := range recommendations {
+		assert.NotEqual(t, contents[0].ID, rec.Content.ID)
+	}
+}
+
+func TestRecommendationsFallBackToPopularNearby(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	newcomer := createUser(t, "newcomer")
+
+	near := models.Geofence{Name: "Corner Cafe", Latitude: 40.0, Longitude: -75.0, Radius: 100, UserID: owner.ID}
+	far := models.Geofence{Name: "Far Cafe", Latitude: 45.0, Longitude: -80.0, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&near)
+	database.DB.Create(&far)
+	database.DB.Create(&models.Content{Title: "Nearby menu", GeofenceID: near.ID})
+	database.DB.Create(&models.Content{Title: "Faraway menu", GeofenceID: far.ID, LikeCount: 50})
+
+	recommendations := getRecommendations(t, newcomer.ID, "lat=40.0&lng=-75.0")
+	assert.Len(t, recommendations, 2)
+	assert.Equal(t, "Nearby menu", recommendations[0].Content.Title)
+	assert.Equal(t, "Popular near you", recommendations[0].Reason)
+	assert.NotNil(t, recommendations[0].DistanceKm)
+
+	// Without a location, popularity decides
+	recommendations = getRecommendations(t, newcomer.ID, "")
+	assert.Equal(t, "Faraway menu", recommendations[0].Content.Title)
+	assert.True(t, strings.HasPrefix(recommendations[0].Reason, "Popular"))
+}
+
+func TestSimilaritiesCapItemsPerUser(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "curator")
+	reader := createUser(t, "reader")
+	fence := models.Geofence{Name: "Library", Latitude: 40.0, Longitude: -75.0, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&fence)
+
+	// The reader viewed 60 items and liked the last one
+	var last models.Content
+	for i := 0; i < 60; i++ {
+		last = models.Content{Title: "Book", GeofenceID: fence.ID}
+		database.DB.Create(&last)
+		database.DB.Create(&models.ContentInteraction{UserID: reader.ID, ContentID: last.ID, InteractionType: models.InteractionView})
+	}
+	database.DB.Create(&models.ContentInteraction{UserID: reader.ID, ContentID: last.ID, InteractionType: models.InteractionLike})
+
+	assert.NoError(t, (&services.ContentRecommendationService{}).ComputeSimilarities())
+
+	// Only their 50 strongest items are paired, the liked one among them
+	var items []uint
+	database.DB.Model(&models.ContentSimilarity{}).Distinct().Pluck("content_id", &items)
+	assert.Len(t, items, 50)
+	assert.Contains(t, items, last.ID)
+}
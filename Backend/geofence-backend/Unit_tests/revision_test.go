@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeofenceRevisions(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	editor := createUser(t, "editor")
+	stranger := createUser(t, "stranger")
+
+	rr := callAsUser(handlers.CreateGeofence, "POST", "/api/geofences", nil, map[string]interface{}{"name": "Store", "latitude": 0, "longitude": 0, "radius": 100, "user_id": owner.ID}, owner.ID)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created struct {
+		Data models.Geofence `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	fence := created.Data
+	assert.Equal(t, 1, fence.Revision)
+	database.DB.Create(&models.GeofenceShare{GeofenceID: fence.ID, OwnerID: owner.ID, UserID: editor.ID, Permission: "edit"})
+	vars := map[string]string{"id": strconv.Itoa(int(fence.ID))}
+
+	// A visit before the edit belongs to the first revision
+	sendLocation(t, owner.ID, 0, 0)
+
+	rr = callAsUser(handlers.UpdateGeofence, "PUT", "/api/geofences/x", vars, map[string]interface{}{"name": "Bigger store", "latitude": 0, "longitude": 0, "radius": 250}, editor.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	sendLocation(t, owner.ID, 0, 0.005)
+	sendLocation(t, owner.ID, 0, 0)
+
+	var visits []models.GeofenceVisit
+	database.DB.Where("geofence_id = ?", fence.ID).Order("id").Find(&visits)
+	assert.Len(t, visits, 2)
+	assert.Equal(t, []int{1, 2}, []int{visits[0].Revision, visits[1].Revision})
+
+	type revisionList struct {
+		Data []models.GeofenceRevision `json:"data"`
+	}
+	rr = callAsUser(handlers.GetGeofenceRevisions, "GET", "/api/geofences/x/revisions", vars, nil, stranger.ID)
+	var list revisionList
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Len(t, list.Data, 2)
+	assert.Equal(t, 2, list.Data[0].Revision)
+	assert.Equal(t, editor.ID, list.Data[0].AuthorID)
+	assert.Equal(t, owner.ID, list.Data[1].AuthorID)
+
+	rr = callAsUser(handlers.DiffGeofenceRevisions, "GET", "/api/geofences/x/revisions/diff?from=1&to=2", vars, nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var diff struct {
+		Data services.RevisionDiff `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &diff))
+	fields := []string{}
+	for _, change := range diff.Data.Changes {
+		fields = append(fields, change.Field)
+	}
+	assert.Equal(t, []string{"name", "radius"}, fields)
+	assert.Equal(t, "Store", diff.Data.Changes[0].From)
+	assert.Equal(t, "Bigger store", diff.Data.Changes[0].To)
+
+	rr = callAsUser(handlers.DiffGeofenceRevisions, "GET", "/api/geofences/x/revisions/diff?from=1&to=9", vars, nil, owner.ID)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Restoring adds a revision and leaves the history alone
+	restoreVars := map[string]string{"id": vars["id"], "revision": "1"}
+	rr = callAsUser(handlers.RestoreGeofenceRevision, "POST", "/api/geofences/x/revisions/1/restore", restoreVars, nil, stranger.ID)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = callAsUser(handlers.RestoreGeofenceRevision, "POST", "/api/geofences/x/revisions/1/restore", restoreVars, nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	database.DB.First(&fence, fence.ID)
+	assert.Equal(t, "Store", fence.Name)
+	assert.Equal(t, 100.0, fence.Radius)
+	assert.Equal(t, 3, fence.Revision)
+
+	revision, err := (&services.RevisionService{}).Get(fence.ID, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 250.0, revision.Radius)
+	diff.Data.Changes = nil
+	rr = callAsUser(handlers.DiffGeofenceRevisions, "GET", "/api/geofences/x/revisions/diff?from=1&to=3", vars, nil, owner.ID)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &diff))
+	assert.Empty(t, diff.Data.Changes)
+}
+
+func TestRevisionBaseline(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	// A fence from before revisions were kept gets its old state recorded
+	// on its first edit
+	owner := createUser(t, "owner")
+	fence := models.Geofence{Name: "Old", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&fence)
+	assert.Equal(t, 0, fence.Revision)
+
+	vars := map[string]string{"id": strconv.Itoa(int(fence.ID))}
+	rr := callAsUser(handlers.UpdateGeofence, "PUT", "/api/geofences/x", vars, map[string]interface{}{"name": "New", "latitude": 0, "longitude": 0, "radius": 100}, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	revisions, err := (&services.RevisionService{}).List(fence.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, "New", revisions[0].Name)
+	assert.Equal(t, "Old", revisions[1].Name)
+}
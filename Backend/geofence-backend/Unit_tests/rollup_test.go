@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestRollupsAreIdempotentAndMatchRawMetrics(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	alice := createUser(t, "alice")
+	bob := createUser(t, "bob")
+
+	fence := models.Geofence{Name: "Market", Latitude: 1, Longitude: 1, Radius: 50, UserID: owner.ID}
+	database.DB.Create(&fence)
+	content := models.Content{Title: "Stalls", GeofenceID: fence.ID}
+	database.DB.Create(&content)
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+	at := func(days, hours int) time.Time { return day.AddDate(0, 0, days).Add(time.Duration(hours) * time.Hour) }
+	exited := at(0, 11)
+	visits := []models.GeofenceVisit{
+		{GeofenceID: fence.ID, UserID: alice.ID, CreatedAt: at(0, 10), ExitedAt: &exited},
+		{GeofenceID: fence.ID, UserID: alice.ID, CreatedAt: at(0, 14)},
+		{GeofenceID: fence.ID, UserID: bob.ID, CreatedAt: at(1, 8)},
+	}
+	for i := range visits {
+		database.DB.Create(&visits[i])
+	}
+	database.DB.Create(&models.ContentInteraction{UserID: bob.ID, ContentID: content.ID, InteractionType: models.InteractionLike, Model: gorm.Model{CreatedAt: at(1, 9)}})
+
+	rollups := &services.RollupService{}
+	assert.NoError(t, rollups.Run())
+	assert.NoError(t, rollups.Run())
+
+	watermark, err := rollups.Watermark()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Now().UTC().Truncate(time.Hour), watermark.UTC())
+
+	var daily []models.AnalyticsRollup
+	database.DB.Where("granularity = ? AND item_type = ?", models.RollupDaily, models.ItemTypeGeofence).Order("bucket_start").Find(&daily)
+	assert.Len(t, daily, 2)
+	assert.Equal(t, int64(2), daily[0].Visits)
+	assert.Equal(t, int64(1), daily[0].UniqueVisitors)
+	assert.Equal(t, int64(1), daily[0].DwellCount)
+	assert.Equal(t, int64(1), daily[1].Likes)
+
+	var hourly int64
+	database.DB.Model(&models.AnalyticsRollup{}).Where("granularity = ?", models.RollupHourly).Count(&hourly)
+	assert.Equal(t, int64(5), hourly) // three visit hours, plus the like on the fence and on the content
+
+	// Backfilling a range again changes nothing
+	assert.NoError(t, rollups.Backfill(day, day.AddDate(0, 0, 2)))
+	assert.Equal(t, services.ErrBackfillTooLong, rollups.Backfill(day.AddDate(-2, 0, 0), day))
+	assert.Equal(t, services.ErrInvalidBackfillRange, rollups.Backfill(day, day))
+	var count int64
+	database.DB.Model(&models.AnalyticsRollup{}).Where("granularity = ?", models.RollupDaily).Count(&count)
+	assert.Equal(t, int64(3), count)
+
+	// A report served from rollups matches the same report from raw visits
+	metrics := &services.GeofenceMetricsService{}
+	fromRollups, err := metrics.GetGeofencePerformanceMetrics(fence.ID, services.MetricsRange{From: day, To: day.AddDate(0, 0, 2)})
+	assert.NoError(t, err)
+	fromVisits, err := metrics.GetGeofencePerformanceMetrics(fence.ID, services.MetricsRange{From: day.Add(-time.Hour), To: day.AddDate(0, 0, 2)})
+	assert.NoError(t, err)
+
+	assert.Equal(t, fromVisits.Visits, fromRollups.Visits)
+	assert.Equal(t, fromVisits.UniqueVisitors, fromRollups.UniqueVisitors)
+	assert.Equal(t, fromVisits.HourOfDay, fromRollups.HourOfDay)
+	assert.Equal(t, *fromVisits.AvgDwellSeconds, *fromRollups.AvgDwellSeconds)
+	assert.Equal(t, int64(2), fromRollups.Series[0].Visits)
+
+	totals, err := rollups.GeofenceTotals(database.DB.Model(&models.Geofence{}).Select("id"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), totals.Visits)
+	assert.Equal(t, int64(1), totals.Likes)
+}
+
+func TestRollupsPickUpLateExits(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	fence := models.Geofence{Name: "Market", Latitude: 1, Longitude: 1, Radius: 50, UserID: owner.ID}
+	database.DB.Create(&fence)
+
+	// A visit from two days ago that's still open when it's rolled up
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -2)
+	visit := models.GeofenceVisit{GeofenceID: fence.ID, UserID: owner.ID, CreatedAt: day.Add(10 * time.Hour)}
+	database.DB.Create(&visit)
+	rollups := &services.RollupService{}
+	assert.NoError(t, rollups.Run())
+
+	// It ends long after the lookback has moved past it
+	database.DB.Model(&visit).Update("exited_at", time.Now().UTC())
+	assert.NoError(t, rollups.Run())
+
+	var daily models.AnalyticsRollup
+	database.DB.Where("granularity = ? AND item_id = ? AND bucket_start = ?", models.RollupDaily, fence.ID, day).First(&daily)
+	assert.Equal(t, int64(1), daily.DwellCount)
+
+	// Average and median dwell agree, whether the report uses rollups or not
+	metrics, err := (&services.GeofenceMetricsService{}).GetGeofencePerformanceMetrics(fence.ID, services.MetricsRange{From: day, To: day.AddDate(0, 0, 1)})
+	assert.NoError(t, err)
+	if assert.NotNil(t, metrics.AvgDwellSeconds) {
+		assert.Equal(t, *metrics.MedianDwellSeconds, *metrics.AvgDwellSeconds)
+	}
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// intersectRoute posts a route body to the intersect-route endpoint
+func intersectRoute(t *testing.T, body string) (int, services.RouteIntersection) {
+	rr := callAsUser(handlers.IntersectRoute, "POST", "/api/geofences/intersect-route", nil, json.RawMessage(body), 0)
+
+	var response struct {
+		Data services.RouteIntersection `json:"data"`
+	}
+	if rr.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	}
+	return rr.Code, response.Data
+}
+
+func TestDecodePolyline(t *testing.T) {
+	points, err := utils.DecodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@", utils.DefaultPolylinePrecision)
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]float64{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}, points)
+
+	_, err = utils.DecodePolyline("_p~iF~ps|U_", utils.DefaultPolylinePrecision)
+	assert.Equal(t, utils.ErrInvalidPolyline, err)
+}
+
+func TestIntersectRoute(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	// Along the equator 1° is about 111195 m
+	const metersPerDegree = 111195.0
+	past := time.Now().Add(-time.Hour)
+	fences := []models.Geofence{
+		{Name: "Start", Latitude: 0, Longitude: 0, Radius: 100, UserID: 1},
+		{Name: "Depot", Latitude: 0, Longitude: 0.02, Radius: 500, UserID: 1},
+		// Its centre is 111 m off the route, so the route cuts a chord
+		{Name: "Toll", Latitude: 0.001, Longitude: 0.05, Radius: 300, UserID: 1},
+		{Name: "Finish", Latitude: 0, Longitude: 0.1, Radius: 200, UserID: 1},
+		{Name: "Far Away", Latitude: 1, Longitude: 1, Radius: 100, UserID: 1},
+		{Name: "Closed", Latitude: 0, Longitude: 0.03, Radius: 100, UserID: 1, ActiveUntil: &past},
+	}
+	for i := range fences {
+		database.DB.Create(&fences[i])
+	}
+
+	// A corridor the route crosses at right angles
+	crossing := models.Geofence{
+		Name:        "Rail Line",
+		Type:        models.GeofenceTypeCorridor,
+		Path:        models.Polyline{{Latitude: -0.01, Longitude: 0.08}, {Latitude: 0.01, Longitude: 0.08}},
+		BufferWidth: 100,
+		UserID:      1,
+	}
+	assert.NoError(t, services.PrepareGeofence(&crossing))
+	database.DB.Create(&crossing)
+
+	code, result := intersectRoute(t, `{"type": "LineString", "coordinates": [[0, 0], [0.04, 0], [0.1, 0]]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.InDelta(t, 0.1*metersPerDegree, result.Length, 1)
+
+	type event struct {
+		Event    string
+		Name     string
+		Distance float64
+	}
+	expected := []event{
+		{"enter", "Start", 0},
+		{"exit", "Start", 100},
+		{"enter", "Depot", 0.02*metersPerDegree - 500},
+		{"exit", "Depot", 0.02*metersPerDegree + 500},
+		{"enter", "Toll", 0.05*metersPerDegree - 278.5},
+		{"exit", "Toll", 0.05*metersPerDegree + 278.5},
+		{"enter", "Rail Line", 0.08*metersPerDegree - 100},
+		{"exit", "Rail Line", 0.08*metersPerDegree + 100},
+		{"enter", "Finish", 0.1*metersPerDegree - 200},
+	}
+	if assert.Len(t, result.Events, len(expected)) {
+		for i, want := range expected {
+			got := result.Events[i]
+			assert.Equal(t, want.Event, got.Event, want.Name)
+			assert.Equal(t, want.Name, got.Name)
+			assert.InDelta(t, want.Distance, got.Distance, 2, want.Name)
+		}
+	}
+
+	// Encoded polylines work too
+	code, result = intersectRoute(t, `{"polyline": "???o}@"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.InDelta(t, 0.01*metersPerDegree, result.Length, 1)
+	assert.Equal(t, "Start", result.Events[0].Name)
+
+	code, _ = intersectRoute(t, `{"type": "Point", "coordinates": [0, 0]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = intersectRoute(t, `{"type": "LineString", "coordinates": [[0, 0]]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestIntersectRouteAcrossAntimeridian(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	dateLine := models.Geofence{Name: "Date Line", Latitude: 0, Longitude: 180, Radius: 500, UserID: 1}
+	greenwich := models.Geofence{Name: "Greenwich", Latitude: 0, Longitude: 0, Radius: 500, UserID: 1}
+	database.DB.Create(&dateLine)
+	database.DB.Create(&greenwich)
+
+	// A short hop over the date line, not a trip round the world
+	code, result := intersectRoute(t, `{"type": "LineString", "coordinates": [[179.99, 0], [-179.99, 0]]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.InDelta(t, 0.02*111195.0, result.Length, 1)
+	if assert.Len(t, result.Events, 2) {
+		assert.Equal(t, "Date Line", result.Events[0].Name)
+		assert.InDelta(t, 179.9955, result.Events[0].Longitude, 0.0001)
+		assert.InDelta(t, -179.9955, result.Events[1].Longitude, 0.0001)
+	}
+}
+
+func TestIntersectRouteCapsCandidates(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	fences := make([]models.Geofence, services.MaxRouteCandidates+1)
+	for i := range fences {
+		fences[i] = models.Geofence{Name: "Stop", Latitude: 0, Longitude: float64(i) * 0.0001, Radius: 5, UserID: 1}
+	}
+	assert.NoError(t, database.DB.CreateInBatches(&fences, 500).Error)
+
+	code, _ := intersectRoute(t, `{"type": "LineString", "coordinates": [[0, 0], [0.3, 0]]}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeofenceActiveAt(t *testing.T) {
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	// A summer night market, Fridays 18:00 to 02:00 New York time
+	market := models.Geofence{
+		ActiveFrom:  &from,
+		ActiveUntil: &until,
+		Timezone:    "America/New_York",
+		Schedule:    []models.GeofenceSchedule{{Weekday: int(time.Friday), Start: "18:00", End: "02:00"}},
+	}
+	newYork, _ := time.LoadLocation("America/New_York")
+
+	assert.True(t, services.GeofenceActiveAt(market, time.Date(2024, 7, 5, 20, 0, 0, 0, newYork)))
+	assert.True(t, services.GeofenceActiveAt(market, time.Date(2024, 7, 6, 1, 59, 0, 0, newYork)))
+	assert.False(t, services.GeofenceActiveAt(market, time.Date(2024, 7, 6, 2, 0, 0, 0, newYork)))
+	assert.False(t, services.GeofenceActiveAt(market, time.Date(2024, 7, 5, 17, 59, 0, 0, newYork)))
+	// 20:00 UTC on a Friday is still the afternoon in New York
+	assert.False(t, services.GeofenceActiveAt(market, time.Date(2024, 7, 5, 20, 0, 0, 0, time.UTC)))
+	// Outside the season
+	assert.False(t, services.GeofenceActiveAt(market, time.Date(2024, 9, 6, 20, 0, 0, 0, newYork)))
+
+	// Without a schedule a fence is always active
+	assert.True(t, services.GeofenceActiveAt(models.Geofence{}, time.Now()))
+
+	assert.Equal(t, services.ErrInvalidTimezone, services.ValidateSchedule(&models.Geofence{Timezone: "Mars/Olympus"}))
+	assert.Equal(t, services.ErrInvalidSchedule, services.ValidateSchedule(&models.Geofence{
+		Schedule: []models.GeofenceSchedule{{Weekday: 1, Start: "09:00", End: "25:00"}},
+	}))
+	assert.Equal(t, services.ErrInvalidActiveRange, services.ValidateSchedule(&models.Geofence{ActiveFrom: &until, ActiveUntil: &from}))
+}
+
+func TestInactiveGeofencesAreAbsent(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	visitor := createUser(t, "visitor")
+
+	// Invalid schedules are rejected
+	rr := callAsUser(handlers.CreateGeofence, "POST", "/api/geofences", nil, map[string]interface{}{
+		"name": "Bad", "latitude": 1, "longitude": 1, "radius": 50, "timezone": "Nowhere/Special",
+	}, owner.ID)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// A fence that is open every day except the current one
+	today := int(time.Now().UTC().Weekday())
+	var windows []map[string]interface{}
+	for day := 0; day < 7; day++ {
+		if day != today {
+			windows = append(windows, map[string]interface{}{"weekday": day, "start": "00:00", "end": "24:00"})
+		}
+	}
+	rr = callAsUser(handlers.CreateGeofence, "POST", "/api/geofences", nil, map[string]interface{}{
+		"name": "Shift Zone", "latitude": 1, "longitude": 1, "radius": 50, "user_id": owner.ID, "schedule": windows,
+	}, owner.ID)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created struct {
+		Data models.Geofence `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	fence := created.Data
+	assert.Len(t, fence.Schedule, 6)
+	database.DB.Create(&models.Geofence{Name: "Always", Latitude: 1, Longitude: 1.001, Radius: 50, UserID: owner.ID})
+	database.DB.Create(&models.Content{Title: "Secret", GeofenceID: fence.ID})
+
+	vars := map[string]string{"id": strconv.Itoa(int(fence.ID))}
+
+	// The activity endpoint reports it inactive now and active tomorrow
+	rr = callAsUser(handlers.GetGeofenceActivity, "GET", "/api/geofences/active", vars, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"active":false`)
+	tomorrow := time.Now().UTC().Add(24 * time.Hour).Format(time.RFC3339)
+	rr = callAsUser(handlers.GetGeofenceActivity, "GET", "/api/geofences/active?at="+tomorrow, vars, nil, 0)
+	assert.Contains(t, rr.Body.String(), `"active":true`)
+	rr = callAsUser(handlers.GetGeofenceActivity, "GET", "/api/geofences/active?at=tomorrow", vars, nil, 0)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Nearby lookups skip it unless asked about a time it's active
+	rr = callAsUser(handlers.GetNearbyGeofences, "GET", "/api/geofences/nearby?lat=1&lng=1", nil, nil, 0)
+	assert.NotContains(t, rr.Body.String(), "Shift Zone")
+	assert.Contains(t, rr.Body.String(), "Always")
+	rr = callAsUser(handlers.GetNearbyGeofences, "GET", "/api/geofences/nearby?lat=1&lng=1&at="+tomorrow, nil, nil, 0)
+	assert.Contains(t, rr.Body.String(), "Shift Zone")
+
+	// Entering it isn't an event
+	rr = callAsUser(handlers.RecordGeofenceVisit, "POST", "/api/geofences/visits", vars, nil, visitor.ID)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	// Its content stays locked, except for its owner
+	path := "/api/contents?geofence_id=" + strconv.Itoa(int(fence.ID))
+	rr = callAsUser(handlers.GetContents, "GET", path, nil, nil, visitor.ID)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = callAsUser(handlers.GetContents, "GET", path, nil, nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Secret")
+
+	// Clearing the schedule reopens it
+	rr = callAsUser(handlers.UpdateGeofence, "PUT", "/api/geofences", vars, map[string]interface{}{
+		"name": "Shift Zone", "latitude": 1, "longitude": 1, "radius": 50,
+	}, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var count int64
+	database.DB.Model(&models.GeofenceSchedule{}).Where("geofence_id = ?", fence.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+	rr = callAsUser(handlers.RecordGeofenceVisit, "POST", "/api/geofences/visits", vars, nil, visitor.ID)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createSearchFixtures creates fences and content with searchable text
+func createSearchFixtures() {
+	fences := []models.Geofence{
+		{Name: "Blue Bottle Cafe", Description: "Coffee shop near the park", Latitude: 37.7749, Longitude: -122.4194, Radius: 100, UserID: 1},
+		{Name: "Running Track", Description: "Runners meet here every morning", Latitude: 37.7760, Longitude: -122.4180, Radius: 300, UserID: 1},
+		{Name: "Library", Description: "Quiet place with a small cafe inside", Latitude: 37.7790, Longitude: -122.4150, Radius: 200, UserID: 1},
+		{Name: "Brooklyn Cafe", Description: "Coffee shop in New York", Latitude: 40.6782, Longitude: -73.9442, Radius: 100, UserID: 1},
+	}
+	for i := range fences {
+		database.DB.Create(&fences[i])
+	}
+
+	database.DB.Create(&models.Content{Title: "Latte art tour", Description: "Best coffee shop <b>latte</b> art", GeofenceID: fences[0].ID})
+}
+
+// runSearch calls the unified search endpoint and returns its items and total
+func runSearch(t *testing.T, query string) ([]interface{}, float64) {
+	rr := callAsUser(handlers.Search, "GET", "/api/search?"+query, nil, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	data := response["data"].(map[string]interface{})
+	return data["items"].([]interface{}), data["total"].(float64)
+}
+
+func TestBuildMatchQuery(t *testing.T) {
+	assert.Equal(t, `"coffee" AND "shop"`, services.BuildMatchQuery("coffee shop"))
+	assert.Equal(t, `"coffee shop"`, services.BuildMatchQuery(`"coffee shop"`))
+	assert.Equal(t, `"caf"*`, services.BuildMatchQuery("caf*"))
+	assert.Equal(t, `("cafe" OR "bar") AND "park"`, services.BuildMatchQuery("cafe OR bar park"))
+
+	// Syntax characters can't break the expression
+	assert.Equal(t, `"drop" AND "table"`, services.BuildMatchQuery(`drop-( table:`))
+	assert.Equal(t, `"unterminated"`, services.BuildMatchQuery(`"unterminated`))
+	assert.Equal(t, "", services.BuildMatchQuery(`"" * -`))
+}
+
+func TestSearchPrefixAndHighlight(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+	createSearchFixtures()
+
+	items, total := runSearch(t, "q=caf*&type=geofences")
+	assert.Equal(t, float64(3), total)
+	assert.Len(t, items, 3)
+
+	// Matched terms are highlighted
+	for _, item := range items {
+		hit := item.(map[string]interface{})
+		assert.Equal(t, "geofence", hit["type"])
+		highlighted := hit["highlight"].(string) + hit["snippet"].(string)
+		assert.Contains(t, highlighted, "<mark>")
+	}
+}
+
+func TestSearchEscapesHTMLInSnippets(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+	createSearchFixtures()
+
+	items, _ := runSearch(t, "q=latte&type=contents")
+	assert.Len(t, items, 1)
+
+	snippet := items[0].(map[string]interface{})["snippet"].(string)
+	assert.Contains(t, snippet, "&lt;b&gt;")
+	assert.Contains(t, snippet, "<mark>")
+}
+
+func TestSearchWithGeographicFilter(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+	createSearchFixtures()
+
+	// Only the San Francisco fences and content are within 5 km
+	items, total := runSearch(t, "q=coffee&lat=37.7749&lng=-122.4194&radius=5")
+	assert.Equal(t, float64(2), total)
+	for _, item := range items {
+		hit := item.(map[string]interface{})
+		assert.Less(t, hit["distance_km"].(float64), 5.0)
+	}
+}
+
+func TestSearchIndexFollowsUpdates(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+	createSearchFixtures()
+
+	database.DB.Model(&models.Geofence{}).Where("name = ?", "Library").Update("name", "Reading Room")
+
+	_, total := runSearch(t, "q=library&type=geofences")
+	assert.Equal(t, float64(0), total)
+	_, total = runSearch(t, "q=reading&type=geofences")
+	assert.Equal(t, float64(1), total)
+
+	// Soft-deleted fences drop out of results
+	database.DB.Where("name = ?", "Reading Room").Delete(&models.Geofence{})
+	_, total = runSearch(t, "q=reading&type=geofences")
+	assert.Equal(t, float64(0), total)
+}
+
+func TestSearchRankingAndStemming(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+	if !database.FullTextSearchEnabled {
+		t.Skip("FTS5 not compiled in; run with -tags sqlite_fts5")
+	}
+	createSearchFixtures()
+
+	// A name match outranks a description match
+	items, _ := runSearch(t, "q=cafe&type=geofences")
+	assert.Len(t, items, 3)
+	assert.NotEqual(t, "Library", items[0].(map[string]interface{})["geofence"].(map[string]interface{})["name"])
+	assert.Equal(t, "Library", items[2].(map[string]interface{})["geofence"].(map[string]interface{})["name"])
+
+	// Porter stemming matches word variants
+	_, total := runSearch(t, "q=runs&type=geofences")
+	assert.Equal(t, float64(1), total)
+
+	// Phrases must match in order
+	_, total = runSearch(t, `q="shop+coffee"&type=geofences`)
+	assert.Equal(t, float64(0), total)
+	_, total = runSearch(t, `q="coffee+shop"&type=geofences`)
+	assert.Equal(t, float64(2), total)
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollowAndPublicProfile(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	alice := createUser(t, "alice")
+	bob := createUser(t, "bob")
+
+	bobID := map[string]string{"id": strconv.Itoa(int(bob.ID))}
+
+	// Following twice only creates one edge
+	rr := callAsUser(handlers.FollowUser, "POST", "/api/users/"+bobID["id"]+"/follow", bobID, nil, alice.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = callAsUser(handlers.FollowUser, "POST", "/api/users/"+bobID["id"]+"/follow", bobID, nil, alice.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, float64(1), data["follower_count"])
+	assert.Equal(t, true, data["is_following"])
+	_, hasPassword := data["password"]
+	assert.False(t, hasPassword)
+
+	// Bob's public profile as seen by alice
+	rr = callAsUser(handlers.GetPublicProfile, "GET", "/api/users/@bob", map[string]string{"username": "bob"}, nil, alice.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	data = response["data"].(map[string]interface{})
+	assert.Equal(t, "bob", data["username"])
+	assert.Equal(t, "Hi, I'm bob", data["bio"])
+	assert.Equal(t, float64(1), data["follower_count"])
+
+	// Bob's followers list contains alice
+	rr = callAsUser(handlers.GetFollowers, "GET", "/api/users/"+bobID["id"]+"/followers", bobID, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	items := response["data"].(map[string]interface{})["items"].([]interface{})
+	assert.Len(t, items, 1)
+	assert.Equal(t, "alice", items[0].(map[string]interface{})["username"])
+
+	// Unfollow removes the edge
+	rr = callAsUser(handlers.UnfollowUser, "POST", "/api/users/"+bobID["id"]+"/unfollow", bobID, nil, alice.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var count int64
+	database.DB.Model(&models.Follow{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestFollowSelfIsRejected(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	alice := createUser(t, "alice")
+	vars := map[string]string{"id": strconv.Itoa(int(alice.ID))}
+
+	rr := callAsUser(handlers.FollowUser, "POST", "/api/users/"+vars["id"]+"/follow", vars, nil, alice.ID)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestBlockHidesFencesAndContent(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	blocked := createUser(t, "blocked")
+
+	geofence := models.Geofence{Name: "Private Spot", Latitude: 37.7749, Longitude: -122.4194, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&geofence)
+	content := models.Content{Title: "Owner Content", GeofenceID: geofence.ID}
+	database.DB.Create(&content)
+
+	// The blocked user follows the owner before the block
+	ownerVars := map[string]string{"id": strconv.Itoa(int(owner.ID))}
+	callAsUser(handlers.FollowUser, "POST", "/api/users/"+ownerVars["id"]+"/follow", ownerVars, nil, blocked.ID)
+
+	blockedVars := map[string]string{"id": strconv.Itoa(int(blocked.ID))}
+	rr := callAsUser(handlers.BlockUser, "POST", "/api/users/"+blockedVars["id"]+"/block", blockedVars, nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Blocking drops the follow edge and prevents re-following
+	var follows int64
+	database.DB.Model(&models.Follow{}).Count(&follows)
+	assert.Equal(t, int64(0), follows)
+	rr = callAsUser(handlers.FollowUser, "POST", "/api/users/"+ownerVars["id"]+"/follow", ownerVars, nil, blocked.ID)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// The owner's fences disappear from the blocked user's listings
+	rr = callAsUser(handlers.GetGeofences, "GET", "/api/geofences", nil, nil, blocked.ID)
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Len(t, response["data"].([]interface{}), 0)
+
+	// ...but not from anyone else's
+	rr = callAsUser(handlers.GetGeofences, "GET", "/api/geofences", nil, nil, 0)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Len(t, response["data"].([]interface{}), 1)
+
+	// Direct access and reactions are refused
+	geofenceVars := map[string]string{"id": strconv.Itoa(int(geofence.ID))}
+	rr = callAsUser(handlers.GetGeofence, "GET", "/api/geofences/"+geofenceVars["id"], geofenceVars, nil, blocked.ID)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	contentVars := map[string]string{"id": strconv.Itoa(int(content.ID))}
+	rr = callAsUser(handlers.LikeContent, "POST", "/api/contents/"+contentVars["id"]+"/like", contentVars, nil, blocked.ID)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = callAsUser(handlers.GetPublicProfile, "GET", "/api/users/@owner", map[string]string{"username": "owner"}, nil, blocked.ID)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Unblocking restores access
+	callAsUser(handlers.UnblockUser, "POST", "/api/users/"+blockedVars["id"]+"/unblock", blockedVars, nil, owner.ID)
+	rr = callAsUser(handlers.GetGeofence, "GET", "/api/geofences/"+geofenceVars["id"], geofenceVars, nil, blocked.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestMuteHidesFromListingsOnly(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	viewer := createUser(t, "viewer")
+	noisy := createUser(t, "noisy")
+
+	geofence := models.Geofence{Name: "Noisy Spot", Latitude: 37.7749, Longitude: -122.4194, Radius: 100, UserID: noisy.ID}
+	database.DB.Create(&geofence)
+
+	noisyVars := map[string]string{"id": strconv.Itoa(int(noisy.ID))}
+	rr := callAsUser(handlers.MuteUser, "POST", "/api/users/"+noisyVars["id"]+"/mute", noisyVars, nil, viewer.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = callAsUser(handlers.GetGeofences, "GET", "/api/geofences", nil, nil, viewer.ID)
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Len(t, response["data"].([]interface{}), 0)
+
+	// A muted user's fence can still be opened directly
+	geofenceVars := map[string]string{"id": strconv.Itoa(int(geofence.ID))}
+	rr = callAsUser(handlers.GetGeofence, "GET", "/api/geofences/"+geofenceVars["id"], geofenceVars, nil, viewer.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/middleware"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// listGeofenceNames calls GetGeofences with the given query and returns the fence names
+func listGeofenceNames(t *testing.T, query string) []string {
+	rr := callAsUser(handlers.GetGeofences, "GET", "/api/geofences?"+query, nil, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data []models.Geofence `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+
+	var names []string
+	for _, geofence := range response.Data {
+		names = append(names, geofence.Name)
+	}
+	return names
+}
+
+func TestNormalizeTag(t *testing.T) {
+	assert.Equal(t, "coffee-shop", services.NormalizeTag("  #Coffee   Shop "))
+	assert.Equal(t, "late_night", services.NormalizeTag("Late_Night!!"))
+	assert.Equal(t, "", services.NormalizeTag("#!?"))
+}
+
+func TestCategoryTreeAndCycles(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	taxonomy := &services.TaxonomyService{}
+	food := models.Category{Name: "Food"}
+	assert.NoError(t, taxonomy.SaveCategory(&food))
+	cafes := models.Category{Name: "Cafes", ParentID: &food.ID}
+	assert.NoError(t, taxonomy.SaveCategory(&cafes))
+	assert.Equal(t, "cafes", cafes.Slug)
+
+	tree, err := taxonomy.CategoryTree()
+	assert.NoError(t, err)
+	assert.Len(t, tree, 1)
+	assert.Len(t, tree[0].Children, 1)
+
+	// A category can't be moved under its own descendant
+	food.ParentID = &cafes.ID
+	assert.Equal(t, services.ErrCategoryCycle, taxonomy.SaveCategory(&food))
+
+	// Parents with children can't be deleted
+	assert.Equal(t, services.ErrCategoryInUse, taxonomy.DeleteCategory(food.ID))
+}
+
+func TestCategoryAdminOnly(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	user := createUser(t, "regular")
+	admin := createUser(t, "admin")
+	database.DB.Model(&admin).Update("is_admin", true)
+
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := strconv.Atoi(r.Header.Get("X-Test-User"))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "userID", uint(userID))))
+		})
+	})
+	adminRouter := router.PathPrefix("").Subrouter()
+	adminRouter.Use(middleware.AdminMiddleware)
+	adminRouter.HandleFunc("/categories", handlers.CreateCategory).Methods("POST")
+
+	for _, tc := range []struct {
+		userID uint
+		code   int
+	}{{user.ID, http.StatusForbidden}, {admin.ID, http.StatusCreated}, {admin.ID, http.StatusConflict}} {
+		req, _ := http.NewRequest("POST", "/categories", bytes.NewBufferString(`{"name":"Parks"}`))
+		req.Header.Set("X-Test-User", strconv.Itoa(int(tc.userID)))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, tc.code, rr.Code)
+	}
+}
+
+func TestFilterGeofencesByCategoryAndTags(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	taxonomy := &services.TaxonomyService{}
+	food := models.Category{Name: "Food"}
+	assert.NoError(t, taxonomy.SaveCategory(&food))
+	cafes := models.Category{Name: "Cafes", ParentID: &food.ID}
+	assert.NoError(t, taxonomy.SaveCategory(&cafes))
+	parks := models.Category{Name: "Parks"}
+	assert.NoError(t, taxonomy.SaveCategory(&parks))
+
+	fences := []models.Geofence{
+		{Name: "Cafe", Latitude: 1, Longitude: 1, Radius: 10, UserID: owner.ID},
+		{Name: "Park Cafe", Latitude: 1, Longitude: 1, Radius: 10, UserID: owner.ID},
+		{Name: "Park", Latitude: 1, Longitude: 1, Radius: 10, UserID: owner.ID},
+	}
+	for i := range fences {
+		database.DB.Create(&fences[i])
+	}
+
+	setCategories := func(fence models.Geofence, ids ...uint) {
+		rr := callAsUser(handlers.SetGeofenceCategories, "PUT", "/", idVars(fence.ID), map[string]interface{}{"category_ids": ids}, owner.ID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+	setCategories(fences[0], cafes.ID)
+	setCategories(fences[1], cafes.ID, parks.ID)
+	setCategories(fences[2], parks.ID)
+
+	rr := callAsUser(handlers.SetGeofenceTags, "PUT", "/", idVars(fences[0].ID), map[string]interface{}{"tags": []string{"Wifi", "#Quiet"}}, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = callAsUser(handlers.SetGeofenceTags, "PUT", "/", idVars(fences[1].ID), map[string]interface{}{"tags": []string{"wifi"}}, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Other users can't change someone else's fence
+	stranger := createUser(t, "stranger")
+	rr = callAsUser(handlers.SetGeofenceTags, "PUT", "/", idVars(fences[0].ID), map[string]interface{}{"tags": []string{"spam"}}, stranger.ID)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// A parent category matches fences in its subcategories
+	foodID := strconv.Itoa(int(food.ID))
+	parksID := strconv.Itoa(int(parks.ID))
+	assert.ElementsMatch(t, []string{"Cafe", "Park Cafe"}, listGeofenceNames(t, "categories="+foodID))
+	assert.ElementsMatch(t, []string{"Cafe", "Park Cafe", "Park"}, listGeofenceNames(t, "categories="+foodID+","+parksID))
+	assert.ElementsMatch(t, []string{"Park Cafe"}, listGeofenceNames(t, "categories="+foodID+","+parksID+"&categories_match=all"))
+
+	assert.ElementsMatch(t, []string{"Cafe", "Park Cafe"}, listGeofenceNames(t, "tags=wifi"))
+	assert.ElementsMatch(t, []string{"Cafe"}, listGeofenceNames(t, "tags=wifi,quiet&tags_match=all"))
+	assert.ElementsMatch(t, []string{"Park Cafe"}, listGeofenceNames(t, "tags=wifi&categories="+parksID))
+
+	// Autocomplete ranks by usage
+	suggestions, err := taxonomy.AutocompleteTags("", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "wifi", suggestions[0].Name)
+	assert.Equal(t, int64(2), suggestions[0].UsageCount)
+
+	suggestions, err = taxonomy.AutocompleteTags("QU", 10)
+	assert.NoError(t, err)
+	assert.Len(t, suggestions, 1)
+	assert.Equal(t, "quiet", suggestions[0].Name)
+
+	// Prefixes are matched by character, not byte
+	database.DB.Create(&models.Tag{Name: "crème-brûlée"})
+	suggestions, err = taxonomy.AutocompleteTags("Crè", 10)
+	assert.NoError(t, err)
+	assert.Len(t, suggestions, 1)
+	assert.Equal(t, "crème-brûlée", suggestions[0].Name)
+}
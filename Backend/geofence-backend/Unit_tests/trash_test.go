@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getTrash lists a user's trash
+func getTrash(t *testing.T, userID uint) []services.TrashItem {
+	rr := callAsUser(handlers.GetTrash, "GET", "/api/trash", nil, nil, userID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Data []services.TrashItem `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response.Data
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	friend := createUser(t, "friend")
+	fence := models.Geofence{Name: "Store", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&fence)
+	menu := models.Content{Title: "Menu", GeofenceID: fence.ID}
+	flyer := models.Content{Title: "Old flyer", GeofenceID: fence.ID}
+	database.DB.Create(&menu)
+	database.DB.Create(&flyer)
+	database.DB.Create(&models.GeofenceShare{GeofenceID: fence.ID, OwnerID: owner.ID, UserID: friend.ID, Permission: "view"})
+	id := strconv.Itoa(int(fence.ID))
+
+	// The flyer is deleted on its own, then the whole fence
+	rr := callAsUser(handlers.DeleteContent, "DELETE", "/api/contents/x", map[string]string{"id": strconv.Itoa(int(flyer.ID))}, nil, owner.ID)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = callAsUser(handlers.DeleteGeofence, "DELETE", "/api/geofences/x", map[string]string{"id": id}, nil, owner.ID)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	var contents, shares int64
+	database.DB.Model(&models.Content{}).Where("geofence_id = ?", fence.ID).Count(&contents)
+	database.DB.Model(&models.GeofenceShare{}).Where("geofence_id = ?", fence.ID).Count(&shares)
+	assert.Equal(t, int64(0), contents)
+	assert.Equal(t, int64(0), shares)
+
+	items := getTrash(t, owner.ID)
+	assert.Len(t, items, 2)
+	assert.Equal(t, services.TrashGeofence, items[0].Kind)
+	assert.Equal(t, int64(1), items[0].Contents)
+	assert.WithinDuration(t, items[0].DeletedAt.Add(30*24*time.Hour), items[0].PurgeAt, time.Second)
+	assert.Equal(t, services.TrashContent, items[1].Kind)
+	assert.Equal(t, flyer.ID, items[1].ID)
+	assert.Empty(t, getTrash(t, friend.ID))
+
+	// Content can't come back before its fence, and only the owner can
+	// restore the fence
+	contentVars := map[string]string{"id": strconv.Itoa(int(flyer.ID))}
+	rr = callAsUser(handlers.RestoreTrashedContent, "POST", "/api/trash/contents/x/restore", contentVars, nil, owner.ID)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	rr = callAsUser(handlers.RestoreTrashedGeofence, "POST", "/api/trash/geofences/x/restore", map[string]string{"id": id}, nil, friend.ID)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Restoring the fence brings back what was deleted with it
+	rr = callAsUser(handlers.RestoreTrashedGeofence, "POST", "/api/trash/geofences/x/restore", map[string]string{"id": id}, nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var remaining []models.Content
+	database.DB.Where("geofence_id = ?", fence.ID).Find(&remaining)
+	assert.Len(t, remaining, 1)
+	assert.Equal(t, menu.ID, remaining[0].ID)
+	assert.NoError(t, (&services.GeofenceAccessService{}).CheckGeofenceAccess(friend.ID, fence.ID, "view"))
+
+	items = getTrash(t, owner.ID)
+	assert.Len(t, items, 1)
+	rr = callAsUser(handlers.RestoreTrashedContent, "POST", "/api/trash/contents/x/restore", contentVars, nil, owner.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, getTrash(t, owner.ID))
+	rr = callAsUser(handlers.RestoreTrashedContent, "POST", "/api/trash/contents/x/restore", contentVars, nil, owner.ID)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestTrashPurge(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	fence := models.Geofence{Name: "Store", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&fence)
+	content := models.Content{Title: "Menu", GeofenceID: fence.ID}
+	database.DB.Create(&content)
+	database.DB.Create(&models.ContentInteraction{UserID: owner.ID, ContentID: content.ID, InteractionType: models.InteractionView})
+	database.DB.Create(&models.GeofenceVisit{GeofenceID: fence.ID, UserID: owner.ID})
+	vars := map[string]string{"id": strconv.Itoa(int(fence.ID))}
+
+	// Only trashed fences can be purged
+	rr := callAsUser(handlers.PurgeTrashedGeofence, "DELETE", "/api/trash/geofences/x", vars, nil, owner.ID)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = callAsUser(handlers.DeleteGeofence, "DELETE", "/api/geofences/x", vars, nil, owner.ID)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = callAsUser(handlers.PurgeTrashedGeofence, "DELETE", "/api/trash/geofences/x", vars, nil, owner.ID)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	var count int64
+	database.DB.Unscoped().Model(&models.Geofence{}).Where("id = ?", fence.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+	database.DB.Unscoped().Model(&models.Content{}).Where("geofence_id = ?", fence.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+	database.DB.Unscoped().Model(&models.ContentInteraction{}).Where("content_id = ?", content.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+	database.DB.Model(&models.GeofenceVisit{}).Where("geofence_id = ?", fence.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestTrashRetention(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+	t.Setenv("TRASH_RETENTION_DAYS", "7")
+
+	owner := createUser(t, "owner")
+	old := models.Geofence{Name: "Old", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	recent := models.Geofence{Name: "Recent", Latitude: 0, Longitude: 0, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&old)
+	database.DB.Create(&recent)
+	database.DB.Delete(&old)
+	database.DB.Delete(&recent)
+	database.DB.Unscoped().Model(&old).Update("deleted_at", time.Now().Add(-8*24*time.Hour))
+
+	assert.NoError(t, (&services.TrashService{}).PurgeExpired())
+
+	var ids []uint
+	database.DB.Unscoped().Model(&models.Geofence{}).Where("user_id = ?", owner.ID).Pluck("id", &ids)
+	assert.Equal(t, []uint{recent.ID}, ids)
+}
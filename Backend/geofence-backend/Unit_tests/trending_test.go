@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getTrending calls a trending endpoint and returns the items
+func getTrending(t *testing.T, handler http.HandlerFunc, query string) []services.TrendingItem {
+	rr := callAsUser(handler, "GET", "/api/trending?"+query, nil, nil, 0)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data struct {
+			Items []services.TrendingItem `json:"items"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response.Data.Items
+}
+
+func TestTrendingScoresByWindowAndRegion(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	visitor := createUser(t, "visitor")
+
+	hot := models.Geofence{Name: "Hot spot", Latitude: 40.0, Longitude: -75.0, Radius: 100, UserID: owner.ID}
+	old := models.Geofence{Name: "Old favourite", Latitude: 40.1, Longitude: -75.1, Radius: 100, UserID: owner.ID}
+	faraway := models.Geofence{Name: "Faraway", Latitude: 10.0, Longitude: 10.0, Radius: 100, UserID: owner.ID}
+	for _, fence := range []*models.Geofence{&hot, &old, &faraway} {
+		database.DB.Create(fence)
+	}
+
+	now := time.Now()
+	visits := []models.GeofenceVisit{
+		{GeofenceID: hot.ID, UserID: visitor.ID, CreatedAt: now.Add(-time.Hour)},
+		{GeofenceID: hot.ID, UserID: owner.ID, CreatedAt: now.Add(-2 * time.Hour)},
+		{GeofenceID: faraway.ID, UserID: visitor.ID, CreatedAt: now.Add(-3 * time.Hour)},
+	}
+	// The old favourite had lots of visits, but two weeks ago
+	for i := 0; i < 20; i++ {
+		visits = append(visits, models.GeofenceVisit{GeofenceID: old.ID, UserID: visitor.ID, CreatedAt: now.Add(-14 * 24 * time.Hour)})
+	}
+	for i := range visits {
+		database.DB.Create(&visits[i])
+	}
+
+	content := models.Content{Title: "Hot take", GeofenceID: hot.ID}
+	database.DB.Create(&content)
+	_, err := (&services.ReactionService{}).AddReaction(visitor.ID, content.ID, models.InteractionLike)
+	assert.NoError(t, err)
+
+	assert.NoError(t, (&services.TrendingService{}).ComputeScores())
+
+	// Only the last day counts for 24h
+	items := getTrending(t, handlers.GetTrendingGeofences, "window=24h")
+	assert.Len(t, items, 2)
+	assert.Equal(t, "Hot spot", items[0].Geofence.Name)
+	assert.Equal(t, int64(2), items[0].Visits)
+	assert.Equal(t, int64(2), items[0].UniqueVisitors)
+	assert.Equal(t, int64(1), items[0].Likes)
+
+	// Older engagement shows up in the 30 day window
+	items = getTrending(t, handlers.GetTrendingGeofences, "window=30d&lat=40.05&lng=-75.05&radius=50")
+	assert.Len(t, items, 2)
+	assert.Equal(t, "Old favourite", items[0].Geofence.Name)
+
+	items = getTrending(t, handlers.GetTrendingContents, "window=7d&bbox=-76,39,-74,41")
+	assert.Len(t, items, 1)
+	assert.Equal(t, "Hot take", items[0].Content.Title)
+
+	rr := callAsUser(handlers.GetTrendingGeofences, "GET", "/api/trending/geofences?window=1y", nil, nil, 0)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestTrendingAcrossAntimeridian(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	fiji := models.Geofence{Name: "Fiji", Latitude: -1, Longitude: 179, Radius: 100, UserID: owner.ID}
+	samoa := models.Geofence{Name: "Samoa", Latitude: 1, Longitude: -172, Radius: 100, UserID: owner.ID}
+	hawaii := models.Geofence{Name: "Hawaii", Latitude: 5, Longitude: -160, Radius: 100, UserID: owner.ID}
+	for _, fence := range []*models.Geofence{&fiji, &samoa, &hawaii} {
+		database.DB.Create(fence)
+		database.DB.Create(&models.GeofenceVisit{GeofenceID: fence.ID, UserID: owner.ID, CreatedAt: time.Now().Add(-time.Hour)})
+	}
+	assert.NoError(t, (&services.TrendingService{}).ComputeScores())
+
+	items := getTrending(t, handlers.GetTrendingGeofences, "window=24h&bbox=170,-10,-170,10")
+	names := []string{}
+	for _, item := range items {
+		names = append(names, item.Geofence.Name)
+	}
+	assert.ElementsMatch(t, []string{"Fiji", "Samoa"}, names)
+}
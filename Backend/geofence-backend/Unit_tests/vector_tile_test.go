@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// getVectorTile requests a geofence vector tile as userID (0 for anonymous)
+func getVectorTile(tile services.Tile, userID uint, etag string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/api/tiles/geofences/tile.mvt", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"z": strconv.Itoa(tile.Z),
+		"x": strconv.Itoa(tile.X),
+		"y": strconv.Itoa(tile.Y),
+	})
+	if userID != 0 {
+		req = req.WithContext(context.WithValue(req.Context(), "userID", userID))
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	rr := httptest.NewRecorder()
+	handlers.GetGeofenceTile(rr, req)
+	return rr
+}
+
+func TestGeofenceVectorTiles(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	owner := createUser(t, "owner")
+	friend := createUser(t, "friend")
+
+	park := models.Geofence{Name: "Dolores Park", Description: "Picnic spot", Latitude: 37.7596, Longitude: -122.4269, Radius: 200, UserID: owner.ID}
+	opera := models.Geofence{Name: "Opera House", Description: "Harbour", Latitude: -33.8568, Longitude: 151.2153, Radius: 100, UserID: owner.ID}
+	database.DB.Create(&park)
+	database.DB.Create(&opera)
+
+	tile := services.TileAt(park.Latitude, park.Longitude, 14)
+
+	// Anonymous viewers get the public properties only
+	rr := getVectorTile(tile, 0, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/vnd.mapbox-vector-tile", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Cache-Control"), "public")
+	body := rr.Body.String()
+	assert.True(t, strings.Contains(body, "Dolores Park"))
+	assert.False(t, strings.Contains(body, "Opera House"))
+	assert.False(t, strings.Contains(body, "Picnic spot"))
+
+	// The owner and users it's shared with see more
+	rr = getVectorTile(tile, owner.ID, "")
+	assert.True(t, strings.Contains(rr.Body.String(), "Picnic spot"))
+	assert.Contains(t, rr.Header().Get("Cache-Control"), "private")
+
+	rr = getVectorTile(tile, friend.ID, "")
+	assert.False(t, strings.Contains(rr.Body.String(), "Picnic spot"))
+	database.DB.Create(&models.GeofenceShare{GeofenceID: park.ID, OwnerID: owner.ID, UserID: friend.ID, Permission: "view"})
+	rr = getVectorTile(tile, friend.ID, "")
+	assert.True(t, strings.Contains(rr.Body.String(), "Picnic spot"))
+
+	// Unchanged tiles are revalidated with their ETag
+	etag := getVectorTile(tile, 0, "").Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	rr = getVectorTile(tile, 0, etag)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.Bytes())
+
+	database.DB.Model(&park).Update("name", "Mission Dolores Park")
+	rr = getVectorTile(tile, 0, etag)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+
+	// Far out, the park is a point and still on the tile
+	rr = getVectorTile(services.TileAt(park.Latitude, park.Longitude, 3), 0, "")
+	assert.True(t, strings.Contains(rr.Body.String(), "Mission Dolores Park"))
+
+	rr = getVectorTile(services.Tile{Z: 2, X: 4, Y: 0}, 0, "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
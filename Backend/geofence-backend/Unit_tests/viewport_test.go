@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"encoding/json"
+	"geofence/internal/database"
+	"geofence/internal/handlers"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// viewportPage is the data of a viewport response
+type viewportPage struct {
+	Items      []models.Geofence `json:"items"`
+	Limit      int               `json:"limit"`
+	NextCursor string            `json:"next_cursor"`
+}
+
+// getViewport lists the geofences in a viewport query
+func getViewport(t *testing.T, query string) (int, viewportPage) {
+	rr := callAsUser(handlers.GetGeofences, "GET", "/api/geofences?"+query, nil, nil, 0)
+
+	var response struct {
+		Data viewportPage `json:"data"`
+	}
+	if rr.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	}
+	return rr.Code, response.Data
+}
+
+// viewportNames returns the names in a viewport page
+func viewportNames(page viewportPage) []string {
+	names := []string{}
+	for _, fence := range page.Items {
+		names = append(names, fence.Name)
+	}
+	return names
+}
+
+func TestViewportQuery(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	fences := []models.Geofence{
+		{Name: "Inside", Latitude: 10, Longitude: 10, Radius: 100, UserID: 1},
+		// Centred about 5.5 km east of the box, but 10 km across
+		{Name: "Overlapping", Latitude: 10, Longitude: 11.05, Radius: 10000, UserID: 1},
+		{Name: "Outside", Latitude: 10, Longitude: 11.05, Radius: 1000, UserID: 1},
+		{Name: "Fiji", Latitude: -17, Longitude: 179.5, Radius: 100, UserID: 1},
+		{Name: "Samoa", Latitude: -14, Longitude: -172, Radius: 100, UserID: 1},
+		// West of the antimeridian, reaching across it
+		{Name: "Date Line", Latitude: 0, Longitude: 179.95, Radius: 20000, UserID: 1},
+	}
+	for i := range fences {
+		database.DB.Create(&fences[i])
+	}
+
+	code, page := getViewport(t, "bbox=9,9,11,11")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"Inside", "Overlapping"}, viewportNames(page))
+	assert.Empty(t, page.NextCursor)
+
+	// A box from 179°E round to 170°W crosses the antimeridian
+	_, page = getViewport(t, "bbox=179,-20,-170,-10")
+	assert.Equal(t, []string{"Fiji", "Samoa"}, viewportNames(page))
+
+	// A fence wrapping over the antimeridian shows east of it too
+	_, page = getViewport(t, "bbox=-179.99,-1,-179,1")
+	assert.Equal(t, []string{"Date Line"}, viewportNames(page))
+
+	assert.True(t, services.CircleIntersectsRegion(0, -179.95, 20000, services.Region{MinLat: -1, MinLng: 179, MaxLat: 1, MaxLng: 179.99}))
+
+	code, _ = getViewport(t, "bbox=9,11,11,9")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = getViewport(t, "bbox=9,9,11,11&cursor=!!")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestViewportPagination(t *testing.T) {
+	// Set up test database
+	setupTestDB()
+
+	for i := 0; i < 250; i++ {
+		database.DB.Create(&models.Geofence{Name: "Fence", Latitude: 45, Longitude: float64(i%2) * 90, Radius: 50, UserID: 1})
+	}
+
+	// Only every other fence is in view, so pages span several batches
+	seen := map[uint]bool{}
+	cursor := ""
+	pages := 0
+	for {
+		_, page := getViewport(t, "bbox=-1,44,1,46&limit=40&cursor="+cursor)
+		pages++
+		assert.LessOrEqual(t, len(page.Items), 40)
+		for _, fence := range page.Items {
+			assert.False(t, seen[fence.ID])
+			assert.Equal(t, 0.0, fence.Longitude)
+			seen[fence.ID] = true
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.Len(t, seen, 125)
+	assert.Equal(t, 4, pages)
+
+	// The server caps the page size
+	_, page := getViewport(t, "bbox=-1,44,1,46&limit=1000")
+	assert.Equal(t, 100, page.Limit)
+	assert.Len(t, page.Items, 100)
+	assert.NotEmpty(t, page.NextCursor)
+}
@@ -5,27 +5,39 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 	
+	"geofence/internal/config"
 	"geofence/internal/handlers"
 	"geofence/internal/database"
 	"geofence/internal/middleware"
+	"geofence/internal/services"
 	
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
 
 func main() {
-	// Load .env file
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: No .env file found")
-	}
+	// Load .env file and settings
+	cfg := config.LoadConfig()
 
 	// Initialize database
-	if err := database.InitDB(); err != nil {
+	if err := database.InitDB(cfg); err != nil {
 		log.Fatal("Database initialization failed:", err)
 	}
-	log.Println("Database initialized successfully")
+	log.Printf("Database initialized successfully (%s)", cfg.DBDriver)
+	if cfg.DBDriver == config.DriverSQLite && !database.FullTextSearchEnabled {
+		log.Println("Warning: FTS5 is not compiled in, so search is unranked LIKE matching; build with -tags sqlite_fts5 (make build)")
+	}
+
+	// Background jobs
+	stop := make(chan struct{})
+	go services.RunPeriodically("purge-deleted-accounts", time.Hour, stop, (&services.AccountService{}).PurgeDueAccounts)
+	go services.RunPeriodically("popularity-scores", 15*time.Minute, stop, (&services.TrendingService{}).ComputeScores)
+	go services.RunPeriodically("analytics-rollups", 10*time.Minute, stop, (&services.RollupService{}).Run)
+	go services.RunPeriodically("content-similarities", 6*time.Hour, stop, (&services.ContentRecommendationService{}).ComputeSimilarities)
+	go services.RunPeriodically("export-cleanup", time.Hour, stop, (&services.ExportService{}).CleanupExports)
+	go services.RunPeriodically("trash-purge", time.Hour, stop, (&services.TrashService{}).PurgeExpired)
 
 	// Create router
 	router := mux.NewRouter()
@@ -90,22 +102,82 @@ func main() {
 	
 	// API routes
 	apiRouter := router.PathPrefix("/api").Subrouter()
+	apiRouter.Use(middleware.OptionalAuthMiddleware) // Identifies the viewer on public routes
 
 	// Public routes (no auth required)
 	apiRouter.HandleFunc("/register", handlers.Register).Methods("POST")
 	apiRouter.HandleFunc("/login", handlers.Login).Methods("POST")
+	apiRouter.HandleFunc("/auth/verify-email", handlers.VerifyEmail).Methods("POST")
 	
 	// Protected routes (auth required)
 	protectedRouter := apiRouter.PathPrefix("").Subrouter()
 	protectedRouter.Use(middleware.AuthMiddleware)
+
+	// Admin routes (auth and users.is_admin required)
+	adminRouter := protectedRouter.PathPrefix("").Subrouter()
+	adminRouter.Use(middleware.AdminMiddleware)
+
+	// Account routes
+	protectedRouter.HandleFunc("/auth/me", handlers.GetUserProfile).Methods("GET")
+	protectedRouter.HandleFunc("/auth/me", handlers.UpdateUserProfile).Methods("PATCH")
+	protectedRouter.HandleFunc("/auth/me", handlers.DeleteAccount).Methods("DELETE")
+	protectedRouter.HandleFunc("/auth/me/restore", handlers.CancelAccountDeletion).Methods("POST")
+	protectedRouter.HandleFunc("/auth/password", handlers.ChangePassword).Methods("POST")
 	
+	// Search routes
+	apiRouter.HandleFunc("/search", handlers.Search).Methods("GET") // Public
+	apiRouter.HandleFunc("/geofences/search", handlers.SearchGeofences).Methods("GET") // Public
+	apiRouter.HandleFunc("/geofences/search/advanced", handlers.SearchGeofencesAdvanced).Methods("GET") // Public
+
+	// Trending routes
+	apiRouter.HandleFunc("/trending/geofences", handlers.GetTrendingGeofences).Methods("GET") // Public
+	apiRouter.HandleFunc("/trending/contents", handlers.GetTrendingContents).Methods("GET") // Public
+	apiRouter.HandleFunc("/geofences/popular", handlers.GetPopularGeofences).Methods("GET") // Public
+
 	// Geofence routes
 	apiRouter.HandleFunc("/geofences/nearby", handlers.GetNearbyGeofences).Methods("GET") // Public
+	apiRouter.HandleFunc("/geofences/clusters", handlers.GetGeofenceClusters).Methods("GET") // Public
+	apiRouter.HandleFunc("/geofences/locate", handlers.LocateGeofences).Methods("GET") // Public
+	protectedRouter.HandleFunc("/geofences/intersect-route", handlers.IntersectRoute).Methods("POST")
+	apiRouter.HandleFunc("/geofences/geojson", handlers.ExportGeofencesGeoJSON).Methods("GET") // Public
+	protectedRouter.HandleFunc("/geofences/geojson", handlers.ImportGeofencesGeoJSON).Methods("POST")
+	protectedRouter.HandleFunc("/geofences/bulk", handlers.BulkGeofenceOperations).Methods("POST")
 	protectedRouter.HandleFunc("/geofences", handlers.CreateGeofence).Methods("POST")
 	apiRouter.HandleFunc("/geofences", handlers.GetGeofences).Methods("GET") // Public
 	apiRouter.HandleFunc("/geofences/{id}", handlers.GetGeofence).Methods("GET") // Public
 	protectedRouter.HandleFunc("/geofences/{id}", handlers.UpdateGeofence).Methods("PUT")
 	protectedRouter.HandleFunc("/geofences/{id}", handlers.DeleteGeofence).Methods("DELETE")
+	apiRouter.HandleFunc("/geofences/{id}/active", handlers.GetGeofenceActivity).Methods("GET") // Public
+	apiRouter.HandleFunc("/geofences/{id}/overlaps", handlers.GetGeofenceOverlaps).Methods("GET") // Public
+	apiRouter.HandleFunc("/geofences/{id}/ancestors", handlers.GetGeofenceAncestors).Methods("GET") // Public
+	apiRouter.HandleFunc("/geofences/{id}/descendants", handlers.GetGeofenceDescendants).Methods("GET") // Public
+	apiRouter.HandleFunc("/geofences/{id}/revisions", handlers.GetGeofenceRevisions).Methods("GET") // Public
+	apiRouter.HandleFunc("/geofences/{id}/revisions/diff", handlers.DiffGeofenceRevisions).Methods("GET") // Public
+	apiRouter.HandleFunc("/geofences/{id}/revisions/{revision:[0-9]+}", handlers.GetGeofenceRevision).Methods("GET") // Public
+	protectedRouter.HandleFunc("/geofences/{id}/revisions/{revision:[0-9]+}/restore", handlers.RestoreGeofenceRevision).Methods("POST")
+	apiRouter.HandleFunc("/geofences/{id}/{operation:union|intersection|difference}", handlers.CombineGeofences).Methods("GET") // Public
+	protectedRouter.HandleFunc("/geofences/{id}/visits", handlers.RecordGeofenceVisit).Methods("POST")
+	protectedRouter.HandleFunc("/geofences/{id}/exit", handlers.RecordGeofenceExit).Methods("POST")
+	protectedRouter.HandleFunc("/locations", handlers.IngestLocation).Methods("POST")
+	protectedRouter.HandleFunc("/geofences/{id}/analytics", handlers.GetGeofenceAnalytics).Methods("GET")
+
+	// Geofence groups
+	protectedRouter.HandleFunc("/groups", handlers.CreateGroup).Methods("POST")
+	protectedRouter.HandleFunc("/groups", handlers.GetGroups).Methods("GET")
+	protectedRouter.HandleFunc("/groups/{id}", handlers.GetGroup).Methods("GET")
+	protectedRouter.HandleFunc("/groups/{id}", handlers.UpdateGroup).Methods("PUT")
+	protectedRouter.HandleFunc("/groups/{id}", handlers.DeleteGroup).Methods("DELETE")
+	protectedRouter.HandleFunc("/groups/{id}/geofences", handlers.AddGroupGeofences).Methods("POST")
+	protectedRouter.HandleFunc("/groups/{id}/geofences/{geofenceId}", handlers.RemoveGroupGeofence).Methods("DELETE")
+	protectedRouter.HandleFunc("/groups/{id}/share", handlers.ShareGroup).Methods("POST")
+	protectedRouter.HandleFunc("/groups/{id}/enable", handlers.EnableGroup).Methods("POST")
+	protectedRouter.HandleFunc("/groups/{id}/disable", handlers.DisableGroup).Methods("POST")
+	protectedRouter.HandleFunc("/groups/{id}/geojson", handlers.ExportGroupGeoJSON).Methods("GET")
+	protectedRouter.HandleFunc("/groups/{id}/subscriptions", handlers.SubscribeToGroup).Methods("POST")
+	protectedRouter.HandleFunc("/groups/{id}/subscriptions", handlers.GetGroupSubscriptions).Methods("GET")
+	protectedRouter.HandleFunc("/groups/{id}/subscriptions/{subscriptionId}", handlers.DeleteGroupSubscription).Methods("DELETE")
+	protectedRouter.HandleFunc("/groups/{id}/events", handlers.GetGroupEvents).Methods("GET")
+	protectedRouter.HandleFunc("/groups/{id}/analytics", handlers.GetGroupAnalytics).Methods("GET")
 
 	// Content routes
 	apiRouter.HandleFunc("/contents", handlers.CreateContent).Methods("POST")
@@ -114,6 +186,73 @@ func main() {
 	apiRouter.HandleFunc("/contents/{id}", handlers.UpdateContent).Methods("PUT")
 	apiRouter.HandleFunc("/contents/{id}", handlers.DeleteContent).Methods("DELETE")
 
+	// Reaction routes (videos/ is the path the frontend uses for content)
+	for _, prefix := range []string{"/contents", "/videos"} {
+		protectedRouter.HandleFunc(prefix+"/{id}/view", handlers.RecordContentView).Methods("POST")
+		protectedRouter.HandleFunc(prefix+"/{id}/like", handlers.LikeContent).Methods("POST")
+		protectedRouter.HandleFunc(prefix+"/{id}/unlike", handlers.UnlikeContent).Methods("POST")
+		protectedRouter.HandleFunc(prefix+"/{id}/favorite", handlers.FavoriteContent).Methods("POST")
+		protectedRouter.HandleFunc(prefix+"/{id}/unfavorite", handlers.UnfavoriteContent).Methods("POST")
+		protectedRouter.HandleFunc(prefix+"/{id}/repost", handlers.RepostContent).Methods("POST")
+		protectedRouter.HandleFunc(prefix+"/{id}/unrepost", handlers.UnrepostContent).Methods("POST")
+	}
+	apiRouter.HandleFunc("/users/{id}/liked", handlers.GetUserLikedContent).Methods("GET") // Public
+	apiRouter.HandleFunc("/users/{id}/favorites", handlers.GetUserFavorites).Methods("GET") // Public
+	apiRouter.HandleFunc("/users/{id}/reposts", handlers.GetUserReposts).Methods("GET") // Public
+
+	// Social routes
+	apiRouter.HandleFunc("/users/@{username}", handlers.GetPublicProfile).Methods("GET") // Public
+	apiRouter.HandleFunc("/users/{id}/followers", handlers.GetFollowers).Methods("GET") // Public
+	apiRouter.HandleFunc("/users/{id}/following", handlers.GetFollowing).Methods("GET") // Public
+	protectedRouter.HandleFunc("/users/{id}/follow", handlers.FollowUser).Methods("POST")
+	protectedRouter.HandleFunc("/users/{id}/unfollow", handlers.UnfollowUser).Methods("POST")
+	protectedRouter.HandleFunc("/users/{id}/block", handlers.BlockUser).Methods("POST")
+	protectedRouter.HandleFunc("/users/{id}/unblock", handlers.UnblockUser).Methods("POST")
+	protectedRouter.HandleFunc("/users/{id}/mute", handlers.MuteUser).Methods("POST")
+	protectedRouter.HandleFunc("/users/{id}/unmute", handlers.UnmuteUser).Methods("POST")
+	protectedRouter.HandleFunc("/blocks", handlers.GetBlockedUsers).Methods("GET")
+	protectedRouter.HandleFunc("/mutes", handlers.GetMutedUsers).Methods("GET")
+
+	// Category and tag routes
+	apiRouter.HandleFunc("/categories", handlers.GetCategories).Methods("GET") // Public
+	apiRouter.HandleFunc("/categories/{id}", handlers.GetCategory).Methods("GET") // Public
+	adminRouter.HandleFunc("/categories", handlers.CreateCategory).Methods("POST")
+	adminRouter.HandleFunc("/categories/{id}", handlers.UpdateCategory).Methods("PUT")
+	adminRouter.HandleFunc("/categories/{id}", handlers.DeleteCategory).Methods("DELETE")
+	protectedRouter.HandleFunc("/geofences/{id}/categories", handlers.SetGeofenceCategories).Methods("PUT")
+	protectedRouter.HandleFunc("/geofences/{id}/tags", handlers.SetGeofenceTags).Methods("PUT")
+	protectedRouter.HandleFunc("/contents/{id}/tags", handlers.SetContentTags).Methods("PUT")
+	apiRouter.HandleFunc("/tags/autocomplete", handlers.AutocompleteTags).Methods("GET") // Public
+
+	// Preferences and recommendations
+	protectedRouter.HandleFunc("/preferences", handlers.GetUserPreferences).Methods("GET")
+	protectedRouter.HandleFunc("/preferences", handlers.UpdateUserPreferences).Methods("PUT")
+	protectedRouter.HandleFunc("/recommendations", handlers.GetRecommendations).Methods("GET")
+	adminRouter.HandleFunc("/admin/analytics/backfill", handlers.BackfillAnalytics).Methods("POST")
+
+	// Trash
+	protectedRouter.HandleFunc("/trash", handlers.GetTrash).Methods("GET")
+	protectedRouter.HandleFunc("/trash/geofences/{id}/restore", handlers.RestoreTrashedGeofence).Methods("POST")
+	protectedRouter.HandleFunc("/trash/geofences/{id}", handlers.PurgeTrashedGeofence).Methods("DELETE")
+	protectedRouter.HandleFunc("/trash/contents/{id}/restore", handlers.RestoreTrashedContent).Methods("POST")
+	protectedRouter.HandleFunc("/trash/contents/{id}", handlers.PurgeTrashedContent).Methods("DELETE")
+
+	// Data exports
+	protectedRouter.HandleFunc("/exports", handlers.CreateExportJob).Methods("POST")
+	protectedRouter.HandleFunc("/exports/jobs", handlers.GetExportJobs).Methods("GET")
+	protectedRouter.HandleFunc("/exports/jobs/{id}", handlers.GetExportJob).Methods("GET")
+	protectedRouter.HandleFunc("/exports/jobs/{id}/download", handlers.DownloadExport).Methods("GET")
+	protectedRouter.HandleFunc("/exports/{dataset}", handlers.ExportData).Methods("GET")
+
+	// Map layers
+	apiRouter.HandleFunc("/heatmap/density", handlers.GetDensity).Methods("GET") // Public
+	apiRouter.HandleFunc("/tiles/geofences/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}.mvt", handlers.GetGeofenceTile).Methods("GET") // Public
+
+	// Map tiles live outside /api so map libraries can use a plain URL template
+	tileRouter := router.PathPrefix("/tiles").Subrouter()
+	tileRouter.Use(middleware.OptionalAuthMiddleware)
+	tileRouter.HandleFunc("/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}.png", handlers.GetHeatmapTile).Methods("GET")
+
 	// API health check
 	apiRouter.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -126,7 +265,7 @@ func main() {
 	// Setup CORS
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"http://localhost:3000"}, // Frontend domain
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"Content-Type", "Authorization", "X-Requested-With"},
 		AllowCredentials: true,
 	})
@@ -140,7 +279,7 @@ func main() {
 	// Start server
 	log.Printf("Server starting on port %s...", port)
 	log.Printf("Backend ready for frontend integration at http://localhost:%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, c.Handler(router)))
+	log.Fatal(http.ListenAndServe(":"+port, c.Handler(middleware.MethodOverride(router))))
 }
 
 func loggingMiddleware(next http.Handler) http.Handler {
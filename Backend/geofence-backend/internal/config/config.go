@@ -1,48 +1,41 @@
-<<<<<<< HEAD
-=======
 // internal/config/config.go
->>>>>>> 56da89969bb36d9b47143d340e6dcfb4932b95b8
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
-<<<<<<< HEAD
 	"strconv"
-=======
->>>>>>> 56da89969bb36d9b47143d340e6dcfb4932b95b8
 
 	"github.com/joho/godotenv"
 )
 
+// Storage drivers. SQLite is embedded and needs no server; Postgres uses
+// PostGIS for spatial queries and is only compiled in with -tags postgres.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
 type Config struct {
+	DBDriver   string
+	DBPath     string
 	DBHost     string
-<<<<<<< HEAD
 	DBPort     int
 	DBUser     string
 	DBPassword string
 	DBName     string
+	DBSSLMode  string
 	ServerPort int
 	JWTSecret  string
 }
 
 func LoadConfig() *Config {
 	// Load .env file
-=======
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	ServerPort string
-}
-
-func LoadConfig() *Config {
->>>>>>> 56da89969bb36d9b47143d340e6dcfb4932b95b8
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
 
-<<<<<<< HEAD
 	// Parse database port
 	dbPort, err := strconv.Atoi(getEnv("DB_PORT", "5432"))
 	if err != nil {
@@ -58,16 +51,25 @@ func LoadConfig() *Config {
 	}
 
 	return &Config{
+		DBDriver:   getEnv("DB_DRIVER", DriverSQLite),
+		DBPath:     getEnv("DB_PATH", "geofence.db"),
 		DBHost:     getEnv("DB_HOST", "localhost"),
 		DBPort:     dbPort,
 		DBUser:     getEnv("DB_USER", ""),
 		DBPassword: getEnv("DB_PASSWORD", ""),
 		DBName:     getEnv("DB_NAME", "geofence_db"),
+		DBSSLMode:  getEnv("DB_SSLMODE", "disable"),
 		ServerPort: serverPort,
 		JWTSecret:  getEnv("JWT_SECRET", "default_secret_key"),
 	}
 }
 
+// PostgresDSN is the connection string for the Postgres settings
+func (c *Config) PostgresDSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		c.DBHost, c.DBPort, c.DBUser, c.DBPassword, c.DBName, c.DBSSLMode)
+}
+
 // getEnv retrieves an environment variable with a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -75,14 +77,4 @@ func getEnv(key, defaultValue string) string {
 		return defaultValue
 	}
 	return value
-=======
-	return &Config{
-		DBHost:     os.Getenv("DB_HOST"),
-		DBPort:     os.Getenv("DB_PORT"),
-		DBUser:     os.Getenv("DB_USER"),
-		DBPassword: os.Getenv("DB_PASSWORD"),
-		DBName:     os.Getenv("DB_NAME"),
-		ServerPort: os.Getenv("SERVER_PORT"),
-	}
->>>>>>> 56da89969bb36d9b47143d340e6dcfb4932b95b8
-}
\ No newline at end of file
+}
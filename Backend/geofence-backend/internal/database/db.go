@@ -1,22 +1,42 @@
 package database
 
 import (
+    "fmt"
+
     "gorm.io/driver/sqlite"
     "gorm.io/gorm"
+    "geofence/internal/config"
     "geofence/internal/models"
 )
 
 var DB *gorm.DB
 
-func InitDB() error {
-    db, err := gorm.Open(sqlite.Open("geofence.db"), &gorm.Config{})
+// dialectors open each compiled-in storage driver. SQLite is always there;
+// postgres.go adds Postgres when built with -tags postgres.
+var dialectors = map[string]func(cfg *config.Config) gorm.Dialector{
+    config.DriverSQLite: func(cfg *config.Config) gorm.Dialector {
+        return sqlite.Open(cfg.DBPath)
+    },
+}
+
+// InitDB connects to the database configured by DB_DRIVER and migrates it
+func InitDB(cfg *config.Config) error {
+    open, ok := dialectors[cfg.DBDriver]
+    if !ok && cfg.DBDriver == config.DriverPostgres {
+        return fmt.Errorf("DB_DRIVER %q is not compiled in; build with -tags postgres", cfg.DBDriver)
+    }
+    if !ok {
+        return fmt.Errorf("unknown DB_DRIVER %q", cfg.DBDriver)
+    }
+
+    // TranslateError turns driver errors such as unique violations into
+    // gorm's, so callers can check them the same way on every driver
+    db, err := gorm.Open(open(cfg), &gorm.Config{TranslateError: true})
     if err != nil {
         return err
     }
 
-    // Auto migrate the schemas
-    err = db.AutoMigrate(&models.User{}, &models.Geofence{}, &models.Content{})
-    if err != nil {
+    if err := migrate(db); err != nil {
         return err
     }
 
@@ -27,14 +47,12 @@ func InitDB() error {
 // InitTestDB initializes a test in-memory SQLite database
 func InitTestDB() error {
     // Use in-memory SQLite for testing
-    db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+    db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{TranslateError: true})
     if err != nil {
         return err
     }
 
-    // Auto migrate the schemas
-    err = db.AutoMigrate(&models.User{}, &models.Geofence{}, &models.Content{})
-    if err != nil {
+    if err := migrate(db); err != nil {
         return err
     }
 
@@ -42,4 +60,60 @@ func InitTestDB() error {
     DB = db
     
     return nil
-}
\ No newline at end of file
+}
+
+// migrate creates or updates the schema shared by the real and test databases
+func migrate(db *gorm.DB) error {
+    // Auto migrate the schemas
+    err := db.AutoMigrate(
+        &models.User{},
+        &models.Category{},
+        &models.Tag{},
+        &models.Geofence{},
+        &models.GeofenceSchedule{},
+        &models.GeofenceRevision{},
+        &models.Content{},
+        &models.ContentInteraction{},
+        &models.GeofenceVisit{},
+        &models.RouteDeviation{},
+        &models.ContentSimilarity{},
+        &models.PopularityScore{},
+        &models.AnalyticsRollup{},
+        &models.RollupWatermark{},
+        &models.ExportJob{},
+        &models.UserPreference{},
+        &models.GeofenceShare{},
+        &models.GeofenceGroup{},
+        &models.GeofenceGroupShare{},
+        &models.GroupSubscription{},
+        &models.GroupEvent{},
+        &models.Follow{},
+        &models.UserRestriction{},
+        &models.ErrorLog{},
+    )
+    if err != nil {
+        return err
+    }
+
+    // A user can hold at most one active like, favorite or repost per content.
+    // Views are not covered so they can be recorded repeatedly.
+    err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_content_reactions_unique
+        ON content_interactions (user_id, content_id, interaction_type)
+        WHERE interaction_type IN ('like', 'favorite', 'repost') AND deleted_at IS NULL`).Error
+    if err != nil {
+        return err
+    }
+
+    // FTS5 is SQLite's; Postgres gets PostGIS locations instead and search
+    // falls back to LIKE
+    if IsPostgres(db) {
+        return setupPostGIS(db)
+    }
+    return setupFullTextSearch(db)
+}
+
+// IsPostgres reports whether db is a Postgres connection, where spatial
+// queries use PostGIS
+func IsPostgres(db *gorm.DB) bool {
+    return db.Dialector.Name() == config.DriverPostgres
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// FullTextSearchEnabled reports whether the FTS5 search tables are available.
+// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag
+// (make run, or go run -tags sqlite_fts5 ./cmd); without it search falls back
+// to LIKE and the server warns at startup.
+var FullTextSearchEnabled bool
+
+// ftsIndex describes an FTS5 table mirroring text columns of a regular table
+type ftsIndex struct {
+	table   string
+	source  string
+	columns []string
+}
+
+var ftsIndexes = []ftsIndex{
+	{table: "geofences_fts", source: "geofences", columns: []string{"name", "description"}},
+	{table: "contents_fts", source: "contents", columns: []string{"title", "description"}},
+}
+
+// setupFullTextSearch creates the FTS5 tables and the triggers that keep them
+// in sync with their source tables, and indexes existing rows the first time
+func setupFullTextSearch(db *gorm.DB) error {
+	for _, idx := range ftsIndexes {
+		existed := db.Migrator().HasTable(idx.table)
+
+		err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS ` + idx.table + ` USING fts5(` +
+			join(idx.columns, "") + `, content='` + idx.source + `', content_rowid='id', tokenize='porter unicode61')`).Error
+		if err != nil {
+			log.Printf("Full-text search disabled: %v", err)
+			FullTextSearchEnabled = false
+			return nil
+		}
+
+		cols := join(idx.columns, "")
+		newCols := join(idx.columns, "new.")
+		oldCols := join(idx.columns, "old.")
+
+		triggers := []string{
+			`CREATE TRIGGER IF NOT EXISTS ` + idx.table + `_ai AFTER INSERT ON ` + idx.source + ` BEGIN
+				INSERT INTO ` + idx.table + `(rowid, ` + cols + `) VALUES (new.id, ` + newCols + `);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS ` + idx.table + `_ad AFTER DELETE ON ` + idx.source + ` BEGIN
+				INSERT INTO ` + idx.table + `(` + idx.table + `, rowid, ` + cols + `) VALUES ('delete', old.id, ` + oldCols + `);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS ` + idx.table + `_au AFTER UPDATE ON ` + idx.source + ` BEGIN
+				INSERT INTO ` + idx.table + `(` + idx.table + `, rowid, ` + cols + `) VALUES ('delete', old.id, ` + oldCols + `);
+				INSERT INTO ` + idx.table + `(rowid, ` + cols + `) VALUES (new.id, ` + newCols + `);
+			END`,
+		}
+		for _, trigger := range triggers {
+			if err := db.Exec(trigger).Error; err != nil {
+				return err
+			}
+		}
+
+		if !existed {
+			if err := db.Exec(`INSERT INTO ` + idx.table + `(` + idx.table + `) VALUES ('rebuild')`).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	FullTextSearchEnabled = true
+	return nil
+}
+
+// join lists columns separated by commas, each with the given prefix
+func join(columns []string, prefix string) string {
+	result := ""
+	for i, column := range columns {
+		if i > 0 {
+			result += ", "
+		}
+		result += prefix + column
+	}
+	return result
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// setupPostGIS gives geofences a geography location kept in step with their
+// latitude and longitude, indexed for ST_DWithin and for ST_Covers against
+// lat/lng boxes, which work on geometry
+func setupPostGIS(db *gorm.DB) error {
+	FullTextSearchEnabled = false
+
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS postgis`,
+		`ALTER TABLE geofences ADD COLUMN IF NOT EXISTS location geography(Point, 4326)
+			GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)::geography) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_geofences_location ON geofences USING GIST (location)`,
+		`CREATE INDEX IF NOT EXISTS idx_geofences_location_geometry ON geofences USING GIST ((location::geometry))`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
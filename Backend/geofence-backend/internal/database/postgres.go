@@ -0,0 +1,18 @@
+//go:build postgres
+
+package database
+
+import (
+	"geofence/internal/config"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Postgres needs gorm.io/driver/postgres, so it's only compiled in with
+// -tags postgres and SQLite-only builds don't pull it in
+func init() {
+	dialectors[config.DriverPostgres] = func(cfg *config.Config) gorm.Dialector {
+		return postgres.Open(cfg.PostgresDSN())
+	}
+}
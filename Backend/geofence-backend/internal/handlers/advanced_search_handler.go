@@ -3,6 +3,7 @@ package handlers
 import (
 	"geofence/internal/database"
 	"geofence/internal/models"
+	"geofence/internal/services"
 	"geofence/internal/utils"
 	"net/http"
 	"strconv"
@@ -12,18 +13,32 @@ import (
 func SearchGeofencesAdvanced(w http.ResponseWriter, r *http.Request) {
 	// Get query parameters
 	query := r.URL.Query().Get("q")
-	category := r.URL.Query().Get("category")
 	user := r.URL.Query().Get("user")
 	radius := r.URL.Query().Get("radius")
 	lat := r.URL.Query().Get("lat")
 	lng := r.URL.Query().Get("lng")
+	minRadius := r.URL.Query().Get("min_radius")
+	maxRadius := r.URL.Query().Get("max_radius")
 	
 	// Start building the query
-	db := database.DB.Model(&models.Geofence{})
+	db := database.DB.Model(&models.Geofence{}).Scopes(services.VisibleGeofences(viewerID(r)))
 	
-	// Apply text search if provided
+	// Apply ranked text search if provided
 	if query != "" {
-		db = db.Where("name LIKE ? OR description LIKE ?", "%"+query+"%", "%"+query+"%")
+		db = db.Scopes(services.MatchGeofences(query))
+	}
+
+	// Filter by geofence size if provided
+	if minRadius != "" {
+		if radius, err := strconv.ParseFloat(minRadius, 64); err == nil {
+			db = db.Where("radius >= ?", radius)
+		}
+	}
+
+	if maxRadius != "" {
+		if radius, err := strconv.ParseFloat(maxRadius, 64); err == nil {
+			db = db.Where("radius <= ?", radius)
+		}
 	}
 	
 	// Filter by user if provided
@@ -34,44 +49,37 @@ func SearchGeofencesAdvanced(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	
-	// Filter by category if provided
-	if category != "" {
-		// This would require a join with a categories table
-		// For simplicity, we'll assume the Category model and relationship exists
-		categoryID, err := strconv.Atoi(category)
-		if err == nil {
-			db = db.Joins("JOIN geofence_categories ON geofences.id = geofence_categories.geofence_id").
-				Where("geofence_categories.category_id = ?", categoryID)
-		}
+	// Filter by category (including subcategories) and tags
+	filters, err := taxonomyFilters(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid category filter")
+		return
 	}
+	db = db.Scopes(filters)
 	
 	// Filter by location if all location parameters are provided
+	var near *services.GeoFilter
 	if lat != "" && lng != "" && radius != "" {
 		latitude, latErr := strconv.ParseFloat(lat, 64)
 		longitude, lngErr := strconv.ParseFloat(lng, 64)
 		radiusVal, radErr := strconv.ParseFloat(radius, 64)
 		
 		if latErr == nil && lngErr == nil && radErr == nil {
-			// This is a simplified approach. For production, use spatial queries
-			// For SQLite, you might need to calculate distance manually
-			// This code assumes you're using a database with spatial functions
-			
-			// For a basic implementation, we'll filter geofences within the radius
-			// using a bounding box approximation
-			latRange := radiusVal / 111.0 // 1 degree lat ≈ 111 km
-			lngRange := radiusVal / (111.0 * 0.85) // Approximate at mid latitudes
-			
-			db = db.Where("latitude BETWEEN ? AND ?", latitude-latRange, latitude+latRange).
-				Where("longitude BETWEEN ? AND ?", longitude-lngRange, longitude+lngRange)
+			// radius is in km
+			near = &services.GeoFilter{Latitude: latitude, Longitude: longitude, RadiusKm: radiusVal}
+			db = db.Scopes(services.WithinBoundingBox("geofences", *near))
 		}
 	}
 	
 	// Execute the query
 	var geofences []models.Geofence
-	if err := db.Find(&geofences).Error; err != nil {
+	if err := db.Preload("Categories").Preload("Tags").Find(&geofences).Error; err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error searching geofences")
 		return
 	}
+	if near != nil {
+		geofences = services.GeofencesWithin(geofences, *near)
+	}
 	
 	// Return results
 	utils.RespondWithSuccess(w, http.StatusOK, geofences)
@@ -84,32 +92,26 @@ func GetPopularGeofences(w http.ResponseWriter, r *http.Request) {
 	limitVal := 10 // Default value
 	
 	if limit != "" {
-		if val, err := strconv.Atoi(limit); err == nil && val > 0 {
+		if val, err := strconv.Atoi(limit); err == nil && val > 0 && val <= utils.MaxPerPage {
 			limitVal = val
 		}
 	}
 	
-	// In a real implementation, you would have a visits or analytics table
-	// to track geofence popularity. For this example, we'll use a simplified approach
-	// by considering geofences with more content as more popular
-	var popularGeofences []struct {
-		models.Geofence
-		ContentCount int `json:"content_count"`
+	// Popularity comes from the precomputed engagement scores
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = models.PopularityWindowMonth
 	}
-	
-	query := `
-		SELECT g.*, COUNT(c.id) as content_count
-		FROM geofences g
-		LEFT JOIN contents c ON g.id = c.geofence_id
-		GROUP BY g.id
-		ORDER BY content_count DESC
-		LIMIT ?
-	`
-	
-	if err := database.DB.Raw(query, limitVal).Scan(&popularGeofences).Error; err != nil {
+	if !services.IsValidWindow(window) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Window must be one of 24h, 7d or 30d")
+		return
+	}
+
+	items, _, err := trendingService.Top(services.TrendingTypeGeofence, window, nil, viewerID(r), limitVal, 0)
+	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching popular geofences")
 		return
 	}
 	
-	utils.RespondWithSuccess(w, http.StatusOK, popularGeofences)
-}
\ No newline at end of file
+	utils.RespondWithSuccess(w, http.StatusOK, items)
+}
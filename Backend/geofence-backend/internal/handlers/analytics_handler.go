@@ -0,0 +1,203 @@
+// internal/handlers/analytics_handler.go
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+var metricsService = &services.GeofenceMetricsService{}
+
+var errInvalidDateRange = errors.New("from must be before to")
+
+// GetGeofenceAnalytics returns visit analytics for a geofence to its owner or
+// an admin. Query parameters: from and to (YYYY-MM-DD, to inclusive, or
+// RFC 3339; default the last 30 days), bucket=day|week and tz (IANA name).
+func GetGeofenceAnalytics(w http.ResponseWriter, r *http.Request) {
+	geofence, ok := analyticsGeofence(w, r)
+	if !ok {
+		return
+	}
+
+	rng, ok := parseMetricsRange(w, r)
+	if !ok {
+		return
+	}
+
+	metrics, err := metricsService.GetGeofencePerformanceMetrics(geofence.ID, rng)
+	if err == services.ErrInvalidMetricsRange {
+		utils.RespondWithError(w, http.StatusBadRequest, "from must be before to, at most a year apart")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error calculating analytics")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, metrics)
+}
+
+// BackfillAnalytics recomputes the analytics rollups for a date range in the
+// background (admin only), after any rollup already running. At most 366
+// days at a time. Body: {"from": "2026-01-01", "to": "2026-01-31"},
+// dates as YYYY-MM-DD (to inclusive) or RFC 3339.
+func BackfillAnalytics(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	from, _, fromErr := parseDateParam(req.From, time.UTC)
+	to, dateOnly, toErr := parseDateParam(req.To, time.UTC)
+	if fromErr != nil || toErr != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "from and to must be dates")
+		return
+	}
+	if dateOnly {
+		to = to.AddDate(0, 0, 1)
+	}
+	if err := rollupService.CheckBackfill(from, to); err != nil {
+		message := "from must be before to"
+		if err == services.ErrBackfillTooLong {
+			message = err.Error()
+		}
+		utils.RespondWithError(w, http.StatusBadRequest, message)
+		return
+	}
+
+	go func() {
+		if err := rollupService.Backfill(from, to); err != nil {
+			log.Printf("Analytics backfill %s to %s failed: %v", from, to, err)
+			return
+		}
+		log.Printf("Analytics backfill %s to %s finished", from, to)
+	}()
+
+	utils.RespondWithSuccess(w, http.StatusAccepted, map[string]interface{}{"from": from, "to": to})
+}
+
+// analyticsGeofence loads the geofence in the URL if the current user owns it or is an admin
+func analyticsGeofence(w http.ResponseWriter, r *http.Request) (*models.Geofence, bool) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return nil, false
+	}
+
+	var geofence models.Geofence
+	if err := database.DB.First(&geofence, mux.Vars(r)["id"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return nil, false
+	}
+
+	if allowed, _ := ownerOrAdmin(geofence.UserID, userID); !allowed {
+		utils.RespondWithError(w, http.StatusForbidden, "Only the owner can view analytics for this geofence")
+		return nil, false
+	}
+
+	return &geofence, true
+}
+
+// ownerOrAdmin reports whether a user is ownerID or an admin, and whether
+// they are an admin
+func ownerOrAdmin(ownerID, userID uint) (allowed, admin bool) {
+	var user models.User
+	admin = database.DB.Select("id", "is_admin").First(&user, userID).Error == nil && user.IsAdmin
+	return ownerID == userID || admin, admin
+}
+
+// parseMetricsRange reads from, to, bucket and tz
+func parseMetricsRange(w http.ResponseWriter, r *http.Request) (services.MetricsRange, bool) {
+	query := r.URL.Query()
+	rng := services.MetricsRange{Bucket: query.Get("bucket"), Location: time.UTC}
+
+	if rng.Bucket != "" && rng.Bucket != services.BucketDay && rng.Bucket != services.BucketWeek {
+		utils.RespondWithError(w, http.StatusBadRequest, "bucket must be day or week")
+		return rng, false
+	}
+
+	if tz := query.Get("tz"); tz != "" {
+		location, err := time.LoadLocation(tz)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Unknown time zone")
+			return rng, false
+		}
+		rng.Location = location
+	}
+
+	rng.To = time.Now()
+	if to := query.Get("to"); to != "" {
+		t, dateOnly, err := parseDateParam(to, rng.Location)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid to date")
+			return rng, false
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		rng.To = t
+	}
+
+	rng.From = rng.To.AddDate(0, 0, -30)
+	if from := query.Get("from"); from != "" {
+		t, _, err := parseDateParam(from, rng.Location)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid from date")
+			return rng, false
+		}
+		rng.From = t
+	}
+
+	return rng, true
+}
+
+// parseDateParam accepts YYYY-MM-DD (in location) or RFC 3339 and reports
+// which form it was
+func parseDateParam(value string, location *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// parseDateRange parses optional from and to dates in UTC; a date-only to
+// is inclusive
+func parseDateRange(from, to string) (*time.Time, *time.Time, error) {
+	var start, end *time.Time
+	if from != "" {
+		t, _, err := parseDateParam(from, time.UTC)
+		if err != nil {
+			return nil, nil, err
+		}
+		start = &t
+	}
+	if to != "" {
+		t, dateOnly, err := parseDateParam(to, time.UTC)
+		if err != nil {
+			return nil, nil, err
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		end = &t
+	}
+	if start != nil && end != nil && !end.After(*start) {
+		return nil, nil, errInvalidDateRange
+	}
+	return start, end, nil
+}
@@ -0,0 +1,63 @@
+// internal/handlers/bulk_handler.go
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"geofence/internal/services"
+	"geofence/internal/utils"
+)
+
+var bulkService = &services.BulkService{}
+
+// bulkRequest is the body of a bulk request
+type bulkRequest struct {
+	Mode       string                   `json:"mode"`
+	Operations []services.BulkOperation `json:"operations"`
+}
+
+// BulkGeofenceOperations applies a batch of geofence and content changes for
+// the current user. Body: {"mode": "transactional" | "best_effort",
+// "operations": [{"op": "create" | "update" | "delete", "resource":
+// "geofence" | "content", "id": ..., "geofence": {...}, "content": {...}}]}.
+// Every operation is validated before any is applied. A transactional batch
+// (the default) is rejected with 400 and nothing applied if any operation
+// fails; a best-effort batch reports each operation's result.
+func BulkGeofenceOperations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	result, err := bulkService.Run(userID, req.Mode, req.Operations)
+	switch err {
+	case nil:
+	case services.ErrTooManyBulkOperations:
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case services.ErrUnknownBulkMode, services.ErrNoBulkOperations:
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error applying operations")
+		return
+	}
+
+	if result.Mode == services.BulkTransactional && result.Failed > 0 {
+		utils.RespondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"status":  "error",
+			"message": "No operations were applied",
+			"data":    result,
+		})
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, result)
+}
@@ -0,0 +1,44 @@
+// internal/handlers/cluster_handler.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"geofence/internal/services"
+	"geofence/internal/utils"
+)
+
+var clusterService = &services.ClusterService{}
+
+// GetGeofenceClusters returns the map markers for a viewport:
+// ?bbox=minLng,minLat,maxLng,maxLat&zoom=12. Nearby fences are grouped into
+// clusters with a count, centroid, bounding box and the zoom they expand at;
+// fences on their own are returned as they are.
+func GetGeofenceClusters(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("bbox") == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, errInvalidBBox.Error())
+		return
+	}
+
+	region, err := parseRegion(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	zoom, err := strconv.Atoi(query.Get("zoom"))
+	if err != nil || zoom < 0 || zoom > services.MaxTileZoom {
+		utils.RespondWithError(w, http.StatusBadRequest, "zoom must be 0-"+strconv.Itoa(services.MaxTileZoom))
+		return
+	}
+
+	result, err := clusterService.Clusters(*region, zoom, viewerID(r))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error clustering geofences")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, result)
+}
@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"geofence/internal/database"
 	"geofence/internal/models"
+	"geofence/internal/services"
 	"geofence/internal/utils"
 
 	"github.com/gorilla/mux"
@@ -38,6 +40,16 @@ func CreateContent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Blocked users can't post to the owner's fences
+	if socialService.IsBlocked(geofence.UserID, viewerID(r)) {
+		utils.RespondWithError(w, http.StatusForbidden, "You can't add content to this geofence")
+		return
+	}
+
+	// Reaction counts are maintained by the reaction endpoints only
+	content.LikeCount, content.FavoriteCount, content.RepostCount = 0, 0, 0
+	content.Tags = nil
+
 	// Create the content
 	result := database.DB.Create(&content)
 	if result.Error != nil {
@@ -57,8 +69,22 @@ func GetContents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Content only unlocks while its fence is active
+	if unlocked, err := contentUnlocked(geofenceID, viewerID(r)); err != nil || !unlocked {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return
+	}
+
+	// Ancestors that cascade their content add theirs while it's unlocked
+	sources, err := contentSources(geofenceID, viewerID(r))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching contents")
+		return
+	}
+
 	var contents []models.Content
-	result := database.DB.Where("geofence_id = ?", geofenceID).Find(&contents)
+	tagFilter := services.FilterContentsByTags(splitList(r.URL.Query().Get("tags")), r.URL.Query().Get("tags_match") == "all")
+	result := database.DB.Preload("Tags").Scopes(services.VisibleContents(viewerID(r)), tagFilter).Where("geofence_id IN ?", sources).Find(&contents)
 	if result.Error != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching contents")
 		return
@@ -86,6 +112,23 @@ func GetContent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Blocked users can't see the owner's content, and nobody sees content
+	// whose fence is gone
+	var ownerID uint
+	owner := database.DB.Model(&models.Geofence{}).Where("id = ?", content.GeofenceID).Select("user_id").Scan(&ownerID)
+	if owner.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching content")
+		return
+	}
+	if owner.RowsAffected == 0 || socialService.IsBlockedEitherWay(ownerID, viewerID(r)) {
+		utils.RespondWithError(w, http.StatusNotFound, "Content not found")
+		return
+	}
+	if unlocked, err := contentUnlocked(content.GeofenceID, viewerID(r)); err != nil || !unlocked {
+		utils.RespondWithError(w, http.StatusNotFound, "Content not found")
+		return
+	}
+
 	utils.RespondWithSuccess(w, http.StatusOK, content)
 }
 
@@ -121,8 +164,10 @@ func UpdateContent(w http.ResponseWriter, r *http.Request) {
 	existingContent.Type = content.Type
 	existingContent.URL = content.URL
 
-	// Save the updated content
-	saveResult := database.DB.Save(&existingContent)
+	// Save only the editable columns so concurrent reactions don't lose count updates
+	saveResult := database.DB.Model(&existingContent).
+		Select("title", "description", "type", "url").
+		Updates(&existingContent)
 	if saveResult.Error != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating content")
 		return
@@ -159,4 +204,44 @@ func DeleteContent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	utils.RespondWithSuccess(w, http.StatusNoContent, nil)
-}
\ No newline at end of file
+}
+
+// contentUnlocked reports whether the content of a geofence is available to
+// the viewer right now: always for the fence's owner, otherwise only while
+// the fence is active
+func contentUnlocked(geofenceID interface{}, viewerID uint) (bool, error) {
+	var geofence models.Geofence
+	if err := database.DB.First(&geofence, geofenceID).Error; err != nil {
+		return false, err
+	}
+	if viewerID != 0 && geofence.UserID == viewerID {
+		return true, nil
+	}
+	return scheduleService.IsActive(&geofence, time.Now())
+}
+
+// contentSources returns the geofences whose content shows in a geofence:
+// the fence itself and the ancestors cascading their content to it that
+// are unlocked for the viewer
+func contentSources(geofenceID string, viewerID uint) ([]uint, error) {
+	id, err := strconv.ParseUint(geofenceID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []uint{uint(id)}
+	ancestors, err := hierarchyService.CascadingAncestors(uint(id), false)
+	if err != nil {
+		return nil, err
+	}
+	for _, ancestorID := range ancestors {
+		unlocked, err := contentUnlocked(ancestorID, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		if unlocked {
+			sources = append(sources, ancestorID)
+		}
+	}
+	return sources, nil
+}
@@ -0,0 +1,233 @@
+// internal/handlers/export_handler.go
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+var exportService = &services.ExportService{}
+
+// ExportData streams visits, interactions or geofences as CSV or Parquet.
+// Query parameters: format=csv|parquet (default csv), from and to
+// (YYYY-MM-DD, to inclusive, or RFC 3339) and geofence_id=1,2. Exports of
+// more than services.MaxSyncExportRows rows have to be run as a job.
+func ExportData(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var geofenceIDs []uint
+	for _, raw := range splitList(query.Get("geofence_id")) {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid geofence_id")
+			return
+		}
+		geofenceIDs = append(geofenceIDs, uint(id))
+	}
+
+	req, ok := exportRequest(w, r, mux.Vars(r)["dataset"], query.Get("format"), query.Get("from"), query.Get("to"), geofenceIDs)
+	if !ok {
+		return
+	}
+
+	count, err := exportService.Count(req)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error preparing export")
+		return
+	}
+	if count > services.MaxSyncExportRows {
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge,
+			"Export has more than "+strconv.Itoa(services.MaxSyncExportRows)+" rows; create an export job instead")
+		return
+	}
+
+	w.Header().Set("Content-Type", services.ExportContentType(req.Format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+services.ExportFilename(req.Dataset, req.Format)+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure part way can only be logged
+	if _, err := exportService.Write(w, req); err != nil {
+		log.Printf("Export of %s for user %d failed: %v", req.Dataset, req.UserID, err)
+	}
+}
+
+// CreateExportJob starts an export in the background. Body:
+// {"dataset": "visits", "format": "parquet", "from": "2026-01-01",
+// "to": "2026-01-31", "geofence_ids": [1, 2]}
+func CreateExportJob(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Dataset     string `json:"dataset"`
+		Format      string `json:"format"`
+		From        string `json:"from"`
+		To          string `json:"to"`
+		GeofenceIDs []uint `json:"geofence_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	req, ok := exportRequest(w, r, body.Dataset, body.Format, body.From, body.To, body.GeofenceIDs)
+	if !ok {
+		return
+	}
+
+	job, err := exportService.StartJob(req)
+	if err == services.ErrTooManyExports {
+		utils.RespondWithError(w, http.StatusTooManyRequests,
+			"At most "+strconv.Itoa(services.MaxActiveExports)+" exports can run at once")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error starting export")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusAccepted, job)
+}
+
+// GetExportJobs lists the current user's export jobs, newest first
+func GetExportJobs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	p := utils.ParsePagination(r)
+	jobs, total, err := exportService.Jobs(userID, p.PerPage, p.Offset())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching exports")
+		return
+	}
+
+	utils.RespondWithPage(w, jobs, p, total)
+}
+
+// GetExportJob returns the status of one of the current user's export jobs
+func GetExportJob(w http.ResponseWriter, r *http.Request) {
+	userID, jobID, ok := exportJobParams(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := exportService.Job(userID, jobID)
+	if err == services.ErrExportNotFound {
+		utils.RespondWithError(w, http.StatusNotFound, "Export not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching export")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, job)
+}
+
+// DownloadExport sends the file of a finished export job
+func DownloadExport(w http.ResponseWriter, r *http.Request) {
+	userID, jobID, ok := exportJobParams(w, r)
+	if !ok {
+		return
+	}
+
+	job, path, err := exportService.DownloadPath(userID, jobID)
+	switch err {
+	case nil:
+	case services.ErrExportNotReady:
+		utils.RespondWithError(w, http.StatusConflict, "Export is "+job.Status)
+		return
+	case services.ErrExportNotFound:
+		utils.RespondWithError(w, http.StatusNotFound, "Export not found or expired")
+		return
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching export")
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Export not found or expired")
+		return
+	}
+	defer file.Close()
+
+	name := job.Dataset + "-" + strconv.FormatUint(uint64(job.ID), 10) + filepath.Ext(path)
+	w.Header().Set("Content-Type", services.ExportContentType(job.Format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeContent(w, r, name, *job.CompletedAt, file)
+}
+
+// exportRequest builds and validates an export for the current user
+func exportRequest(w http.ResponseWriter, r *http.Request, dataset, format, from, to string, geofenceIDs []uint) (services.ExportRequest, bool) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return services.ExportRequest{}, false
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "is_admin").First(&user, userID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not found")
+		return services.ExportRequest{}, false
+	}
+
+	if format == "" {
+		format = models.ExportFormatCSV
+	}
+	req := services.ExportRequest{
+		UserID:      userID,
+		IsAdmin:     user.IsAdmin,
+		Dataset:     dataset,
+		Format:      format,
+		GeofenceIDs: geofenceIDs,
+	}
+
+	var err error
+	if req.From, req.To, err = parseDateRange(from, to); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "from and to must be dates, from before to")
+		return req, false
+	}
+
+	switch err := exportService.Validate(req); err {
+	case nil:
+		return req, true
+	case services.ErrUnknownDataset:
+		utils.RespondWithError(w, http.StatusBadRequest, "dataset must be visits, interactions or geofences")
+	case services.ErrUnknownFormat:
+		utils.RespondWithError(w, http.StatusBadRequest, "format must be csv or parquet")
+	case services.ErrExportForbidden:
+		utils.RespondWithError(w, http.StatusForbidden, "You can only export your own geofences")
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error preparing export")
+	}
+	return req, false
+}
+
+// exportJobParams reads the current user and the job ID in the URL
+func exportJobParams(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return 0, 0, false
+	}
+
+	jobID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid export ID")
+		return 0, 0, false
+	}
+
+	return userID, uint(jobID), true
+}
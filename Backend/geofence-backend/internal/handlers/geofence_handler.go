@@ -2,15 +2,85 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"geofence/internal/database"
 	"geofence/internal/models"
+	"geofence/internal/services"
 	"geofence/internal/utils"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
+var (
+	viewportService  = &services.ViewportService{}
+	scheduleService  = &services.ScheduleService{}
+	overlapService   = &services.OverlapService{}
+	hierarchyService = &services.HierarchyService{}
+)
+
+// geofenceResponse is a geofence with the user's other fences it overlaps
+type geofenceResponse struct {
+	models.Geofence
+	Overlaps []services.GeofenceOverlap `json:"overlaps,omitempty"`
+}
+
+// checkOverlaps finds the owner's fences that fence overlaps by at least
+// ?overlap_threshold= (0-1, services.DefaultOverlapThreshold by default).
+// With ?reject_overlaps=true it answers 409 itself and reports false if
+// there are any.
+func checkOverlaps(w http.ResponseWriter, r *http.Request, fence models.Geofence) ([]services.GeofenceOverlap, bool) {
+	threshold := services.DefaultOverlapThreshold
+	if value := r.URL.Query().Get("overlap_threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			utils.RespondWithError(w, http.StatusBadRequest, services.ErrInvalidThreshold.Error())
+			return nil, false
+		}
+		threshold = parsed
+	}
+
+	overlaps, err := overlapService.Overlaps(fence, threshold)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error checking overlapping geofences")
+		return nil, false
+	}
+
+	if len(overlaps) > 0 && r.URL.Query().Get("reject_overlaps") == "true" {
+		utils.RespondWithError(w, http.StatusConflict,
+			fmt.Sprintf("Geofence overlaps %q by %.0f%%", overlaps[0].Name, overlaps[0].Ratio*100))
+		return nil, false
+	}
+	return overlaps, true
+}
+
+// checkHierarchy validates a fence's parent and children, answering the
+// request itself and reporting false if they don't fit
+func checkHierarchy(w http.ResponseWriter, r *http.Request, fence models.Geofence) bool {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		userID = fence.UserID
+	}
+
+	err := hierarchyService.ValidateHierarchy(fence, userID)
+	switch err {
+	case nil:
+		return true
+	case services.ErrParentForbidden:
+		utils.RespondWithError(w, http.StatusForbidden, err.Error())
+	case services.ErrParentNotFound, services.ErrHierarchyCycle, services.ErrHierarchyTooDeep,
+		services.ErrOutsideParent, services.ErrChildrenOutside:
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error checking geofence hierarchy")
+	}
+	return false
+}
+
 // CreateGeofence handles the creation of a new geofence
 func CreateGeofence(w http.ResponseWriter, r *http.Request) {
 	var geofence models.Geofence
@@ -25,21 +95,58 @@ func CreateGeofence(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Corridors get their radius from their path
+	if err := services.PrepareGeofence(&geofence); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	if geofence.Radius <= 0 {
 		utils.RespondWithError(w, http.StatusBadRequest, "Radius must be greater than 0")
 		return
 	}
 
-	result := database.DB.Create(&geofence)
-	if result.Error != nil {
+	if err := services.ValidateSchedule(&geofence); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for i := range geofence.Schedule {
+		geofence.Schedule[i].ID = 0
+	}
+
+	// Categories and tags are assigned through their own endpoints
+	geofence.Categories, geofence.Tags = nil, nil
+
+	if !checkHierarchy(w, r, geofence) {
+		return
+	}
+
+	overlaps, ok := checkOverlaps(w, r, geofence)
+	if !ok {
+		return
+	}
+
+	authorID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		authorID = geofence.UserID
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&geofence).Error; err != nil {
+			return err
+		}
+		return revisionService.Record(tx, &geofence, authorID)
+	})
+	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating geofence")
 		return
 	}
 
-	utils.RespondWithSuccess(w, http.StatusCreated, geofence)
+	utils.RespondWithSuccess(w, http.StatusCreated, geofenceResponse{Geofence: geofence, Overlaps: overlaps})
 }
 
-// GetGeofences returns all geofences
+// GetGeofences returns all geofences. With ?bbox=minLng,minLat,maxLng,maxLat
+// it returns the fences in that viewport instead, paged with ?cursor= and
+// ?limit=.
 func GetGeofences(w http.ResponseWriter, r *http.Request) {
 	// Get user_id from query parameter if provided
 	userID := r.URL.Query().Get("user_id")
@@ -47,10 +154,23 @@ func GetGeofences(w http.ResponseWriter, r *http.Request) {
 	var geofences []models.Geofence
 	var result error
 
+	filters, err := taxonomyFilters(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid category filter")
+		return
+	}
+
+	// With a viewport the fences come back a cursor page at a time
+	if r.URL.Query().Get("bbox") != "" {
+		getViewportGeofences(w, r, userID, filters)
+		return
+	}
+
+	db := database.DB.Preload("Categories").Preload("Tags").Preload("Schedule").Scopes(services.VisibleGeofences(viewerID(r)), filters)
 	if userID != "" {
-		result = database.DB.Where("user_id = ?", userID).Find(&geofences).Error
+		result = db.Where("user_id = ?", userID).Find(&geofences).Error
 	} else {
-		result = database.DB.Find(&geofences).Error
+		result = db.Find(&geofences).Error
 	}
 
 	if result != nil {
@@ -61,21 +181,140 @@ func GetGeofences(w http.ResponseWriter, r *http.Request) {
 	utils.RespondWithSuccess(w, http.StatusOK, geofences)
 }
 
+// getViewportGeofences returns the fences whose area intersects the bbox
+// viewport, including ones centred outside it
+func getViewportGeofences(w http.ResponseWriter, r *http.Request, userID string, filters func(*gorm.DB) *gorm.DB) {
+	region, err := parseRegion(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p, err := utils.ParseCursorPagination(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	scopes := []func(*gorm.DB) *gorm.DB{services.VisibleGeofences(viewerID(r)), filters, func(db *gorm.DB) *gorm.DB {
+		db = db.Preload("Categories").Preload("Tags").Preload("Schedule")
+		if userID != "" {
+			db = db.Where("geofences.user_id = ?", userID)
+		}
+		return db
+	}}
+	geofences, next, err := viewportService.Geofences(*region, p.After, p.Limit, scopes...)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching geofences")
+		return
+	}
+
+	nextCursor := ""
+	if next != 0 {
+		nextCursor = utils.EncodeCursor(next)
+	}
+	utils.RespondWithCursorPage(w, geofences, p, nextCursor)
+}
+
 // GetGeofence returns a specific geofence by ID
 func GetGeofence(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
 
 	var geofence models.Geofence
-	result := database.DB.First(&geofence, id)
+	result := database.DB.Preload("Schedule").First(&geofence, id)
 	if result.Error != nil {
 		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
 		return
 	}
 
+	// Blocked users can't see the owner's fences
+	if socialService.IsBlockedEitherWay(geofence.UserID, viewerID(r)) {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return
+	}
+
 	utils.RespondWithSuccess(w, http.StatusOK, geofence)
 }
 
+// RecordGeofenceVisit logs that the current user entered a geofence
+func RecordGeofenceVisit(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var geofence models.Geofence
+	if err := database.DB.First(&geofence, mux.Vars(r)["id"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return
+	}
+
+	if socialService.IsBlockedEitherWay(geofence.UserID, userID) {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return
+	}
+
+	// Entering a fence outside its schedule isn't an event
+	active, err := scheduleService.IsActive(&geofence, time.Now())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error checking geofence schedule")
+		return
+	}
+	if !active {
+		utils.RespondWithError(w, http.StatusConflict, "Geofence is not active")
+		return
+	}
+
+	visit := models.GeofenceVisit{GeofenceID: geofence.ID, UserID: userID, Revision: geofence.Revision}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&visit).Error; err != nil {
+			return err
+		}
+		return groupService.PublishVisitEvent(tx, geofence.ID, models.GroupEventEnter, visit.CreatedAt)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error recording visit")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusCreated, visit)
+}
+
+// RecordGeofenceExit closes the current user's open visit to a geofence
+func RecordGeofenceExit(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var visit models.GeofenceVisit
+	err := database.DB.Where("geofence_id = ? AND user_id = ? AND exited_at IS NULL", mux.Vars(r)["id"], userID).
+		Order("created_at DESC").
+		First(&visit).Error
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "No open visit to this geofence")
+		return
+	}
+
+	now := time.Now()
+	visit.ExitedAt = &now
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&visit).Update("exited_at", now).Error; err != nil {
+			return err
+		}
+		return groupService.PublishVisitEvent(tx, visit.GeofenceID, models.GroupEventExit, now)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error recording exit")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, visit)
+}
+
 // UpdateGeofence updates an existing geofence
 func UpdateGeofence(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
@@ -93,19 +332,49 @@ func UpdateGeofence(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	previous := existingGeofence
+
 	// Update fields
-	existingGeofence.Name = geofence.Name
-	existingGeofence.Description = geofence.Description
-	existingGeofence.Latitude = geofence.Latitude
-	existingGeofence.Longitude = geofence.Longitude
-	existingGeofence.Radius = geofence.Radius
+	services.ApplyGeofenceUpdate(&existingGeofence, geofence)
+
+	if err := services.PrepareGeofence(&existingGeofence); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := services.ValidateSchedule(&existingGeofence); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !checkHierarchy(w, r, existingGeofence) {
+		return
+	}
 
-	if err := database.DB.Save(&existingGeofence).Error; err != nil {
+	overlaps, ok := checkOverlaps(w, r, existingGeofence)
+	if !ok {
+		return
+	}
+
+	authorID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		authorID = existingGeofence.UserID
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// The fence's state before this edit is kept as a revision
+		if err := revisionService.Baseline(tx, &previous); err != nil {
+			return err
+		}
+		existingGeofence.Revision = previous.Revision
+		if err := services.SaveGeofence(tx, &existingGeofence); err != nil {
+			return err
+		}
+		return revisionService.Record(tx, &existingGeofence, authorID)
+	})
+	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating geofence")
 		return
 	}
 
-	utils.RespondWithSuccess(w, http.StatusOK, existingGeofence)
+	utils.RespondWithSuccess(w, http.StatusOK, geofenceResponse{Geofence: existingGeofence, Overlaps: overlaps})
 }
 
 // DeleteGeofence deletes a geofence by ID
@@ -119,7 +388,15 @@ func DeleteGeofence(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := database.DB.Delete(&geofence).Error; err != nil {
+	// Its children move up to its parent; it goes to the trash with its
+	// content and shares
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := hierarchyService.Detach(tx, geofence); err != nil {
+			return err
+		}
+		return trashService.Trash(tx, &geofence)
+	})
+	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting geofence")
 		return
 	}
@@ -127,6 +404,9 @@ func DeleteGeofence(w http.ResponseWriter, r *http.Request) {
 	utils.RespondWithSuccess(w, http.StatusNoContent, nil)
 }
 
+// nearbyRadiusKm is how far GetNearbyGeofences looks, about 0.1° of latitude
+const nearbyRadiusKm = 11.1
+
 // GetNearbyGeofences returns geofences near specified coordinates
 func GetNearbyGeofences(w http.ResponseWriter, r *http.Request) {
 	lat, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
@@ -141,24 +421,77 @@ func GetNearbyGeofences(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Simple range check for nearby geofences
-	// In a production environment, you would use more sophisticated spatial queries
+	at, err := parseActiveAt(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Fences centred within nearbyRadiusKm, using PostGIS when it's there
 	var geofences []models.Geofence
-	result := database.DB.Where(
-		"latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?",
-		lat-0.1, lat+0.1, lng-0.1, lng+0.1,
-	).Find(&geofences)
+	near := services.GeoFilter{Latitude: lat, Longitude: lng, RadiusKm: nearbyRadiusKm}
+	result := database.DB.Preload("Schedule").
+		Scopes(services.VisibleGeofences(viewerID(r)), services.WithinBoundingBox("geofences", near)).
+		Find(&geofences)
 
 	if result.Error != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching nearby geofences")
 		return
 	}
+	geofences = services.GeofencesWithin(geofences, near)
 
-	utils.RespondWithSuccess(w, http.StatusOK, geofences)
+	// Fences outside their schedule aren't there
+	utils.RespondWithSuccess(w, http.StatusOK, services.ActiveGeofences(geofences, at))
+}
+
+// GetGeofenceActivity reports whether a geofence is active now or at ?at=
+// (RFC 3339)
+func GetGeofenceActivity(w http.ResponseWriter, r *http.Request) {
+	at, err := parseActiveAt(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var geofence models.Geofence
+	if err := database.DB.First(&geofence, mux.Vars(r)["id"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return
+	}
+	if socialService.IsBlockedEitherWay(geofence.UserID, viewerID(r)) {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return
+	}
+
+	active, err := scheduleService.IsActive(&geofence, at)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error checking geofence schedule")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, map[string]interface{}{
+		"geofence_id": geofence.ID,
+		"at":          at,
+		"active":      active,
+	})
+}
+
+var errInvalidActiveAt = errors.New("at must be an RFC 3339 time")
+
+// parseActiveAt reads ?at= (RFC 3339), defaulting to now
+func parseActiveAt(r *http.Request) (time.Time, error) {
+	value := r.URL.Query().Get("at")
+	if value == "" {
+		return time.Now(), nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errInvalidActiveAt
+	}
+	return at, nil
 }
-// Add this to internal/handlers/geofence_handler.go
 
-// SearchGeofences searches for geofences by name or description
+// SearchGeofences searches for geofences by name or description, best matches first
 func SearchGeofences(w http.ResponseWriter, r *http.Request) {
 	// Get search query from URL parameters
 	query := r.URL.Query().Get("q")
@@ -168,7 +501,7 @@ func SearchGeofences(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var geofences []models.Geofence
-	result := database.DB.Where("name LIKE ? OR description LIKE ?", "%"+query+"%", "%"+query+"%").Find(&geofences)
+	result := database.DB.Scopes(services.MatchGeofences(query), services.VisibleGeofences(viewerID(r))).Find(&geofences)
 	if result.Error != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error searching geofences")
 		return
@@ -0,0 +1,62 @@
+// internal/handlers/geojson_handler.go
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+)
+
+var geoJSONService = &services.GeoJSONService{}
+
+// ExportGeofencesGeoJSON returns the geofences the viewer can see as a
+// GeoJSON FeatureCollection, optionally only those of ?user_id=
+func ExportGeofencesGeoJSON(w http.ResponseWriter, r *http.Request) {
+	db := database.DB.Scopes(services.VisibleGeofences(viewerID(r))).Order("id")
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		db = db.Where("user_id = ?", userID)
+	}
+
+	var geofences []models.Geofence
+	if err := db.Find(&geofences).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching geofences")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(geoJSONService.Export(geofences))
+}
+
+// ImportGeofencesGeoJSON creates the current user's geofences from a GeoJSON
+// FeatureCollection of Points (with a radius) and LineStrings (with a
+// buffer_width). Nothing is created if any feature is invalid.
+func ImportGeofencesGeoJSON(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var collection utils.GeoJSONFeatureCollection
+	if err := json.NewDecoder(r.Body).Decode(&collection); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	geofences, err := geoJSONService.Import(userID, collection)
+	if err != nil {
+		if err == services.ErrTooManyFeatures {
+			utils.RespondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusCreated, geofences)
+}
@@ -0,0 +1,440 @@
+// internal/handlers/group_handler.go
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var groupService = &services.GroupService{}
+
+// groupRequest is the body for creating and updating groups
+type groupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	GeofenceIDs []uint `json:"geofence_ids"`
+}
+
+// loadGroup loads the group in the URL for the current user. Only its owner
+// gets it unless shared is true, when users it's shared with do too.
+func loadGroup(w http.ResponseWriter, r *http.Request, shared bool) (*models.GeofenceGroup, uint, bool) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return nil, 0, false
+	}
+
+	var group models.GeofenceGroup
+	if err := database.DB.First(&group, mux.Vars(r)["id"]).Error; err != nil || !groupService.CanView(group, userID) {
+		utils.RespondWithError(w, http.StatusNotFound, "Group not found")
+		return nil, 0, false
+	}
+	if !shared && group.UserID != userID {
+		utils.RespondWithError(w, http.StatusForbidden, "Only the owner can manage this group")
+		return nil, 0, false
+	}
+
+	return &group, userID, true
+}
+
+// respondWithGroupError maps group service errors to responses
+func respondWithGroupError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case services.ErrGroupGeofenceNotFound:
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+	case services.ErrGroupMemberForbidden:
+		utils.RespondWithError(w, http.StatusForbidden, err.Error())
+	case services.ErrTooManyGroupMembers:
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case services.ErrInvalidSharePermission, services.ErrInvalidGroupEvents:
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, message)
+	}
+}
+
+// CreateGroup creates a group of the current user's geofences. Body:
+// {"name": "...", "description": "...", "geofence_ids": [...]}
+func CreateGroup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req groupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Name == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	group := models.GeofenceGroup{Name: req.Name, Description: req.Description, UserID: userID}
+	if err := database.DB.Create(&group).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating group")
+		return
+	}
+	if err := groupService.AddMembers(&group, req.GeofenceIDs); err != nil {
+		database.DB.Unscoped().Delete(&group)
+		respondWithGroupError(w, err, "Error creating group")
+		return
+	}
+
+	group.Geofences, _ = groupService.Members(group.ID)
+	utils.RespondWithSuccess(w, http.StatusCreated, group)
+}
+
+// GetGroups returns the current user's groups and the groups shared with them
+func GetGroups(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	groups := []models.GeofenceGroup{}
+	shared := database.DB.Model(&models.GeofenceGroupShare{}).Select("group_id").Where("user_id = ?", userID)
+	if err := database.DB.Where("user_id = ? OR id IN (?)", userID, shared).Order("id").Find(&groups).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching groups")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, groups)
+}
+
+// GetGroup returns a group with the fences in it the user can see
+func GetGroup(w http.ResponseWriter, r *http.Request) {
+	group, userID, ok := loadGroup(w, r, true)
+	if !ok {
+		return
+	}
+
+	members, err := groupService.Members(group.ID, services.VisibleGeofences(userID))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching group")
+		return
+	}
+	group.Geofences = members
+
+	utils.RespondWithSuccess(w, http.StatusOK, group)
+}
+
+// UpdateGroup renames a group or changes its description
+func UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	group, _, ok := loadGroup(w, r, false)
+	if !ok {
+		return
+	}
+
+	var req groupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Name == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	group.Name, group.Description = req.Name, req.Description
+	if err := database.DB.Model(group).Select("name", "description").Updates(group).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating group")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, group)
+}
+
+// DeleteGroup deletes a group; its fences stay
+func DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	group, _, ok := loadGroup(w, r, false)
+	if !ok {
+		return
+	}
+
+	if err := groupService.Delete(group); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting group")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusNoContent, nil)
+}
+
+// AddGroupGeofences adds fences to a group. Body: {"geofence_ids": [...]}
+func AddGroupGeofences(w http.ResponseWriter, r *http.Request) {
+	group, _, ok := loadGroup(w, r, false)
+	if !ok {
+		return
+	}
+
+	var req groupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := groupService.AddMembers(group, req.GeofenceIDs); err != nil {
+		respondWithGroupError(w, err, "Error adding geofences")
+		return
+	}
+
+	group.Geofences, _ = groupService.Members(group.ID)
+	utils.RespondWithSuccess(w, http.StatusOK, group)
+}
+
+// RemoveGroupGeofence takes a fence out of a group
+func RemoveGroupGeofence(w http.ResponseWriter, r *http.Request) {
+	group, _, ok := loadGroup(w, r, false)
+	if !ok {
+		return
+	}
+
+	var geofence models.Geofence
+	if err := database.DB.First(&geofence, mux.Vars(r)["geofenceId"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return
+	}
+
+	if err := groupService.RemoveMember(group, geofence.ID); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error removing geofence")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusNoContent, nil)
+}
+
+// ShareGroup shares every fence in a group with a user, including fences
+// added later. Body: {"user_id": 2, "permission": "view"}
+func ShareGroup(w http.ResponseWriter, r *http.Request) {
+	group, userID, ok := loadGroup(w, r, false)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UserID     uint   `json:"user_id"`
+		Permission string `json:"permission"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.UserID == userID {
+		utils.RespondWithError(w, http.StatusBadRequest, "You can't share a group with yourself")
+		return
+	}
+
+	var target models.User
+	if err := database.DB.First(&target, req.UserID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Target user not found")
+		return
+	}
+
+	share, err := groupService.Share(*group, target.ID, req.Permission)
+	if err != nil {
+		respondWithGroupError(w, err, "Error sharing group")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, share)
+}
+
+// EnableGroup enables every fence in a group
+func EnableGroup(w http.ResponseWriter, r *http.Request) {
+	setGroupDisabled(w, r, false)
+}
+
+// DisableGroup disables every fence in a group
+func DisableGroup(w http.ResponseWriter, r *http.Request) {
+	setGroupDisabled(w, r, true)
+}
+
+func setGroupDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	group, userID, ok := loadGroup(w, r, false)
+	if !ok {
+		return
+	}
+
+	updated, err := groupService.SetDisabled(group.ID, userID, disabled)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating geofences")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, map[string]interface{}{
+		"group_id": group.ID,
+		"disabled": disabled,
+		"updated":  updated,
+	})
+}
+
+// ExportGroupGeoJSON returns a group's fences as a GeoJSON FeatureCollection
+func ExportGroupGeoJSON(w http.ResponseWriter, r *http.Request) {
+	group, userID, ok := loadGroup(w, r, true)
+	if !ok {
+		return
+	}
+
+	members, err := groupService.Members(group.ID, services.VisibleGeofences(userID))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching geofences")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(geoJSONService.Export(members))
+}
+
+// SubscribeToGroup subscribes the current user to enter and/or exit events
+// at a group's fences. Body: {"events": ["enter", "exit"]}
+func SubscribeToGroup(w http.ResponseWriter, r *http.Request) {
+	group, userID, ok := loadGroup(w, r, true)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Events []string `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	subscription, err := groupService.Subscribe(group.ID, userID, req.Events)
+	if err != nil {
+		respondWithGroupError(w, err, "Error creating subscription")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusCreated, subscription)
+}
+
+// GetGroupSubscriptions returns the current user's subscriptions to a group
+func GetGroupSubscriptions(w http.ResponseWriter, r *http.Request) {
+	group, userID, ok := loadGroup(w, r, true)
+	if !ok {
+		return
+	}
+
+	subscriptions := []models.GroupSubscription{}
+	if err := database.DB.Where("group_id = ? AND user_id = ?", group.ID, userID).Order("id").Find(&subscriptions).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching subscriptions")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, subscriptions)
+}
+
+// DeleteGroupSubscription cancels one of the current user's subscriptions
+// and drops its undelivered events
+func DeleteGroupSubscription(w http.ResponseWriter, r *http.Request) {
+	group, userID, ok := loadGroup(w, r, true)
+	if !ok {
+		return
+	}
+
+	var subscription models.GroupSubscription
+	err := database.DB.Where("id = ? AND group_id = ? AND user_id = ?", mux.Vars(r)["subscriptionId"], group.ID, userID).First(&subscription).Error
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Subscription not found")
+		return
+	}
+
+	database.DB.Where("subscription_id = ?", subscription.ID).Delete(&models.GroupEvent{})
+	if err := database.DB.Delete(&subscription).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting subscription")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusNoContent, nil)
+}
+
+// GetGroupEvents returns the events delivered to the current user's
+// subscriptions to a group, oldest first, paged with ?cursor= and ?limit=
+func GetGroupEvents(w http.ResponseWriter, r *http.Request) {
+	group, userID, ok := loadGroup(w, r, true)
+	if !ok {
+		return
+	}
+
+	p, err := utils.ParseCursorPagination(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events, next, err := groupService.Events(group.ID, userID, p.After, p.Limit)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching events")
+		return
+	}
+
+	nextCursor := ""
+	if next != 0 {
+		nextCursor = utils.EncodeCursor(next)
+	}
+	utils.RespondWithCursorPage(w, events, p, nextCursor)
+}
+
+// GetGroupAnalytics returns visit analytics across a group's fences to its
+// owner or an admin. The owner only sees the fences they own; a fence they
+// could edit when it was added may since have been unshared. Takes the same
+// parameters as GetGeofenceAnalytics.
+func GetGroupAnalytics(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var group models.GeofenceGroup
+	if err := database.DB.First(&group, mux.Vars(r)["id"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+	allowed, admin := ownerOrAdmin(group.UserID, userID)
+	if !allowed {
+		utils.RespondWithError(w, http.StatusForbidden, "Only the owner can view analytics for this group")
+		return
+	}
+
+	rng, ok := parseMetricsRange(w, r)
+	if !ok {
+		return
+	}
+
+	var scopes []func(*gorm.DB) *gorm.DB
+	if !admin {
+		scopes = append(scopes, services.OwnedGeofences(userID))
+	}
+	geofenceIDs, err := groupService.MemberIDs(group.ID, scopes...)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error calculating analytics")
+		return
+	}
+
+	metrics, err := metricsService.GetGroupMetrics(group.ID, geofenceIDs, rng)
+	if err == services.ErrInvalidMetricsRange {
+		utils.RespondWithError(w, http.StatusBadRequest, "from must be before to, at most a year apart")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error calculating analytics")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, metrics)
+}
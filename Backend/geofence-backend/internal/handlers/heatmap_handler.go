@@ -0,0 +1,134 @@
+// internal/handlers/heatmap_handler.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+var heatmapService = &services.HeatmapService{}
+
+// GetDensity counts visits or fences per grid cell for map display.
+// Query parameters: layer=visits|geofences (default visits),
+// grid=tile|geohash (default tile), zoom (tile grid, default 10) or
+// precision (geohash grid, default 5), from and to, and a region given as
+// ?bbox=minLng,minLat,maxLng,maxLat or ?lat=&lng=&radius= (km).
+func GetDensity(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	opts, ok := heatmapOptions(w, r)
+	if !ok {
+		return
+	}
+
+	region, err := parseRegion(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.Region = region
+
+	grid := query.Get("grid")
+	if grid == "" {
+		grid = services.DensityGridTile
+	}
+	levelParam, level := "zoom", 10
+	if grid == services.DensityGridGeohash {
+		levelParam, level = "precision", 5
+	}
+	if raw := query.Get(levelParam); raw != "" {
+		if level, err = strconv.Atoi(raw); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid "+levelParam)
+			return
+		}
+	}
+
+	cells, err := heatmapService.Density(opts, grid, level)
+	switch err {
+	case nil:
+	case services.ErrUnknownGrid:
+		utils.RespondWithError(w, http.StatusBadRequest, "grid must be tile or geohash")
+		return
+	case services.ErrInvalidLevel:
+		utils.RespondWithError(w, http.StatusBadRequest, "zoom must be 0-"+strconv.Itoa(services.MaxTileZoom)+
+			" and precision 1-"+strconv.Itoa(services.MaxGeohashPrecision))
+		return
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error calculating density")
+		return
+	}
+
+	var total int64
+	for _, cell := range cells {
+		total += cell.Count
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, map[string]interface{}{
+		"layer": opts.Layer,
+		"grid":  grid,
+		"level": level,
+		"total": total,
+		"cells": cells,
+	})
+}
+
+// GetHeatmapTile renders a 256x256 PNG heatmap tile at /tiles/{z}/{x}/{y}.png.
+// Supports ?layer=visits|geofences (default visits) and from and to.
+func GetHeatmapTile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	z, zErr := strconv.Atoi(vars["z"])
+	x, xErr := strconv.Atoi(vars["x"])
+	y, yErr := strconv.Atoi(vars["y"])
+	tile := services.Tile{Z: z, X: x, Y: y}
+	if zErr != nil || xErr != nil || yErr != nil || !tile.Valid() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tile coordinates")
+		return
+	}
+
+	opts, ok := heatmapOptions(w, r)
+	if !ok {
+		return
+	}
+
+	png, err := heatmapService.RenderTile(opts, tile)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error rendering tile")
+		return
+	}
+
+	// Tiles depend on who's looking when some owners are hidden from them
+	cacheControl := "public, max-age=300"
+	if opts.ViewerID != 0 {
+		cacheControl = "private, max-age=300"
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Write(png)
+}
+
+// heatmapOptions reads the layer and date range shared by density and tiles
+func heatmapOptions(w http.ResponseWriter, r *http.Request) (services.HeatmapOptions, bool) {
+	query := r.URL.Query()
+	opts := services.HeatmapOptions{Layer: query.Get("layer"), ViewerID: viewerID(r)}
+
+	if opts.Layer == "" {
+		opts.Layer = services.HeatmapLayerVisits
+	}
+	if opts.Layer != services.HeatmapLayerVisits && opts.Layer != services.HeatmapLayerGeofences {
+		utils.RespondWithError(w, http.StatusBadRequest, "layer must be visits or geofences")
+		return opts, false
+	}
+
+	var err error
+	if opts.From, opts.To, err = parseDateRange(query.Get("from"), query.Get("to")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "from and to must be dates, from before to")
+		return opts, false
+	}
+
+	return opts, true
+}
@@ -0,0 +1,128 @@
+// internal/handlers/hierarchy_handler.go
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// GetGeofenceAncestors returns the fences a geofence is nested in, from the
+// root down to its parent
+func GetGeofenceAncestors(w http.ResponseWriter, r *http.Request) {
+	var geofence models.Geofence
+	err := database.DB.Scopes(services.VisibleGeofences(viewerID(r))).First(&geofence, mux.Vars(r)["id"]).Error
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return
+	}
+
+	// Fences the viewer can't see are left out of the path
+	ancestors, err := hierarchyService.VisibleAncestors(geofence.ID, viewerID(r))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching ancestors")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, ancestors)
+}
+
+// GetGeofenceDescendants returns the fences nested in a geofence level by
+// level, down to ?depth= levels (all of them by default)
+func GetGeofenceDescendants(w http.ResponseWriter, r *http.Request) {
+	var geofence models.Geofence
+	err := database.DB.Scopes(services.VisibleGeofences(viewerID(r))).First(&geofence, mux.Vars(r)["id"]).Error
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return
+	}
+
+	depth := 0
+	if value := r.URL.Query().Get("depth"); value != "" {
+		if depth, err = strconv.Atoi(value); err != nil || depth < 1 {
+			utils.RespondWithError(w, http.StatusBadRequest, "depth must be a positive number")
+			return
+		}
+	}
+
+	descendants, err := hierarchyService.Descendants(geofence.ID, depth, services.VisibleGeofences(viewerID(r)))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching descendants")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, descendants)
+}
+
+// LocateGeofences returns the active fences containing ?lat=&lng=, innermost
+// first, each with its full hierarchy path. ?at= (RFC 3339) checks another
+// time than now; ?altitude=&vertical_accuracy= or ?floor= check fences with
+// an altitude band in 3D.
+func LocateGeofences(w http.ResponseWriter, r *http.Request) {
+	lat, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid latitude parameter")
+		return
+	}
+
+	lng, err := strconv.ParseFloat(r.URL.Query().Get("lng"), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid longitude parameter")
+		return
+	}
+
+	at, err := parseActiveAt(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fix, err := parseAltitudeFix(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	matches, err := hierarchyService.Locate(lat, lng, fix, viewerID(r), at)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error locating geofences")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, matches)
+}
+
+var errInvalidAltitudeFix = errors.New("altitude and vertical_accuracy must be numbers and floor a whole number")
+
+// parseAltitudeFix reads the optional ?altitude=, ?vertical_accuracy= and
+// ?floor= parameters
+func parseAltitudeFix(r *http.Request) (services.AltitudeFix, error) {
+	var fix services.AltitudeFix
+	query := r.URL.Query()
+	for name, target := range map[string]**float64{"altitude": &fix.Altitude, "vertical_accuracy": &fix.VerticalAccuracy} {
+		if query.Get(name) == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(query.Get(name), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return fix, errInvalidAltitudeFix
+		}
+		*target = &value
+	}
+	if query.Get("floor") != "" {
+		floor, err := strconv.Atoi(query.Get("floor"))
+		if err != nil {
+			return fix, errInvalidAltitudeFix
+		}
+		fix.Floor = &floor
+	}
+	return fix, nil
+}
@@ -0,0 +1,40 @@
+// internal/handlers/location_handler.go
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"geofence/internal/services"
+	"geofence/internal/utils"
+)
+
+var locationService = &services.LocationService{}
+
+// IngestLocation takes the current user's position and returns the fences
+// they entered and left, including corridors they went off route from
+func IngestLocation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var update services.LocationUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if update.Latitude < -90 || update.Latitude > 90 || update.Longitude < -180 || update.Longitude > 180 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid coordinates")
+		return
+	}
+
+	result, err := locationService.Ingest(userID, update)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error recording location")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, result)
+}
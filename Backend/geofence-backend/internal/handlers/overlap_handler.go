@@ -0,0 +1,80 @@
+// internal/handlers/overlap_handler.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// GetGeofenceOverlaps returns the owner's other fences a geofence overlaps
+// by at least ?overlap_threshold= (0-1) of the smaller fence
+func GetGeofenceOverlaps(w http.ResponseWriter, r *http.Request) {
+	var geofence models.Geofence
+	err := database.DB.Scopes(services.VisibleGeofences(viewerID(r))).First(&geofence, mux.Vars(r)["id"]).Error
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return
+	}
+
+	threshold := services.DefaultOverlapThreshold
+	if value := r.URL.Query().Get("overlap_threshold"); value != "" {
+		if threshold, err = strconv.ParseFloat(value, 64); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, services.ErrInvalidThreshold.Error())
+			return
+		}
+	}
+
+	overlaps, err := overlapService.Overlaps(geofence, threshold)
+	if err == services.ErrInvalidThreshold {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error checking overlapping geofences")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, overlaps)
+}
+
+// CombineGeofences returns the union, intersection or difference of a
+// geofence and the one given by ?with= as GeoJSON polygon geometry. The
+// difference is the first fence minus the second.
+func CombineGeofences(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	with := r.URL.Query().Get("with")
+	if with == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "with is required")
+		return
+	}
+
+	var fences []models.Geofence
+	for _, id := range []string{vars["id"], with} {
+		var geofence models.Geofence
+		err := database.DB.Scopes(services.VisibleGeofences(viewerID(r))).First(&geofence, id).Error
+		if err != nil {
+			utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+			return
+		}
+		fences = append(fences, geofence)
+	}
+
+	shape, err := overlapService.Combine(fences[0], fences[1], vars["operation"])
+	if err == services.ErrUnknownSetOperation {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error combining geofences")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, shape)
+}
@@ -3,25 +3,11 @@ package handlers
 import (
 	"encoding/json"
 	"geofence/internal/database"
+	"geofence/internal/models"
 	"geofence/internal/utils"
 	"net/http"
-	"time"
 )
 
-// UserPreferences represents user preferences
-type UserPreferences struct {
-	ID               uint      `json:"id" gorm:"primaryKey"`
-	UserID           uint      `json:"user_id" gorm:"uniqueIndex"`
-	Language         string    `json:"language" gorm:"default:'en'"`
-	DistanceUnit     string    `json:"distance_unit" gorm:"default:'km'"`
-	TemperatureUnit  string    `json:"temperature_unit" gorm:"default:'celsius'"`
-	NotificationsEnabled bool   `json:"notifications_enabled" gorm:"default:true"`
-	DarkMode         bool      `json:"dark_mode" gorm:"default:false"`
-	AutoCheckIn      bool      `json:"auto_check_in" gorm:"default:true"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
-}
-
 // GetUserPreferences returns the preferences for the current user
 func GetUserPreferences(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
@@ -32,21 +18,21 @@ func GetUserPreferences(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Find user preferences
-	var preferences UserPreferences
+	var preferences models.UserPreference
 	result := database.DB.Where("user_id = ?", userID).First(&preferences)
 	
 	// If preferences don't exist, create default preferences
 	if result.Error != nil {
-		preferences = UserPreferences{
+		preferences = models.UserPreference{
 			UserID:               userID,
 			Language:             "en",
 			DistanceUnit:         "km",
 			TemperatureUnit:      "celsius",
 			NotificationsEnabled: true,
+			DefaultRadius:        500,
+			Theme:                "light",
 			DarkMode:             false,
 			AutoCheckIn:          true,
-			CreatedAt:            time.Now(),
-			UpdatedAt:            time.Now(),
 		}
 		
 		if err := database.DB.Create(&preferences).Error; err != nil {
@@ -68,21 +54,20 @@ func UpdateUserPreferences(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Parse the request body
-	var preferences UserPreferences
+	var preferences models.UserPreference
 	if err := json.NewDecoder(r.Body).Decode(&preferences); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 	
 	// Find existing preferences
-	var existingPreferences UserPreferences
+	var existingPreferences models.UserPreference
 	result := database.DB.Where("user_id = ?", userID).First(&existingPreferences)
 	
 	if result.Error != nil {
 		// Create new preferences
+		preferences.ID = 0
 		preferences.UserID = userID
-		preferences.CreatedAt = time.Now()
-		preferences.UpdatedAt = time.Now()
 		
 		if err := database.DB.Create(&preferences).Error; err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Error creating preferences")
@@ -96,7 +81,10 @@ func UpdateUserPreferences(w http.ResponseWriter, r *http.Request) {
 		existingPreferences.NotificationsEnabled = preferences.NotificationsEnabled
 		existingPreferences.DarkMode = preferences.DarkMode
 		existingPreferences.AutoCheckIn = preferences.AutoCheckIn
-		existingPreferences.UpdatedAt = time.Now()
+		existingPreferences.Theme = preferences.Theme
+		if preferences.DefaultRadius > 0 {
+			existingPreferences.DefaultRadius = preferences.DefaultRadius
+		}
 		
 		if err := database.DB.Save(&existingPreferences).Error; err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Error updating preferences")
@@ -0,0 +1,163 @@
+// internal/handlers/reaction_handler.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// ContentWithReactions is a content item annotated with the caller's own reactions
+type ContentWithReactions struct {
+	models.Content
+	IsLiked     bool `json:"is_liked"`
+	IsFavorited bool `json:"is_favorited"`
+	IsReposted  bool `json:"is_reposted"`
+}
+
+var reactionService = &services.ReactionService{}
+
+// LikeContent likes a content item for the current user
+func LikeContent(w http.ResponseWriter, r *http.Request) {
+	handleReaction(w, r, models.InteractionLike, true)
+}
+
+// UnlikeContent removes the current user's like from a content item
+func UnlikeContent(w http.ResponseWriter, r *http.Request) {
+	handleReaction(w, r, models.InteractionLike, false)
+}
+
+// FavoriteContent adds a content item to the current user's favorites
+func FavoriteContent(w http.ResponseWriter, r *http.Request) {
+	handleReaction(w, r, models.InteractionFavorite, true)
+}
+
+// UnfavoriteContent removes a content item from the current user's favorites
+func UnfavoriteContent(w http.ResponseWriter, r *http.Request) {
+	handleReaction(w, r, models.InteractionFavorite, false)
+}
+
+// RepostContent reposts a content item to the current user's profile
+func RepostContent(w http.ResponseWriter, r *http.Request) {
+	handleReaction(w, r, models.InteractionRepost, true)
+}
+
+// UnrepostContent removes a repost from the current user's profile
+func UnrepostContent(w http.ResponseWriter, r *http.Request) {
+	handleReaction(w, r, models.InteractionRepost, false)
+}
+
+// RecordContentView logs a view of a content item by the current user
+func RecordContentView(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	contentID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid content ID")
+		return
+	}
+
+	err = reactionService.RecordView(userID, uint(contentID))
+	if err == services.ErrContentNotFound {
+		utils.RespondWithError(w, http.StatusNotFound, "Content not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error recording view")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusNoContent, nil)
+}
+
+// GetUserLikedContent returns the content a user has liked
+func GetUserLikedContent(w http.ResponseWriter, r *http.Request) {
+	listReactedContent(w, r, models.InteractionLike)
+}
+
+// GetUserFavorites returns the content a user has favorited
+func GetUserFavorites(w http.ResponseWriter, r *http.Request) {
+	listReactedContent(w, r, models.InteractionFavorite)
+}
+
+// GetUserReposts returns the content a user has reposted
+func GetUserReposts(w http.ResponseWriter, r *http.Request) {
+	listReactedContent(w, r, models.InteractionRepost)
+}
+
+func handleReaction(w http.ResponseWriter, r *http.Request, reactionType string, add bool) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	contentID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid content ID")
+		return
+	}
+
+	var content *models.Content
+	if add {
+		content, err = reactionService.AddReaction(userID, uint(contentID), reactionType)
+	} else {
+		content, err = reactionService.RemoveReaction(userID, uint(contentID), reactionType)
+	}
+
+	if err == services.ErrContentNotFound {
+		utils.RespondWithError(w, http.StatusNotFound, "Content not found")
+		return
+	}
+	if err == services.ErrBlocked {
+		utils.RespondWithError(w, http.StatusForbidden, "You can't interact with this content")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating reaction")
+		return
+	}
+
+	reacted, err := reactionService.HasReacted(userID, content.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching reactions")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, ContentWithReactions{
+		Content:     *content,
+		IsLiked:     reacted[models.InteractionLike],
+		IsFavorited: reacted[models.InteractionFavorite],
+		IsReposted:  reacted[models.InteractionRepost],
+	})
+}
+
+func listReactedContent(w http.ResponseWriter, r *http.Request, reactionType string) {
+	userID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	page := utils.ParsePagination(r)
+	contents, total, err := reactionService.ListReactedContent(uint(userID), viewerID(r), reactionType, page.PerPage, page.Offset())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching content")
+		return
+	}
+
+	if contents == nil {
+		contents = []models.Content{}
+	}
+
+	utils.RespondWithPage(w, contents, page, total)
+}
@@ -0,0 +1,46 @@
+// internal/handlers/recommendation_handler.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"geofence/internal/services"
+	"geofence/internal/utils"
+)
+
+var recommendationService = &services.ContentRecommendationService{}
+
+// GetRecommendations returns content recommended for the current user, each
+// with a reason. Sending ?lat=&lng= favours content near that point.
+func GetRecommendations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	opts := services.RecommendationOptions{UserID: userID, Limit: 20}
+	if val, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && val > 0 && val <= 100 {
+		opts.Limit = val
+	}
+
+	lat, lng := r.URL.Query().Get("lat"), r.URL.Query().Get("lng")
+	if lat != "" || lng != "" {
+		latitude, latErr := strconv.ParseFloat(lat, 64)
+		longitude, lngErr := strconv.ParseFloat(lng, 64)
+		if latErr != nil || lngErr != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid coordinates")
+			return
+		}
+		opts.Latitude, opts.Longitude = &latitude, &longitude
+	}
+
+	recommendations, err := recommendationService.Recommend(opts)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching recommendations")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, recommendations)
+}
@@ -0,0 +1,158 @@
+// internal/handlers/revision_handler.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var revisionService = &services.RevisionService{}
+
+// visibleGeofence loads a geofence the viewer can see, answering the request
+// itself if there's none
+func visibleGeofence(w http.ResponseWriter, r *http.Request) (*models.Geofence, bool) {
+	var geofence models.Geofence
+	err := database.DB.Scopes(services.VisibleGeofences(viewerID(r))).First(&geofence, mux.Vars(r)["id"]).Error
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return nil, false
+	}
+	return &geofence, true
+}
+
+// GetGeofenceRevisions returns a geofence's revision history, newest first
+func GetGeofenceRevisions(w http.ResponseWriter, r *http.Request) {
+	geofence, ok := visibleGeofence(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := revisionService.List(geofence.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching revisions")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, revisions)
+}
+
+// GetGeofenceRevision returns one revision of a geofence
+func GetGeofenceRevision(w http.ResponseWriter, r *http.Request) {
+	geofence, ok := visibleGeofence(w, r)
+	if !ok {
+		return
+	}
+
+	number, err := strconv.Atoi(mux.Vars(r)["revision"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid revision")
+		return
+	}
+
+	revision, err := revisionService.Get(geofence.ID, number)
+	if err == services.ErrRevisionNotFound {
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching revision")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, revision)
+}
+
+// DiffGeofenceRevisions returns the fields that changed between the
+// revisions ?from= and ?to= of a geofence
+func DiffGeofenceRevisions(w http.ResponseWriter, r *http.Request) {
+	geofence, ok := visibleGeofence(w, r)
+	if !ok {
+		return
+	}
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid from revision")
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid to revision")
+		return
+	}
+
+	diff, err := revisionService.Diff(geofence.ID, from, to)
+	if err == services.ErrRevisionNotFound {
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error comparing revisions")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, diff)
+}
+
+// RestoreGeofenceRevision puts an old revision's geometry and metadata back
+// on a geofence. The restored state becomes a new revision; the history
+// itself isn't changed.
+func RestoreGeofenceRevision(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	geofence, ok := editableGeofence(w, r, vars["id"])
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(uint)
+
+	number, err := strconv.Atoi(vars["revision"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid revision")
+		return
+	}
+
+	revision, err := revisionService.Get(geofence.ID, number)
+	if err == services.ErrRevisionNotFound {
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching revision")
+		return
+	}
+
+	revisionService.Restore(geofence, *revision)
+	if err := services.PrepareGeofence(geofence); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !checkHierarchy(w, r, *geofence) {
+		return
+	}
+
+	overlaps, ok := checkOverlaps(w, r, *geofence)
+	if !ok {
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Schedule").Save(geofence).Error; err != nil {
+			return err
+		}
+		return revisionService.Record(tx, geofence, userID)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error restoring revision")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, geofenceResponse{Geofence: *geofence, Overlaps: overlaps})
+}
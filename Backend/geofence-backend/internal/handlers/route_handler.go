@@ -0,0 +1,107 @@
+// internal/handlers/route_handler.go
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+)
+
+var routeIntersectionService = &services.RouteIntersectionService{}
+
+var errInvalidRouteBody = errors.New("send an encoded polyline as {\"polyline\": ...} or a GeoJSON LineString")
+
+// intersectRouteRequest is a route as an encoded polyline (with an optional
+// precision, 5 by default), a GeoJSON LineString geometry or a Feature with
+// one
+type intersectRouteRequest struct {
+	Polyline    string                 `json:"polyline"`
+	Precision   int                    `json:"precision"`
+	Type        string                 `json:"type"`
+	Coordinates json.RawMessage        `json:"coordinates"`
+	Geometry    *utils.GeoJSONGeometry `json:"geometry"`
+}
+
+// route returns the request's route as points
+func (req intersectRouteRequest) route() (models.Polyline, error) {
+	var route models.Polyline
+
+	if req.Polyline != "" {
+		precision := req.Precision
+		if precision == 0 {
+			precision = utils.DefaultPolylinePrecision
+		}
+		if precision < 0 || precision > 10 {
+			return nil, errInvalidRouteBody
+		}
+		points, err := utils.DecodePolyline(req.Polyline, precision)
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range points {
+			route = append(route, models.GeoPoint{Latitude: point[0], Longitude: point[1]})
+		}
+		return route, nil
+	}
+
+	geometry := req.Geometry
+	if req.Type == utils.GeoJSONLineString {
+		geometry = &utils.GeoJSONGeometry{Type: req.Type, Coordinates: req.Coordinates}
+	}
+	if geometry == nil || geometry.Type != utils.GeoJSONLineString {
+		return nil, errInvalidRouteBody
+	}
+	var positions [][]float64
+	if err := json.Unmarshal(geometry.Coordinates, &positions); err != nil {
+		return nil, errInvalidRouteBody
+	}
+	for _, position := range positions {
+		if len(position) < 2 {
+			return nil, errInvalidRouteBody
+		}
+		route = append(route, models.GeoPoint{Latitude: position[1], Longitude: position[0]})
+	}
+	return route, nil
+}
+
+// IntersectRoute returns where a planned route enters and leaves geofences,
+// in order, with distances along the route in metres. Only fences active
+// now, or at ?at= (RFC 3339), count.
+func IntersectRoute(w http.ResponseWriter, r *http.Request) {
+	at, err := parseActiveAt(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req intersectRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	route, err := req.route()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := routeIntersectionService.Intersect(route, viewerID(r), at)
+	if err == services.ErrInvalidRoute {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err == services.ErrTooManyRouteCandidates {
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error intersecting route")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, result)
+}
@@ -0,0 +1,67 @@
+// internal/handlers/search_handler.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"geofence/internal/services"
+	"geofence/internal/utils"
+)
+
+var searchService = &services.SearchService{}
+
+// Search runs a ranked full-text search across geofences and content.
+// Supports prefix (caf*) and phrase ("coffee shop") queries, an optional
+// type filter (geofences, contents) and an optional lat/lng/radius (km)
+// geographic filter.
+func Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Search query is required")
+		return
+	}
+
+	opts := services.SearchOptions{
+		Text:     query,
+		ViewerID: viewerID(r),
+	}
+
+	if types := r.URL.Query().Get("type"); types != "" && types != "all" {
+		for _, t := range strings.Split(types, ",") {
+			t = strings.TrimSpace(t)
+			if t != services.SearchTypeGeofences && t != services.SearchTypeContents {
+				utils.RespondWithError(w, http.StatusBadRequest, "Type must be 'geofences', 'contents' or 'all'")
+				return
+			}
+			opts.Types = append(opts.Types, t)
+		}
+	}
+
+	lat, lng, radius := r.URL.Query().Get("lat"), r.URL.Query().Get("lng"), r.URL.Query().Get("radius")
+	if lat != "" || lng != "" || radius != "" {
+		latitude, latErr := strconv.ParseFloat(lat, 64)
+		longitude, lngErr := strconv.ParseFloat(lng, 64)
+		radiusKm, radErr := strconv.ParseFloat(radius, 64)
+
+		if latErr != nil || lngErr != nil || radErr != nil || radiusKm <= 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "lat, lng and a positive radius (km) are required for a geographic filter")
+			return
+		}
+
+		opts.Near = &services.GeoFilter{Latitude: latitude, Longitude: longitude, RadiusKm: radiusKm}
+	}
+
+	page := utils.ParsePagination(r)
+	opts.Limit = page.PerPage
+	opts.Offset = page.Offset()
+
+	results, total, err := searchService.Search(opts)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error searching")
+		return
+	}
+
+	utils.RespondWithPage(w, results, page, total)
+}
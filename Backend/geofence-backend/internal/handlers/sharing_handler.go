@@ -14,17 +14,6 @@ import (
 	"github.com/gorilla/mux"
 )
 
-// GeofenceShare represents sharing a geofence with a user
-type GeofenceShare struct {
-	ID         uint      `json:"id" gorm:"primaryKey"`
-	GeofenceID uint      `json:"geofence_id"`
-	OwnerID    uint      `json:"owner_id"`
-	UserID     uint      `json:"user_id"`
-	Permission string    `json:"permission"` // "view", "edit", "admin"
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
-}
-
 // ShareGeofence allows users to share a geofence with another user
 func ShareGeofence(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
@@ -79,7 +68,7 @@ func ShareGeofence(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Check if already shared
-	var existingShare GeofenceShare
+	var existingShare models.GeofenceShare
 	result := database.DB.Where("geofence_id = ? AND user_id = ?", id, shareRequest.UserID).First(&existingShare)
 	
 	if result.Error == nil {
@@ -97,7 +86,7 @@ func ShareGeofence(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Create new share
-	newShare := GeofenceShare{
+	newShare := models.GeofenceShare{
 		GeofenceID: uint(id),
 		OwnerID:    ownerID,
 		UserID:     shareRequest.UserID,
@@ -123,7 +112,7 @@ func GetSharedGeofences(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	var shares []GeofenceShare
+	var shares []models.GeofenceShare
 	if err := database.DB.Where("user_id = ?", userID).Find(&shares).Error; err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching shares")
 		return
@@ -131,7 +120,7 @@ func GetSharedGeofences(w http.ResponseWriter, r *http.Request) {
 	
 	// If no shares, return empty array
 	if len(shares) == 0 {
-		utils.RespondWithSuccess(w, http.StatusOK, []GeofenceShare{})
+		utils.RespondWithSuccess(w, http.StatusOK, []models.GeofenceShare{})
 		return
 	}
 	
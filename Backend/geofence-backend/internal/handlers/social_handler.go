@@ -0,0 +1,282 @@
+// internal/handlers/social_handler.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// PublicUser is the subset of a user that is safe to show to anyone
+type PublicUser struct {
+	ID        uint   `json:"id"`
+	Username  string `json:"username"`
+	Bio       string `json:"bio"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// PublicProfile is a user's public page, as seen by the requesting user
+type PublicProfile struct {
+	PublicUser
+	FollowerCount  int64 `json:"follower_count"`
+	FollowingCount int64 `json:"following_count"`
+	GeofenceCount  int64 `json:"geofence_count"`
+	IsFollowing    bool  `json:"is_following"`
+	FollowsYou     bool  `json:"follows_you"`
+}
+
+var socialService = &services.SocialService{}
+
+// FollowUser makes the current user follow another user
+func FollowUser(w http.ResponseWriter, r *http.Request) {
+	handleFollow(w, r, true)
+}
+
+// UnfollowUser makes the current user stop following another user
+func UnfollowUser(w http.ResponseWriter, r *http.Request) {
+	handleFollow(w, r, false)
+}
+
+// BlockUser blocks another user for the current user
+func BlockUser(w http.ResponseWriter, r *http.Request) {
+	handleRestriction(w, r, models.RestrictionBlock, true)
+}
+
+// UnblockUser lifts a block
+func UnblockUser(w http.ResponseWriter, r *http.Request) {
+	handleRestriction(w, r, models.RestrictionBlock, false)
+}
+
+// MuteUser mutes another user for the current user
+func MuteUser(w http.ResponseWriter, r *http.Request) {
+	handleRestriction(w, r, models.RestrictionMute, true)
+}
+
+// UnmuteUser lifts a mute
+func UnmuteUser(w http.ResponseWriter, r *http.Request) {
+	handleRestriction(w, r, models.RestrictionMute, false)
+}
+
+// GetBlockedUsers returns the users the current user has blocked
+func GetBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	listRestricted(w, r, models.RestrictionBlock)
+}
+
+// GetMutedUsers returns the users the current user has muted
+func GetMutedUsers(w http.ResponseWriter, r *http.Request) {
+	listRestricted(w, r, models.RestrictionMute)
+}
+
+// GetPublicProfile returns a user's public profile by username
+func GetPublicProfile(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// Users who blocked the viewer are indistinguishable from missing users
+	if socialService.IsBlocked(user.ID, viewerID(r)) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	profile, err := buildPublicProfile(user, viewerID(r))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching profile")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, profile)
+}
+
+// GetFollowers returns a page of users following the given user
+func GetFollowers(w http.ResponseWriter, r *http.Request) {
+	listFollows(w, r, socialService.ListFollowers)
+}
+
+// GetFollowing returns a page of users the given user follows
+func GetFollowing(w http.ResponseWriter, r *http.Request) {
+	listFollows(w, r, socialService.ListFollowing)
+}
+
+func handleFollow(w http.ResponseWriter, r *http.Request, follow bool) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	targetID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if follow {
+		err = socialService.Follow(userID, uint(targetID))
+	} else {
+		err = socialService.Unfollow(userID, uint(targetID))
+	}
+
+	if !respondWithSocialError(w, err) {
+		return
+	}
+
+	var target models.User
+	if err := database.DB.First(&target, targetID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	profile, err := buildPublicProfile(target, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching profile")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, profile)
+}
+
+func handleRestriction(w http.ResponseWriter, r *http.Request, kind string, add bool) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	targetID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if add {
+		err = socialService.Restrict(userID, uint(targetID), kind)
+	} else {
+		err = socialService.Unrestrict(userID, uint(targetID), kind)
+	}
+
+	if !respondWithSocialError(w, err) {
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, map[string]interface{}{
+		"user_id": targetID,
+		"kind":    kind,
+		"active":  add,
+	})
+}
+
+func listRestricted(w http.ResponseWriter, r *http.Request, kind string) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	users, err := socialService.ListRestricted(userID, kind)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching users")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, toPublicUsers(users))
+}
+
+func listFollows(w http.ResponseWriter, r *http.Request, list func(uint, int, int) ([]models.User, int64, error)) {
+	userID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if socialService.IsBlocked(uint(userID), viewerID(r)) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	page := utils.ParsePagination(r)
+	users, total, err := list(uint(userID), page.PerPage, page.Offset())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching users")
+		return
+	}
+
+	utils.RespondWithPage(w, toPublicUsers(users), page, total)
+}
+
+// respondWithSocialError writes the response for a social service error and
+// reports whether the caller should carry on
+func respondWithSocialError(w http.ResponseWriter, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case services.ErrUserNotFound:
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+	case services.ErrSelfRelation:
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case services.ErrBlocked:
+		utils.RespondWithError(w, http.StatusForbidden, "You can't interact with this user")
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating relationship")
+	}
+	return false
+}
+
+func buildPublicProfile(user models.User, viewer uint) (PublicProfile, error) {
+	followers, following, err := socialService.CountFollows(user.ID)
+	if err != nil {
+		return PublicProfile{}, err
+	}
+
+	var geofenceCount int64
+	if err := database.DB.Model(&models.Geofence{}).Where("user_id = ?", user.ID).Count(&geofenceCount).Error; err != nil {
+		return PublicProfile{}, err
+	}
+
+	profile := PublicProfile{
+		PublicUser:     toPublicUser(user),
+		FollowerCount:  followers,
+		FollowingCount: following,
+		GeofenceCount:  geofenceCount,
+	}
+
+	if viewer != 0 && viewer != user.ID {
+		profile.IsFollowing = socialService.IsFollowing(viewer, user.ID)
+		profile.FollowsYou = socialService.IsFollowing(user.ID, viewer)
+	}
+
+	return profile, nil
+}
+
+func toPublicUser(user models.User) PublicUser {
+	return PublicUser{
+		ID:        user.ID,
+		Username:  user.Username,
+		Bio:       user.Bio,
+		AvatarURL: user.AvatarURL,
+	}
+}
+
+func toPublicUsers(users []models.User) []PublicUser {
+	result := make([]PublicUser, 0, len(users))
+	for _, user := range users {
+		result = append(result, toPublicUser(user))
+	}
+	return result
+}
+
+// viewerID returns the authenticated user's ID, or 0 for anonymous requests
+func viewerID(r *http.Request) uint {
+	userID, _ := r.Context().Value("userID").(uint)
+	return userID
+}
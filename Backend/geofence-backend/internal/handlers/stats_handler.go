@@ -6,9 +6,12 @@ import (
 
 	"geofence/internal/database"
 	"geofence/internal/models"
+	"geofence/internal/services"
 	"geofence/internal/utils"
 )
 
+var rollupService = &services.RollupService{}
+
 // GetUserStats returns statistics for a user
 func GetUserStats(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
@@ -55,11 +58,19 @@ func GetUserStats(w http.ResponseWriter, r *http.Request) {
 		Limit(3).
 		Scan(&activeGeofences)
 
+	// Engagement across the user's fences, read from the analytics rollups
+	engagement, err := rollupService.GeofenceTotals(database.DB.Model(&models.Geofence{}).Select("id").Where("user_id = ?", id))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching engagement")
+		return
+	}
+
 	stats := map[string]interface{}{
 		"geofence_count":        geofenceCount,
 		"content_count":         contentCount,
 		"latest_geofence":       latestGeofence,
 		"most_active_locations": activeGeofences,
+		"engagement":            engagement,
 	}
 
 	utils.RespondWithSuccess(w, http.StatusOK, stats)
@@ -84,11 +95,18 @@ func GetSystemStats(w http.ResponseWriter, r *http.Request) {
 	database.DB.Order("created_at DESC").First(&latestUser)
 	latestUser.Password = "" // Don't expose password
 
+	engagement, err := rollupService.GeofenceTotals(database.DB.Model(&models.Geofence{}).Select("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching engagement")
+		return
+	}
+
 	stats := map[string]interface{}{
 		"user_count":     userCount,
 		"geofence_count": geofenceCount,
 		"content_count":  contentCount,
 		"latest_user":    latestUser,
+		"engagement":     engagement,
 	}
 
 	utils.RespondWithSuccess(w, http.StatusOK, stats)
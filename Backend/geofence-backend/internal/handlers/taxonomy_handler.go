@@ -0,0 +1,300 @@
+// internal/handlers/taxonomy_handler.go
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var taxonomyService = &services.TaxonomyService{}
+
+// GetCategories returns the category tree
+func GetCategories(w http.ResponseWriter, r *http.Request) {
+	tree, err := taxonomyService.CategoryTree()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching categories")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, tree)
+}
+
+// GetCategory returns a category with its direct subcategories
+func GetCategory(w http.ResponseWriter, r *http.Request) {
+	var category models.Category
+	if err := database.DB.Preload("Children").First(&category, mux.Vars(r)["id"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, category)
+}
+
+// CreateCategory adds a category (admin only)
+func CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	category.ID = 0
+	saveCategory(w, &category, http.StatusCreated)
+}
+
+// UpdateCategory renames or moves a category (admin only)
+func UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	var category models.Category
+	if err := database.DB.First(&category, mux.Vars(r)["id"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	var req struct {
+		Name        string `json:"name"`
+		Slug        string `json:"slug"`
+		Description string `json:"description"`
+		ParentID    *uint  `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	category.Name = req.Name
+	category.Slug = req.Slug
+	category.Description = req.Description
+	category.ParentID = req.ParentID
+	saveCategory(w, &category, http.StatusOK)
+}
+
+// DeleteCategory removes a category without subcategories (admin only)
+func DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	var category models.Category
+	if err := database.DB.First(&category, mux.Vars(r)["id"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	err := taxonomyService.DeleteCategory(category.ID)
+	if err == services.ErrCategoryInUse {
+		utils.RespondWithError(w, http.StatusConflict, "Move or delete the subcategories first")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting category")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusNoContent, nil)
+}
+
+// SetGeofenceCategories replaces a geofence's categories
+func SetGeofenceCategories(w http.ResponseWriter, r *http.Request) {
+	geofence, ok := editableGeofence(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var req struct {
+		CategoryIDs []uint `json:"category_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	err := taxonomyService.SetGeofenceCategories(geofence, req.CategoryIDs)
+	if err == services.ErrCategoryNotFound {
+		utils.RespondWithError(w, http.StatusBadRequest, "Unknown category")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating categories")
+		return
+	}
+
+	database.DB.Preload("Categories").Preload("Tags").First(geofence, geofence.ID)
+	utils.RespondWithSuccess(w, http.StatusOK, geofence)
+}
+
+// SetGeofenceTags replaces a geofence's tags
+func SetGeofenceTags(w http.ResponseWriter, r *http.Request) {
+	geofence, ok := editableGeofence(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	tags, ok := decodeTags(w, r)
+	if !ok {
+		return
+	}
+
+	if err := taxonomyService.SetGeofenceTags(geofence, tags); err != nil {
+		respondWithTagError(w, err)
+		return
+	}
+
+	database.DB.Preload("Categories").Preload("Tags").First(geofence, geofence.ID)
+	utils.RespondWithSuccess(w, http.StatusOK, geofence)
+}
+
+// SetContentTags replaces a content item's tags
+func SetContentTags(w http.ResponseWriter, r *http.Request) {
+	var content models.Content
+	if err := database.DB.First(&content, mux.Vars(r)["id"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Content not found")
+		return
+	}
+
+	// Content is tagged by whoever can edit the fence it belongs to
+	if _, ok := editableGeofence(w, r, strconv.FormatUint(uint64(content.GeofenceID), 10)); !ok {
+		return
+	}
+
+	tags, ok := decodeTags(w, r)
+	if !ok {
+		return
+	}
+
+	if err := taxonomyService.SetContentTags(&content, tags); err != nil {
+		respondWithTagError(w, err)
+		return
+	}
+
+	database.DB.Preload("Tags").First(&content, content.ID)
+	utils.RespondWithSuccess(w, http.StatusOK, content)
+}
+
+// AutocompleteTags suggests existing tags starting with ?prefix=, most used first
+func AutocompleteTags(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if val, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && val > 0 && val <= 50 {
+		limit = val
+	}
+
+	suggestions, err := taxonomyService.AutocompleteTags(r.URL.Query().Get("prefix"), limit)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching tags")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, suggestions)
+}
+
+// taxonomyFilters applies ?categories=1,2&categories_match=all and
+// ?tags=a,b&tags_match=all to a geofence query. Matching defaults to any.
+// The older single ?category= parameter is still accepted.
+func taxonomyFilters(r *http.Request) (func(*gorm.DB) *gorm.DB, error) {
+	query := r.URL.Query()
+
+	categories := query.Get("categories")
+	if categories == "" {
+		categories = query.Get("category")
+	}
+
+	var categoryIDs []uint
+	for _, raw := range splitList(categories) {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		categoryIDs = append(categoryIDs, uint(id))
+	}
+
+	byCategory, err := taxonomyService.FilterByCategories(categoryIDs, query.Get("categories_match") == "all")
+	if err != nil {
+		return nil, err
+	}
+	byTag := services.FilterGeofencesByTags(splitList(query.Get("tags")), query.Get("tags_match") == "all")
+
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(byCategory, byTag)
+	}, nil
+}
+
+// editableGeofence loads a geofence the current user owns or has edit access to
+func editableGeofence(w http.ResponseWriter, r *http.Request, id string) (*models.Geofence, bool) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return nil, false
+	}
+
+	var geofence models.Geofence
+	if err := database.DB.First(&geofence, id).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Geofence not found")
+		return nil, false
+	}
+
+	if geofence.UserID != userID {
+		if err := (&services.GeofenceAccessService{}).CheckGeofenceAccess(userID, geofence.ID, "edit"); err != nil {
+			utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to edit this geofence")
+			return nil, false
+		}
+	}
+
+	return &geofence, true
+}
+
+func decodeTags(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return nil, false
+	}
+	return req.Tags, true
+}
+
+func respondWithTagError(w http.ResponseWriter, err error) {
+	if err == services.ErrTooManyTags {
+		utils.RespondWithError(w, http.StatusBadRequest, "At most "+strconv.Itoa(services.MaxTagsPerItem)+" tags are allowed")
+		return
+	}
+	utils.RespondWithError(w, http.StatusInternalServerError, "Error updating tags")
+}
+
+func saveCategory(w http.ResponseWriter, category *models.Category, status int) {
+	if strings.TrimSpace(category.Name) == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	err := taxonomyService.SaveCategory(category)
+	switch {
+	case err == services.ErrCategoryNotFound:
+		utils.RespondWithError(w, http.StatusBadRequest, "Parent category not found")
+	case err == services.ErrCategoryCycle:
+		utils.RespondWithError(w, http.StatusBadRequest, "A category can't be moved under itself")
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		utils.RespondWithError(w, http.StatusConflict, "A category with this slug already exists")
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving category")
+	default:
+		utils.RespondWithSuccess(w, status, category)
+	}
+}
+
+// splitList splits a comma-separated query value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,125 @@
+// internal/handlers/trash_handler.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+var trashService = &services.TrashService{}
+
+// trashRequest reads the current user and the ID of the trashed item in the
+// URL, answering the request itself if either is missing
+func trashRequest(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid ID")
+		return 0, 0, false
+	}
+	return userID, uint(id), true
+}
+
+// respondWithTrashError maps trash service errors to responses
+func respondWithTrashError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case services.ErrNotInTrash:
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case services.ErrGeofenceInTrash:
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, message)
+	}
+}
+
+// GetTrash lists the current user's deleted geofences and content, with when
+// each will be purged
+func GetTrash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	items, err := trashService.List(userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching trash")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, items)
+}
+
+// RestoreTrashedGeofence restores a deleted geofence with the content and
+// shares deleted along with it
+func RestoreTrashedGeofence(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := trashRequest(w, r)
+	if !ok {
+		return
+	}
+
+	geofence, err := trashService.RestoreGeofence(userID, id)
+	if err != nil {
+		respondWithTrashError(w, err, "Error restoring geofence")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, geofence)
+}
+
+// PurgeTrashedGeofence permanently deletes a geofence in the trash
+func PurgeTrashedGeofence(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := trashRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := trashService.PurgeGeofence(userID, id); err != nil {
+		respondWithTrashError(w, err, "Error purging geofence")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusNoContent, nil)
+}
+
+// RestoreTrashedContent restores content deleted from one of the current
+// user's geofences
+func RestoreTrashedContent(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := trashRequest(w, r)
+	if !ok {
+		return
+	}
+
+	content, err := trashService.RestoreContent(userID, id)
+	if err != nil {
+		respondWithTrashError(w, err, "Error restoring content")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, content)
+}
+
+// PurgeTrashedContent permanently deletes content in the trash
+func PurgeTrashedContent(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := trashRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := trashService.PurgeContent(userID, id); err != nil {
+		respondWithTrashError(w, err, "Error purging content")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,101 @@
+// internal/handlers/trending_handler.go
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"geofence/internal/models"
+	"geofence/internal/services"
+	"geofence/internal/utils"
+)
+
+var trendingService = &services.TrendingService{}
+
+// GetTrendingGeofences returns geofences ranked by recent engagement.
+// Supports ?window=24h|7d|30d (default 24h) and a region given as
+// ?bbox=minLng,minLat,maxLng,maxLat or ?lat=&lng=&radius= (km).
+func GetTrendingGeofences(w http.ResponseWriter, r *http.Request) {
+	listTrending(w, r, services.TrendingTypeGeofence)
+}
+
+// GetTrendingContents returns content ranked by recent engagement, with the
+// same filters as GetTrendingGeofences
+func GetTrendingContents(w http.ResponseWriter, r *http.Request) {
+	listTrending(w, r, services.TrendingTypeContent)
+}
+
+func listTrending(w http.ResponseWriter, r *http.Request, itemType string) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = models.PopularityWindowDay
+	}
+	if !services.IsValidWindow(window) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Window must be one of 24h, 7d or 30d")
+		return
+	}
+
+	region, err := parseRegion(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page := utils.ParsePagination(r)
+	items, total, err := trendingService.Top(itemType, window, region, viewerID(r), page.PerPage, page.Offset())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching trending items")
+		return
+	}
+
+	utils.RespondWithPage(w, items, page, total)
+}
+
+var (
+	errInvalidBBox   = errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+	errInvalidRadius = errors.New("lat, lng and a positive radius are required together")
+)
+
+// parseRegion reads ?bbox=minLng,minLat,maxLng,maxLat or ?lat=&lng=&radius=
+// (km). It returns nil when neither is given.
+func parseRegion(r *http.Request) (*services.Region, error) {
+	query := r.URL.Query()
+
+	if bbox := query.Get("bbox"); bbox != "" {
+		parts := splitList(bbox)
+		if len(parts) != 4 {
+			return nil, errInvalidBBox
+		}
+		var values [4]float64
+		for i, part := range parts {
+			value, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return nil, errInvalidBBox
+			}
+			values[i] = value
+		}
+		// minLng may exceed maxLng for boxes crossing the antimeridian
+		if values[1] > values[3] || values[1] < -90 || values[3] > 90 ||
+			math.Abs(values[0]) > 180 || math.Abs(values[2]) > 180 {
+			return nil, errInvalidBBox
+		}
+		return &services.Region{MinLng: values[0], MinLat: values[1], MaxLng: values[2], MaxLat: values[3]}, nil
+	}
+
+	lat, lng, radius := query.Get("lat"), query.Get("lng"), query.Get("radius")
+	if lat == "" && lng == "" && radius == "" {
+		return nil, nil
+	}
+
+	latitude, latErr := strconv.ParseFloat(lat, 64)
+	longitude, lngErr := strconv.ParseFloat(lng, 64)
+	radiusKm, radErr := strconv.ParseFloat(radius, 64)
+	if latErr != nil || lngErr != nil || radErr != nil || radiusKm <= 0 {
+		return nil, errInvalidRadius
+	}
+
+	region := services.RegionAround(services.GeoFilter{Latitude: latitude, Longitude: longitude, RadiusKm: radiusKm})
+	return &region, nil
+}
@@ -7,9 +7,11 @@ import (
 	"geofence/internal/database"
 	"geofence/internal/middleware"
 	"geofence/internal/models"
+	"geofence/internal/services"
 	"geofence/internal/utils"
 
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // RegisterRequest represents the structure for user registration input
@@ -132,11 +134,7 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	// Prepare response (exclude password)
 	response := map[string]interface{}{
 		"token": token,
-		"user": map[string]interface{}{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-		},
+		"user":  accountResponse(user),
 	}
 
 	utils.RespondWithSuccess(w, http.StatusOK, response)
@@ -158,12 +156,270 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Prepare response (exclude password)
+	utils.RespondWithSuccess(w, http.StatusOK, accountResponse(user))
+}
+
+// UpdateProfileRequest holds the profile fields a user can change.
+// Fields left out of the request are not modified.
+type UpdateProfileRequest struct {
+	Username  *string `json:"username"`
+	Bio       *string `json:"bio"`
+	AvatarURL *string `json:"avatar_url"`
+	Email     *string `json:"email"`
+}
+
+// UpdateUserProfile updates the authenticated user's profile. A new email
+// address only replaces the current one after it has been verified.
+func UpdateUserProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// Check every field before changing anything
+	updates := map[string]interface{}{}
+
+	if req.Username != nil && *req.Username != user.Username {
+		if *req.Username == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "Username is required")
+			return
+		}
+
+		var count int64
+		database.DB.Model(&models.User{}).Where("username = ? AND id <> ?", *req.Username, userID).Count(&count)
+		if count > 0 {
+			utils.RespondWithError(w, http.StatusConflict, "Username already exists")
+			return
+		}
+		updates["username"] = *req.Username
+	}
+
+	if req.Bio != nil {
+		updates["bio"] = *req.Bio
+	}
+
+	if req.AvatarURL != nil {
+		updates["avatar_url"] = *req.AvatarURL
+	}
+
+	newEmail := ""
+	if req.Email != nil && *req.Email != user.Email {
+		if *req.Email == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "Email is required")
+			return
+		}
+
+		var count int64
+		database.DB.Model(&models.User{}).Where("email = ?", *req.Email).Count(&count)
+		if count > 0 {
+			utils.RespondWithError(w, http.StatusConflict, "Email already exists")
+			return
+		}
+		newEmail = *req.Email
+	}
+
+	// The profile changes and the pending email are saved together, and not
+	// at all if the verification email can't be sent
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(&user).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if newEmail != "" {
+			return accountService.RequestEmailChange(tx, &user, newEmail)
+		}
+		return nil
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating profile")
+		return
+	}
+
+	database.DB.First(&user, userID)
+	utils.RespondWithSuccess(w, http.StatusOK, accountResponse(user))
+}
+
+// VerifyEmail confirms a pending email change using the emailed token
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	user, err := accountService.VerifyEmail(req.Token)
+	if err == services.ErrInvalidVerificationToken {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if err == services.ErrEmailTaken {
+		utils.RespondWithError(w, http.StatusConflict, "Email already exists")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error verifying email")
+		return
+	}
+
+	database.DB.First(user, user.ID)
+	utils.RespondWithSuccess(w, http.StatusOK, accountResponse(*user))
+}
+
+// ChangePasswordRequest represents the structure for a password change
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePassword replaces the authenticated user's password after checking the current one
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.CurrentPassword == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Current password is required")
+		return
+	}
+
+	if req.NewPassword == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "New password is required")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Current password is incorrect")
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error hashing password")
+		return
+	}
+
+	if err := database.DB.Model(&user).Update("password", string(hashedPassword)).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating password")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, map[string]string{"message": "Password updated"})
+}
+
+// DeleteAccount schedules the authenticated user's account for deletion.
+// The password must be confirmed; the account is purged after the grace period.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Password is required")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Password is incorrect")
+		return
+	}
+
+	purgeAt, err := accountService.ScheduleDeletion(&user)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error scheduling account deletion")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusAccepted, map[string]interface{}{
+		"deletion_scheduled_at": purgeAt,
+	})
+}
+
+// CancelAccountDeletion keeps an account that is waiting to be purged
+func CancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := accountService.CancelDeletion(&user); err == services.ErrNoDeletionScheduled {
+		utils.RespondWithError(w, http.StatusBadRequest, "Account deletion is not scheduled")
+		return
+	} else if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error cancelling account deletion")
+		return
+	}
+
+	database.DB.First(&user, userID)
+	utils.RespondWithSuccess(w, http.StatusOK, accountResponse(user))
+}
+
+var accountService = &services.AccountService{}
+
+// accountResponse is the private view of a user's own account (excludes password)
+func accountResponse(user models.User) map[string]interface{} {
 	response := map[string]interface{}{
-		"id":       user.ID,
-		"username": user.Username,
-		"email":    user.Email,
+		"id":         user.ID,
+		"username":   user.Username,
+		"email":      user.Email,
+		"bio":        user.Bio,
+		"avatar_url": user.AvatarURL,
 	}
 
-	utils.RespondWithSuccess(w, http.StatusOK, response)
+	if user.PendingEmail != "" {
+		response["pending_email"] = user.PendingEmail
+	}
+
+	if user.DeletionScheduledAt != nil {
+		response["deletion_scheduled_at"] = user.DeletionScheduledAt
+	}
+
+	return response
 }
\ No newline at end of file
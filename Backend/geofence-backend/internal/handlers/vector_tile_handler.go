@@ -0,0 +1,59 @@
+// internal/handlers/vector_tile_handler.go
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"geofence/internal/services"
+	"geofence/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+var vectorTileService = &services.VectorTileService{}
+
+// GetGeofenceTile serves the geofences on a tile as a Mapbox Vector Tile at
+// /api/tiles/geofences/{z}/{x}/{y}.mvt. Responses carry an ETag of the tile's
+// contents and If-None-Match gets a 304 when nothing changed.
+func GetGeofenceTile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	z, zErr := strconv.Atoi(vars["z"])
+	x, xErr := strconv.Atoi(vars["x"])
+	y, yErr := strconv.Atoi(vars["y"])
+	tile := services.Tile{Z: z, X: x, Y: y}
+	if zErr != nil || xErr != nil || yErr != nil || !tile.Valid() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tile coordinates")
+		return
+	}
+
+	viewer := viewerID(r)
+	body, err := vectorTileService.GeofenceTile(tile, viewer)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error rendering tile")
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	// Properties depend on who's looking, so only anonymous tiles are shared
+	cacheControl := "public, max-age=60"
+	if viewer != 0 {
+		cacheControl = "private, max-age=60"
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Vary", "Authorization")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == etag || match == "W/"+etag || match == "*") {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/utils"
+)
+
+// AdminMiddleware only lets users flagged as admins through. It must run
+// after AuthMiddleware. Admins are granted by setting users.is_admin directly.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("userID").(uint)
+		if !ok {
+			utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+			return
+		}
+
+		var user models.User
+		if err := database.DB.Select("id", "is_admin").First(&user, userID).Error; err != nil || !user.IsAdmin {
+			utils.RespondWithError(w, http.StatusForbidden, "Admin access required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -97,6 +97,26 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// OptionalAuthMiddleware adds the user ID to the request context when a valid
+// token is supplied, but lets anonymous requests through unchanged
+func OptionalAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.Header.Get("Authorization"), " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			claims := &Claims{}
+			token, err := jwt.ParseWithClaims(parts[1], claims, func(token *jwt.Token) (interface{}, error) {
+				return GetJWTKey(), nil
+			})
+
+			if err == nil && token.Valid {
+				r = r.WithContext(context.WithValue(r.Context(), "userID", claims.UserID))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // RefreshToken handles token renewal
 func RefreshToken(w http.ResponseWriter, r *http.Request) {
 	// Get Authorization header
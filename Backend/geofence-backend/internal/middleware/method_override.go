@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MethodOverride lets clients that can only POST reach PATCH, PUT and DELETE
+// routes by adding ?_method=PATCH (etc.) to the URL. It must wrap the router
+// so the rewritten method is used for route matching.
+func MethodOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			switch method := strings.ToUpper(r.URL.Query().Get("_method")); method {
+			case http.MethodPatch, http.MethodPut, http.MethodDelete:
+				r.Method = method
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -11,4 +11,11 @@ type Content struct {
 	Type        string `json:"type" gorm:"default:'text'"`
 	URL         string `json:"url,omitempty"`
 	GeofenceID  uint   `json:"geofence_id" gorm:"not null"`
+	Tags        []Tag  `json:"tags,omitempty" gorm:"many2many:content_tags"`
+
+	// Reaction counts are denormalized from ContentInteraction and kept in
+	// step by ReactionService; don't write them directly.
+	LikeCount     int64 `json:"like_count" gorm:"not null;default:0"`
+	FavoriteCount int64 `json:"favorite_count" gorm:"not null;default:0"`
+	RepostCount   int64 `json:"repost_count" gorm:"not null;default:0"`
 }
\ No newline at end of file
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Datasets and formats an ExportJob can produce
+const (
+	ExportDatasetVisits       = "visits"
+	ExportDatasetInteractions = "interactions"
+	ExportDatasetGeofences    = "geofences"
+
+	ExportFormatCSV     = "csv"
+	ExportFormatParquet = "parquet"
+)
+
+// ExportJob statuses
+const (
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+)
+
+// ExportJob is an export running in the background. The finished file is kept
+// on disk at FilePath until ExpiresAt. GeofenceIDs is a comma-separated list;
+// empty means every fence the user can export.
+type ExportJob struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"index"`
+	Dataset     string     `json:"dataset"`
+	Format      string     `json:"format"`
+	From        *time.Time `json:"from"`
+	To          *time.Time `json:"to"`
+	GeofenceIDs string     `json:"geofence_ids"`
+	Status      string     `json:"status" gorm:"index"`
+	Error       string     `json:"error,omitempty"`
+	Rows        int64      `json:"rows"`
+	Size        int64      `json:"size"`
+	FilePath    string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at" gorm:"index"`
+}
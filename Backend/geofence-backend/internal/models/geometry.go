@@ -0,0 +1,69 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Geofence types
+const (
+	GeofenceTypeCircle   = "circle"
+	GeofenceTypeCorridor = "corridor"
+)
+
+// Altitude references
+const (
+	AltitudeEllipsoid = "ellipsoid"
+	AltitudeFloor     = "floor"
+)
+
+// GeoPoint is a WGS84 coordinate
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Polyline is a path of points, stored as a JSON array
+type Polyline []GeoPoint
+
+// Value implements driver.Valuer
+func (p Polyline) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(p)
+	return string(encoded), err
+}
+
+// Scan implements sql.Scanner
+func (p *Polyline) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	}
+	return fmt.Errorf("cannot scan %T into Polyline", value)
+}
+
+// GormDataType stores polylines as text
+func (Polyline) GormDataType() string {
+	return "text"
+}
+
+// RouteDeviation records a user leaving a corridor geofence they were
+// travelling along. Distance is how far (metres) from the path they were.
+type RouteDeviation struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	GeofenceID uint      `json:"geofence_id" gorm:"index;not null"`
+	UserID     uint      `json:"user_id" gorm:"index;not null"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Distance   float64   `json:"distance"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GeofenceGroup is a named collection of an owner's geofences, like "All
+// stores in Florida". A fence can be in any number of groups.
+type GeofenceGroup struct {
+	gorm.Model
+	Name        string     `json:"name" gorm:"not null"`
+	Description string     `json:"description"`
+	UserID      uint       `json:"user_id" gorm:"index"`
+	Geofences   []Geofence `json:"geofences,omitempty" gorm:"many2many:geofence_group_members"`
+}
+
+// GeofenceGroupShare shares a whole group: every member fence is shared
+// with the user, including fences added to the group later
+type GeofenceGroupShare struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	GroupID    uint      `json:"group_id" gorm:"uniqueIndex:idx_group_share"`
+	UserID     uint      `json:"user_id" gorm:"uniqueIndex:idx_group_share"`
+	Permission string    `json:"permission"` // "view", "edit", "admin"
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Group event types
+const (
+	GroupEventEnter = "enter"
+	GroupEventExit  = "exit"
+)
+
+// GroupSubscription subscribes a user to the enter and/or exit events of
+// every fence in a group. Events is a comma-separated list.
+type GroupSubscription struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	GroupID   uint      `json:"group_id" gorm:"index"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Events    string    `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GroupEvent is an event delivered to a subscription's feed. Events don't
+// say who entered or left.
+type GroupEvent struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	SubscriptionID uint      `json:"subscription_id" gorm:"index"`
+	GroupID        uint      `json:"group_id"`
+	GeofenceID     uint      `json:"geofence_id"`
+	Event          string    `json:"event"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
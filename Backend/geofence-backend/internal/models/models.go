@@ -10,7 +10,19 @@ type User struct {
 	Username  string     `json:"username" gorm:"unique"`
 	Email     string     `json:"email" gorm:"unique"`
 	Password  string     `json:"password,omitempty"`
+	IsAdmin   bool       `json:"is_admin" gorm:"default:false"`
+	Bio       string     `json:"bio"`
+	AvatarURL string     `json:"avatar_url"`
 	Geofences []Geofence `json:"geofences,omitempty"`
+
+	// An email change only takes effect once the new address is verified
+	PendingEmail               string     `json:"-"`
+	EmailVerificationTokenHash string     `json:"-"`
+	EmailVerificationExpiresAt *time.Time `json:"-"`
+
+	// Set when the user asks to delete their account; the account is purged
+	// once the grace period has passed unless the request is cancelled
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
 }
 
 type Geofence struct {
@@ -22,9 +34,50 @@ type Geofence struct {
 	Radius      float64   `json:"radius"`
 	UserID      uint      `json:"user_id"`
 	Contents    []Content `json:"contents,omitempty" gorm:"foreignKey:GeofenceID"`
+	Categories  []Category `json:"categories,omitempty" gorm:"many2many:geofence_categories"`
+	Tags        []Tag      `json:"tags,omitempty" gorm:"many2many:geofence_tags"`
+
+	// Type is GeofenceTypeCircle (Radius metres around Latitude/Longitude)
+	// or GeofenceTypeCorridor (BufferWidth metres either side of Path). For
+	// corridors Latitude, Longitude and Radius are derived from the path:
+	// they're the circle enclosing the whole corridor.
+	Type        string   `json:"type" gorm:"not null;default:'circle'"`
+	Path        Polyline `json:"path,omitempty"`
+	BufferWidth float64  `json:"buffer_width,omitempty"`
+
+	// MinAltitude and MaxAltitude bound the fence vertically; either end can
+	// be left open. AltitudeRef is what they measure: AltitudeEllipsoid
+	// (metres above the WGS84 ellipsoid) or AltitudeFloor (floor numbers).
+	// Fixes without a matching altitude are only checked in 2D.
+	MinAltitude *float64 `json:"min_altitude,omitempty"`
+	MaxAltitude *float64 `json:"max_altitude,omitempty"`
+	AltitudeRef string   `json:"altitude_ref,omitempty"`
+
+	// A fence is only active while it isn't Disabled, between ActiveFrom and
+	// ActiveUntil and, if it has a Schedule, during one of its weekly
+	// windows. Timezone (an IANA name, UTC when empty) is what the windows
+	// are read in.
+	Disabled    bool               `json:"disabled"`
+	ActiveFrom  *time.Time         `json:"active_from,omitempty"`
+	ActiveUntil *time.Time         `json:"active_until,omitempty"`
+	Timezone    string             `json:"timezone,omitempty"`
+	Schedule    []GeofenceSchedule `json:"schedule,omitempty" gorm:"foreignKey:GeofenceID"`
+
+	// ParentID nests a fence inside another (campus > building > floor); a
+	// child lies wholly inside its parent. CascadeContent shows the fence's
+	// content in all its descendants and CascadePermissions extends its
+	// shares (and its owner's access) to them.
+	ParentID           *uint `json:"parent_id,omitempty" gorm:"index"`
+	CascadeContent     bool  `json:"cascade_content"`
+	CascadePermissions bool  `json:"cascade_permissions"`
+
+	// Revision is the number of the fence's current GeofenceRevision, 0 for
+	// fences from before revisions were kept
+	Revision int `json:"revision"`
 }
 
-// Remove the Content struct from here since it's already defined in content.go
+// UserPreference holds a user's app settings. DefaultRadius (metres) is also
+// what recommendations treat as "near" the user.
 type UserPreference struct {
     gorm.Model
     UserID              uint   `json:"user_id" gorm:"uniqueIndex"`
@@ -32,11 +85,69 @@ type UserPreference struct {
     DefaultRadius       float64 `json:"default_radius" gorm:"default:500"`
     Theme               string  `json:"theme" gorm:"default:'light'"`
     Language            string  `json:"language" gorm:"default:'en'"`
+    DistanceUnit        string  `json:"distance_unit" gorm:"default:'km'"`
+    TemperatureUnit     string  `json:"temperature_unit" gorm:"default:'celsius'"`
+    DarkMode            bool    `json:"dark_mode" gorm:"default:false"`
+    AutoCheckIn         bool    `json:"auto_check_in" gorm:"default:true"`
 }
+
+// GeofenceShare represents sharing a geofence with a user. Shares are
+// trashed and restored along with their geofence.
+type GeofenceShare struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	GeofenceID uint           `json:"geofence_id" gorm:"index"`
+	OwnerID    uint           `json:"owner_id"`
+	UserID     uint           `json:"user_id" gorm:"index"`
+	Permission string         `json:"permission"` // "view", "edit", "admin"
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
 type ContentInteraction struct {
 	gorm.Model
-	UserID           uint      `json:"user_id"`
-	ContentID        uint      `json:"content_id"`
+	UserID           uint      `json:"user_id" gorm:"index"`
+	ContentID        uint      `json:"content_id" gorm:"index"`
 	InteractionType  string    `json:"interaction_type"`
 	InteractionTime  time.Time `json:"interaction_time"`
+}
+
+// GeofenceVisit records a user entering a geofence. ExitedAt is set when
+// they leave; visits without it don't count towards dwell time. Revision is
+// the fence's revision when they entered.
+type GeofenceVisit struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	GeofenceID uint       `json:"geofence_id" gorm:"index"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"index"`
+	ExitedAt   *time.Time `json:"exited_at" gorm:"index"`
+	Revision   int        `json:"revision"`
+}
+
+// ErrorLog is an error recorded by ErrorLoggingService, with where it
+// happened and any context the caller added
+type ErrorLog struct {
+	gorm.Model
+	ErrorMessage string                 `json:"error_message"`
+	SourceFile   string                 `json:"source_file"`
+	LineNumber   int                    `json:"line_number"`
+	Context      map[string]interface{} `json:"context" gorm:"serializer:json"`
+}
+
+// Interaction types stored in ContentInteraction.InteractionType.
+// Likes, favorites and reposts are reactions: a user holds at most one of each per content.
+const (
+	InteractionView     = "view"
+	InteractionLike     = "like"
+	InteractionFavorite = "favorite"
+	InteractionRepost   = "repost"
+)
+
+// IsReaction reports whether the interaction type is a toggleable reaction
+func IsReaction(interactionType string) bool {
+	switch interactionType {
+	case InteractionLike, InteractionFavorite, InteractionRepost:
+		return true
+	}
+	return false
 }
\ No newline at end of file
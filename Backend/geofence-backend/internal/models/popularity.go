@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Trending windows a PopularityScore can be computed over
+const (
+	PopularityWindowDay   = "24h"
+	PopularityWindowWeek  = "7d"
+	PopularityWindowMonth = "30d"
+)
+
+// PopularityScore is a precomputed trending score for a geofence or content
+// item over one time window. Latitude and Longitude are the geofence's (or
+// the content's geofence's) so results can be filtered by region.
+type PopularityScore struct {
+	ID             uint      `json:"-" gorm:"primaryKey"`
+	ItemType       string    `json:"item_type" gorm:"uniqueIndex:idx_popularity_item;not null"`
+	ItemID         uint      `json:"item_id" gorm:"uniqueIndex:idx_popularity_item;not null"`
+	Window         string    `json:"window" gorm:"column:time_window;uniqueIndex:idx_popularity_item;index:idx_popularity_rank,priority:1;not null"`
+	Score          float64   `json:"score" gorm:"index:idx_popularity_rank,priority:2"`
+	Visits         int64     `json:"visits"`
+	UniqueVisitors int64     `json:"unique_visitors"`
+	Views          int64     `json:"views"`
+	Likes          int64     `json:"likes"`
+	Favorites      int64     `json:"favorites"`
+	Reposts        int64     `json:"reposts"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	ComputedAt     time.Time `json:"computed_at"`
+}
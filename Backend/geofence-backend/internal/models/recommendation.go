@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ContentSimilarity is a precomputed item-item similarity between two pieces
+// of content. Rows are rebuilt in bulk by the recommendation job; each
+// content keeps only its closest neighbours.
+type ContentSimilarity struct {
+	ContentID        uint      `json:"content_id" gorm:"primaryKey;autoIncrement:false"`
+	SimilarContentID uint      `json:"similar_content_id" gorm:"primaryKey;autoIncrement:false"`
+	Score            float64   `json:"score"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// GeofenceRevision is an immutable snapshot of a fence's geometry and
+// metadata, taken each time it's created, edited or restored. Revision counts
+// up from 1 per fence; AuthorID is who made the change. Activity settings
+// (Disabled, the active window and the schedule) and the fence's place in a
+// hierarchy aren't versioned.
+type GeofenceRevision struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	GeofenceID  uint      `json:"geofence_id" gorm:"uniqueIndex:idx_geofence_revision"`
+	Revision    int       `json:"revision" gorm:"uniqueIndex:idx_geofence_revision"`
+	AuthorID    uint      `json:"author_id" gorm:"index"`
+	CreatedAt   time.Time `json:"created_at"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Type        string    `json:"type"`
+	Latitude    float64   `json:"latitude"`
+	Longitude   float64   `json:"longitude"`
+	Radius      float64   `json:"radius"`
+	Path        Polyline  `json:"path,omitempty"`
+	BufferWidth float64   `json:"buffer_width,omitempty"`
+	MinAltitude *float64  `json:"min_altitude,omitempty"`
+	MaxAltitude *float64  `json:"max_altitude,omitempty"`
+	AltitudeRef string    `json:"altitude_ref,omitempty"`
+}
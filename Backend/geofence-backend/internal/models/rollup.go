@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Rollup granularities
+const (
+	RollupHourly = "hour"
+	RollupDaily  = "day"
+)
+
+// Item types that analytics are kept for
+const (
+	ItemTypeGeofence = "geofence"
+	ItemTypeContent  = "content"
+)
+
+// AnalyticsRollup summarizes the visits and interactions of one geofence or
+// content item over one hour or one UTC day. Content rows only carry
+// interaction counts; geofence rows include the interactions on their content.
+type AnalyticsRollup struct {
+	ID                uint      `json:"-" gorm:"primaryKey"`
+	Granularity       string    `json:"granularity" gorm:"uniqueIndex:idx_rollup_bucket;not null"`
+	ItemType          string    `json:"item_type" gorm:"uniqueIndex:idx_rollup_bucket;not null"`
+	ItemID            uint      `json:"item_id" gorm:"uniqueIndex:idx_rollup_bucket;not null"`
+	BucketStart       time.Time `json:"bucket_start" gorm:"uniqueIndex:idx_rollup_bucket;index;not null"`
+	Visits            int64     `json:"visits"`
+	UniqueVisitors    int64     `json:"unique_visitors"`
+	DwellCount        int64     `json:"dwell_count"`
+	DwellSecondsTotal float64   `json:"dwell_seconds_total"`
+	Views             int64     `json:"views"`
+	Likes             int64     `json:"likes"`
+	Favorites         int64     `json:"favorites"`
+	Reposts           int64     `json:"reposts"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// RollupWatermark records how far a background aggregation has got: every
+// bucket ending at or before ProcessedUntil has been rolled up.
+type RollupWatermark struct {
+	Name           string    `json:"name" gorm:"primaryKey"`
+	ProcessedUntil time.Time `json:"processed_until"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// GeofenceSchedule is a weekly window during which a geofence is active.
+// Weekday counts from Sunday (0) and Start and End are "HH:MM" in the
+// fence's time zone; a window whose End is at or before its Start runs past
+// midnight into the next day.
+type GeofenceSchedule struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	GeofenceID uint   `json:"geofence_id" gorm:"index;not null"`
+	Weekday    int    `json:"weekday"`
+	Start      string `json:"start" gorm:"not null"`
+	End        string `json:"end" gorm:"not null"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// Follow is a directed edge in the follow graph: FollowerID follows FollowingID
+type Follow struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	FollowerID  uint      `json:"follower_id" gorm:"not null;uniqueIndex:idx_follow_pair"`
+	FollowingID uint      `json:"following_id" gorm:"not null;uniqueIndex:idx_follow_pair;index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UserRestriction records that UserID has blocked or muted TargetID
+type UserRestriction struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_restriction"`
+	TargetID  uint      `json:"target_id" gorm:"not null;uniqueIndex:idx_restriction;index"`
+	Kind      string    `json:"kind" gorm:"not null;uniqueIndex:idx_restriction"` // "block", "mute"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Restriction kinds stored in UserRestriction.Kind.
+// A block hides the blocker's fences and content from the target and stops
+// the target from interacting with them; a mute only hides the target's
+// fences and content from the muter's listings.
+const (
+	RestrictionBlock = "block"
+	RestrictionMute  = "mute"
+)
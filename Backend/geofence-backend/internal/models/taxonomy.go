@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Category is an admin-managed classification for geofences. Categories form
+// a tree through ParentID; filtering by a category includes its descendants.
+type Category struct {
+	gorm.Model
+	Name        string     `json:"name" gorm:"not null"`
+	Slug        string     `json:"slug" gorm:"uniqueIndex;not null"`
+	Description string     `json:"description"`
+	ParentID    *uint      `json:"parent_id" gorm:"index"`
+	Children    []Category `json:"children,omitempty" gorm:"foreignKey:ParentID"`
+}
+
+// Tag is a free-form, user-supplied label. Names are stored normalized
+// (lowercase, hyphenated) so "Coffee Shop" and "coffee-shop" are one tag.
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,261 @@
+// internal/services/account_service.go
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// EmailVerificationTTL is how long an email change link stays valid
+const EmailVerificationTTL = 24 * time.Hour
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrNoDeletionScheduled      = errors.New("account deletion is not scheduled")
+	ErrEmailTaken               = errors.New("email already exists")
+)
+
+// AccountService manages email changes and account deletion
+type AccountService struct{}
+
+// AccountDeletionGracePeriod returns how long a deleted account is kept
+// before it is purged, from ACCOUNT_DELETION_GRACE_DAYS (default 30 days)
+func AccountDeletionGracePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || days < 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// RequestEmailChange stores newEmail as pending within tx and sends a
+// verification link to it. The current email stays active until the link is
+// used.
+func (s *AccountService) RequestEmailChange(tx *gorm.DB, user *models.User, newEmail string) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(EmailVerificationTTL)
+	err = tx.Model(user).Updates(map[string]interface{}{
+		"pending_email":                 newEmail,
+		"email_verification_token_hash": hashToken(token),
+		"email_verification_expires_at": expiresAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	return (&EmailService{}).SendEmailVerification(newEmail, token)
+}
+
+// VerifyEmail promotes the pending email matching token to the user's email.
+// If another account has taken the address since the change was requested,
+// the pending change is dropped and ErrEmailTaken returned.
+func (s *AccountService) VerifyEmail(token string) (*models.User, error) {
+	var user models.User
+	err := database.DB.Where("email_verification_token_hash = ? AND email_verification_expires_at > ?", hashToken(token), time.Now()).
+		First(&user).Error
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	taken := false
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"pending_email":                 "",
+			"email_verification_token_hash": "",
+			"email_verification_expires_at": nil,
+		}
+
+		var count int64
+		if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", user.PendingEmail, user.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			taken = true
+		} else {
+			updates["email"] = user.PendingEmail
+		}
+		return tx.Model(&user).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrEmailTaken
+	}
+
+	return &user, nil
+}
+
+// ScheduleDeletion marks the account for deletion after the grace period and
+// returns when it will be purged
+func (s *AccountService) ScheduleDeletion(user *models.User) (time.Time, error) {
+	purgeAt := time.Now().Add(AccountDeletionGracePeriod())
+	if err := database.DB.Model(user).Update("deletion_scheduled_at", purgeAt).Error; err != nil {
+		return time.Time{}, err
+	}
+	return purgeAt, nil
+}
+
+// CancelDeletion keeps an account that was scheduled for deletion
+func (s *AccountService) CancelDeletion(user *models.User) error {
+	if user.DeletionScheduledAt == nil {
+		return ErrNoDeletionScheduled
+	}
+	return database.DB.Model(user).Update("deletion_scheduled_at", nil).Error
+}
+
+// PurgeDueAccounts permanently deletes every account whose grace period has ended
+func (s *AccountService) PurgeDueAccounts() error {
+	var userIDs []uint
+	err := database.DB.Model(&models.User{}).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", time.Now()).
+		Pluck("id", &userIDs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if err := s.PurgeAccount(userID); err != nil {
+			return err
+		}
+		log.Printf("Purged account %d", userID)
+	}
+	return nil
+}
+
+// PurgeAccount permanently deletes a user and everything they own. Their
+// geofences, groups, content, shares, reactions, preferences and social
+// edges are removed; view and visit history is kept for analytics with the
+// user ID cleared.
+func (s *AccountService) PurgeAccount(userID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var geofenceIDs []uint
+		if err := tx.Unscoped().Model(&models.Geofence{}).Where("user_id = ?", userID).Pluck("id", &geofenceIDs).Error; err != nil {
+			return err
+		}
+
+		var contentIDs []uint
+		if err := tx.Unscoped().Model(&models.Content{}).Where("geofence_id IN ?", geofenceIDs).Pluck("id", &contentIDs).Error; err != nil {
+			return err
+		}
+
+		// Everything attached to the user's own fences goes with them
+		if err := tx.Unscoped().Where("content_id IN ?", contentIDs).Delete(&models.ContentInteraction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("id IN ?", contentIDs).Delete(&models.Content{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("geofence_id IN ?", geofenceIDs).Delete(&models.GeofenceVisit{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("geofence_id IN ? OR user_id = ?", geofenceIDs, userID).Delete(&models.RouteDeviation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("geofence_id IN ?", geofenceIDs).Delete(&models.GeofenceSchedule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("geofence_id IN ?", geofenceIDs).Delete(&models.GeofenceRevision{}).Error; err != nil {
+			return err
+		}
+		// The user's groups go too, and their fences leave other groups
+		groupIDs := tx.Unscoped().Model(&models.GeofenceGroup{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("group_id IN (?) OR subscription_id IN (?)", groupIDs,
+			tx.Model(&models.GroupSubscription{}).Select("id").Where("user_id = ?", userID)).Delete(&models.GroupEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id IN (?) OR user_id = ?", groupIDs, userID).Delete(&models.GroupSubscription{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id IN (?) OR user_id = ?", groupIDs, userID).Delete(&models.GeofenceGroupShare{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM geofence_group_members WHERE geofence_group_id IN (?) OR geofence_id IN ?", groupIDs, geofenceIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.GeofenceGroup{}).Error; err != nil {
+			return err
+		}
+
+		// Other people's fences nested in the user's become top-level
+		if err := tx.Unscoped().Model(&models.Geofence{}).Where("parent_id IN ?", geofenceIDs).Update("parent_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("id IN ?", geofenceIDs).Delete(&models.Geofence{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("geofence_id IN ? OR owner_id = ? OR user_id = ?", geofenceIDs, userID, userID).Delete(&models.GeofenceShare{}).Error; err != nil {
+			return err
+		}
+
+		// Withdraw the user's reactions on other people's content so the
+		// denormalized counters stay accurate
+		for reactionType, column := range reactionCountColumns {
+			reacted := tx.Model(&models.ContentInteraction{}).Select("content_id").
+				Where("user_id = ? AND interaction_type = ?", userID, reactionType)
+			err := tx.Model(&models.Content{}).Where("id IN (?) AND "+column+" > 0", reacted).
+				UpdateColumn(column, gorm.Expr(column+" - 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		reactionTypes := []string{models.InteractionLike, models.InteractionFavorite, models.InteractionRepost}
+		if err := tx.Unscoped().Where("user_id = ? AND interaction_type IN ?", userID, reactionTypes).Delete(&models.ContentInteraction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.ContentInteraction{}).Where("user_id = ?", userID).Update("user_id", 0).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.GeofenceVisit{}).Where("user_id = ?", userID).Update("user_id", 0).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.GeofenceRevision{}).Where("author_id = ?", userID).Update("author_id", 0).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.UserPreference{}).Error; err != nil {
+			return err
+		}
+		// Export files are removed by the export cleanup job once expired
+		if err := tx.Model(&models.ExportJob{}).Where("user_id = ?", userID).Update("expires_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("follower_id = ? OR following_id = ?", userID, userID).Delete(&models.Follow{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR target_id = ?", userID, userID).Delete(&models.UserRestriction{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&models.User{}, userID).Error
+	})
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,341 @@
+// internal/services/bulk_service.go
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MaxBulkOperations caps the operations in one batch
+const MaxBulkOperations = 500
+
+// Bulk modes: a transactional batch is applied all or nothing, a best-effort
+// batch applies every operation it can
+const (
+	BulkTransactional = "transactional"
+	BulkBestEffort    = "best_effort"
+)
+
+// Bulk operations and the resources they work on
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+
+	BulkGeofence = "geofence"
+	BulkContent  = "content"
+)
+
+// Statuses of the operations in a batch
+const (
+	BulkApplied    = "applied"
+	BulkFailed     = "failed"
+	BulkNotApplied = "not_applied"
+)
+
+var (
+	ErrNoBulkOperations      = errors.New("operations are required")
+	ErrTooManyBulkOperations = fmt.Errorf("a batch can have at most %d operations", MaxBulkOperations)
+	ErrUnknownBulkMode       = errors.New("mode must be transactional or best_effort")
+	ErrUnknownBulkOperation  = errors.New("op must be create, update or delete and resource geofence or content")
+	ErrBulkMissingData       = errors.New("create and update need the geofence or content to write")
+	ErrBulkDuplicateTarget   = errors.New("a batch can change each geofence or content only once")
+	ErrBulkNotFound          = errors.New("not found")
+	ErrBulkForbidden         = errors.New("you can only change geofences you own or can edit")
+	ErrBulkTitleRequired     = errors.New("content title is required")
+)
+
+// BulkService applies batches of geofence and content changes
+type BulkService struct{}
+
+// BulkOperation is one change in a batch. Updates and deletes name their
+// target by ID; creates and updates carry the geofence or content to write.
+type BulkOperation struct {
+	Op       string           `json:"op"`
+	Resource string           `json:"resource"`
+	ID       uint             `json:"id,omitempty"`
+	Geofence *models.Geofence `json:"geofence,omitempty"`
+	Content  *models.Content  `json:"content,omitempty"`
+}
+
+// BulkItemResult is what happened to one operation, by its index in the
+// batch. ID is the geofence or content it changed.
+type BulkItemResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	ID     uint   `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BulkResult is the outcome of a batch
+type BulkResult struct {
+	Mode    string           `json:"mode"`
+	Applied int              `json:"applied"`
+	Failed  int              `json:"failed"`
+	Results []BulkItemResult `json:"results"`
+}
+
+// bulkItem is a validated operation with what it will write
+type bulkItem struct {
+	op       BulkOperation
+	geofence *models.Geofence
+	previous models.Geofence
+	content  *models.Content
+}
+
+// Run validates every operation in a batch and applies them. In
+// transactional mode nothing is applied unless every operation is valid and
+// succeeds; in best-effort mode each valid operation is applied on its own.
+// Errors are reported per operation; the returned error is only for a batch
+// that can't be run at all.
+func (s *BulkService) Run(userID uint, mode string, operations []BulkOperation) (*BulkResult, error) {
+	if mode == "" {
+		mode = BulkTransactional
+	}
+	if mode != BulkTransactional && mode != BulkBestEffort {
+		return nil, ErrUnknownBulkMode
+	}
+	if len(operations) == 0 {
+		return nil, ErrNoBulkOperations
+	}
+	if len(operations) > MaxBulkOperations {
+		return nil, ErrTooManyBulkOperations
+	}
+
+	result := &BulkResult{Mode: mode, Results: make([]BulkItemResult, len(operations))}
+	items := make([]*bulkItem, len(operations))
+	targets := map[string]bool{}
+	for i, op := range operations {
+		result.Results[i] = BulkItemResult{Index: i, Status: BulkNotApplied, ID: op.ID}
+
+		if op.Op == BulkUpdate || op.Op == BulkDelete {
+			target := fmt.Sprintf("%s/%d", op.Resource, op.ID)
+			if targets[target] {
+				result.fail(i, ErrBulkDuplicateTarget)
+				continue
+			}
+			targets[target] = true
+		}
+
+		item, err := s.prepare(userID, op)
+		if err != nil {
+			result.fail(i, err)
+			continue
+		}
+		items[i] = item
+	}
+
+	if mode == BulkTransactional {
+		if result.Failed > 0 {
+			return result, nil
+		}
+		failed := -1
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			for i, item := range items {
+				if err := s.apply(tx, userID, item); err != nil {
+					failed = i
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil && failed < 0 {
+			return nil, err
+		}
+		if err != nil {
+			result.fail(failed, err)
+			return result, nil
+		}
+		for i, item := range items {
+			result.applied(i, item)
+		}
+		return result, nil
+	}
+
+	for i, item := range items {
+		if item == nil {
+			continue
+		}
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return s.apply(tx, userID, item)
+		})
+		if err != nil {
+			result.fail(i, err)
+			continue
+		}
+		result.applied(i, item)
+	}
+	return result, nil
+}
+
+// fail marks an operation as failed
+func (r *BulkResult) fail(index int, err error) {
+	r.Results[index].Status, r.Results[index].Error = BulkFailed, err.Error()
+	r.Failed++
+}
+
+// applied marks an operation as applied
+func (r *BulkResult) applied(index int, item *bulkItem) {
+	r.Results[index].Status = BulkApplied
+	if item.geofence != nil {
+		r.Results[index].ID = item.geofence.ID
+	} else {
+		r.Results[index].ID = item.content.ID
+	}
+	r.Applied++
+}
+
+// prepare checks an operation against the database as it is before the
+// batch and works out what it will write. Geofences go through
+// GeofenceValidationService and the hierarchy rules, like single edits do.
+func (s *BulkService) prepare(userID uint, op BulkOperation) (*bulkItem, error) {
+	item := &bulkItem{op: op}
+	validator := &GeofenceValidationService{}
+	hierarchy := &HierarchyService{}
+
+	switch {
+	case op.Resource == BulkGeofence && op.Op == BulkCreate:
+		if op.Geofence == nil {
+			return nil, ErrBulkMissingData
+		}
+		fence := *op.Geofence
+		fence.Model = gorm.Model{}
+		fence.UserID, fence.Revision = userID, 0
+		fence.Contents, fence.Categories, fence.Tags = nil, nil, nil
+		for i := range fence.Schedule {
+			fence.Schedule[i].ID = 0
+		}
+		if err := validator.ValidateGeofence(&fence); err != nil {
+			return nil, err
+		}
+		if err := hierarchy.ValidateHierarchy(fence, userID); err != nil {
+			return nil, err
+		}
+		item.geofence = &fence
+
+	case op.Resource == BulkGeofence && op.Op == BulkUpdate:
+		if op.Geofence == nil {
+			return nil, ErrBulkMissingData
+		}
+		fence, err := s.editableGeofence(userID, op.ID)
+		if err != nil {
+			return nil, err
+		}
+		item.previous = *fence
+		ApplyGeofenceUpdate(fence, *op.Geofence)
+		if err := validator.ValidateGeofence(fence); err != nil {
+			return nil, err
+		}
+		if err := hierarchy.ValidateHierarchy(*fence, userID); err != nil {
+			return nil, err
+		}
+		item.geofence = fence
+
+	case op.Resource == BulkGeofence && op.Op == BulkDelete:
+		fence, err := s.editableGeofence(userID, op.ID)
+		if err != nil {
+			return nil, err
+		}
+		item.geofence = fence
+
+	case op.Resource == BulkContent && op.Op == BulkCreate:
+		if op.Content == nil {
+			return nil, ErrBulkMissingData
+		}
+		content := *op.Content
+		if content.Title == "" {
+			return nil, ErrBulkTitleRequired
+		}
+		if _, err := s.editableGeofence(userID, content.GeofenceID); err != nil {
+			return nil, err
+		}
+		content.Model = gorm.Model{}
+		content.LikeCount, content.FavoriteCount, content.RepostCount = 0, 0, 0
+		content.Tags = nil
+		item.content = &content
+
+	case op.Resource == BulkContent && (op.Op == BulkUpdate || op.Op == BulkDelete):
+		var content models.Content
+		if err := database.DB.First(&content, op.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrBulkNotFound
+			}
+			return nil, err
+		}
+		if _, err := s.editableGeofence(userID, content.GeofenceID); err != nil {
+			return nil, err
+		}
+		if op.Op == BulkUpdate {
+			if op.Content == nil {
+				return nil, ErrBulkMissingData
+			}
+			content.Title, content.Description = op.Content.Title, op.Content.Description
+			content.Type, content.URL = op.Content.Type, op.Content.URL
+		}
+		item.content = &content
+
+	default:
+		return nil, ErrUnknownBulkOperation
+	}
+	return item, nil
+}
+
+// editableGeofence loads a geofence the user owns or can edit
+func (s *BulkService) editableGeofence(userID, geofenceID uint) (*models.Geofence, error) {
+	var fence models.Geofence
+	if err := database.DB.First(&fence, geofenceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBulkNotFound
+		}
+		return nil, err
+	}
+	if fence.UserID != userID && (&GeofenceAccessService{}).CheckGeofenceAccess(userID, fence.ID, "edit") != nil {
+		return nil, ErrBulkForbidden
+	}
+	return &fence, nil
+}
+
+// apply writes a prepared operation, keeping revisions and the trash as
+// single edits do
+func (s *BulkService) apply(tx *gorm.DB, userID uint, item *bulkItem) error {
+	revisions := &RevisionService{}
+
+	switch {
+	case item.geofence != nil && item.op.Op == BulkCreate:
+		if err := tx.Create(item.geofence).Error; err != nil {
+			return err
+		}
+		return revisions.Record(tx, item.geofence, userID)
+
+	case item.geofence != nil && item.op.Op == BulkUpdate:
+		if err := revisions.Baseline(tx, &item.previous); err != nil {
+			return err
+		}
+		item.geofence.Revision = item.previous.Revision
+		if err := SaveGeofence(tx, item.geofence); err != nil {
+			return err
+		}
+		return revisions.Record(tx, item.geofence, userID)
+
+	case item.geofence != nil:
+		if err := (&HierarchyService{}).Detach(tx, *item.geofence); err != nil {
+			return err
+		}
+		return (&TrashService{}).Trash(tx, item.geofence)
+
+	case item.op.Op == BulkCreate:
+		return tx.Create(item.content).Error
+
+	case item.op.Op == BulkUpdate:
+		// Only the editable columns, so concurrent reactions keep their counts
+		return tx.Model(item.content).Select("title", "description", "type", "url").Updates(item.content).Error
+
+	default:
+		return tx.Delete(item.content).Error
+	}
+}
@@ -0,0 +1,206 @@
+// internal/services/cluster_service.go
+package services
+
+import (
+	"math"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+)
+
+const (
+	// MaxClusterZoom is the deepest zoom fences are clustered at; beyond it
+	// every fence is returned on its own
+	MaxClusterZoom = 16
+
+	// clusterRadius is how close (in pixels of a clusterExtent tile) points
+	// have to be to merge
+	clusterRadius = 60
+	clusterExtent = 512
+)
+
+// ClusterService groups geofences into map marker clusters, the way
+// supercluster does: fences are merged level by level from MaxClusterZoom
+// out, so a cluster at one zoom splits into its children at the next.
+type ClusterService struct{}
+
+// GeofenceCluster is a group of nearby fences. Latitude and Longitude are the
+// centroid of its fences; ExpansionZoom is the zoom at which it splits up.
+type GeofenceCluster struct {
+	Count         int        `json:"count"`
+	Latitude      float64    `json:"latitude"`
+	Longitude     float64    `json:"longitude"`
+	BBox          [4]float64 `json:"bbox"` // minLng, minLat, maxLng, maxLat
+	ExpansionZoom int        `json:"expansion_zoom"`
+}
+
+// ClusterResult is what a viewport shows at one zoom: clusters and the
+// fences that aren't part of any
+type ClusterResult struct {
+	Zoom      int               `json:"zoom"`
+	Clusters  []GeofenceCluster `json:"clusters"`
+	Geofences []models.Geofence `json:"geofences"`
+}
+
+// clusterNode is a fence or cluster in projected coordinates (0-1 on both axes)
+type clusterNode struct {
+	x, y    float64
+	count   int
+	fence   int // index of the fence for single fences, -1 for clusters
+	created int // zoom the cluster formed at
+	bbox    [4]float64
+	zoom    int // lowest zoom the node has been considered at
+}
+
+// Clusters clusters the fences in region for display at zoom. Fences in a
+// margin around the region take part too, so clusters at the edge don't
+// change as the map pans.
+func (s *ClusterService) Clusters(region Region, zoom int, viewerID uint) (*ClusterResult, error) {
+	if zoom < 0 || zoom > MaxTileZoom {
+		return nil, ErrInvalidTile
+	}
+
+	var fences []models.Geofence
+	err := database.DB.Scopes(VisibleGeofences(viewerID), geofenceCentresIn(region.widened())).
+		Order("id").
+		Find(&fences).Error
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*clusterNode, len(fences))
+	for i, fence := range fences {
+		x, y := worldPixel(fence.Latitude, fence.Longitude, 0)
+		nodes[i] = &clusterNode{
+			x:       x / TileSize,
+			y:       y / TileSize,
+			count:   1,
+			fence:   i,
+			created: MaxClusterZoom + 1,
+			bbox:    [4]float64{fence.Longitude, fence.Latitude, fence.Longitude, fence.Latitude},
+			zoom:    math.MaxInt32,
+		}
+	}
+
+	for z := MaxClusterZoom; z >= zoom; z-- {
+		nodes = clusterLevel(nodes, z)
+	}
+
+	result := &ClusterResult{Zoom: zoom, Clusters: []GeofenceCluster{}, Geofences: []models.Geofence{}}
+	for _, node := range nodes {
+		lat, lng := unproject(node.x, node.y)
+		if !region.Contains(lat, lng) {
+			continue
+		}
+		if node.fence >= 0 {
+			result.Geofences = append(result.Geofences, fences[node.fence])
+			continue
+		}
+		result.Clusters = append(result.Clusters, GeofenceCluster{
+			Count:         node.count,
+			Latitude:      lat,
+			Longitude:     lng,
+			BBox:          node.bbox,
+			ExpansionZoom: node.created + 1,
+		})
+	}
+	return result, nil
+}
+
+// widened grows the region by half its size on every side, wrapping round
+// the antimeridian. A region that would go all the way round covers every
+// longitude.
+func (r Region) widened() Region {
+	width := r.MaxLng - r.MinLng
+	if r.Crosses() {
+		width += 360
+	}
+	latMargin, lngMargin := (r.MaxLat-r.MinLat)/2, width/2
+	wide := Region{MinLat: r.MinLat - latMargin, MaxLat: r.MaxLat + latMargin, MinLng: -180, MaxLng: 180}
+	if width+2*lngMargin < 360 {
+		wide.MinLng, wide.MaxLng = wrapLng(r.MinLng-lngMargin), wrapLng(r.MaxLng+lngMargin)
+	}
+	return wide
+}
+
+// wrapLng brings a longitude back into [-180, 180)
+func wrapLng(lng float64) float64 {
+	return math.Mod(math.Mod(lng+180, 360)+360, 360) - 180
+}
+
+// clusterLevel merges the nodes of the level above into the nodes at zoom z
+func clusterLevel(nodes []*clusterNode, z int) []*clusterNode {
+	r := clusterRadius / (clusterExtent * math.Pow(2, float64(z)))
+
+	// A grid of r-sized cells; neighbours are in the 3x3 cells around a node
+	type cell struct{ x, y int }
+	grid := map[cell][]*clusterNode{}
+	cellOf := func(node *clusterNode) cell {
+		return cell{int(math.Floor(node.x / r)), int(math.Floor(node.y / r))}
+	}
+	for _, node := range nodes {
+		c := cellOf(node)
+		grid[c] = append(grid[c], node)
+	}
+
+	var next []*clusterNode
+	for _, node := range nodes {
+		if node.zoom <= z {
+			continue
+		}
+		node.zoom = z
+
+		var neighbours []*clusterNode
+		count := node.count
+		c := cellOf(node)
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				for _, other := range grid[cell{c.x + dx, c.y + dy}] {
+					if other.zoom <= z {
+						continue
+					}
+					if ddx, ddy := other.x-node.x, other.y-node.y; ddx*ddx+ddy*ddy <= r*r {
+						neighbours = append(neighbours, other)
+						count += other.count
+					}
+				}
+			}
+		}
+
+		if len(neighbours) == 0 {
+			next = append(next, node)
+			continue
+		}
+
+		cluster := &clusterNode{
+			x:       node.x * float64(node.count),
+			y:       node.y * float64(node.count),
+			count:   count,
+			fence:   -1,
+			created: z,
+			bbox:    node.bbox,
+			zoom:    math.MaxInt32,
+		}
+		for _, other := range neighbours {
+			other.zoom = z
+			cluster.x += other.x * float64(other.count)
+			cluster.y += other.y * float64(other.count)
+			cluster.bbox = [4]float64{
+				math.Min(cluster.bbox[0], other.bbox[0]),
+				math.Min(cluster.bbox[1], other.bbox[1]),
+				math.Max(cluster.bbox[2], other.bbox[2]),
+				math.Max(cluster.bbox[3], other.bbox[3]),
+			}
+		}
+		cluster.x /= float64(count)
+		cluster.y /= float64(count)
+		next = append(next, cluster)
+	}
+	return next
+}
+
+// unproject turns projected (0-1) coordinates back into latitude and longitude
+func unproject(x, y float64) (float64, float64) {
+	lat := math.Atan(math.Sinh(math.Pi*(1-2*y))) * 180 / math.Pi
+	return lat, x*360 - 180
+}
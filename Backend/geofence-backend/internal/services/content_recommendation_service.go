@@ -2,26 +2,494 @@
 package services
 
 import (
+	"math"
+	"sort"
+	"time"
+
 	"geofence/internal/database"
 	"geofence/internal/models"
+
+	"gorm.io/gorm"
 )
 
+const (
+	// similarityNeighbours is how many similar items are kept per content
+	similarityNeighbours = 20
+
+	// similarityHistory is how far back interactions feed the similarity job
+	similarityHistory = 180 * 24 * time.Hour
+
+	// similarityItemsPerUser caps the items each user contributes to the
+	// similarity job, their strongest signals first. Pair counting is
+	// quadratic in it.
+	similarityItemsPerUser = 50
+
+	// similarityUserBatch is how many users' signals the job loads at once
+	similarityUserBatch = 500
+
+	// proximityWeight is the share of the final score that comes from distance
+	// when the caller sends a location
+	proximityWeight = 0.3
+
+	// nearbyCandidateRadiusKm bounds the popular-nearby fallback
+	nearbyCandidateRadiusKm = 25.0
+
+	defaultPreferenceRadius = 500.0 // metres, matches UserPreference.DefaultRadius
+)
+
+// interactionWeights is how strongly each signal says "I'm interested in this".
+// A visit to a fence counts towards every piece of content in it.
+var interactionWeights = map[string]float64{
+	models.InteractionView:     1,
+	models.InteractionLike:     3,
+	models.InteractionRepost:   3,
+	models.InteractionFavorite: 4,
+}
+
+const visitWeight = 0.5
+
+// ContentRecommendationService recommends content using item-item
+// collaborative filtering over interactions and visits, blended with how
+// close the content is to the user. Of the user's preferences only
+// DefaultRadius bears on it, as the distance that counts as nearby; the
+// others are display settings.
 type ContentRecommendationService struct{}
 
-// RecommendContentForGeofence suggests content based on user interactions
-func (s *ContentRecommendationService) RecommendContentForGeofence(geofenceID uint) ([]models.Content, error) {
-	var recommendedContents []models.Content
-
-	// Complex recommendation logic
-	database.DB.Raw(`
-		SELECT c.* 
-		FROM contents c
-		JOIN geofence_visits v ON c.geofence_id = v.geofence_id
-		WHERE c.geofence_id = ? 
-		GROUP BY c.id 
-		ORDER BY COUNT(v.id) DESC 
-		LIMIT 5
-	`, geofenceID).Scan(&recommendedContents)
-
-	return recommendedContents, nil
-}
\ No newline at end of file
+// RecommendationOptions describes a recommendation request
+type RecommendationOptions struct {
+	UserID    uint
+	Latitude  *float64
+	Longitude *float64
+	Limit     int
+}
+
+// Recommendation is a recommended content item with the reason it was chosen
+type Recommendation struct {
+	Content    models.Content `json:"content"`
+	Score      float64        `json:"score"`
+	Reason     string         `json:"reason"`
+	DistanceKm *float64       `json:"distance_km,omitempty"`
+}
+
+// signal is one user's interest in one content item
+type signal struct {
+	userID    uint
+	contentID uint
+	weight    float64
+	source    string
+}
+
+// ComputeSimilarities rebuilds the content_similarities table from recent
+// interactions and visits using cosine similarity. It's run periodically.
+// Users are read in batches, each contributing at most
+// similarityItemsPerUser items, so the work per user is bounded.
+func (s *ContentRecommendationService) ComputeSimilarities() error {
+	since := time.Now().Add(-similarityHistory)
+	userIDs, err := s.signalUsers(since)
+	if err != nil {
+		return err
+	}
+
+	norms := map[uint]float64{}
+	dots := map[uint]map[uint]float64{}
+	for len(userIDs) > 0 {
+		batch := userIDs
+		if len(batch) > similarityUserBatch {
+			batch = batch[:similarityUserBatch]
+		}
+		userIDs = userIDs[len(batch):]
+
+		signals, err := s.loadSignals(batch, since)
+		if err != nil {
+			return err
+		}
+
+		// Sparse user x item matrix
+		byUser := map[uint]map[uint]float64{}
+		for _, sig := range signals {
+			if byUser[sig.userID] == nil {
+				byUser[sig.userID] = map[uint]float64{}
+			}
+			byUser[sig.userID][sig.contentID] += sig.weight
+		}
+
+		// Dot products between every pair of items sharing a user
+		for _, items := range byUser {
+			items = strongestItems(items, similarityItemsPerUser)
+			for a, wa := range items {
+				norms[a] += wa * wa
+				for b, wb := range items {
+					if a == b {
+						continue
+					}
+					if dots[a] == nil {
+						dots[a] = map[uint]float64{}
+					}
+					dots[a][b] += wa * wb
+				}
+			}
+		}
+	}
+
+	now := time.Now()
+	var rows []models.ContentSimilarity
+	for a, neighbours := range dots {
+		var scored []models.ContentSimilarity
+		for b, dot := range neighbours {
+			scored = append(scored, models.ContentSimilarity{
+				ContentID:        a,
+				SimilarContentID: b,
+				Score:            dot / math.Sqrt(norms[a]*norms[b]),
+				UpdatedAt:        now,
+			})
+		}
+		sort.Slice(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+		if len(scored) > similarityNeighbours {
+			scored = scored[:similarityNeighbours]
+		}
+		rows = append(rows, scored...)
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.ContentSimilarity{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, 500).Error
+	})
+}
+
+// Recommend returns content for the user ranked by similarity to what they've
+// engaged with, nudged towards content near them. Users with no history get
+// popular content, preferring what's nearby.
+func (s *ContentRecommendationService) Recommend(opts RecommendationOptions) ([]Recommendation, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 20
+	}
+
+	history, err := s.loadSignals([]uint{opts.UserID}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	// The user's strongest signal per item, used both as the query and to
+	// explain recommendations
+	profile := map[uint]signal{}
+	for _, sig := range history {
+		current, seen := profile[sig.contentID]
+		if !seen {
+			profile[sig.contentID] = sig
+			continue
+		}
+		current.weight += sig.weight
+		if interactionWeights[sig.source] > interactionWeights[current.source] {
+			current.source = sig.source
+		}
+		profile[sig.contentID] = current
+	}
+
+	scores, because, err := s.scoreCandidates(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	candidateIDs := make([]uint, 0, len(scores))
+	for id := range scores {
+		candidateIDs = append(candidateIDs, id)
+	}
+
+	near := s.userLocation(opts)
+	if near != nil {
+		nearby, err := s.popularContentIDs(opts.UserID, near, 100)
+		if err != nil {
+			return nil, err
+		}
+		candidateIDs = append(candidateIDs, nearby...)
+	}
+	if len(candidateIDs) < opts.Limit {
+		popular, err := s.popularContentIDs(opts.UserID, nil, opts.Limit*2)
+		if err != nil {
+			return nil, err
+		}
+		candidateIDs = append(candidateIDs, popular...)
+	}
+
+	type candidate struct {
+		models.Content
+		FenceLatitude  float64
+		FenceLongitude float64
+	}
+	var candidates []candidate
+	err = database.DB.Model(&models.Content{}).
+		Joins("JOIN geofences ON geofences.id = contents.geofence_id AND geofences.deleted_at IS NULL").
+		Scopes(VisibleContents(opts.UserID)).
+		Where("contents.id IN ?", uniqueIDs(candidateIDs)).
+		Select("contents.*, geofences.latitude AS fence_latitude, geofences.longitude AS fence_longitude").
+		Scan(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := s.sourceNames(because)
+	if err != nil {
+		return nil, err
+	}
+
+	maxScore := 0.0
+	for _, score := range scores {
+		maxScore = math.Max(maxScore, score)
+	}
+
+	results := make([]Recommendation, 0, len(candidates))
+	for _, c := range candidates {
+		if _, seen := profile[c.ID]; seen {
+			continue
+		}
+
+		rec := Recommendation{Content: c.Content, Reason: "Popular right now"}
+		if score, ok := scores[c.ID]; ok && maxScore > 0 {
+			rec.Score = score / maxScore
+			rec.Reason = explain(profile[because[c.ID]], names[because[c.ID]])
+		} else {
+			// Popularity alone ranks below any collaborative match
+			rec.Score = 0.1 * popularity(c.Content)
+		}
+
+		if near != nil {
+			distance := (&GeofenceValidationService{}).CalculateDistance(near.Latitude, near.Longitude, c.FenceLatitude, c.FenceLongitude)
+			rec.DistanceKm = &distance
+			proximity := proximityScore(distance, near.RadiusKm)
+			rec.Score = (1-proximityWeight)*rec.Score + proximityWeight*proximity
+			if _, ok := scores[c.ID]; !ok && distance <= nearbyCandidateRadiusKm {
+				rec.Reason = "Popular near you"
+			}
+		}
+
+		results = append(results, rec)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results, nil
+}
+
+// scoreCandidates sums weighted similarities from the user's items to their
+// neighbours, remembering which of the user's items contributed most
+func (s *ContentRecommendationService) scoreCandidates(profile map[uint]signal) (map[uint]float64, map[uint]uint, error) {
+	scores := map[uint]float64{}
+	because := map[uint]uint{}
+	if len(profile) == 0 {
+		return scores, because, nil
+	}
+
+	sourceIDs := make([]uint, 0, len(profile))
+	for id := range profile {
+		sourceIDs = append(sourceIDs, id)
+	}
+
+	var similarities []models.ContentSimilarity
+	if err := database.DB.Where("content_id IN ?", sourceIDs).Find(&similarities).Error; err != nil {
+		return nil, nil, err
+	}
+
+	best := map[uint]float64{}
+	for _, sim := range similarities {
+		if _, own := profile[sim.SimilarContentID]; own {
+			continue
+		}
+		contribution := profile[sim.ContentID].weight * sim.Score
+		scores[sim.SimilarContentID] += contribution
+		if contribution > best[sim.SimilarContentID] {
+			best[sim.SimilarContentID] = contribution
+			because[sim.SimilarContentID] = sim.ContentID
+		}
+	}
+	return scores, because, nil
+}
+
+// strongestItems keeps a user's n highest weighted items
+func strongestItems(items map[uint]float64, n int) map[uint]float64 {
+	if len(items) <= n {
+		return items
+	}
+	ids := make([]uint, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if items[ids[i]] != items[ids[j]] {
+			return items[ids[i]] > items[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	kept := make(map[uint]float64, n)
+	for _, id := range ids[:n] {
+		kept[id] = items[id]
+	}
+	return kept
+}
+
+// signalUsers lists, in order, the users with interactions or visits since
+// the given time
+func (s *ContentRecommendationService) signalUsers(since time.Time) ([]uint, error) {
+	var interacted, visited []uint
+	err := database.DB.Model(&models.ContentInteraction{}).
+		Where("user_id <> 0 AND created_at >= ?", since).
+		Distinct().Pluck("user_id", &interacted).Error
+	if err != nil {
+		return nil, err
+	}
+	err = database.DB.Model(&models.GeofenceVisit{}).
+		Where("user_id <> 0 AND created_at >= ?", since).
+		Distinct().Pluck("user_id", &visited).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[uint]bool{}
+	var userIDs []uint
+	for _, id := range append(interacted, visited...) {
+		if !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	return userIDs, nil
+}
+
+// loadSignals reads the given users' interactions and visits since the
+// given time
+func (s *ContentRecommendationService) loadSignals(userIDs []uint, since time.Time) ([]signal, error) {
+	var interactions []models.ContentInteraction
+	query := database.DB.Select("user_id", "content_id", "interaction_type").
+		Where("user_id <> 0 AND user_id IN ? AND created_at >= ?", userIDs, since)
+	if err := query.Find(&interactions).Error; err != nil {
+		return nil, err
+	}
+
+	var signals []signal
+	for _, interaction := range interactions {
+		if weight, ok := interactionWeights[interaction.InteractionType]; ok {
+			signals = append(signals, signal{interaction.UserID, interaction.ContentID, weight, interaction.InteractionType})
+		}
+	}
+
+	var visits []struct {
+		UserID    uint
+		ContentID uint
+	}
+	visitQuery := database.DB.Model(&models.GeofenceVisit{}).
+		Select("DISTINCT geofence_visits.user_id, contents.id AS content_id").
+		Joins("JOIN contents ON contents.geofence_id = geofence_visits.geofence_id AND contents.deleted_at IS NULL").
+		Where("geofence_visits.user_id IN ? AND geofence_visits.created_at >= ?", userIDs, since)
+	if err := visitQuery.Scan(&visits).Error; err != nil {
+		return nil, err
+	}
+	for _, visit := range visits {
+		signals = append(signals, signal{visit.UserID, visit.ContentID, visitWeight, "visit"})
+	}
+
+	return signals, nil
+}
+
+// userLocation returns the point and "nearby" radius to blend proximity with,
+// or nil when the caller didn't send a location
+func (s *ContentRecommendationService) userLocation(opts RecommendationOptions) *GeoFilter {
+	if opts.Latitude == nil || opts.Longitude == nil {
+		return nil
+	}
+
+	radius := defaultPreferenceRadius
+	var preference models.UserPreference
+	if err := database.DB.Where("user_id = ?", opts.UserID).First(&preference).Error; err == nil && preference.DefaultRadius > 0 {
+		radius = preference.DefaultRadius
+	}
+
+	return &GeoFilter{Latitude: *opts.Latitude, Longitude: *opts.Longitude, RadiusKm: radius / 1000}
+}
+
+// popularContentIDs returns the most reacted-to visible content, optionally
+// limited to fences near a point
+func (s *ContentRecommendationService) popularContentIDs(viewerID uint, near *GeoFilter, limit int) ([]uint, error) {
+	query := database.DB.Model(&models.Content{}).
+		Joins("JOIN geofences ON geofences.id = contents.geofence_id AND geofences.deleted_at IS NULL").
+		Scopes(VisibleContents(viewerID))
+	if near != nil {
+		query = query.Scopes(WithinBoundingBox("geofences", GeoFilter{Latitude: near.Latitude, Longitude: near.Longitude, RadiusKm: nearbyCandidateRadiusKm}))
+	}
+
+	var ids []uint
+	err := query.Order("contents.like_count + contents.favorite_count + contents.repost_count DESC, contents.created_at DESC").
+		Limit(limit).
+		Pluck("contents.id", &ids).Error
+	return ids, err
+}
+
+// sourceNames returns, for each content the user engaged with, the name to
+// show in an explanation: the content title, or the fence name for visits
+func (s *ContentRecommendationService) sourceNames(because map[uint]uint) (map[uint][2]string, error) {
+	ids := make([]uint, 0, len(because))
+	for _, id := range because {
+		ids = append(ids, id)
+	}
+
+	var rows []struct {
+		ID           uint
+		Title        string
+		GeofenceName string
+	}
+	err := database.DB.Unscoped().Model(&models.Content{}).
+		Select("contents.id, contents.title, geofences.name AS geofence_name").
+		Joins("LEFT JOIN geofences ON geofences.id = contents.geofence_id").
+		Where("contents.id IN ?", ids).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[uint][2]string{}
+	for _, row := range rows {
+		names[row.ID] = [2]string{row.Title, row.GeofenceName}
+	}
+	return names, nil
+}
+
+// explain turns the user's strongest tie to a similar item into a reason
+func explain(source signal, names [2]string) string {
+	title, fence := names[0], names[1]
+	if source.source == "visit" && fence != "" {
+		return "Because you visited \"" + fence + "\""
+	}
+
+	verbs := map[string]string{
+		models.InteractionLike:     "liked",
+		models.InteractionFavorite: "favorited",
+		models.InteractionRepost:   "reposted",
+		models.InteractionView:     "viewed",
+	}
+
+	verb, ok := verbs[source.source]
+	if !ok || title == "" {
+		return "Similar to content you've engaged with"
+	}
+	return "Because you " + verb + " \"" + title + "\""
+}
+
+// proximityScore is 1 within the user's preferred radius and falls off with distance beyond it
+func proximityScore(distanceKm, radiusKm float64) float64 {
+	if distanceKm <= radiusKm {
+		return 1
+	}
+	return radiusKm / distanceKm
+}
+
+// popularity maps reaction counts to [0, 1)
+func popularity(content models.Content) float64 {
+	total := float64(content.LikeCount + content.FavoriteCount + content.RepostCount)
+	return total / (total + 10)
+}
@@ -0,0 +1,32 @@
+// internal/services/email_service.go
+package services
+
+import (
+	"log"
+	"net/url"
+	"os"
+)
+
+// EmailService delivers transactional email. No mail provider is wired up
+// yet, so messages are only noted in the server log.
+type EmailService struct{}
+
+// SendEmailVerification sends the link that confirms a new email address.
+// The link carries the token that verifies the change, so it's only logged
+// when EMAIL_LOG_LINKS=true, for local development.
+func (s *EmailService) SendEmailVerification(to, token string) error {
+	if os.Getenv("EMAIL_LOG_LINKS") != "true" {
+		log.Printf("Email verification sent to %s", to)
+		return nil
+	}
+	link := frontendURL() + "/verify-email?token=" + url.QueryEscape(token)
+	log.Printf("Email verification for %s (EMAIL_LOG_LINKS is on; never in production): %s", to, link)
+	return nil
+}
+
+func frontendURL() string {
+	if u := os.Getenv("FRONTEND_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:3000"
+}
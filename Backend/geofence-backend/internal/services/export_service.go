@@ -0,0 +1,499 @@
+// internal/services/export_service.go
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxSyncExportRows is the largest export served directly; bigger ones
+	// have to run as a job
+	MaxSyncExportRows = 50000
+
+	// MaxActiveExports caps how many jobs a user can have queued or running
+	MaxActiveExports = 3
+
+	// exportRetention is how long a finished export can be downloaded
+	exportRetention = 24 * time.Hour
+
+	// exportStaleAfter is when a job that never finished (e.g. because the
+	// server restarted) is marked failed
+	exportStaleAfter = time.Hour
+)
+
+var (
+	ErrUnknownDataset  = errors.New("unknown export dataset")
+	ErrUnknownFormat   = errors.New("unknown export format")
+	ErrExportForbidden = errors.New("geofence not owned by user")
+	ErrExportTooLarge  = errors.New("export too large")
+	ErrTooManyExports  = errors.New("too many exports in progress")
+	ErrExportNotFound  = errors.New("export not found")
+	ErrExportNotReady  = errors.New("export not ready")
+)
+
+// exportModels are the models each dataset's rows are read into. Their JSON
+// field names are the export's column names.
+var exportModels = map[string]interface{}{
+	models.ExportDatasetVisits:       models.GeofenceVisit{},
+	models.ExportDatasetInteractions: models.ContentInteraction{},
+	models.ExportDatasetGeofences:    models.Geofence{},
+}
+
+// ExportService exports visits, interactions and geofence definitions as CSV
+// or Parquet, either streamed directly or as a background job
+type ExportService struct{}
+
+// ExportRequest selects what to export. Users can export data for the fences
+// they own; admins can export everything.
+type ExportRequest struct {
+	UserID      uint
+	IsAdmin     bool
+	Dataset     string
+	Format      string
+	From        *time.Time
+	To          *time.Time
+	GeofenceIDs []uint
+}
+
+// Validate checks the dataset, format and that the user owns every
+// requested fence
+func (s *ExportService) Validate(req ExportRequest) error {
+	if _, ok := exportModels[req.Dataset]; !ok {
+		return ErrUnknownDataset
+	}
+	if req.Format != models.ExportFormatCSV && req.Format != models.ExportFormatParquet {
+		return ErrUnknownFormat
+	}
+	if req.IsAdmin || len(req.GeofenceIDs) == 0 {
+		return nil
+	}
+
+	var owned int64
+	err := database.DB.Model(&models.Geofence{}).
+		Where("id IN ? AND user_id = ?", req.GeofenceIDs, req.UserID).
+		Count(&owned).Error
+	if err != nil {
+		return err
+	}
+	if owned < int64(len(uniqueIDs(req.GeofenceIDs))) {
+		return ErrExportForbidden
+	}
+	return nil
+}
+
+// Count returns how many rows an export would contain
+func (s *ExportService) Count(req ExportRequest) (int64, error) {
+	var count int64
+	err := s.query(req).Count(&count).Error
+	return count, err
+}
+
+// Write streams an export to w and returns the number of rows written
+func (s *ExportService) Write(w io.Writer, req ExportRequest) (int64, error) {
+	model := exportModels[req.Dataset]
+	columns := exportColumns(reflect.TypeOf(model))
+
+	out, err := newExportWriter(w, req.Format, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	query := s.query(req)
+	rows, err := query.Order("id").Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var written int64
+	values := make([]interface{}, len(columns))
+	for rows.Next() {
+		item := reflect.New(reflect.TypeOf(model))
+		if err := query.ScanRows(rows, item.Interface()); err != nil {
+			return written, err
+		}
+		for i, column := range columns {
+			values[i] = column.value(item.Elem())
+		}
+		if err := out.WriteRow(values); err != nil {
+			return written, err
+		}
+		written++
+	}
+	if err := rows.Err(); err != nil {
+		return written, err
+	}
+
+	return written, out.Close()
+}
+
+// query selects the rows of an export
+func (s *ExportService) query(req ExportRequest) *gorm.DB {
+	fences := database.DB.Model(&models.Geofence{}).Select("id")
+	if !req.IsAdmin {
+		fences = fences.Where("user_id = ?", req.UserID)
+	}
+	if len(req.GeofenceIDs) > 0 {
+		fences = fences.Where("id IN ?", req.GeofenceIDs)
+	}
+
+	var query *gorm.DB
+	switch req.Dataset {
+	case models.ExportDatasetVisits:
+		query = database.DB.Model(&models.GeofenceVisit{}).Where("geofence_id IN (?)", fences)
+	case models.ExportDatasetInteractions:
+		// Withdrawn reactions are part of the history; DeletedAt says when
+		contents := database.DB.Unscoped().Model(&models.Content{}).Select("id").Where("geofence_id IN (?)", fences)
+		query = database.DB.Unscoped().Model(&models.ContentInteraction{}).Where("content_id IN (?)", contents)
+	default:
+		query = database.DB.Model(&models.Geofence{}).Where("id IN (?)", fences)
+	}
+
+	if req.From != nil {
+		query = query.Where("created_at >= ?", *req.From)
+	}
+	if req.To != nil {
+		query = query.Where("created_at < ?", *req.To)
+	}
+	return query
+}
+
+// StartJob queues an export and runs it in the background
+func (s *ExportService) StartJob(req ExportRequest) (*models.ExportJob, error) {
+	var active int64
+	err := database.DB.Model(&models.ExportJob{}).
+		Where("user_id = ? AND status IN ?", req.UserID, []string{models.ExportPending, models.ExportRunning}).
+		Count(&active).Error
+	if err != nil {
+		return nil, err
+	}
+	if active >= MaxActiveExports {
+		return nil, ErrTooManyExports
+	}
+
+	ids := make([]string, len(req.GeofenceIDs))
+	for i, id := range req.GeofenceIDs {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	job := &models.ExportJob{
+		UserID:      req.UserID,
+		Dataset:     req.Dataset,
+		Format:      req.Format,
+		From:        req.From,
+		To:          req.To,
+		GeofenceIDs: strings.Join(ids, ","),
+		Status:      models.ExportPending,
+	}
+	if err := database.DB.Create(job).Error; err != nil {
+		return nil, err
+	}
+
+	go s.runJob(*job, req)
+	return job, nil
+}
+
+// runJob writes a job's export to the export directory and records the result
+func (s *ExportService) runJob(job models.ExportJob, req ExportRequest) {
+	database.DB.Model(&job).Update("status", models.ExportRunning)
+
+	path, rows, size, err := s.writeFile(job, req)
+	now := time.Now()
+	updates := map[string]interface{}{"completed_at": now}
+	if err != nil {
+		log.Printf("Export job %d failed: %v", job.ID, err)
+		updates["status"] = models.ExportFailed
+		updates["error"] = "Export failed"
+	} else {
+		updates["status"] = models.ExportCompleted
+		updates["file_path"] = path
+		updates["rows"] = rows
+		updates["size"] = size
+		updates["expires_at"] = now.Add(exportRetention)
+	}
+	database.DB.Model(&job).Updates(updates)
+}
+
+func (s *ExportService) writeFile(job models.ExportJob, req ExportRequest) (string, int64, int64, error) {
+	dir := ExportDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", 0, 0, err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("export-%d.%s", job.ID, job.Format))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	rows, err := s.Write(file, req)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return path, rows, info.Size(), nil
+}
+
+// Jobs returns a page of a user's export jobs, newest first, and the total
+func (s *ExportService) Jobs(userID uint, limit, offset int) ([]models.ExportJob, int64, error) {
+	query := database.DB.Model(&models.ExportJob{}).Where("user_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var jobs []models.ExportJob
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&jobs).Error
+	return jobs, total, err
+}
+
+// Job returns one of a user's export jobs
+func (s *ExportService) Job(userID, jobID uint) (*models.ExportJob, error) {
+	var job models.ExportJob
+	err := database.DB.Where("id = ? AND user_id = ?", jobID, userID).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrExportNotFound
+	}
+	return &job, err
+}
+
+// DownloadPath returns the file of a finished, unexpired job
+func (s *ExportService) DownloadPath(userID, jobID uint) (*models.ExportJob, string, error) {
+	job, err := s.Job(userID, jobID)
+	if err != nil {
+		return nil, "", err
+	}
+	if job.Status != models.ExportCompleted {
+		return job, "", ErrExportNotReady
+	}
+	if job.ExpiresAt == nil || time.Now().After(*job.ExpiresAt) || job.FilePath == "" {
+		return job, "", ErrExportNotFound
+	}
+	return job, job.FilePath, nil
+}
+
+// CleanupExports deletes expired export files and their jobs, and fails jobs
+// that stopped without finishing. It's run periodically.
+func (s *ExportService) CleanupExports() error {
+	now := time.Now()
+
+	err := database.DB.Model(&models.ExportJob{}).
+		Where("status IN ? AND created_at < ?", []string{models.ExportPending, models.ExportRunning}, now.Add(-exportStaleAfter)).
+		Updates(map[string]interface{}{"status": models.ExportFailed, "error": "Export was interrupted", "completed_at": now}).Error
+	if err != nil {
+		return err
+	}
+
+	var expired []models.ExportJob
+	err = database.DB.Where("expires_at < ? OR (status = ? AND completed_at < ?)", now, models.ExportFailed, now.Add(-exportRetention)).
+		Find(&expired).Error
+	if err != nil {
+		return err
+	}
+	for _, job := range expired {
+		if job.FilePath != "" {
+			if err := os.Remove(job.FilePath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := database.DB.Delete(&job).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportDir is where export files are written: $EXPORT_DIR, or a directory
+// under the system temp directory
+func ExportDir() string {
+	if dir := os.Getenv("EXPORT_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "geofence-exports")
+}
+
+// ExportFilename is the download name for an export of dataset in format
+func ExportFilename(dataset, format string) string {
+	return fmt.Sprintf("%s-%s.%s", dataset, time.Now().UTC().Format("20060102-150405"), format)
+}
+
+// ExportContentType is the MIME type of an export format
+func ExportContentType(format string) string {
+	if format == models.ExportFormatParquet {
+		return "application/vnd.apache.parquet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// exportColumn is one column of an export, read from a model field
+type exportColumn struct {
+	utils.ParquetColumn
+	index []int
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	timePtrType   = reflect.TypeOf(&time.Time{})
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+)
+
+// exportColumns lists a model's scalar fields under their JSON names,
+// flattening embedded structs like gorm.Model. Associations are skipped.
+func exportColumns(modelType reflect.Type) []exportColumn {
+	var columns []exportColumn
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for _, column := range exportColumns(field.Type) {
+				column.index = append([]int{i}, column.index...)
+				columns = append(columns, column)
+			}
+			continue
+		}
+
+		column := exportColumn{ParquetColumn: utils.ParquetColumn{Name: name}, index: []int{i}}
+		switch {
+		case field.Type == timeType:
+			column.Type = utils.ParquetTimestamp
+		case field.Type == timePtrType, field.Type == deletedAtType:
+			column.Type = utils.ParquetTimestamp
+			column.Optional = true
+		default:
+			switch field.Type.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				column.Type = utils.ParquetInt64
+			case reflect.Float32, reflect.Float64:
+				column.Type = utils.ParquetDouble
+			case reflect.String:
+				column.Type = utils.ParquetString
+			case reflect.Bool:
+				column.Type = utils.ParquetBool
+			default:
+				continue
+			}
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// value reads the column from a model as int64, float64, string, bool,
+// time.Time or nil
+func (c exportColumn) value(item reflect.Value) interface{} {
+	field := item.FieldByIndex(c.index)
+	switch v := field.Interface().(type) {
+	case time.Time:
+		return v
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return *v
+	case gorm.DeletedAt:
+		if !v.Valid {
+			return nil
+		}
+		return v.Time
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		return field.Float()
+	case reflect.Bool:
+		return field.Bool()
+	}
+	return field.String()
+}
+
+// exportWriter writes rows of values in one file format
+type exportWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+func newExportWriter(w io.Writer, format string, columns []exportColumn) (exportWriter, error) {
+	if format == models.ExportFormatParquet {
+		parquetColumns := make([]utils.ParquetColumn, len(columns))
+		for i, column := range columns {
+			parquetColumns[i] = column.ParquetColumn
+		}
+		return utils.NewParquetWriter(w, parquetColumns)
+	}
+
+	out := &csvExportWriter{w: csv.NewWriter(w)}
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	return out, out.w.Write(header)
+}
+
+// csvExportWriter writes values the way they appear in JSON responses; nulls
+// are empty cells
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvExportWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case time.Time:
+			record[i] = v.UTC().Format(time.RFC3339Nano)
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			record[i] = strconv.FormatBool(v)
+		case string:
+			record[i] = v
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvExportWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,250 @@
+// internal/services/fence_shapes.go
+package services
+
+import (
+	"math"
+	"sort"
+
+	"geofence/internal/models"
+)
+
+// fenceField is a signed distance field: negative inside a shape, positive
+// outside, in metres of a flat projection
+type fenceField func(x, y float64) float64
+
+// localProjection is a flat projection in metres around an origin, good for
+// the few kilometres fences span
+type localProjection struct {
+	lat, lng, metersPerLngDegree float64
+}
+
+func newLocalProjection(lat, lng float64) localProjection {
+	return localProjection{lat: lat, lng: lng, metersPerLngDegree: metersPerDegree * math.Max(math.Cos(toRadians(lat)), 0.01)}
+}
+
+func (p localProjection) forward(lat, lng float64) (float64, float64) {
+	return math.Remainder(lng-p.lng, 360) * p.metersPerLngDegree, (lat - p.lat) * metersPerDegree
+}
+
+func (p localProjection) inverse(x, y float64) (float64, float64) {
+	lng := p.lng + x/p.metersPerLngDegree
+	if lng > 180 {
+		lng -= 360
+	} else if lng < -180 {
+		lng += 360
+	}
+	return p.lat + y/metersPerDegree, lng
+}
+
+// shapeField returns a fence's distance field in the projection
+func shapeField(fence models.Geofence, projection localProjection) fenceField {
+	if fence.Type == models.GeofenceTypeCorridor {
+		path := make([][2]float64, len(fence.Path))
+		for i, point := range fence.Path {
+			path[i][0], path[i][1] = projection.forward(point.Latitude, point.Longitude)
+		}
+		return func(x, y float64) float64 {
+			nearest := math.Inf(1)
+			for i := 1; i < len(path); i++ {
+				nearest = math.Min(nearest, pointSegmentDistance(x, y, path[i-1], path[i]))
+			}
+			return nearest - fence.BufferWidth
+		}
+	}
+
+	cx, cy := projection.forward(fence.Latitude, fence.Longitude)
+	return func(x, y float64) float64 {
+		return math.Hypot(x-cx, y-cy) - fence.Radius
+	}
+}
+
+// shapeRing is a closed contour in projected metres, not repeating its
+// first point
+type shapeRing [][2]float64
+
+// area is the ring's signed (shoelace) area
+func (r shapeRing) area() float64 {
+	sum := 0.0
+	for i := range r {
+		j := (i + 1) % len(r)
+		sum += r[i][0]*r[j][1] - r[j][0]*r[i][1]
+	}
+	return sum / 2
+}
+
+// contains reports whether a point is inside the ring (even-odd rule)
+func (r shapeRing) contains(x, y float64) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		if (r[i][1] > y) != (r[j][1] > y) && x < (r[j][0]-r[i][0])*(y-r[i][1])/(r[j][1]-r[i][1])+r[i][0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// shapePolygon is an outer ring and its holes, the outer counterclockwise
+// and the holes clockwise
+type shapePolygon struct {
+	outer shapeRing
+	holes []shapeRing
+}
+
+// contourField traces the zero contour of a field over a box with
+// marching squares, linearly interpolating crossings along cell edges.
+// The box should leave the shape a cell or more from its edges so every
+// contour closes. It returns the polygons and their total area.
+func contourField(field fenceField, minX, minY, maxX, maxY float64, cells int) ([]shapePolygon, float64) {
+	step := math.Max(maxX-minX, maxY-minY) / float64(cells)
+	if step <= 0 {
+		return nil, 0
+	}
+	nx := int(math.Ceil((maxX-minX)/step)) + 1
+	ny := int(math.Ceil((maxY-minY)/step)) + 1
+
+	values := make([][]float64, nx+1)
+	for i := range values {
+		values[i] = make([]float64, ny+1)
+		for j := range values[i] {
+			values[i][j] = field(minX+float64(i)*step, minY+float64(j)*step)
+		}
+	}
+	inside := func(v float64) bool { return v < 0 }
+
+	// Crossings are keyed by the grid edge they're on: the edge from grid
+	// point (i, j) going right (0) or up (1)
+	type edgeKey struct{ i, j, dir int }
+	points := map[edgeKey][2]float64{}
+	next := map[edgeKey]edgeKey{}
+
+	for i := 0; i < nx; i++ {
+		for j := 0; j < ny; j++ {
+			// Corners counterclockwise and the edges leaving each of them
+			corners := [4][2]int{{i, j}, {i + 1, j}, {i + 1, j + 1}, {i, j + 1}}
+			edges := [4]edgeKey{{i, j, 0}, {i + 1, j, 1}, {i, j + 1, 0}, {i, j, 1}}
+
+			type crossing struct {
+				key   edgeKey
+				enter bool
+			}
+			var crossings []crossing
+			for k := 0; k < 4; k++ {
+				a, b := corners[k], corners[(k+1)%4]
+				va, vb := values[a[0]][a[1]], values[b[0]][b[1]]
+				if inside(va) == inside(vb) {
+					continue
+				}
+				key := edges[k]
+				if _, ok := points[key]; !ok {
+					t := va / (va - vb)
+					points[key] = [2]float64{
+						minX + (float64(a[0])+t*float64(b[0]-a[0]))*step,
+						minY + (float64(a[1])+t*float64(b[1]-a[1]))*step,
+					}
+				}
+				crossings = append(crossings, crossing{key, inside(vb)})
+			}
+			if len(crossings) == 0 {
+				continue
+			}
+
+			// Each segment runs from where the walk round the cell leaves the
+			// shape to where it enters it: the next entry when the centre is
+			// inside (the inside corners join up), otherwise the previous one
+			centreInside := inside(field(minX+(float64(i)+0.5)*step, minY+(float64(j)+0.5)*step))
+			n := len(crossings)
+			for k, c := range crossings {
+				if c.enter {
+					continue
+				}
+				partner := (k + n - 1) % n
+				if centreInside {
+					partner = (k + 1) % n
+				}
+				next[c.key] = crossings[partner].key
+			}
+		}
+	}
+
+	// Chain the segments into rings
+	var rings []shapeRing
+	visited := map[edgeKey]bool{}
+	starts := make([]edgeKey, 0, len(next))
+	for key := range next {
+		starts = append(starts, key)
+	}
+	sort.Slice(starts, func(a, b int) bool {
+		if starts[a].i != starts[b].i {
+			return starts[a].i < starts[b].i
+		}
+		if starts[a].j != starts[b].j {
+			return starts[a].j < starts[b].j
+		}
+		return starts[a].dir < starts[b].dir
+	})
+	for _, start := range starts {
+		if visited[start] {
+			continue
+		}
+		var ring shapeRing
+		for key, ok := start, true; ok && !visited[key]; key, ok = next[key] {
+			visited[key] = true
+			ring = append(ring, points[key])
+		}
+		if len(ring) >= 3 {
+			rings = append(rings, ring)
+		}
+	}
+	if len(rings) == 0 {
+		return nil, 0
+	}
+
+	// All rings share an orientation convention, so outer boundaries have
+	// the sign of the largest ring and holes the other
+	sort.Slice(rings, func(a, b int) bool { return math.Abs(rings[a].area()) > math.Abs(rings[b].area()) })
+	outerSign := math.Signbit(rings[0].area())
+
+	var polygons []shapePolygon
+	var holes []shapeRing
+	for _, ring := range rings {
+		if math.Signbit(ring.area()) == outerSign {
+			polygons = append(polygons, shapePolygon{outer: orient(ring, true)})
+		} else {
+			holes = append(holes, orient(ring, false))
+		}
+	}
+	for _, hole := range holes {
+		// Rings are sorted largest first, so the last match is the
+		// innermost outer ring around the hole
+		owner := -1
+		for k, polygon := range polygons {
+			if polygon.outer.contains(hole[0][0], hole[0][1]) {
+				owner = k
+			}
+		}
+		if owner >= 0 {
+			polygons[owner].holes = append(polygons[owner].holes, hole)
+		}
+	}
+
+	area := 0.0
+	for _, polygon := range polygons {
+		area += polygon.outer.area()
+		for _, hole := range polygon.holes {
+			area += hole.area()
+		}
+	}
+	return polygons, area
+}
+
+// orient returns the ring counterclockwise, or clockwise if ccw is false
+func orient(ring shapeRing, ccw bool) shapeRing {
+	if (ring.area() > 0) == ccw {
+		return ring
+	}
+	reversed := make(shapeRing, len(ring))
+	for i, point := range ring {
+		reversed[len(ring)-1-i] = point
+	}
+	return reversed
+}
@@ -9,24 +9,45 @@ import (
 
 type GeofenceAccessService struct{}
 
-// CheckGeofenceAccess verifies if a user can access a specific geofence
+// Permission hierarchy: admin > edit > view
+var permissionLevels = map[string]int{
+	"view":  1,
+	"edit":  2,
+	"admin": 3,
+}
+
+// CheckGeofenceAccess verifies if a user can access a specific geofence.
+// Ancestors that cascade their permissions grant access too: through their
+// shares, and fully to their owner.
 func (s *GeofenceAccessService) CheckGeofenceAccess(userID, geofenceID uint, requiredPermission string) error {
-	var share models.GeofenceShare
-	result := database.DB.Where("user_id = ? AND geofence_id = ?", userID, geofenceID).First(&share)
-	
-	if result.Error != nil {
+	geofenceIDs := []uint{geofenceID}
+	cascading, err := (&HierarchyService{}).CascadingAncestors(geofenceID, true)
+	if err != nil {
 		return errors.New("no access to geofence")
 	}
+	if len(cascading) > 0 {
+		var owned int64
+		database.DB.Model(&models.Geofence{}).Where("id IN ? AND user_id = ?", cascading, userID).Count(&owned)
+		if owned > 0 {
+			return nil
+		}
+		geofenceIDs = append(geofenceIDs, cascading...)
+	}
 
-	// Permission hierarchy: admin > edit > view
-	permissions := map[string]int{
-		"view":  1,
-		"edit":  2,
-		"admin": 3,
+	var shares []models.GeofenceShare
+	result := database.DB.Where("user_id = ? AND geofence_id IN ?", userID, geofenceIDs).Find(&shares)
+	
+	if result.Error != nil || len(shares) == 0 {
+		return errors.New("no access to geofence")
 	}
 
-	currentPermissionLevel := permissions[share.Permission]
-	requiredPermissionLevel := permissions[requiredPermission]
+	currentPermissionLevel := 0
+	for _, share := range shares {
+		if permissionLevels[share.Permission] > currentPermissionLevel {
+			currentPermissionLevel = permissionLevels[share.Permission]
+		}
+	}
+	requiredPermissionLevel := permissionLevels[requiredPermission]
 
 	if currentPermissionLevel < requiredPermissionLevel {
 		return errors.New("insufficient permissions")
@@ -0,0 +1,257 @@
+// internal/services/geofence_geometry.go
+package services
+
+import (
+	"errors"
+	"math"
+
+	"geofence/internal/models"
+)
+
+const (
+	// MaxCorridorPoints caps the vertices of a corridor's path
+	MaxCorridorPoints = 10000
+
+	// metersPerDegree is the length of a degree of latitude, close enough
+	// for the local projections below
+	metersPerDegree = 111320.0
+)
+
+var (
+	ErrUnknownGeofenceType = errors.New("geofence type must be circle or corridor")
+	ErrInvalidCorridor     = errors.New("corridors need a path of 2 to 10000 valid points and a positive buffer_width")
+	ErrInvalidAltitude     = errors.New("altitude_ref must be ellipsoid or floor, min_altitude can't be above max_altitude and floors must be whole numbers")
+)
+
+// AltitudeFix is the vertical part of a location fix. Altitude (metres above
+// the WGS84 ellipsoid) only counts together with its VerticalAccuracy
+// (metres); Floor is a floor number.
+type AltitudeFix struct {
+	Altitude         *float64 `json:"altitude,omitempty"`
+	VerticalAccuracy *float64 `json:"vertical_accuracy,omitempty"`
+	Floor            *int     `json:"floor,omitempty"`
+}
+
+// PrepareGeofence checks a fence's type and, for corridors, validates the
+// path and derives the enclosing circle from it
+func PrepareGeofence(fence *models.Geofence) error {
+	if err := prepareAltitude(fence); err != nil {
+		return err
+	}
+
+	switch fence.Type {
+	case "", models.GeofenceTypeCircle:
+		fence.Type = models.GeofenceTypeCircle
+		fence.Path, fence.BufferWidth = nil, 0
+		return nil
+	case models.GeofenceTypeCorridor:
+	default:
+		return ErrUnknownGeofenceType
+	}
+
+	if len(fence.Path) < 2 || len(fence.Path) > MaxCorridorPoints || fence.BufferWidth <= 0 {
+		return ErrInvalidCorridor
+	}
+	// Longitudes are measured from the first vertex the short way round, so
+	// a path over the antimeridian is centred on it, not on the far side
+	origin := fence.Path[0].Longitude
+	minLat, minLng := math.Inf(1), math.Inf(1)
+	maxLat, maxLng := math.Inf(-1), math.Inf(-1)
+	for _, point := range fence.Path {
+		if !isValidLatitude(point.Latitude) || !isValidLongitude(point.Longitude) {
+			return ErrInvalidCorridor
+		}
+		dLng := math.Remainder(point.Longitude-origin, 360)
+		minLat, maxLat = math.Min(minLat, point.Latitude), math.Max(maxLat, point.Latitude)
+		minLng, maxLng = math.Min(minLng, dLng), math.Max(maxLng, dLng)
+	}
+
+	// The farthest point of a segment from the centre is one of its ends,
+	// so the circle through the farthest vertex plus the buffer covers it all
+	fence.Latitude, fence.Longitude = (minLat+maxLat)/2, wrapLng(origin+(minLng+maxLng)/2)
+	validator := &GeofenceValidationService{}
+	farthest := 0.0
+	for _, point := range fence.Path {
+		farthest = math.Max(farthest, validator.CalculateDistance(fence.Latitude, fence.Longitude, point.Latitude, point.Longitude)*1000)
+	}
+	fence.Radius = farthest + fence.BufferWidth
+	return nil
+}
+
+// prepareAltitude checks a fence's altitude band, measured above the
+// ellipsoid unless it says otherwise
+func prepareAltitude(fence *models.Geofence) error {
+	if !hasAltitude(*fence) {
+		fence.AltitudeRef = ""
+		return nil
+	}
+	switch fence.AltitudeRef {
+	case "":
+		fence.AltitudeRef = models.AltitudeEllipsoid
+	case models.AltitudeEllipsoid, models.AltitudeFloor:
+	default:
+		return ErrInvalidAltitude
+	}
+
+	for _, bound := range []*float64{fence.MinAltitude, fence.MaxAltitude} {
+		if bound == nil {
+			continue
+		}
+		if math.IsNaN(*bound) || math.IsInf(*bound, 0) {
+			return ErrInvalidAltitude
+		}
+		if fence.AltitudeRef == models.AltitudeFloor && *bound != math.Trunc(*bound) {
+			return ErrInvalidAltitude
+		}
+	}
+	if low, high := altitudeBand(*fence); low > high {
+		return ErrInvalidAltitude
+	}
+	return nil
+}
+
+// hasAltitude reports whether a fence is bounded vertically
+func hasAltitude(fence models.Geofence) bool {
+	return fence.MinAltitude != nil || fence.MaxAltitude != nil
+}
+
+// altitudeBand returns a fence's altitude band, open ends as infinities
+func altitudeBand(fence models.Geofence) (float64, float64) {
+	low, high := math.Inf(-1), math.Inf(1)
+	if fence.MinAltitude != nil {
+		low = *fence.MinAltitude
+	}
+	if fence.MaxAltitude != nil {
+		high = *fence.MaxAltitude
+	}
+	return low, high
+}
+
+// WithinAltitude reports whether a fix is within a fence's altitude band. A
+// fix whose altitude is only known to within its vertical accuracy counts
+// when that range reaches the band. Fences without a band, and fixes without
+// the altitude the band is measured in, always pass: they're 2D only.
+func WithinAltitude(fence models.Geofence, fix AltitudeFix) bool {
+	if !hasAltitude(fence) {
+		return true
+	}
+	low, high := altitudeBand(fence)
+
+	if fence.AltitudeRef == models.AltitudeFloor {
+		if fix.Floor == nil {
+			return true
+		}
+		floor := float64(*fix.Floor)
+		return floor >= low && floor <= high
+	}
+
+	if fix.Altitude == nil || fix.VerticalAccuracy == nil {
+		return true
+	}
+	accuracy := math.Abs(*fix.VerticalAccuracy)
+	return *fix.Altitude+accuracy >= low && *fix.Altitude-accuracy <= high
+}
+
+// verticallyApart reports whether two fences' altitude bands, measured the
+// same way, don't meet. Bands measured differently can't be compared.
+func verticallyApart(a, b models.Geofence) bool {
+	if !hasAltitude(a) || !hasAltitude(b) || a.AltitudeRef != b.AltitudeRef {
+		return false
+	}
+	aLow, aHigh := altitudeBand(a)
+	bLow, bHigh := altitudeBand(b)
+	return aHigh < bLow || bHigh < aLow
+}
+
+// GeofenceContainsFix reports whether a fix lies inside a fence, in 3D when
+// the fix has the altitude the fence is bounded by
+func GeofenceContainsFix(fence models.Geofence, lat, lng float64, fix AltitudeFix) bool {
+	return WithinAltitude(fence, fix) && GeofenceContains(fence, lat, lng)
+}
+
+// GeofenceContains reports whether a point lies inside a fence
+func GeofenceContains(fence models.Geofence, lat, lng float64) bool {
+	if fence.Type == models.GeofenceTypeCorridor {
+		return DistanceToPath(fence.Path, lat, lng) <= fence.BufferWidth
+	}
+	return (&GeofenceValidationService{}).CalculateDistance(fence.Latitude, fence.Longitude, lat, lng)*1000 <= fence.Radius
+}
+
+// DistanceToPath returns how far (metres) a point is from the nearest point
+// of a path. Segments are measured in a flat projection around the point,
+// which is accurate for the distances corridors are about.
+func DistanceToPath(path models.Polyline, lat, lng float64) float64 {
+	project := func(point models.GeoPoint) [2]float64 {
+		dLng := math.Remainder(point.Longitude-lng, 360)
+		return [2]float64{dLng * metersPerDegree * math.Cos(toRadians(lat)), (point.Latitude - lat) * metersPerDegree}
+	}
+
+	nearest := math.Inf(1)
+	for i := range path {
+		b := project(path[i])
+		a := b
+		if i > 0 {
+			a = project(path[i-1])
+		}
+		nearest = math.Min(nearest, pointSegmentDistance(0, 0, a, b))
+	}
+	return nearest
+}
+
+// pointSegmentDistance is the distance from (x, y) to the segment a-b
+func pointSegmentDistance(x, y float64, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, ((x-a[0])*dx+(y-a[1])*dy)/length))
+	}
+	return math.Hypot(x-a[0]-t*dx, y-a[1]-t*dy)
+}
+
+// GeofenceIntersectsRegion reports whether any part of a fence overlaps the
+// region
+func GeofenceIntersectsRegion(fence models.Geofence, region Region) bool {
+	if fence.Type != models.GeofenceTypeCorridor {
+		return CircleIntersectsRegion(fence.Latitude, fence.Longitude, fence.Radius, region)
+	}
+
+	// Grow the box by the buffer and look for a segment crossing it
+	latPad := fence.BufferWidth / metersPerDegree
+	lngPad := fence.BufferWidth / (metersPerDegree * math.Max(math.Cos(toRadians(math.Max(math.Abs(region.MinLat), math.Abs(region.MaxLat)))), 0.01))
+	for _, span := range region.lngSpans() {
+		for i := 1; i < len(fence.Path); i++ {
+			a, b := fence.Path[i-1], fence.Path[i]
+			if segmentIntersectsBox(a.Longitude, a.Latitude, b.Longitude, b.Latitude,
+				span[0]-lngPad, region.MinLat-latPad, span[1]+lngPad, region.MaxLat+latPad) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// segmentIntersectsBox clips the segment (x1,y1)-(x2,y2) against a box
+// (Liang–Barsky) and reports whether anything is left
+func segmentIntersectsBox(x1, y1, x2, y2, minX, minY, maxX, maxY float64) bool {
+	dx, dy := x2-x1, y2-y1
+	lo, hi := 0.0, 1.0
+	for _, edge := range [4][2]float64{{-dx, x1 - minX}, {dx, maxX - x1}, {-dy, y1 - minY}, {dy, maxY - y1}} {
+		p, q := edge[0], edge[1]
+		if p == 0 {
+			if q < 0 {
+				return false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			lo = math.Max(lo, t)
+		} else {
+			hi = math.Min(hi, t)
+		}
+		if lo > hi {
+			return false
+		}
+	}
+	return true
+}
@@ -2,31 +2,273 @@
 package services
 
 import (
+	"errors"
+	"sort"
 	"time"
 
 	"geofence/internal/database"
 	"geofence/internal/models"
 )
 
+const (
+	BucketDay  = "day"
+	BucketWeek = "week"
+
+	// MaxMetricsRange caps how long a date range one analytics request can cover
+	MaxMetricsRange = 366 * 24 * time.Hour
+)
+
+var ErrInvalidMetricsRange = errors.New("invalid date range")
+
 type GeofenceMetricsService struct{}
 
-// GetGeofencePerformanceMetrics calculates various performance indicators
-func (s *GeofenceMetricsService) GetGeofencePerformanceMetrics(geofenceID uint) (map[string]interface{}, error) {
-	var metrics = make(map[string]interface{})
+// MetricsRange selects the visits an analytics report covers. Buckets and
+// histograms are computed in Location.
+type MetricsRange struct {
+	From     time.Time
+	To       time.Time
+	Bucket   string
+	Location *time.Location
+}
+
+// MetricsBucket is one day or week of a visit time series
+type MetricsBucket struct {
+	Start          time.Time `json:"start"`
+	Visits         int64     `json:"visits"`
+	UniqueVisitors int64     `json:"unique_visitors"`
+}
+
+// GeofenceMetrics is a geofence's, or a group's, visit analytics over a
+// date range. Dwell times are in seconds and nil when no visit in the range
+// has ended.
+type GeofenceMetrics struct {
+	GeofenceID         uint            `json:"geofence_id,omitempty"`
+	GroupID            uint            `json:"group_id,omitempty"`
+	GeofenceIDs        []uint          `json:"geofence_ids,omitempty"`
+	From               time.Time       `json:"from"`
+	To                 time.Time       `json:"to"`
+	Bucket             string          `json:"bucket"`
+	Visits             int64           `json:"visits"`
+	UniqueVisitors     int64           `json:"unique_visitors"`
+	AvgDwellSeconds    *float64        `json:"avg_dwell_seconds"`
+	MedianDwellSeconds *float64        `json:"median_dwell_seconds"`
+	ReturnVisitorRate  float64         `json:"return_visitor_rate"`
+	HourOfDay          [24]int64       `json:"hour_of_day"`
+	DayOfWeek          [7]int64        `json:"day_of_week"` // Sunday first
+	Series             []MetricsBucket `json:"series"`
+}
+
+// GetGeofencePerformanceMetrics calculates visit analytics for a geofence.
+// Anonymized visits (from purged accounts) count as visits but not visitors.
+// Daily UTC reports over fully rolled-up days are served from the rollup
+// tables; anything else is computed from raw visits.
+func (s *GeofenceMetricsService) GetGeofencePerformanceMetrics(geofenceID uint, rng MetricsRange) (*GeofenceMetrics, error) {
+	return s.metrics(&GeofenceMetrics{GeofenceID: geofenceID}, []uint{geofenceID}, rng)
+}
+
+// GetGroupMetrics calculates the same analytics over all of a group's
+// fences, a visitor counting once however many of them they visited. Rollups
+// can't tell visitors shared between fences apart, so group reports are
+// always computed from raw visits.
+func (s *GeofenceMetricsService) GetGroupMetrics(groupID uint, geofenceIDs []uint, rng MetricsRange) (*GeofenceMetrics, error) {
+	return s.metrics(&GeofenceMetrics{GroupID: groupID, GeofenceIDs: geofenceIDs}, geofenceIDs, rng)
+}
+
+// metrics fills in a report for visits to any of the fences
+func (s *GeofenceMetricsService) metrics(metrics *GeofenceMetrics, geofenceIDs []uint, rng MetricsRange) (*GeofenceMetrics, error) {
+	if rng.Location == nil {
+		rng.Location = time.UTC
+	}
+	if !rng.To.After(rng.From) || rng.To.Sub(rng.From) > MaxMetricsRange {
+		return nil, ErrInvalidMetricsRange
+	}
+	if rng.Bucket != BucketWeek {
+		rng.Bucket = BucketDay
+	}
+
+	metrics.From, metrics.To, metrics.Bucket = rng.From, rng.To, rng.Bucket
+
+	var buckets map[int64]*MetricsBucket
+	var err error
+	if len(geofenceIDs) == 1 && s.rollupsCover(rng) {
+		buckets, err = s.countsFromRollups(geofenceIDs[0], rng, metrics)
+	} else {
+		buckets, err = s.countsFromVisits(geofenceIDs, rng, metrics)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Visitor counts and dwell times need individual visits either way, but
+	// only the per-user totals and the finished visits. The average and
+	// median dwell both come from the finished visits so they always agree.
+	var perUser []struct {
+		UserID uint
+		Visits int64
+	}
+	err = database.DB.Model(&models.GeofenceVisit{}).
+		Select("user_id, COUNT(*) AS visits").
+		Where("geofence_id IN ? AND user_id <> 0 AND created_at >= ? AND created_at < ?", geofenceIDs, rng.From, rng.To).
+		Group("user_id").
+		Scan(&perUser).Error
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.UniqueVisitors = int64(len(perUser))
+	if metrics.UniqueVisitors > 0 {
+		returning := 0
+		for _, user := range perUser {
+			if user.Visits > 1 {
+				returning++
+			}
+		}
+		metrics.ReturnVisitorRate = float64(returning) / float64(metrics.UniqueVisitors)
+	}
+
+	var finished []models.GeofenceVisit
+	err = database.DB.Select("created_at", "exited_at").
+		Where("geofence_id IN ? AND exited_at IS NOT NULL AND created_at >= ? AND created_at < ?", geofenceIDs, rng.From, rng.To).
+		Find(&finished).Error
+	if err != nil {
+		return nil, err
+	}
 
-	// Total visits in last 30 days
-	database.DB.Raw(`
-		SELECT COUNT(*) as total_visits 
-		FROM geofence_visits 
-		WHERE geofence_id = ? AND created_at >= ?
-	`, geofenceID, time.Now().AddDate(0, 0, -30)).Scan(&metrics["total_visits"])
+	var dwells []float64
+	var dwellTotal float64
+	for _, visit := range finished {
+		if visit.ExitedAt.After(visit.CreatedAt) {
+			dwell := visit.ExitedAt.Sub(visit.CreatedAt).Seconds()
+			dwells = append(dwells, dwell)
+			dwellTotal += dwell
+		}
+	}
+	if len(dwells) > 0 {
+		avg := dwellTotal / float64(len(dwells))
+		median := medianOf(dwells)
+		metrics.AvgDwellSeconds = &avg
+		metrics.MedianDwellSeconds = &median
+	}
 
-	// Unique visitors
-	database.DB.Raw(`
-		SELECT COUNT(DISTINCT user_id) as unique_visitors 
-		FROM geofence_visits 
-		WHERE geofence_id = ? AND created_at >= ?
-	`, geofenceID, time.Now().AddDate(0, 0, -30)).Scan(&metrics["unique_visitors"])
+	// Every bucket in the range is listed, including empty ones
+	metrics.Series = []MetricsBucket{}
+	for start := bucketStart(rng.From.In(rng.Location), rng.Bucket); start.Before(rng.To); start = nextBucket(start, rng.Bucket) {
+		if bucket, ok := buckets[start.Unix()]; ok {
+			metrics.Series = append(metrics.Series, *bucket)
+		} else {
+			metrics.Series = append(metrics.Series, MetricsBucket{Start: start})
+		}
+	}
 
 	return metrics, nil
-}
\ No newline at end of file
+}
+
+// rollupsCover reports whether the report lines up with complete daily rollups
+func (s *GeofenceMetricsService) rollupsCover(rng MetricsRange) bool {
+	if rng.Bucket != BucketDay {
+		return false
+	}
+	for _, t := range []time.Time{rng.From, rng.To} {
+		if _, offset := t.In(rng.Location).Zone(); offset != 0 || !t.UTC().Truncate(24*time.Hour).Equal(t) {
+			return false
+		}
+	}
+
+	watermark, err := (&RollupService{}).Watermark()
+	return err == nil && !rng.To.After(watermark)
+}
+
+// countsFromRollups fills visits and histograms from hourly rollups and
+// returns the daily series from daily rollups
+func (s *GeofenceMetricsService) countsFromRollups(geofenceID uint, rng MetricsRange, metrics *GeofenceMetrics) (map[int64]*MetricsBucket, error) {
+	var hourly []models.AnalyticsRollup
+	err := database.DB.Where("granularity = ? AND item_type = ? AND item_id = ? AND bucket_start >= ? AND bucket_start < ?",
+		models.RollupHourly, models.ItemTypeGeofence, geofenceID, rng.From.UTC(), rng.To.UTC()).
+		Find(&hourly).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range hourly {
+		at := row.BucketStart.In(rng.Location)
+		metrics.Visits += row.Visits
+		metrics.HourOfDay[at.Hour()] += row.Visits
+		metrics.DayOfWeek[at.Weekday()] += row.Visits
+	}
+
+	var daily []models.AnalyticsRollup
+	err = database.DB.Where("granularity = ? AND item_type = ? AND item_id = ? AND bucket_start >= ? AND bucket_start < ?",
+		models.RollupDaily, models.ItemTypeGeofence, geofenceID, rng.From.UTC(), rng.To.UTC()).
+		Find(&daily).Error
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := map[int64]*MetricsBucket{}
+	for _, row := range daily {
+		start := row.BucketStart.In(rng.Location)
+		buckets[start.Unix()] = &MetricsBucket{Start: start, Visits: row.Visits, UniqueVisitors: row.UniqueVisitors}
+	}
+	return buckets, nil
+}
+
+// countsFromVisits computes the same as countsFromRollups from raw visits
+func (s *GeofenceMetricsService) countsFromVisits(geofenceIDs []uint, rng MetricsRange, metrics *GeofenceMetrics) (map[int64]*MetricsBucket, error) {
+	var visits []models.GeofenceVisit
+	err := database.DB.Where("geofence_id IN ? AND created_at >= ? AND created_at < ?", geofenceIDs, rng.From, rng.To).
+		Find(&visits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := map[int64]*MetricsBucket{}
+	bucketVisitors := map[int64]map[uint]bool{}
+
+	for _, visit := range visits {
+		at := visit.CreatedAt.In(rng.Location)
+		metrics.Visits++
+		metrics.HourOfDay[at.Hour()]++
+		metrics.DayOfWeek[at.Weekday()]++
+
+		start := bucketStart(at, rng.Bucket)
+		key := start.Unix()
+		if buckets[key] == nil {
+			buckets[key] = &MetricsBucket{Start: start}
+			bucketVisitors[key] = map[uint]bool{}
+		}
+		buckets[key].Visits++
+		if visit.UserID != 0 && !bucketVisitors[key][visit.UserID] {
+			bucketVisitors[key][visit.UserID] = true
+			buckets[key].UniqueVisitors++
+		}
+	}
+
+	return buckets, nil
+}
+
+// bucketStart truncates t to the start of its day, or of its week (Monday)
+func bucketStart(t time.Time, bucket string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if bucket == BucketWeek {
+		offset := (int(day.Weekday()) + 6) % 7
+		day = day.AddDate(0, 0, -offset)
+	}
+	return day
+}
+
+func nextBucket(start time.Time, bucket string) time.Time {
+	if bucket == BucketWeek {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+func medianOf(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,51 @@
+// internal/services/geofence_update.go
+package services
+
+import (
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ApplyGeofenceUpdate copies the editable fields of update onto a fence.
+// Ownership, categories, tags and the revision number stay as they are.
+func ApplyGeofenceUpdate(fence *models.Geofence, update models.Geofence) {
+	fence.Name = update.Name
+	fence.Description = update.Description
+	fence.Latitude = update.Latitude
+	fence.Longitude = update.Longitude
+	fence.Radius = update.Radius
+	fence.Type = update.Type
+	fence.Path = update.Path
+	fence.BufferWidth = update.BufferWidth
+	fence.MinAltitude = update.MinAltitude
+	fence.MaxAltitude = update.MaxAltitude
+	fence.AltitudeRef = update.AltitudeRef
+	fence.Disabled = update.Disabled
+	fence.ActiveFrom = update.ActiveFrom
+	fence.ActiveUntil = update.ActiveUntil
+	fence.Timezone = update.Timezone
+	fence.Schedule = update.Schedule
+	fence.ParentID = update.ParentID
+	fence.CascadeContent = update.CascadeContent
+	fence.CascadePermissions = update.CascadePermissions
+}
+
+// SaveGeofence saves an existing fence and replaces its schedule with the
+// fence's
+func SaveGeofence(tx *gorm.DB, fence *models.Geofence) error {
+	if err := tx.Omit("Schedule").Save(fence).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("geofence_id = ?", fence.ID).Delete(&models.GeofenceSchedule{}).Error; err != nil {
+		return err
+	}
+	for i := range fence.Schedule {
+		fence.Schedule[i].ID = 0
+		fence.Schedule[i].GeofenceID = fence.ID
+	}
+	if len(fence.Schedule) == 0 {
+		return nil
+	}
+	return tx.Create(&fence.Schedule).Error
+}
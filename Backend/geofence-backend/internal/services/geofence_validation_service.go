@@ -15,6 +15,10 @@ func (s *GeofenceValidationService) ValidateGeofence(geofence *models.Geofence)
 		return errors.New("geofence name is required")
 	}
 
+	if err := PrepareGeofence(geofence); err != nil {
+		return err
+	}
+
 	if geofence.Radius <= 0 {
 		return errors.New("geofence radius must be positive")
 	}
@@ -27,6 +31,10 @@ func (s *GeofenceValidationService) ValidateGeofence(geofence *models.Geofence)
 		return errors.New("invalid longitude")
 	}
 
+	if err := ValidateSchedule(geofence); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,163 @@
+// internal/services/geojson_service.go
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// MaxGeoJSONImport caps the features in one import
+const MaxGeoJSONImport = 1000
+
+var (
+	ErrNotFeatureCollection = errors.New("body must be a GeoJSON FeatureCollection")
+	ErrTooManyFeatures      = fmt.Errorf("a GeoJSON import can have at most %d features", MaxGeoJSONImport)
+	ErrUnsupportedGeometry  = errors.New("geometry must be a Point (circle) or LineString (corridor)")
+)
+
+// GeoJSONService converts geofences to and from GeoJSON. Circles are Points
+// with a radius property and corridors LineStrings with a buffer_width
+// property, both in metres. Altitude bands are min_altitude, max_altitude and
+// altitude_ref properties.
+type GeoJSONService struct{}
+
+// Export returns fences as a FeatureCollection
+func (s *GeoJSONService) Export(fences []models.Geofence) utils.GeoJSONFeatureCollection {
+	collection := utils.NewFeatureCollection()
+	for _, fence := range fences {
+		feature := utils.GeoJSONFeature{
+			Type: "Feature",
+			ID:   fence.ID,
+			Properties: map[string]interface{}{
+				"name":        fence.Name,
+				"description": fence.Description,
+				"user_id":     fence.UserID,
+			},
+		}
+
+		var coordinates interface{}
+		if fence.Type == models.GeofenceTypeCorridor {
+			line := make([][2]float64, len(fence.Path))
+			for i, point := range fence.Path {
+				line[i] = [2]float64{point.Longitude, point.Latitude}
+			}
+			coordinates = line
+			feature.Geometry = &utils.GeoJSONGeometry{Type: utils.GeoJSONLineString}
+			feature.Properties["buffer_width"] = fence.BufferWidth
+		} else {
+			coordinates = [2]float64{fence.Longitude, fence.Latitude}
+			feature.Geometry = &utils.GeoJSONGeometry{Type: utils.GeoJSONPoint}
+			feature.Properties["radius"] = fence.Radius
+		}
+		feature.Geometry.Coordinates, _ = json.Marshal(coordinates)
+		if fence.MinAltitude != nil {
+			feature.Properties["min_altitude"] = *fence.MinAltitude
+		}
+		if fence.MaxAltitude != nil {
+			feature.Properties["max_altitude"] = *fence.MaxAltitude
+		}
+		if hasAltitude(fence) {
+			feature.Properties["altitude_ref"] = fence.AltitudeRef
+		}
+
+		collection.Features = append(collection.Features, feature)
+	}
+	return collection
+}
+
+// Import creates a fence owned by userID for every feature. Either all of
+// them are created or, if any feature is invalid, none are.
+func (s *GeoJSONService) Import(userID uint, collection utils.GeoJSONFeatureCollection) ([]models.Geofence, error) {
+	if collection.Type != "FeatureCollection" {
+		return nil, ErrNotFeatureCollection
+	}
+	if len(collection.Features) > MaxGeoJSONImport {
+		return nil, ErrTooManyFeatures
+	}
+
+	fences := make([]models.Geofence, len(collection.Features))
+	validator := &GeofenceValidationService{}
+	for i, feature := range collection.Features {
+		fence, err := s.geofenceFromFeature(feature)
+		if err != nil {
+			return nil, fmt.Errorf("feature %d: %w", i, err)
+		}
+		fence.UserID = userID
+		if err := validator.ValidateGeofence(&fence); err != nil {
+			return nil, fmt.Errorf("feature %d: %w", i, err)
+		}
+		fences[i] = fence
+	}
+
+	if len(fences) == 0 {
+		return fences, nil
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&fences).Error; err != nil {
+			return err
+		}
+		revisions := &RevisionService{}
+		for i := range fences {
+			if err := revisions.Record(tx, &fences[i], userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fences, nil
+}
+
+// geofenceFromFeature reads a fence's geometry and properties from a feature
+func (s *GeoJSONService) geofenceFromFeature(feature utils.GeoJSONFeature) (models.Geofence, error) {
+	var fence models.Geofence
+	if feature.Geometry == nil {
+		return fence, ErrUnsupportedGeometry
+	}
+
+	fence.Name, _ = feature.Properties["name"].(string)
+	fence.Description, _ = feature.Properties["description"].(string)
+	if altitude, ok := feature.Properties["min_altitude"].(float64); ok {
+		fence.MinAltitude = &altitude
+	}
+	if altitude, ok := feature.Properties["max_altitude"].(float64); ok {
+		fence.MaxAltitude = &altitude
+	}
+	fence.AltitudeRef, _ = feature.Properties["altitude_ref"].(string)
+
+	switch feature.Geometry.Type {
+	case utils.GeoJSONPoint:
+		var position []float64
+		if err := json.Unmarshal(feature.Geometry.Coordinates, &position); err != nil || len(position) < 2 {
+			return fence, ErrUnsupportedGeometry
+		}
+		fence.Type = models.GeofenceTypeCircle
+		fence.Longitude, fence.Latitude = position[0], position[1]
+		fence.Radius, _ = feature.Properties["radius"].(float64)
+	case utils.GeoJSONLineString:
+		var positions [][]float64
+		if err := json.Unmarshal(feature.Geometry.Coordinates, &positions); err != nil {
+			return fence, ErrUnsupportedGeometry
+		}
+		fence.Type = models.GeofenceTypeCorridor
+		for _, position := range positions {
+			if len(position) < 2 {
+				return fence, ErrUnsupportedGeometry
+			}
+			fence.Path = append(fence.Path, models.GeoPoint{Latitude: position[1], Longitude: position[0]})
+		}
+		fence.BufferWidth, _ = feature.Properties["buffer_width"].(float64)
+	default:
+		return fence, ErrUnsupportedGeometry
+	}
+	return fence, nil
+}
@@ -0,0 +1,303 @@
+// internal/services/group_service.go
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MaxGroupMembersPerRequest caps how many fences one request adds to a group
+const MaxGroupMembersPerRequest = 1000
+
+var (
+	ErrGroupGeofenceNotFound  = errors.New("geofence not found")
+	ErrGroupMemberForbidden   = errors.New("you can only add geofences you own or can edit")
+	ErrTooManyGroupMembers    = errors.New("at most 1000 geofences can be added at once")
+	ErrInvalidSharePermission = errors.New("permission must be 'view', 'edit', or 'admin'")
+	ErrInvalidGroupEvents     = errors.New("events must be enter and/or exit")
+)
+
+// GroupService manages geofence groups and the operations that apply to all
+// their fences at once
+type GroupService struct{}
+
+// groupMembers selects the IDs of a group's fences
+func groupMembers(groupID uint) *gorm.DB {
+	return database.DB.Table("geofence_group_members").Select("geofence_id").Where("geofence_group_id = ?", groupID)
+}
+
+// Members returns a group's fences, narrowed by scopes
+func (s *GroupService) Members(groupID uint, scopes ...func(*gorm.DB) *gorm.DB) ([]models.Geofence, error) {
+	var fences []models.Geofence
+	err := database.DB.Scopes(scopes...).
+		Where("geofences.id IN (?)", groupMembers(groupID)).
+		Order("geofences.id").
+		Find(&fences).Error
+	return fences, err
+}
+
+// MemberIDs returns the IDs of a group's fences, narrowed by scopes
+func (s *GroupService) MemberIDs(groupID uint, scopes ...func(*gorm.DB) *gorm.DB) ([]uint, error) {
+	var ids []uint
+	err := database.DB.Model(&models.Geofence{}).Scopes(scopes...).
+		Where("id IN (?)", groupMembers(groupID)).
+		Order("id").
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// OwnedGeofences narrows a geofence query to a user's own fences
+func OwnedGeofences(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("geofences.user_id = ?", userID)
+	}
+}
+
+// CanView reports whether a user owns a group or has it shared with them
+func (s *GroupService) CanView(group models.GeofenceGroup, userID uint) bool {
+	if group.UserID == userID {
+		return true
+	}
+	var count int64
+	database.DB.Model(&models.GeofenceGroupShare{}).Where("group_id = ? AND user_id = ?", group.ID, userID).Count(&count)
+	return count > 0
+}
+
+// AddMembers adds fences to a group. The group's owner has to own each fence
+// or be able to edit it. Fences are shared with everyone the group is
+// shared with.
+func (s *GroupService) AddMembers(group *models.GeofenceGroup, geofenceIDs []uint) error {
+	if len(geofenceIDs) > MaxGroupMembersPerRequest {
+		return ErrTooManyGroupMembers
+	}
+	if len(geofenceIDs) == 0 {
+		return nil
+	}
+
+	var fences []models.Geofence
+	if err := database.DB.Where("id IN ?", geofenceIDs).Find(&fences).Error; err != nil {
+		return err
+	}
+	unique := map[uint]bool{}
+	for _, id := range geofenceIDs {
+		unique[id] = true
+	}
+	if len(fences) != len(unique) {
+		return ErrGroupGeofenceNotFound
+	}
+
+	access := &GeofenceAccessService{}
+	for _, fence := range fences {
+		if fence.UserID != group.UserID && access.CheckGeofenceAccess(group.UserID, fence.ID, "edit") != nil {
+			return ErrGroupMemberForbidden
+		}
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(group).Association("Geofences").Append(&fences); err != nil {
+			return err
+		}
+
+		var shares []models.GeofenceGroupShare
+		if err := tx.Where("group_id = ?", group.ID).Find(&shares).Error; err != nil {
+			return err
+		}
+		for _, share := range shares {
+			if err := shareFences(tx, group.UserID, share, fences); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveMember takes a fence out of a group. Shares made through the group
+// are kept.
+func (s *GroupService) RemoveMember(group *models.GeofenceGroup, geofenceID uint) error {
+	return database.DB.Model(group).Association("Geofences").Delete(&models.Geofence{Model: gorm.Model{ID: geofenceID}})
+}
+
+// Share shares every fence in the group with a user, now and as fences are
+// added. Only fences the group's owner owns are shared, as only a fence's
+// owner can share it.
+func (s *GroupService) Share(group models.GeofenceGroup, userID uint, permission string) (*models.GeofenceGroupShare, error) {
+	if permission != "view" && permission != "edit" && permission != "admin" {
+		return nil, ErrInvalidSharePermission
+	}
+
+	var share models.GeofenceGroupShare
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("group_id = ? AND user_id = ?", group.ID, userID).First(&share).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		share.GroupID, share.UserID, share.Permission = group.ID, userID, permission
+		if err := tx.Save(&share).Error; err != nil {
+			return err
+		}
+
+		var fences []models.Geofence
+		if err := tx.Where("id IN (?)", groupMembers(group.ID)).Find(&fences).Error; err != nil {
+			return err
+		}
+		return shareFences(tx, group.UserID, share, fences)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// shareFences creates or upgrades the fence shares a group share stands for.
+// A fence already shared at a higher level, directly or through another
+// group, keeps that level.
+func shareFences(tx *gorm.DB, ownerID uint, share models.GeofenceGroupShare, fences []models.Geofence) error {
+	for _, fence := range fences {
+		if fence.UserID != ownerID || fence.UserID == share.UserID {
+			continue
+		}
+
+		var existing models.GeofenceShare
+		err := tx.Where("geofence_id = ? AND user_id = ?", fence.ID, share.UserID).First(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if permissionLevels[existing.Permission] >= permissionLevels[share.Permission] {
+			continue
+		}
+		existing.GeofenceID, existing.OwnerID, existing.UserID, existing.Permission = fence.ID, ownerID, share.UserID, share.Permission
+		if err := tx.Save(&existing).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetDisabled enables or disables the fences in a group that the user owns
+// or can still edit, and returns how many changed
+func (s *GroupService) SetDisabled(groupID, userID uint, disabled bool) (int64, error) {
+	var fences []models.Geofence
+	err := database.DB.Select("id", "user_id").
+		Where("id IN (?) AND disabled <> ?", groupMembers(groupID), disabled).
+		Find(&fences).Error
+	if err != nil {
+		return 0, err
+	}
+
+	access := &GeofenceAccessService{}
+	var ids []uint
+	for _, fence := range fences {
+		if fence.UserID == userID || access.CheckGeofenceAccess(userID, fence.ID, "edit") == nil {
+			ids = append(ids, fence.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result := database.DB.Model(&models.Geofence{}).Where("id IN ?", ids).Update("disabled", disabled)
+	return result.RowsAffected, result.Error
+}
+
+// Subscribe subscribes a user to events of a group's fences
+func (s *GroupService) Subscribe(groupID, userID uint, events []string) (*models.GroupSubscription, error) {
+	seen := map[string]bool{}
+	var kinds []string
+	for _, event := range events {
+		if event != models.GroupEventEnter && event != models.GroupEventExit {
+			return nil, ErrInvalidGroupEvents
+		}
+		if !seen[event] {
+			seen[event] = true
+			kinds = append(kinds, event)
+		}
+	}
+	if len(kinds) == 0 {
+		return nil, ErrInvalidGroupEvents
+	}
+
+	subscription := models.GroupSubscription{GroupID: groupID, UserID: userID, Events: strings.Join(kinds, ",")}
+	if err := database.DB.Create(&subscription).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// PublishVisitEvent adds an enter or exit event at a fence to the feeds of
+// the subscriptions of every group it's in
+func (s *GroupService) PublishVisitEvent(tx *gorm.DB, geofenceID uint, event string, at time.Time) error {
+	groups := tx.Table("geofence_group_members").Select("geofence_group_id").Where("geofence_id = ?", geofenceID)
+
+	var subscriptions []models.GroupSubscription
+	if err := tx.Where("group_id IN (?)", groups).Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	var events []models.GroupEvent
+	for _, subscription := range subscriptions {
+		for _, kind := range strings.Split(subscription.Events, ",") {
+			if kind == event {
+				events = append(events, models.GroupEvent{
+					SubscriptionID: subscription.ID,
+					GroupID:        subscription.GroupID,
+					GeofenceID:     geofenceID,
+					Event:          event,
+					OccurredAt:     at,
+				})
+			}
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return tx.Create(&events).Error
+}
+
+// Events returns a page of the events delivered to a user's subscriptions to
+// a group, oldest first, after the event afterID. The returned ID is where
+// the next page starts, 0 on the last page.
+func (s *GroupService) Events(groupID, userID, afterID uint, limit int) ([]models.GroupEvent, uint, error) {
+	subscriptions := database.DB.Model(&models.GroupSubscription{}).Select("id").Where("group_id = ? AND user_id = ?", groupID, userID)
+
+	events := []models.GroupEvent{}
+	err := database.DB.Where("group_id = ? AND subscription_id IN (?) AND id > ?", groupID, subscriptions, afterID).
+		Order("id").
+		Limit(limit + 1).
+		Find(&events).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var next uint
+	if len(events) > limit {
+		events = events[:limit]
+		next = events[limit-1].ID
+	}
+	return events, next, nil
+}
+
+// Delete removes a group with its membership, shares, subscriptions and
+// events. The fences themselves and the shares made through the group stay.
+func (s *GroupService) Delete(group *models.GeofenceGroup) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(group).Association("Geofences").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.GeofenceGroupShare{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupSubscription{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+}
@@ -0,0 +1,280 @@
+// internal/services/heatmap_service.go
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Layers a density grid or heatmap can show
+const (
+	HeatmapLayerVisits    = "visits"
+	HeatmapLayerGeofences = "geofences"
+)
+
+// Grids density can be aggregated into
+const (
+	DensityGridTile    = "tile"
+	DensityGridGeohash = "geohash"
+)
+
+// heatmapRadius is how far in pixels one point's heat spreads on a tile
+const heatmapRadius = 16
+
+var (
+	ErrUnknownLayer = errors.New("unknown heatmap layer")
+	ErrUnknownGrid  = errors.New("unknown density grid")
+	ErrInvalidLevel = errors.New("invalid density grid level")
+)
+
+// heatmapRamp maps heat (0-1) to colour, from transparent blue to red
+var heatmapRamp = []struct {
+	at    float64
+	color color.NRGBA
+}{
+	{0, color.NRGBA{0, 0, 255, 0}},
+	{0.2, color.NRGBA{0, 128, 255, 140}},
+	{0.4, color.NRGBA{0, 255, 128, 180}},
+	{0.6, color.NRGBA{255, 255, 0, 200}},
+	{0.8, color.NRGBA{255, 128, 0, 220}},
+	{1, color.NRGBA{255, 0, 0, 240}},
+}
+
+// HeatmapService aggregates visits and fence centroids for map display
+type HeatmapService struct{}
+
+// HeatmapOptions selects the points a grid or tile is built from. Visits are
+// placed at their fence's centre.
+type HeatmapOptions struct {
+	Layer    string
+	Region   *Region
+	From     *time.Time
+	To       *time.Time
+	ViewerID uint
+}
+
+// HeatmapPoint is a location with how many visits or fences it stands for
+type HeatmapPoint struct {
+	Latitude  float64
+	Longitude float64
+	Weight    int64
+}
+
+// DensityCell is one grid cell with the number of visits or fences in it.
+// Latitude and Longitude are the weighted centre of what's in the cell.
+type DensityCell struct {
+	Cell      string  `json:"cell"`
+	Tile      *Tile   `json:"tile,omitempty"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Count     int64   `json:"count"`
+}
+
+// points returns the weighted points for a layer
+func (s *HeatmapService) points(opts HeatmapOptions) ([]HeatmapPoint, error) {
+	query, err := s.pointQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []HeatmapPoint
+	err = query.Scan(&points).Error
+	return points, err
+}
+
+func (s *HeatmapService) pointQuery(opts HeatmapOptions) (*gorm.DB, error) {
+	var query *gorm.DB
+	var timeColumn string
+	switch opts.Layer {
+	case HeatmapLayerVisits:
+		query = database.DB.Model(&models.GeofenceVisit{}).
+			Select("geofences.latitude, geofences.longitude, COUNT(*) AS weight").
+			Joins("JOIN geofences ON geofences.id = geofence_visits.geofence_id AND geofences.deleted_at IS NULL").
+			Group("geofences.id, geofences.latitude, geofences.longitude")
+		timeColumn = "geofence_visits.created_at"
+	case HeatmapLayerGeofences:
+		query = database.DB.Model(&models.Geofence{}).
+			Select("geofences.latitude, geofences.longitude, 1 AS weight")
+		timeColumn = "geofences.created_at"
+	default:
+		return nil, ErrUnknownLayer
+	}
+
+	query = query.Scopes(VisibleGeofences(opts.ViewerID))
+	if opts.Region != nil {
+		query = query.Scopes(geofenceCentresIn(*opts.Region))
+	}
+	if opts.From != nil {
+		query = query.Where(timeColumn+" >= ?", *opts.From)
+	}
+	if opts.To != nil {
+		query = query.Where(timeColumn+" < ?", *opts.To)
+	}
+	return query, nil
+}
+
+// Density counts a layer's points per cell: slippy-map tiles at zoom level
+// (grid "tile") or geohashes of length level (grid "geohash"). Cells are
+// ordered by count, highest first; empty cells are left out.
+func (s *HeatmapService) Density(opts HeatmapOptions, grid string, level int) ([]DensityCell, error) {
+	var cellOf func(point HeatmapPoint) (string, *Tile)
+	switch grid {
+	case DensityGridTile:
+		if level < 0 || level > MaxTileZoom {
+			return nil, ErrInvalidLevel
+		}
+		cellOf = func(point HeatmapPoint) (string, *Tile) {
+			tile := TileAt(point.Latitude, point.Longitude, level)
+			return strconv.Itoa(tile.Z) + "/" + strconv.Itoa(tile.X) + "/" + strconv.Itoa(tile.Y), &tile
+		}
+	case DensityGridGeohash:
+		if level < 1 || level > MaxGeohashPrecision {
+			return nil, ErrInvalidLevel
+		}
+		cellOf = func(point HeatmapPoint) (string, *Tile) {
+			return Geohash(point.Latitude, point.Longitude, level), nil
+		}
+	default:
+		return nil, ErrUnknownGrid
+	}
+
+	points, err := s.points(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cells := map[string]*DensityCell{}
+	for _, point := range points {
+		key, tile := cellOf(point)
+		cell := cells[key]
+		if cell == nil {
+			cell = &DensityCell{Cell: key, Tile: tile}
+			cells[key] = cell
+		}
+		// Running weighted mean of the cell's points
+		cell.Count += point.Weight
+		share := float64(point.Weight) / float64(cell.Count)
+		cell.Latitude += (point.Latitude - cell.Latitude) * share
+		cell.Longitude += (point.Longitude - cell.Longitude) * share
+	}
+
+	result := make([]DensityCell, 0, len(cells))
+	for _, cell := range cells {
+		result = append(result, *cell)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Cell < result[j].Cell
+	})
+	return result, nil
+}
+
+// RenderTile draws a layer's heatmap for one tile as a transparent PNG. Heat
+// is scaled against the heaviest point in the whole layer, so neighbouring
+// tiles match.
+func (s *HeatmapService) RenderTile(opts HeatmapOptions, tile Tile) ([]byte, error) {
+	if !tile.Valid() {
+		return nil, ErrInvalidTile
+	}
+
+	// Points just outside the tile still spread heat into it
+	n := float64(int(1) << uint(tile.Z))
+	margin := float64(heatmapRadius) / TileSize
+	opts.Region = &Region{
+		MinLng: (float64(tile.X)-margin)/n*360 - 180,
+		MaxLng: (float64(tile.X+1)+margin)/n*360 - 180,
+		MinLat: tileLat(math.Min(float64(tile.Y+1)+margin, n), n),
+		MaxLat: tileLat(math.Max(float64(tile.Y)-margin, 0), n),
+	}
+	points, err := s.points(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	heat := make([]float64, TileSize*TileSize)
+	if len(points) > 0 {
+		maxWeight, err := s.maxWeight(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		sigma := float64(heatmapRadius) / 2
+		for _, point := range points {
+			px, py := tile.Pixel(point.Latitude, point.Longitude)
+			for y := int(math.Max(0, py-heatmapRadius)); y < TileSize && float64(y) <= py+heatmapRadius; y++ {
+				for x := int(math.Max(0, px-heatmapRadius)); x < TileSize && float64(x) <= px+heatmapRadius; x++ {
+					dx, dy := float64(x)+0.5-px, float64(y)+0.5-py
+					if d2 := dx*dx + dy*dy; d2 <= heatmapRadius*heatmapRadius {
+						heat[y*TileSize+x] += float64(point.Weight) * math.Exp(-d2/(2*sigma*sigma))
+					}
+				}
+			}
+		}
+
+		// A log scale keeps a few busy fences from washing out the rest
+		scale := math.Log1p(2 * float64(maxWeight))
+		for i, value := range heat {
+			heat[i] = math.Min(1, math.Log1p(value)/scale)
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, TileSize, TileSize))
+	for i, value := range heat {
+		if value > 0 {
+			img.SetNRGBA(i%TileSize, i/TileSize, heatmapColor(value))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// maxWeight returns the heaviest point in a layer, ignoring the region
+func (s *HeatmapService) maxWeight(opts HeatmapOptions) (int64, error) {
+	opts.Region = nil
+	query, err := s.pointQuery(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var heaviest int64
+	err = database.DB.Table("(?) AS points", query).Select("COALESCE(MAX(weight), 0)").Scan(&heaviest).Error
+	return heaviest, err
+}
+
+// heatmapColor interpolates the colour ramp at heat
+func heatmapColor(heat float64) color.NRGBA {
+	for i := 1; i < len(heatmapRamp); i++ {
+		low, high := heatmapRamp[i-1], heatmapRamp[i]
+		if heat <= high.at {
+			t := (heat - low.at) / (high.at - low.at)
+			mix := func(a, b uint8) uint8 {
+				return uint8(float64(a) + (float64(b)-float64(a))*t)
+			}
+			return color.NRGBA{
+				R: mix(low.color.R, high.color.R),
+				G: mix(low.color.G, high.color.G),
+				B: mix(low.color.B, high.color.B),
+				A: mix(low.color.A, high.color.A),
+			}
+		}
+	}
+	return heatmapRamp[len(heatmapRamp)-1].color
+}
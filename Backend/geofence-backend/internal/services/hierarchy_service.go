@@ -0,0 +1,307 @@
+// internal/services/hierarchy_service.go
+package services
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxHierarchyDepth caps how many levels fences can be nested
+	MaxHierarchyDepth = 10
+
+	// containmentTolerance (metres) lets a child touch its parent's edge
+	containmentTolerance = 1.0
+	// containmentAreaTolerance is the share of a child that may poke out of
+	// a corridor parent, which is only measured to the grid it's traced on
+	containmentAreaTolerance = 0.01
+)
+
+var (
+	ErrParentNotFound   = errors.New("parent geofence not found")
+	ErrParentForbidden  = errors.New("you can only nest a geofence inside one you own or can edit")
+	ErrHierarchyCycle   = errors.New("a geofence can't be nested inside itself or its descendants")
+	ErrHierarchyTooDeep = errors.New("geofences can be nested at most 10 levels deep")
+	ErrOutsideParent    = errors.New("geofence must lie inside its parent")
+	ErrChildrenOutside  = errors.New("geofence must still contain all its children")
+)
+
+// HierarchyService manages parent/child geofences
+type HierarchyService struct{}
+
+// GeofenceDescendant is a fence below another; Depth is 1 for its children
+type GeofenceDescendant struct {
+	models.Geofence
+	Depth int `json:"depth"`
+}
+
+// GeofenceMatch is a fence containing a point and its hierarchy path, from
+// the root down to the fence itself
+type GeofenceMatch struct {
+	models.Geofence
+	Path []models.Geofence `json:"path"`
+}
+
+// ValidateHierarchy checks a fence's place in the hierarchy before it's
+// saved: its parent exists, userID may nest fences in it, it isn't one of
+// the fence's descendants, the nesting isn't too deep and the fence lies
+// inside it. A fence that's already saved must also still contain its
+// children.
+func (s *HierarchyService) ValidateHierarchy(fence models.Geofence, userID uint) error {
+	var descendants []GeofenceDescendant
+	if fence.ID != 0 {
+		var err error
+		if descendants, err = s.Descendants(fence.ID, 0); err != nil {
+			return err
+		}
+	}
+
+	height := 0
+	for _, descendant := range descendants {
+		if descendant.Depth > height {
+			height = descendant.Depth
+		}
+		if descendant.ParentID != nil && *descendant.ParentID == fence.ID && !GeofenceWithin(descendant.Geofence, fence) {
+			return ErrChildrenOutside
+		}
+	}
+
+	if fence.ParentID == nil {
+		return nil
+	}
+	if *fence.ParentID == fence.ID {
+		return ErrHierarchyCycle
+	}
+	for _, descendant := range descendants {
+		if descendant.ID == *fence.ParentID {
+			return ErrHierarchyCycle
+		}
+	}
+
+	var parent models.Geofence
+	if err := database.DB.First(&parent, *fence.ParentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrParentNotFound
+		}
+		return err
+	}
+	if parent.UserID != userID {
+		if err := (&GeofenceAccessService{}).CheckGeofenceAccess(userID, parent.ID, "edit"); err != nil {
+			return ErrParentForbidden
+		}
+	}
+
+	ancestors, err := s.Ancestors(parent.ID)
+	if err != nil {
+		return err
+	}
+	// The parent's ancestors, the parent, the fence and its subtree
+	if len(ancestors)+2+height > MaxHierarchyDepth {
+		return ErrHierarchyTooDeep
+	}
+
+	if !GeofenceWithin(fence, parent) {
+		return ErrOutsideParent
+	}
+	return nil
+}
+
+// Ancestors returns the fences above a fence, from the root down to its
+// parent
+func (s *HierarchyService) Ancestors(geofenceID uint) ([]models.Geofence, error) {
+	var fence models.Geofence
+	if err := database.DB.First(&fence, geofenceID).Error; err != nil {
+		return nil, err
+	}
+
+	ancestors := []models.Geofence{}
+	seen := map[uint]bool{fence.ID: true}
+	for fence.ParentID != nil && len(ancestors) < MaxHierarchyDepth {
+		var parent models.Geofence
+		err := database.DB.First(&parent, *fence.ParentID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if seen[parent.ID] {
+			break
+		}
+		seen[parent.ID] = true
+		ancestors = append(ancestors, parent)
+		fence = parent
+	}
+
+	// Root first
+	for i, j := 0, len(ancestors)-1; i < j; i, j = i+1, j-1 {
+		ancestors[i], ancestors[j] = ancestors[j], ancestors[i]
+	}
+	return ancestors, nil
+}
+
+// VisibleAncestors is Ancestors without the fences the viewer can't see
+func (s *HierarchyService) VisibleAncestors(geofenceID, viewerID uint) ([]models.Geofence, error) {
+	ancestors, err := s.Ancestors(geofenceID)
+	if err != nil || viewerID == 0 || len(ancestors) == 0 {
+		return ancestors, err
+	}
+
+	ids := make([]uint, len(ancestors))
+	for i, ancestor := range ancestors {
+		ids[i] = ancestor.ID
+	}
+	var visibleIDs []uint
+	err = database.DB.Model(&models.Geofence{}).Scopes(VisibleGeofences(viewerID)).
+		Where("geofences.id IN ?", ids).
+		Pluck("geofences.id", &visibleIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	visible := map[uint]bool{}
+	for _, id := range visibleIDs {
+		visible[id] = true
+	}
+
+	filtered := []models.Geofence{}
+	for _, ancestor := range ancestors {
+		if visible[ancestor.ID] {
+			filtered = append(filtered, ancestor)
+		}
+	}
+	return filtered, nil
+}
+
+// Descendants returns the fences below a fence level by level, down to
+// maxDepth levels (all of them when 0). Scopes limit which fences are
+// included; a fence they leave out hides its subtree too.
+func (s *HierarchyService) Descendants(geofenceID uint, maxDepth int, scopes ...func(*gorm.DB) *gorm.DB) ([]GeofenceDescendant, error) {
+	if maxDepth <= 0 || maxDepth > MaxHierarchyDepth {
+		maxDepth = MaxHierarchyDepth
+	}
+
+	descendants := []GeofenceDescendant{}
+	seen := map[uint]bool{geofenceID: true}
+	level := []uint{geofenceID}
+	for depth := 1; depth <= maxDepth && len(level) > 0; depth++ {
+		var children []models.Geofence
+		err := database.DB.Scopes(scopes...).
+			Where("geofences.parent_id IN ?", level).
+			Order("geofences.id").
+			Find(&children).Error
+		if err != nil {
+			return nil, err
+		}
+
+		level = nil
+		for _, child := range children {
+			if seen[child.ID] {
+				continue
+			}
+			seen[child.ID] = true
+			descendants = append(descendants, GeofenceDescendant{Geofence: child, Depth: depth})
+			level = append(level, child.ID)
+		}
+	}
+	return descendants, nil
+}
+
+// Locate returns the fences the viewer can see that contain a point (at the
+// fix's altitude, when it has one) and are active at the given time, each
+// with its hierarchy path, innermost first
+func (s *HierarchyService) Locate(lat, lng float64, fix AltitudeFix, viewerID uint, at time.Time) ([]GeofenceMatch, error) {
+	point := Region{MinLat: lat, MinLng: lng, MaxLat: lat, MaxLng: lng}
+
+	var candidates []models.Geofence
+	err := database.DB.Preload("Schedule").
+		Scopes(VisibleGeofences(viewerID), regionPrefilter(point)).
+		Order("geofences.id").
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []GeofenceMatch{}
+	for _, fence := range ActiveGeofences(candidates, at) {
+		if !GeofenceContainsFix(fence, lat, lng, fix) {
+			continue
+		}
+		ancestors, err := s.VisibleAncestors(fence.ID, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		fence.Schedule = nil
+		matches = append(matches, GeofenceMatch{Geofence: fence, Path: append(ancestors, fence)})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return len(matches[i].Path) > len(matches[j].Path) })
+	return matches, nil
+}
+
+// Detach moves a fence's children up to its own parent, before the fence is
+// deleted. They lie inside the grandparent since they lie inside the fence.
+func (s *HierarchyService) Detach(tx *gorm.DB, fence models.Geofence) error {
+	return tx.Model(&models.Geofence{}).Where("parent_id = ?", fence.ID).Update("parent_id", fence.ParentID).Error
+}
+
+// CascadingAncestors returns the IDs of a fence's ancestors that cascade
+// their content (or, with permissions, their permissions) to it
+func (s *HierarchyService) CascadingAncestors(geofenceID uint, permissions bool) ([]uint, error) {
+	ancestors, err := s.Ancestors(geofenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint
+	for _, ancestor := range ancestors {
+		if (permissions && ancestor.CascadePermissions) || (!permissions && ancestor.CascadeContent) {
+			ids = append(ids, ancestor.ID)
+		}
+	}
+	return ids, nil
+}
+
+// GeofenceWithin reports whether a fence lies wholly inside another. Inside
+// a circle it's enough for the child's circle, or for every corridor vertex
+// with the buffer around it, to be within the radius. Inside a corridor it's
+// measured on the traced shapes.
+func GeofenceWithin(child, parent models.Geofence) bool {
+	// Bands measured differently (or a child without one) are only checked
+	// in 2D
+	if hasAltitude(parent) && hasAltitude(child) && child.AltitudeRef == parent.AltitudeRef {
+		childLow, childHigh := altitudeBand(child)
+		parentLow, parentHigh := altitudeBand(parent)
+		if childLow < parentLow || childHigh > parentHigh {
+			return false
+		}
+	}
+
+	if parent.Type != models.GeofenceTypeCorridor {
+		validator := &GeofenceValidationService{}
+		within := func(lat, lng, radius float64) bool {
+			return validator.CalculateDistance(parent.Latitude, parent.Longitude, lat, lng)*1000+radius <= parent.Radius+containmentTolerance
+		}
+		if child.Type != models.GeofenceTypeCorridor {
+			return within(child.Latitude, child.Longitude, child.Radius)
+		}
+		for _, point := range child.Path {
+			if !within(point.Latitude, point.Longitude, child.BufferWidth) {
+				return false
+			}
+		}
+		return true
+	}
+
+	overlaps := &OverlapService{}
+	outside, _, err := overlaps.combine(child, parent, SetDifference, operationGridCells)
+	if err != nil {
+		return false
+	}
+	return outside <= overlaps.area(child)*containmentAreaTolerance
+}
@@ -0,0 +1,150 @@
+// internal/services/location_service.go
+package services
+
+import (
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// LocationService turns a user's location updates into geofence events
+type LocationService struct{}
+
+// LocationUpdate is a position reported by a user's device. Fences with an
+// altitude band are only checked in 3D when it carries that altitude.
+type LocationUpdate struct {
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	RecordedAt time.Time `json:"recorded_at"`
+	AltitudeFix
+}
+
+// LocationResult is what a location update changed: the active fences the
+// user is now in, the visits opened and closed, and the corridors they
+// strayed from
+type LocationResult struct {
+	Inside   []uint                  `json:"inside"`
+	Entered  []models.GeofenceVisit  `json:"entered"`
+	Exited   []models.GeofenceVisit  `json:"exited"`
+	OffRoute []models.RouteDeviation `json:"off_route"`
+}
+
+// Ingest records a location update. Entering an active fence opens a visit
+// and leaving one (or it going inactive) closes it; leaving a corridor is
+// also recorded as a route deviation. Both are published to the fence's
+// group subscriptions.
+func (s *LocationService) Ingest(userID uint, update LocationUpdate) (*LocationResult, error) {
+	at := update.RecordedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	point := Region{MinLat: update.Latitude, MinLng: update.Longitude, MaxLat: update.Latitude, MaxLng: update.Longitude}
+
+	result := &LocationResult{
+		Inside:   []uint{},
+		Entered:  []models.GeofenceVisit{},
+		Exited:   []models.GeofenceVisit{},
+		OffRoute: []models.RouteDeviation{},
+	}
+	groups := &GroupService{}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var candidates []models.Geofence
+		err := tx.Preload("Schedule").
+			Scopes(VisibleGeofences(userID), regionPrefilter(point)).
+			Order("geofences.id").
+			Find(&candidates).Error
+		if err != nil {
+			return err
+		}
+
+		inside := map[uint]bool{}
+		revisions := map[uint]int{}
+		for _, fence := range ActiveGeofences(candidates, at) {
+			if GeofenceContainsFix(fence, update.Latitude, update.Longitude, update.AltitudeFix) {
+				inside[fence.ID] = true
+				revisions[fence.ID] = fence.Revision
+				result.Inside = append(result.Inside, fence.ID)
+			}
+		}
+
+		var open []models.GeofenceVisit
+		if err := tx.Where("user_id = ? AND exited_at IS NULL", userID).Order("id").Find(&open).Error; err != nil {
+			return err
+		}
+		visiting := map[uint]bool{}
+		var left []uint
+		for _, visit := range open {
+			visiting[visit.GeofenceID] = true
+			if !inside[visit.GeofenceID] {
+				left = append(left, visit.GeofenceID)
+			}
+		}
+
+		var leftFences []models.Geofence
+		if len(left) > 0 {
+			if err := tx.Where("id IN ?", left).Find(&leftFences).Error; err != nil {
+				return err
+			}
+		}
+		corridors := map[uint]models.Geofence{}
+		for _, fence := range leftFences {
+			if fence.Type == models.GeofenceTypeCorridor {
+				corridors[fence.ID] = fence
+			}
+		}
+
+		for _, visit := range open {
+			if inside[visit.GeofenceID] {
+				continue
+			}
+			exitedAt := at
+			visit.ExitedAt = &exitedAt
+			if err := tx.Model(&visit).Update("exited_at", exitedAt).Error; err != nil {
+				return err
+			}
+			result.Exited = append(result.Exited, visit)
+			if err := groups.PublishVisitEvent(tx, visit.GeofenceID, models.GroupEventExit, at); err != nil {
+				return err
+			}
+
+			corridor, ok := corridors[visit.GeofenceID]
+			if !ok {
+				continue
+			}
+			deviation := models.RouteDeviation{
+				GeofenceID: corridor.ID,
+				UserID:     userID,
+				Latitude:   update.Latitude,
+				Longitude:  update.Longitude,
+				Distance:   DistanceToPath(corridor.Path, update.Latitude, update.Longitude),
+				CreatedAt:  at,
+			}
+			if err := tx.Create(&deviation).Error; err != nil {
+				return err
+			}
+			result.OffRoute = append(result.OffRoute, deviation)
+		}
+
+		for _, id := range result.Inside {
+			if visiting[id] {
+				continue
+			}
+			visit := models.GeofenceVisit{GeofenceID: id, UserID: userID, Revision: revisions[id], CreatedAt: at}
+			if err := tx.Create(&visit).Error; err != nil {
+				return err
+			}
+			result.Entered = append(result.Entered, visit)
+			if err := groups.PublishVisitEvent(tx, id, models.GroupEventEnter, at); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
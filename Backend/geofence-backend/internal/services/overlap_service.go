@@ -0,0 +1,184 @@
+// internal/services/overlap_service.go
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/utils"
+)
+
+const (
+	// DefaultOverlapThreshold is the share of the smaller fence two fences
+	// have to have in common to count as overlapping
+	DefaultOverlapThreshold = 0.5
+
+	// Set operations
+	SetUnion        = "union"
+	SetIntersection = "intersection"
+	SetDifference   = "difference"
+
+	// Grid cells along the longer side of the box fences are traced in:
+	// coarser for overlap checks, finer for geometry that's returned
+	overlapGridCells   = 128
+	operationGridCells = 256
+)
+
+var (
+	ErrUnknownSetOperation = errors.New("operation must be union, intersection or difference")
+	ErrInvalidThreshold    = errors.New("overlap threshold must be between 0 and 1")
+)
+
+// OverlapService finds overlapping geofences and combines fences into new
+// shapes
+type OverlapService struct{}
+
+// GeofenceOverlap is an existing fence a fence overlaps. Ratio is the
+// shared area as a share of the smaller fence; Area is in square metres.
+type GeofenceOverlap struct {
+	GeofenceID uint    `json:"geofence_id"`
+	Name       string  `json:"name"`
+	Ratio      float64 `json:"ratio"`
+	Area       float64 `json:"area"`
+}
+
+// GeofenceShape is the result of a set operation: its area in square
+// metres and a GeoJSON Polygon or MultiPolygon (with no coordinates when
+// the result is empty)
+type GeofenceShape struct {
+	Operation   string                 `json:"operation"`
+	GeofenceIDs [2]uint                `json:"geofence_ids"`
+	Area        float64                `json:"area"`
+	Geometry    *utils.GeoJSONGeometry `json:"geometry"`
+}
+
+// Overlaps returns the owner's other fences that share at least threshold
+// of the smaller fence's area with this one, most overlapping first
+func (s *OverlapService) Overlaps(fence models.Geofence, threshold float64) ([]GeofenceOverlap, error) {
+	if threshold < 0 || threshold > 1 {
+		return nil, ErrInvalidThreshold
+	}
+
+	bounds := RegionAround(GeoFilter{Latitude: fence.Latitude, Longitude: fence.Longitude, RadiusKm: fence.Radius / 1000})
+
+	var candidates []models.Geofence
+	err := database.DB.Scopes(regionPrefilter(bounds)).
+		Where("geofences.user_id = ? AND geofences.id <> ?", fence.UserID, fence.ID).
+		Order("geofences.id").
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	validator := &GeofenceValidationService{}
+	overlaps := []GeofenceOverlap{}
+	for _, other := range candidates {
+		// Fences whose enclosing circles or altitude bands don't meet can't
+		// overlap
+		if verticallyApart(fence, other) {
+			continue
+		}
+		if validator.CalculateDistance(fence.Latitude, fence.Longitude, other.Latitude, other.Longitude)*1000 >= fence.Radius+other.Radius {
+			continue
+		}
+
+		shared, _, err := s.combine(fence, other, SetIntersection, overlapGridCells)
+		if err != nil {
+			return nil, err
+		}
+		if shared <= 0 {
+			continue
+		}
+		smaller := math.Min(s.area(fence), s.area(other))
+		ratio := math.Min(shared/smaller, 1)
+		if ratio < threshold {
+			continue
+		}
+		overlaps = append(overlaps, GeofenceOverlap{GeofenceID: other.ID, Name: other.Name, Ratio: ratio, Area: shared})
+	}
+
+	sort.SliceStable(overlaps, func(i, j int) bool { return overlaps[i].Ratio > overlaps[j].Ratio })
+	return overlaps, nil
+}
+
+// Combine computes the union, intersection or difference (a minus b) of two
+// fences as polygon geometry
+func (s *OverlapService) Combine(a, b models.Geofence, operation string) (*GeofenceShape, error) {
+	area, polygons, err := s.combine(a, b, operation, operationGridCells)
+	if err != nil {
+		return nil, err
+	}
+
+	projection := s.projection(a, b)
+	coordinates := make([][][][2]float64, len(polygons))
+	for i, polygon := range polygons {
+		for _, ring := range append([]shapeRing{polygon.outer}, polygon.holes...) {
+			closed := make([][2]float64, 0, len(ring)+1)
+			for _, point := range append(ring, ring[0]) {
+				lat, lng := projection.inverse(point[0], point[1])
+				closed = append(closed, [2]float64{lng, lat})
+			}
+			coordinates[i] = append(coordinates[i], closed)
+		}
+	}
+
+	geometry := &utils.GeoJSONGeometry{Type: utils.GeoJSONMultiPolygon}
+	if len(coordinates) == 1 {
+		geometry.Type = utils.GeoJSONPolygon
+		geometry.Coordinates, err = json.Marshal(coordinates[0])
+	} else {
+		geometry.Coordinates, err = json.Marshal(coordinates)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &GeofenceShape{Operation: operation, GeofenceIDs: [2]uint{a.ID, b.ID}, Area: area, Geometry: geometry}, nil
+}
+
+// combine traces the result of a set operation in the fences' shared
+// projection
+func (s *OverlapService) combine(a, b models.Geofence, operation string, cells int) (float64, []shapePolygon, error) {
+	projection := s.projection(a, b)
+	fa, fb := shapeField(a, projection), shapeField(b, projection)
+
+	var field fenceField
+	switch operation {
+	case SetUnion:
+		field = func(x, y float64) float64 { return math.Min(fa(x, y), fb(x, y)) }
+	case SetIntersection:
+		field = func(x, y float64) float64 { return math.Max(fa(x, y), fb(x, y)) }
+	case SetDifference:
+		field = func(x, y float64) float64 { return math.Max(fa(x, y), -fb(x, y)) }
+	default:
+		return 0, nil, ErrUnknownSetOperation
+	}
+
+	// The box around both fences' enclosing circles, a little over a cell
+	// bigger on each side so every contour closes
+	ax, ay := projection.forward(a.Latitude, a.Longitude)
+	bx, by := projection.forward(b.Latitude, b.Longitude)
+	minX, maxX := math.Min(ax-a.Radius, bx-b.Radius), math.Max(ax+a.Radius, bx+b.Radius)
+	minY, maxY := math.Min(ay-a.Radius, by-b.Radius), math.Max(ay+a.Radius, by+b.Radius)
+	pad := math.Max(maxX-minX, maxY-minY) * 2 / float64(cells)
+	polygons, area := contourField(field, minX-pad, minY-pad, maxX+pad, maxY+pad, cells)
+	return area, polygons, nil
+}
+
+// area is a fence's area in square metres
+func (s *OverlapService) area(fence models.Geofence) float64 {
+	if fence.Type != models.GeofenceTypeCorridor {
+		return math.Pi * fence.Radius * fence.Radius
+	}
+	area, _, _ := s.combine(fence, fence, SetUnion, overlapGridCells)
+	return area
+}
+
+// projection centres a flat projection between two fences
+func (s *OverlapService) projection(a, b models.Geofence) localProjection {
+	return newLocalProjection((a.Latitude+b.Latitude)/2, a.Longitude+math.Remainder(b.Longitude-a.Longitude, 360)/2)
+}
@@ -0,0 +1,188 @@
+// internal/services/reaction_service.go
+package services
+
+import (
+	"errors"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidReaction = errors.New("invalid reaction type")
+	ErrContentNotFound = errors.New("content not found")
+)
+
+// ReactionService manages likes, favorites and reposts on content
+type ReactionService struct{}
+
+// reactionCountColumns maps each reaction type to its denormalized counter on contents
+var reactionCountColumns = map[string]string{
+	models.InteractionLike:     "like_count",
+	models.InteractionFavorite: "favorite_count",
+	models.InteractionRepost:   "repost_count",
+}
+
+// AddReaction records a reaction and returns the updated content.
+// Reacting twice is a no-op: the counter only moves when a new row is inserted.
+func (s *ReactionService) AddReaction(userID, contentID uint, reactionType string) (*models.Content, error) {
+	column, ok := reactionCountColumns[reactionType]
+	if !ok {
+		return nil, ErrInvalidReaction
+	}
+
+	var content models.Content
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&content, contentID).Error; err != nil {
+			return ErrContentNotFound
+		}
+
+		// Owners who blocked the user don't accept reactions from them
+		var ownerID uint
+		tx.Model(&models.Geofence{}).Where("id = ?", content.GeofenceID).Select("user_id").Scan(&ownerID)
+		if (&SocialService{}).IsBlocked(ownerID, userID) {
+			return ErrBlocked
+		}
+
+		interaction := models.ContentInteraction{
+			UserID:          userID,
+			ContentID:       contentID,
+			InteractionType: reactionType,
+			InteractionTime: time.Now(),
+		}
+
+		// The partial unique index on content_interactions turns duplicates into no-ops
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&interaction)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		return tx.Model(&models.Content{}).Where("id = ?", contentID).
+			UpdateColumn(column, gorm.Expr(column+" + 1")).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reload(contentID)
+}
+
+// RecordView logs that the user opened a content item. Views aren't unique;
+// each one is a separate signal for recommendations and analytics.
+func (s *ReactionService) RecordView(userID, contentID uint) error {
+	var content models.Content
+	if err := database.DB.Select("id").First(&content, contentID).Error; err != nil {
+		return ErrContentNotFound
+	}
+
+	return database.DB.Create(&models.ContentInteraction{
+		UserID:          userID,
+		ContentID:       contentID,
+		InteractionType: models.InteractionView,
+		InteractionTime: time.Now(),
+	}).Error
+}
+
+// RemoveReaction withdraws a reaction and returns the updated content.
+// Removing a reaction that doesn't exist is a no-op.
+func (s *ReactionService) RemoveReaction(userID, contentID uint, reactionType string) (*models.Content, error) {
+	column, ok := reactionCountColumns[reactionType]
+	if !ok {
+		return nil, ErrInvalidReaction
+	}
+
+	var content models.Content
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&content, contentID).Error; err != nil {
+			return ErrContentNotFound
+		}
+
+		result := tx.Where("user_id = ? AND content_id = ? AND interaction_type = ?", userID, contentID, reactionType).
+			Delete(&models.ContentInteraction{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		return tx.Model(&models.Content{}).Where("id = ? AND "+column+" > 0", contentID).
+			UpdateColumn(column, gorm.Expr(column+" - 1")).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reload(contentID)
+}
+
+// HasReacted reports which reactions a user currently holds on a content
+func (s *ReactionService) HasReacted(userID, contentID uint) (map[string]bool, error) {
+	var types []string
+	err := database.DB.Model(&models.ContentInteraction{}).
+		Where("user_id = ? AND content_id = ? AND interaction_type IN ?", userID, contentID,
+			[]string{models.InteractionLike, models.InteractionFavorite, models.InteractionRepost}).
+		Pluck("interaction_type", &types).Error
+	if err != nil {
+		return nil, err
+	}
+
+	reacted := map[string]bool{
+		models.InteractionLike:     false,
+		models.InteractionFavorite: false,
+		models.InteractionRepost:   false,
+	}
+	for _, t := range types {
+		reacted[t] = true
+	}
+	return reacted, nil
+}
+
+// ListReactedContent returns the content a user has reacted to, most recent reaction first,
+// leaving out content viewerID isn't allowed to see
+func (s *ReactionService) ListReactedContent(userID, viewerID uint, reactionType string, limit, offset int) ([]models.Content, int64, error) {
+	if !models.IsReaction(reactionType) {
+		return nil, 0, ErrInvalidReaction
+	}
+
+	query := database.DB.Model(&models.Content{}).
+		Joins("JOIN content_interactions ON content_interactions.content_id = contents.id").
+		Where("content_interactions.user_id = ? AND content_interactions.interaction_type = ?", userID, reactionType).
+		Where("content_interactions.deleted_at IS NULL").
+		Scopes(VisibleContents(viewerID)).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var contents []models.Content
+	err := query.Select("contents.*").
+		Order("content_interactions.created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&contents).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return contents, total, nil
+}
+
+func (s *ReactionService) reload(contentID uint) (*models.Content, error) {
+	var content models.Content
+	if err := database.DB.First(&content, contentID).Error; err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
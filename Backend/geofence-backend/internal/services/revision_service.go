@@ -0,0 +1,163 @@
+// internal/services/revision_service.go
+package services
+
+import (
+	"errors"
+	"reflect"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// RevisionService keeps the revision history of geofences
+type RevisionService struct{}
+
+// RevisionChange is a field that differs between two revisions
+type RevisionChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// RevisionDiff is what changed from one revision to another
+type RevisionDiff struct {
+	From    int              `json:"from"`
+	To      int              `json:"to"`
+	Changes []RevisionChange `json:"changes"`
+}
+
+// Baseline records a fence from before revisions were kept as its first
+// revision, credited to its owner, so an edit doesn't lose its old state.
+// Fences that already have revisions are left alone.
+func (s *RevisionService) Baseline(tx *gorm.DB, fence *models.Geofence) error {
+	if fence.Revision != 0 {
+		return nil
+	}
+	revision := snapshotRevision(*fence)
+	revision.Revision, revision.AuthorID, revision.CreatedAt = 1, fence.UserID, fence.UpdatedAt
+	if err := tx.Create(&revision).Error; err != nil {
+		return err
+	}
+	fence.Revision = 1
+	return tx.Model(fence).UpdateColumn("revision", 1).Error
+}
+
+// Record saves a fence's current state as its next revision
+func (s *RevisionService) Record(tx *gorm.DB, fence *models.Geofence, authorID uint) error {
+	revision := snapshotRevision(*fence)
+	revision.Revision, revision.AuthorID = fence.Revision+1, authorID
+	if err := tx.Create(&revision).Error; err != nil {
+		return err
+	}
+	fence.Revision = revision.Revision
+	return tx.Model(fence).UpdateColumn("revision", revision.Revision).Error
+}
+
+// List returns a fence's revisions, newest first
+func (s *RevisionService) List(geofenceID uint) ([]models.GeofenceRevision, error) {
+	revisions := []models.GeofenceRevision{}
+	err := database.DB.Where("geofence_id = ?", geofenceID).Order("revision DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+// Get returns one of a fence's revisions
+func (s *RevisionService) Get(geofenceID uint, number int) (*models.GeofenceRevision, error) {
+	var revision models.GeofenceRevision
+	err := database.DB.Where("geofence_id = ? AND revision = ?", geofenceID, number).First(&revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// Diff compares two of a fence's revisions field by field
+func (s *RevisionService) Diff(geofenceID uint, from, to int) (*RevisionDiff, error) {
+	a, err := s.Get(geofenceID, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.Get(geofenceID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &RevisionDiff{From: from, To: to, Changes: []RevisionChange{}}
+	before, after := revisionFields(*a), revisionFields(*b)
+	for i := range before {
+		if !reflect.DeepEqual(before[i].value, after[i].value) {
+			diff.Changes = append(diff.Changes, RevisionChange{Field: before[i].name, From: before[i].value, To: after[i].value})
+		}
+	}
+	return diff, nil
+}
+
+// Restore puts an old revision's geometry and metadata back on a fence. It
+// doesn't save the fence: it still has to be validated, saved and recorded
+// as a new revision, so history is never rewritten.
+func (s *RevisionService) Restore(fence *models.Geofence, revision models.GeofenceRevision) {
+	fence.Name, fence.Description = revision.Name, revision.Description
+	fence.Type, fence.Latitude, fence.Longitude, fence.Radius = revision.Type, revision.Latitude, revision.Longitude, revision.Radius
+	fence.Path, fence.BufferWidth = revision.Path, revision.BufferWidth
+	fence.MinAltitude, fence.MaxAltitude, fence.AltitudeRef = revision.MinAltitude, revision.MaxAltitude, revision.AltitudeRef
+}
+
+// snapshotRevision copies the versioned fields of a fence
+func snapshotRevision(fence models.Geofence) models.GeofenceRevision {
+	return models.GeofenceRevision{
+		GeofenceID:  fence.ID,
+		Name:        fence.Name,
+		Description: fence.Description,
+		Type:        fence.Type,
+		Latitude:    fence.Latitude,
+		Longitude:   fence.Longitude,
+		Radius:      fence.Radius,
+		Path:        fence.Path,
+		BufferWidth: fence.BufferWidth,
+		MinAltitude: fence.MinAltitude,
+		MaxAltitude: fence.MaxAltitude,
+		AltitudeRef: fence.AltitudeRef,
+	}
+}
+
+// revisionField is a versioned field of a revision, by its JSON name
+type revisionField struct {
+	name  string
+	value interface{}
+}
+
+// revisionFields lists the versioned fields of a revision, with pointers
+// dereferenced so equal values compare equal
+func revisionFields(revision models.GeofenceRevision) []revisionField {
+	var minAltitude, maxAltitude interface{}
+	if revision.MinAltitude != nil {
+		minAltitude = *revision.MinAltitude
+	}
+	if revision.MaxAltitude != nil {
+		maxAltitude = *revision.MaxAltitude
+	}
+	path := revision.Path
+	if len(path) == 0 {
+		path = nil
+	}
+
+	return []revisionField{
+		{"name", revision.Name},
+		{"description", revision.Description},
+		{"type", revision.Type},
+		{"latitude", revision.Latitude},
+		{"longitude", revision.Longitude},
+		{"radius", revision.Radius},
+		{"path", path},
+		{"buffer_width", revision.BufferWidth},
+		{"min_altitude", minAltitude},
+		{"max_altitude", maxAltitude},
+		{"altitude_ref", revision.AltitudeRef},
+	}
+}
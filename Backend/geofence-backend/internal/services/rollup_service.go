@@ -0,0 +1,382 @@
+// internal/services/rollup_service.go
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	analyticsWatermark = "analytics"
+
+	// rollupChunk is how much raw data one transaction rolls up; the
+	// watermark advances after each chunk so an interrupted run resumes there
+	rollupChunk = 24 * time.Hour
+
+	// rollupLookback re-processes recent hours on every run so exits and
+	// other late writes land in the right bucket. Visits that started before
+	// it and exit later are re-rolled by rollupLateExits.
+	rollupLookback = 6 * time.Hour
+)
+
+var (
+	ErrInvalidBackfillRange = errors.New("invalid backfill range")
+	ErrBackfillTooLong      = errors.New("a backfill can cover at most 366 days")
+)
+
+// rollupMu serializes the periodic run and backfills, which delete and
+// rewrite the same buckets
+var rollupMu sync.Mutex
+
+// RollupService aggregates raw visits and interactions into hourly and daily
+// summaries. Rolling up a range always recomputes it from raw rows, so runs
+// are idempotent and any range can be backfilled.
+type RollupService struct{}
+
+// rollupVisit and rollupInteraction are the raw rows a rollup reads
+type rollupVisit struct {
+	GeofenceID uint
+	UserID     uint
+	CreatedAt  time.Time
+	ExitedAt   *time.Time
+}
+
+type rollupInteraction struct {
+	ContentID       uint
+	GeofenceID      uint
+	InteractionType string
+	CreatedAt       time.Time
+}
+
+// Run rolls up every complete hour since the watermark, chunk by chunk.
+// On the first run it starts from the oldest raw event.
+func (s *RollupService) Run() error {
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+
+	until := time.Now().UTC().Truncate(time.Hour)
+
+	start, err := s.Watermark()
+	if err != nil {
+		return err
+	}
+	if start.IsZero() {
+		if start, err = s.oldestEvent(); err != nil || start.IsZero() {
+			return err
+		}
+	} else {
+		start = start.Add(-rollupLookback)
+	}
+	start = start.UTC().Truncate(time.Hour)
+
+	if err := s.rollupLateExits(start); err != nil {
+		return err
+	}
+
+	for start.Before(until) {
+		end := start.Add(rollupChunk)
+		if end.After(until) {
+			end = until
+		}
+
+		if err := s.rollup(start, end); err != nil {
+			return err
+		}
+		if err := s.setWatermark(end); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// CheckBackfill validates a backfill range: from before to, at most
+// MaxMetricsRange apart
+func (s *RollupService) CheckBackfill(from, to time.Time) error {
+	if !to.After(from) {
+		return ErrInvalidBackfillRange
+	}
+	if to.Sub(from) > MaxMetricsRange {
+		return ErrBackfillTooLong
+	}
+	return nil
+}
+
+// Backfill recomputes the rollups between from and to (rounded out to whole
+// hours) without moving the watermark. It waits for any run or backfill in
+// progress.
+func (s *RollupService) Backfill(from, to time.Time) error {
+	if err := s.CheckBackfill(from, to); err != nil {
+		return err
+	}
+	from = from.UTC().Truncate(time.Hour)
+	to = to.UTC().Add(time.Hour - time.Nanosecond).Truncate(time.Hour)
+
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+
+	for start := from; start.Before(to); start = start.Add(rollupChunk) {
+		end := start.Add(rollupChunk)
+		if end.After(to) {
+			end = to
+		}
+		if err := s.rollup(start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollupLateExits recomputes, up to since, the days of visits that started
+// before since but ended after it. Their buckets were rolled up before the
+// exit, so their dwell time is missing there.
+func (s *RollupService) rollupLateExits(since time.Time) error {
+	var starts []time.Time
+	err := database.DB.Model(&models.GeofenceVisit{}).
+		Where("exited_at >= ? AND created_at < ?", since, since).
+		Pluck("created_at", &starts).Error
+	if err != nil {
+		return err
+	}
+
+	days := map[int64]time.Time{}
+	for _, at := range starts {
+		day := at.UTC().Truncate(24 * time.Hour)
+		days[day.Unix()] = day
+	}
+	for _, day := range days {
+		end := day.Add(24 * time.Hour)
+		if end.After(since) {
+			end = since
+		}
+		if err := s.rollup(day, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watermark returns the time rollups are complete up to, or zero if they
+// have never run
+func (s *RollupService) Watermark() (time.Time, error) {
+	var mark models.RollupWatermark
+	err := database.DB.Where("name = ?", analyticsWatermark).First(&mark).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	return mark.ProcessedUntil, err
+}
+
+func (s *RollupService) setWatermark(until time.Time) error {
+	return database.DB.Save(&models.RollupWatermark{Name: analyticsWatermark, ProcessedUntil: until}).Error
+}
+
+// rollup recomputes the hourly buckets in [from, to) and every daily bucket
+// those hours fall in
+func (s *RollupService) rollup(from, to time.Time) error {
+	dayFrom := from.Truncate(24 * time.Hour)
+	dayTo := to.Add(24*time.Hour - time.Nanosecond).Truncate(24 * time.Hour)
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.rollupGranularity(tx, models.RollupHourly, time.Hour, from, to); err != nil {
+			return err
+		}
+		return s.rollupGranularity(tx, models.RollupDaily, 24*time.Hour, dayFrom, dayTo)
+	})
+}
+
+func (s *RollupService) rollupGranularity(tx *gorm.DB, granularity string, size time.Duration, from, to time.Time) error {
+	var visits []rollupVisit
+	err := tx.Model(&models.GeofenceVisit{}).
+		Select("geofence_id, user_id, created_at, exited_at").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Scan(&visits).Error
+	if err != nil {
+		return err
+	}
+
+	// Interactions are events: a reaction that was later withdrawn still happened
+	var interactions []rollupInteraction
+	err = tx.Unscoped().Model(&models.ContentInteraction{}).
+		Select("content_interactions.content_id, contents.geofence_id, content_interactions.interaction_type, content_interactions.created_at").
+		Joins("JOIN contents ON contents.id = content_interactions.content_id").
+		Where("content_interactions.created_at >= ? AND content_interactions.created_at < ?", from, to).
+		Scan(&interactions).Error
+	if err != nil {
+		return err
+	}
+
+	type key struct {
+		itemType string
+		itemID   uint
+		start    int64
+	}
+	rows := map[key]*models.AnalyticsRollup{}
+	row := func(itemType string, itemID uint, at time.Time) *models.AnalyticsRollup {
+		start := at.UTC().Truncate(size)
+		k := key{itemType, itemID, start.Unix()}
+		if rows[k] == nil {
+			rows[k] = &models.AnalyticsRollup{Granularity: granularity, ItemType: itemType, ItemID: itemID, BucketStart: start}
+		}
+		return rows[k]
+	}
+
+	visitors := map[key]map[uint]bool{}
+	for _, visit := range visits {
+		r := row(models.ItemTypeGeofence, visit.GeofenceID, visit.CreatedAt)
+		r.Visits++
+		if visit.ExitedAt != nil && visit.ExitedAt.After(visit.CreatedAt) {
+			r.DwellCount++
+			r.DwellSecondsTotal += visit.ExitedAt.Sub(visit.CreatedAt).Seconds()
+		}
+		if visit.UserID != 0 {
+			k := key{r.ItemType, r.ItemID, r.BucketStart.Unix()}
+			if visitors[k] == nil {
+				visitors[k] = map[uint]bool{}
+			}
+			if !visitors[k][visit.UserID] {
+				visitors[k][visit.UserID] = true
+				r.UniqueVisitors++
+			}
+		}
+	}
+
+	for _, interaction := range interactions {
+		for _, r := range []*models.AnalyticsRollup{
+			row(models.ItemTypeContent, interaction.ContentID, interaction.CreatedAt),
+			row(models.ItemTypeGeofence, interaction.GeofenceID, interaction.CreatedAt),
+		} {
+			switch interaction.InteractionType {
+			case models.InteractionView:
+				r.Views++
+			case models.InteractionLike:
+				r.Likes++
+			case models.InteractionFavorite:
+				r.Favorites++
+			case models.InteractionRepost:
+				r.Reposts++
+			}
+		}
+	}
+
+	err = tx.Where("granularity = ? AND bucket_start >= ? AND bucket_start < ?", granularity, from.UTC(), to.UTC()).
+		Delete(&models.AnalyticsRollup{}).Error
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+
+	batch := make([]models.AnalyticsRollup, 0, len(rows))
+	for _, r := range rows {
+		batch = append(batch, *r)
+	}
+	return tx.CreateInBatches(batch, 500).Error
+}
+
+// EngagementTotals are all-time counts of visits and interactions
+type EngagementTotals struct {
+	Visits    int64 `json:"visits"`
+	Views     int64 `json:"views"`
+	Likes     int64 `json:"likes"`
+	Favorites int64 `json:"favorites"`
+	Reposts   int64 `json:"reposts"`
+}
+
+// GeofenceTotals sums engagement for the geofences selected by geofenceIDs
+// (a subquery of IDs): daily rollups for whole days before the watermark,
+// hourly rollups for the rest of that day, and raw rows after it
+func (s *RollupService) GeofenceTotals(geofenceIDs *gorm.DB) (EngagementTotals, error) {
+	var totals EngagementTotals
+
+	watermark, err := s.Watermark()
+	if err != nil {
+		return totals, err
+	}
+	watermark = watermark.UTC()
+	day := watermark.Truncate(24 * time.Hour)
+
+	sums := "COALESCE(SUM(visits), 0) AS visits, COALESCE(SUM(views), 0) AS views, COALESCE(SUM(likes), 0) AS likes, " +
+		"COALESCE(SUM(favorites), 0) AS favorites, COALESCE(SUM(reposts), 0) AS reposts"
+	for _, part := range []struct {
+		granularity string
+		from, to    time.Time
+	}{
+		{models.RollupDaily, time.Time{}, day},
+		{models.RollupHourly, day, watermark},
+	} {
+		var sum EngagementTotals
+		err := database.DB.Model(&models.AnalyticsRollup{}).Select(sums).
+			Where("granularity = ? AND item_type = ? AND item_id IN (?)", part.granularity, models.ItemTypeGeofence, geofenceIDs).
+			Where("bucket_start >= ? AND bucket_start < ?", part.from, part.to).
+			Scan(&sum).Error
+		if err != nil {
+			return totals, err
+		}
+		totals.add(sum)
+	}
+
+	var recentVisits int64
+	if err := database.DB.Model(&models.GeofenceVisit{}).
+		Where("geofence_id IN (?) AND created_at >= ?", geofenceIDs, watermark).
+		Count(&recentVisits).Error; err != nil {
+		return totals, err
+	}
+	totals.Visits += recentVisits
+
+	var recent []struct {
+		InteractionType string
+		Count           int64
+	}
+	err = database.DB.Unscoped().Model(&models.ContentInteraction{}).
+		Select("content_interactions.interaction_type, COUNT(*) AS count").
+		Joins("JOIN contents ON contents.id = content_interactions.content_id").
+		Where("contents.geofence_id IN (?) AND content_interactions.created_at >= ?", geofenceIDs, watermark).
+		Group("content_interactions.interaction_type").
+		Scan(&recent).Error
+	if err != nil {
+		return totals, err
+	}
+	for _, row := range recent {
+		switch row.InteractionType {
+		case models.InteractionView:
+			totals.Views += row.Count
+		case models.InteractionLike:
+			totals.Likes += row.Count
+		case models.InteractionFavorite:
+			totals.Favorites += row.Count
+		case models.InteractionRepost:
+			totals.Reposts += row.Count
+		}
+	}
+
+	return totals, nil
+}
+
+func (t *EngagementTotals) add(other EngagementTotals) {
+	t.Visits += other.Visits
+	t.Views += other.Views
+	t.Likes += other.Likes
+	t.Favorites += other.Favorites
+	t.Reposts += other.Reposts
+}
+
+// oldestEvent returns when the first visit or interaction happened
+func (s *RollupService) oldestEvent() (time.Time, error) {
+	var oldest time.Time
+	for _, model := range []interface{}{&models.GeofenceVisit{}, &models.ContentInteraction{}} {
+		var first struct{ CreatedAt time.Time }
+		err := database.DB.Unscoped().Model(model).Select("created_at").Order("created_at").Limit(1).Scan(&first).Error
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !first.CreatedAt.IsZero() && (oldest.IsZero() || first.CreatedAt.Before(oldest)) {
+			oldest = first.CreatedAt
+		}
+	}
+	return oldest, nil
+}
@@ -0,0 +1,263 @@
+// internal/services/route_intersection_service.go
+package services
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+)
+
+const (
+	// MaxRoutePoints caps the vertices of a route checked against fences
+	MaxRoutePoints = 10000
+
+	// MaxRouteCandidates caps the fences near a route that are checked
+	// against it
+	MaxRouteCandidates = 2000
+
+	// Crossing events
+	RouteEventEnter = "enter"
+	RouteEventExit  = "exit"
+
+	// routeMergeTolerance (metres) joins stretches inside a fence that touch
+	// where route or corridor segments meet
+	routeMergeTolerance = 0.01
+)
+
+var (
+	ErrInvalidRoute           = errors.New("a route needs 2 to 10000 valid points")
+	ErrTooManyRouteCandidates = errors.New("the route passes more than 2000 geofences; split it into shorter routes")
+)
+
+// RouteIntersectionService works out which geofences a route passes through
+type RouteIntersectionService struct{}
+
+// RouteCrossing is a route entering or leaving a fence. Distance is how far
+// along the route (metres) it happens.
+type RouteCrossing struct {
+	Event      string  `json:"event"`
+	GeofenceID uint    `json:"geofence_id"`
+	Name       string  `json:"name"`
+	Distance   float64 `json:"distance"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+}
+
+// RouteIntersection is a route's length (metres) and its crossings in the
+// order they happen. A route starting inside a fence enters it at distance
+// 0; one ending inside a fence never exits it.
+type RouteIntersection struct {
+	Length float64         `json:"length"`
+	Events []RouteCrossing `json:"events"`
+}
+
+// routeStretch is a part of the route inside a fence
+type routeStretch struct {
+	start, end           float64
+	startPoint, endPoint models.GeoPoint
+}
+
+// Intersect returns the crossings of the route with the fences the viewer
+// can see that are active at the given time
+func (s *RouteIntersectionService) Intersect(route models.Polyline, viewerID uint, at time.Time) (*RouteIntersection, error) {
+	if len(route) < 2 || len(route) > MaxRoutePoints {
+		return nil, ErrInvalidRoute
+	}
+	for _, point := range route {
+		if !isValidLatitude(point.Latitude) || !isValidLongitude(point.Longitude) {
+			return nil, ErrInvalidRoute
+		}
+	}
+
+	var candidates []models.Geofence
+	err := database.DB.Preload("Schedule").
+		Scopes(VisibleGeofences(viewerID), regionPrefilter(routeBounds(route))).
+		Order("geofences.id").
+		Limit(MaxRouteCandidates + 1).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) > MaxRouteCandidates {
+		return nil, ErrTooManyRouteCandidates
+	}
+
+	// Distance along the route at each vertex
+	validator := &GeofenceValidationService{}
+	along := make([]float64, len(route))
+	for i := 1; i < len(route); i++ {
+		along[i] = along[i-1] + validator.CalculateDistance(route[i-1].Latitude, route[i-1].Longitude, route[i].Latitude, route[i].Longitude)*1000
+	}
+	length := along[len(along)-1]
+
+	result := &RouteIntersection{Length: length, Events: []RouteCrossing{}}
+	for _, fence := range ActiveGeofences(candidates, at) {
+		for _, stretch := range routeStretches(route, along, fence) {
+			result.Events = append(result.Events, RouteCrossing{
+				Event:      RouteEventEnter,
+				GeofenceID: fence.ID,
+				Name:       fence.Name,
+				Distance:   stretch.start,
+				Latitude:   stretch.startPoint.Latitude,
+				Longitude:  stretch.startPoint.Longitude,
+			})
+			if stretch.end < length-routeMergeTolerance {
+				result.Events = append(result.Events, RouteCrossing{
+					Event:      RouteEventExit,
+					GeofenceID: fence.ID,
+					Name:       fence.Name,
+					Distance:   stretch.end,
+					Latitude:   stretch.endPoint.Latitude,
+					Longitude:  stretch.endPoint.Longitude,
+				})
+			}
+		}
+	}
+
+	// Exits before entries at the same spot, so handovers read in order
+	sort.SliceStable(result.Events, func(i, j int) bool {
+		a, b := result.Events[i], result.Events[j]
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		if a.Event != b.Event {
+			return a.Event == RouteEventExit
+		}
+		return a.GeofenceID < b.GeofenceID
+	})
+	return result, nil
+}
+
+// routeBounds returns the box around a route. Each leg goes the short way
+// round, so a route over the antimeridian gets a box that crosses it rather
+// than one spanning the globe.
+func routeBounds(route models.Polyline) Region {
+	bounds := Region{MinLat: route[0].Latitude, MinLng: route[0].Longitude, MaxLat: route[0].Latitude, MaxLng: route[0].Longitude}
+	lng := route[0].Longitude
+	for _, point := range route[1:] {
+		// Longitudes are followed without wrapping, then wrapped at the end
+		lng += math.Remainder(point.Longitude-lng, 360)
+		bounds.MinLat, bounds.MaxLat = math.Min(bounds.MinLat, point.Latitude), math.Max(bounds.MaxLat, point.Latitude)
+		bounds.MinLng, bounds.MaxLng = math.Min(bounds.MinLng, lng), math.Max(bounds.MaxLng, lng)
+	}
+
+	if bounds.MaxLng-bounds.MinLng >= 360 {
+		bounds.MinLng, bounds.MaxLng = -180, 180
+	} else {
+		bounds.MinLng, bounds.MaxLng = wrapLng(bounds.MinLng), wrapLng(bounds.MaxLng)
+	}
+	return bounds
+}
+
+// routeStretches returns the parts of the route inside a fence, in order.
+// Fences are treated as capsules (a segment grown by a radius; a circle is
+// a capsule of zero length) in a flat projection around the fence's centre.
+func routeStretches(route models.Polyline, along []float64, fence models.Geofence) []routeStretch {
+	project := func(point models.GeoPoint) [2]float64 {
+		dLng := math.Remainder(point.Longitude-fence.Longitude, 360)
+		return [2]float64{dLng * metersPerDegree * math.Cos(toRadians(fence.Latitude)), (point.Latitude - fence.Latitude) * metersPerDegree}
+	}
+
+	type capsule struct {
+		a, b   [2]float64
+		radius float64
+	}
+	var capsules []capsule
+	if fence.Type == models.GeofenceTypeCorridor {
+		for i := 1; i < len(fence.Path); i++ {
+			capsules = append(capsules, capsule{project(fence.Path[i-1]), project(fence.Path[i]), fence.BufferWidth})
+		}
+	} else {
+		capsules = append(capsules, capsule{radius: fence.Radius})
+	}
+
+	var stretches []routeStretch
+	for i := 1; i < len(route); i++ {
+		p, q := project(route[i-1]), project(route[i])
+		for _, c := range capsules {
+			// Skip capsules whose box is out of the segment's reach
+			if math.Min(p[0], q[0]) > math.Max(c.a[0], c.b[0])+c.radius || math.Max(p[0], q[0]) < math.Min(c.a[0], c.b[0])-c.radius ||
+				math.Min(p[1], q[1]) > math.Max(c.a[1], c.b[1])+c.radius || math.Max(p[1], q[1]) < math.Min(c.a[1], c.b[1])-c.radius {
+				continue
+			}
+			t0, t1, ok := segmentInCapsule(p, q, c.a, c.b, c.radius)
+			if !ok {
+				continue
+			}
+			segmentLength := along[i] - along[i-1]
+			stretches = append(stretches, routeStretch{
+				start:      along[i-1] + t0*segmentLength,
+				end:        along[i-1] + t1*segmentLength,
+				startPoint: interpolate(route[i-1], route[i], t0),
+				endPoint:   interpolate(route[i-1], route[i], t1),
+			})
+		}
+	}
+
+	sort.Slice(stretches, func(i, j int) bool { return stretches[i].start < stretches[j].start })
+	var merged []routeStretch
+	for _, stretch := range stretches {
+		if last := len(merged) - 1; last >= 0 && stretch.start <= merged[last].end+routeMergeTolerance {
+			if stretch.end > merged[last].end {
+				merged[last].end, merged[last].endPoint = stretch.end, stretch.endPoint
+			}
+			continue
+		}
+		merged = append(merged, stretch)
+	}
+	return merged
+}
+
+// segmentInCapsule returns the part [t0, t1] of the segment p-q within
+// radius of the segment a-b. The distance to a convex shape is convex along
+// a line, so the part is found by a ternary search for the closest point
+// and bisection either side of it.
+func segmentInCapsule(p, q, a, b [2]float64, radius float64) (float64, float64, bool) {
+	distance := func(t float64) float64 {
+		x, y := p[0]+(q[0]-p[0])*t, p[1]+(q[1]-p[1])*t
+		return pointSegmentDistance(x, y, a, b)
+	}
+
+	lo, hi := 0.0, 1.0
+	for i := 0; i < 100; i++ {
+		m1, m2 := lo+(hi-lo)/3, hi-(hi-lo)/3
+		if distance(m1) < distance(m2) {
+			hi = m2
+		} else {
+			lo = m1
+		}
+	}
+	closest := (lo + hi) / 2
+	if distance(closest) > radius {
+		return 0, 0, false
+	}
+
+	edge := func(outside, inside float64) float64 {
+		if distance(outside) <= radius {
+			return outside
+		}
+		for i := 0; i < 60; i++ {
+			mid := (outside + inside) / 2
+			if distance(mid) <= radius {
+				inside = mid
+			} else {
+				outside = mid
+			}
+		}
+		return inside
+	}
+	return edge(0, closest), edge(1, closest), true
+}
+
+// interpolate returns the point a fraction t of the way from a to b, going
+// the short way round
+func interpolate(a, b models.GeoPoint, t float64) models.GeoPoint {
+	return models.GeoPoint{
+		Latitude:  a.Latitude + (b.Latitude-a.Latitude)*t,
+		Longitude: wrapLng(a.Longitude + math.Remainder(b.Longitude-a.Longitude, 360)*t),
+	}
+}
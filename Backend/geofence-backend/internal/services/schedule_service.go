@@ -0,0 +1,144 @@
+// internal/services/schedule_service.go
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+)
+
+const minutesPerDay = 24 * 60
+
+var (
+	ErrInvalidTimezone    = errors.New("unknown time zone")
+	ErrInvalidSchedule    = errors.New("schedule windows need a weekday from 0 (Sunday) to 6 and start and end times as HH:MM")
+	ErrInvalidActiveRange = errors.New("active_until must be after active_from")
+	ErrGeofenceInactive   = errors.New("geofence is not active")
+)
+
+// ScheduleService decides when time-scheduled geofences are active
+type ScheduleService struct{}
+
+// ValidateSchedule checks a fence's active dates, time zone and weekly
+// windows
+func ValidateSchedule(fence *models.Geofence) error {
+	if fence.ActiveFrom != nil && fence.ActiveUntil != nil && !fence.ActiveUntil.After(*fence.ActiveFrom) {
+		return ErrInvalidActiveRange
+	}
+	if _, err := time.LoadLocation(fence.Timezone); err != nil {
+		return ErrInvalidTimezone
+	}
+	for _, window := range fence.Schedule {
+		if window.Weekday < 0 || window.Weekday > 6 {
+			return ErrInvalidSchedule
+		}
+		if _, ok := parseClock(window.Start, false); !ok {
+			return ErrInvalidSchedule
+		}
+		if _, ok := parseClock(window.End, true); !ok {
+			return ErrInvalidSchedule
+		}
+	}
+	return nil
+}
+
+// IsActive loads the fence's weekly windows and reports whether it is
+// active at the given time
+func (s *ScheduleService) IsActive(fence *models.Geofence, at time.Time) (bool, error) {
+	if err := database.DB.Where("geofence_id = ?", fence.ID).Order("id").Find(&fence.Schedule).Error; err != nil {
+		return false, err
+	}
+	return GeofenceActiveAt(*fence, at), nil
+}
+
+// GeofenceActiveAt reports whether a fence, with its Schedule loaded, is
+// active at the given time. Fences without a schedule are always active
+// unless disabled.
+func GeofenceActiveAt(fence models.Geofence, at time.Time) bool {
+	if fence.Disabled {
+		return false
+	}
+	if fence.ActiveFrom != nil && at.Before(*fence.ActiveFrom) {
+		return false
+	}
+	if fence.ActiveUntil != nil && !at.Before(*fence.ActiveUntil) {
+		return false
+	}
+	if len(fence.Schedule) == 0 {
+		return true
+	}
+
+	location, err := time.LoadLocation(fence.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	local := at.In(location)
+	weekday := int(local.Weekday())
+	minute := local.Hour()*60 + local.Minute()
+
+	for _, window := range fence.Schedule {
+		start, ok := parseClock(window.Start, false)
+		if !ok {
+			continue
+		}
+		end, ok := parseClock(window.End, true)
+		if !ok {
+			continue
+		}
+
+		if end > start {
+			if window.Weekday == weekday && minute >= start && minute < end {
+				return true
+			}
+			continue
+		}
+
+		// Overnight: the rest of the window's day and the start of the next
+		if window.Weekday == weekday && minute >= start {
+			return true
+		}
+		if (window.Weekday+1)%7 == weekday && minute < end {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveGeofences keeps the fences, with their Schedule loaded, that are
+// active at the given time
+func ActiveGeofences(fences []models.Geofence, at time.Time) []models.Geofence {
+	active := []models.Geofence{}
+	for _, fence := range fences {
+		if GeofenceActiveAt(fence, at) {
+			active = append(active, fence)
+		}
+	}
+	return active
+}
+
+// parseClock turns "HH:MM" into minutes past midnight. "24:00" is only
+// accepted as an end time.
+func parseClock(value string, end bool) (int, bool) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+		return 0, false
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, false
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 || hour < 0 {
+		return 0, false
+	}
+
+	total := hour*60 + minute
+	if total < minutesPerDay || (end && total == minutesPerDay) {
+		return total, true
+	}
+	return 0, false
+}
@@ -0,0 +1,26 @@
+// internal/services/scheduler.go
+package services
+
+import (
+	"log"
+	"time"
+)
+
+// RunPeriodically runs job every interval until stop is closed. The first run
+// happens immediately. Errors are logged and don't stop the schedule.
+func RunPeriodically(name string, interval time.Duration, stop <-chan struct{}, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(); err != nil {
+			log.Printf("Scheduled job %s failed: %v", name, err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
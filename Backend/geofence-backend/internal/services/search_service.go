@@ -0,0 +1,517 @@
+// internal/services/search_service.go
+package services
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SearchTypeGeofences = "geofences"
+	SearchTypeContents  = "contents"
+
+	// maxGeoSearchCandidates caps how many text matches are distance-checked
+	// when a search is combined with a geographic filter
+	maxGeoSearchCandidates = 1000
+
+	// Highlight markers are control characters in SQL so the surrounding
+	// text can be HTML-escaped before they're turned into <mark> tags
+	highlightOpen  = "\x02"
+	highlightClose = "\x03"
+)
+
+// SearchService runs ranked full-text search over geofences and content
+type SearchService struct{}
+
+// GeoFilter restricts search results to a circle around a point
+type GeoFilter struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+}
+
+// SearchOptions describes a unified search request
+type SearchOptions struct {
+	Text     string
+	Types    []string
+	Near     *GeoFilter
+	ViewerID uint
+	Limit    int
+	Offset   int
+}
+
+// SearchResult is a single ranked hit. Highlight and Snippet are HTML-escaped
+// with matched terms wrapped in <mark>.
+type SearchResult struct {
+	Type       string           `json:"type"`
+	ID         uint             `json:"id"`
+	Highlight  string           `json:"highlight"`
+	Snippet    string           `json:"snippet"`
+	Score      float64          `json:"score"`
+	DistanceKm *float64         `json:"distance_km,omitempty"`
+	Geofence   *models.Geofence `json:"geofence,omitempty"`
+	Content    *models.Content  `json:"content,omitempty"`
+}
+
+// geofenceHit and contentHit are the raw rows scanned from the search queries
+type geofenceHit struct {
+	models.Geofence
+	Highlight string
+	Snippet   string
+	Rank      float64
+}
+
+type contentHit struct {
+	models.Content
+	Highlight      string
+	Snippet        string
+	Rank           float64
+	FenceLatitude  float64
+	FenceLongitude float64
+}
+
+// Search returns hits for every requested type merged into one ranked list,
+// plus the total number of hits
+func (s *SearchService) Search(opts SearchOptions) ([]SearchResult, int64, error) {
+	if len(opts.Types) == 0 {
+		opts.Types = []string{SearchTypeGeofences, SearchTypeContents}
+	}
+
+	// Each type contributes at most the hits needed to fill the requested page
+	fetch := opts.Offset + opts.Limit
+	if opts.Near != nil {
+		fetch = maxGeoSearchCandidates
+	}
+
+	var results []SearchResult
+	var total int64
+
+	for _, searchType := range opts.Types {
+		var hits []SearchResult
+		var count int64
+		var err error
+
+		switch searchType {
+		case SearchTypeGeofences:
+			hits, count, err = s.searchGeofences(opts, fetch)
+		case SearchTypeContents:
+			hits, count, err = s.searchContents(opts, fetch)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		results = append(results, hits...)
+		total += count
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if opts.Near != nil {
+		total = int64(len(results))
+	}
+
+	if opts.Offset >= len(results) {
+		return []SearchResult{}, total, nil
+	}
+	end := opts.Offset + opts.Limit
+	if end > len(results) {
+		end = len(results)
+	}
+
+	return results[opts.Offset:end], total, nil
+}
+
+func (s *SearchService) searchGeofences(opts SearchOptions, fetch int) ([]SearchResult, int64, error) {
+	query := database.DB.Model(&models.Geofence{}).
+		Scopes(MatchGeofences(opts.Text), VisibleGeofences(opts.ViewerID))
+
+	if opts.Near != nil {
+		query = query.Scopes(WithinBoundingBox("geofences", *opts.Near))
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var hits []geofenceHit
+	err := query.Select("geofences.*, " + geofenceHighlightColumns()).
+		Limit(fetch).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	terms := searchTerms(opts.Text)
+	results := make([]SearchResult, 0, len(hits))
+	for i := range hits {
+		hit := hits[i]
+		result := SearchResult{
+			Type:      "geofence",
+			ID:        hit.ID,
+			Highlight: renderHighlight(hit.Highlight, hit.Name, terms),
+			Snippet:   renderSnippet(hit.Snippet, hit.Description, terms),
+			Score:     -hit.Rank,
+			Geofence:  &hits[i].Geofence,
+		}
+
+		if opts.Near != nil {
+			distance := (&GeofenceValidationService{}).CalculateDistance(opts.Near.Latitude, opts.Near.Longitude, hit.Latitude, hit.Longitude)
+			if distance > opts.Near.RadiusKm {
+				continue
+			}
+			result.DistanceKm = &distance
+		}
+
+		results = append(results, result)
+	}
+
+	return results, total, nil
+}
+
+func (s *SearchService) searchContents(opts SearchOptions, fetch int) ([]SearchResult, int64, error) {
+	query := database.DB.Model(&models.Content{}).
+		Joins("JOIN geofences ON geofences.id = contents.geofence_id AND geofences.deleted_at IS NULL").
+		Scopes(MatchContents(opts.Text), VisibleContents(opts.ViewerID))
+
+	if opts.Near != nil {
+		query = query.Scopes(WithinBoundingBox("geofences", *opts.Near))
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var hits []contentHit
+	err := query.Select("contents.*, geofences.latitude AS fence_latitude, geofences.longitude AS fence_longitude, " + contentHighlightColumns()).
+		Limit(fetch).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	terms := searchTerms(opts.Text)
+	results := make([]SearchResult, 0, len(hits))
+	for i := range hits {
+		hit := hits[i]
+		result := SearchResult{
+			Type:      "content",
+			ID:        hit.ID,
+			Highlight: renderHighlight(hit.Highlight, hit.Title, terms),
+			Snippet:   renderSnippet(hit.Snippet, hit.Description, terms),
+			Score:     -hit.Rank,
+			Content:   &hits[i].Content,
+		}
+
+		if opts.Near != nil {
+			distance := (&GeofenceValidationService{}).CalculateDistance(opts.Near.Latitude, opts.Near.Longitude, hit.FenceLatitude, hit.FenceLongitude)
+			if distance > opts.Near.RadiusKm {
+				continue
+			}
+			result.DistanceKm = &distance
+		}
+
+		results = append(results, result)
+	}
+
+	return results, total, nil
+}
+
+// MatchGeofences is a query scope keeping geofences whose name or description
+// matches text, best matches first
+func MatchGeofences(text string) func(*gorm.DB) *gorm.DB {
+	return matchScope(text, "geofences", "geofences_fts", "name", "description")
+}
+
+// MatchContents is a query scope keeping content whose title or description
+// matches text, best matches first
+func MatchContents(text string) func(*gorm.DB) *gorm.DB {
+	return matchScope(text, "contents", "contents_fts", "title", "description")
+}
+
+func matchScope(text, table, ftsTable, titleColumn, bodyColumn string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !database.FullTextSearchEnabled {
+			terms := searchTerms(text)
+			if len(terms) == 0 {
+				return db.Where("1 = 0")
+			}
+			// LIKE ignores case on SQLite but not on Postgres
+			like := " LIKE ?"
+			if database.IsPostgres(db) {
+				like = " ILIKE ?"
+			}
+			for _, term := range terms {
+				pattern := "%" + term + "%"
+				db = db.Where(table+"."+titleColumn+like+" OR "+table+"."+bodyColumn+like, pattern, pattern)
+			}
+			return db
+		}
+
+		match := BuildMatchQuery(text)
+		if match == "" {
+			return db.Where("1 = 0")
+		}
+
+		// The title column carries ten times the weight of the description
+		return db.Joins("JOIN "+ftsTable+" ON "+ftsTable+".rowid = "+table+".id").
+			Where(ftsTable+" MATCH ?", match).
+			Order("bm25(" + ftsTable + ", 10.0, 1.0)")
+	}
+}
+
+func geofenceHighlightColumns() string {
+	return highlightColumns("geofences_fts")
+}
+
+func contentHighlightColumns() string {
+	return highlightColumns("contents_fts")
+}
+
+// highlightColumns selects the highlighted title, a description snippet and
+// the bm25 rank. Without FTS the rank is 0 and highlighting happens in Go.
+func highlightColumns(ftsTable string) string {
+	if !database.FullTextSearchEnabled {
+		return "'' AS highlight, '' AS snippet, 0 AS rank"
+	}
+	return "highlight(" + ftsTable + ", 0, '" + highlightOpen + "', '" + highlightClose + "') AS highlight, " +
+		"snippet(" + ftsTable + ", 1, '" + highlightOpen + "', '" + highlightClose + "', '…', 16) AS snippet, " +
+		"bm25(" + ftsTable + ", 10.0, 1.0) AS rank"
+}
+
+// BuildMatchQuery turns free text into an FTS5 MATCH expression. Words are
+// ANDed together, "quoted phrases" stay phrases, a trailing * makes a prefix
+// query and OR between two terms is kept. Everything else FTS5 would read as
+// syntax is quoted away, so any input produces a valid expression.
+func BuildMatchQuery(input string) string {
+	var terms []string
+	pendingOr := false
+
+	for _, token := range tokenizeSearch(input) {
+		if !token.phrase && token.text == "OR" {
+			pendingOr = len(terms) > 0
+			continue
+		}
+
+		words := strings.FieldsFunc(token.text, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(words) == 0 {
+			continue
+		}
+
+		term := `"` + strings.Join(words, " ") + `"`
+		if token.prefix {
+			term += "*"
+		}
+
+		if pendingOr {
+			// FTS5 binds AND tighter than OR, so OR groups are parenthesized
+			terms[len(terms)-1] = "(" + terms[len(terms)-1] + " OR " + term + ")"
+			pendingOr = false
+		} else {
+			terms = append(terms, term)
+		}
+	}
+
+	return strings.Join(terms, " AND ")
+}
+
+type searchToken struct {
+	text   string
+	phrase bool
+	prefix bool
+}
+
+// tokenizeSearch splits input into words and double-quoted phrases
+func tokenizeSearch(input string) []searchToken {
+	var tokens []searchToken
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		switch {
+		case unicode.IsSpace(runes[i]):
+			i++
+		case runes[i] == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			token := searchToken{text: string(runes[i+1 : min(end, len(runes))]), phrase: true}
+			i = end + 1
+			if i < len(runes) && runes[i] == '*' {
+				token.prefix = true
+				i++
+			}
+			tokens = append(tokens, token)
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+				end++
+			}
+			word := string(runes[i:end])
+			tokens = append(tokens, searchToken{
+				text:   strings.TrimRight(word, "*"),
+				prefix: strings.HasSuffix(word, "*"),
+			})
+			i = end
+		}
+	}
+
+	return tokens
+}
+
+// searchTerms returns the plain words of a query, used for the LIKE fallback
+func searchTerms(input string) []string {
+	var terms []string
+	for _, token := range tokenizeSearch(input) {
+		if !token.phrase && token.text == "OR" {
+			continue
+		}
+		if text := strings.TrimSpace(token.text); text != "" {
+			terms = append(terms, text)
+		}
+	}
+	return terms
+}
+
+// renderHighlight HTML-escapes an FTS highlight and turns its markers into
+// <mark> tags, or highlights terms in the plain text when FTS is off
+func renderHighlight(marked, plain string, terms []string) string {
+	if marked == "" {
+		marked = markTerms(plain, terms)
+	}
+	return renderMarks(marked)
+}
+
+// renderSnippet is renderHighlight for a short excerpt around the first match
+func renderSnippet(marked, plain string, terms []string) string {
+	if marked == "" {
+		marked = excerpt(markTerms(plain, terms), 120)
+	}
+	return renderMarks(marked)
+}
+
+func renderMarks(marked string) string {
+	escaped := html.EscapeString(marked)
+	escaped = strings.ReplaceAll(escaped, highlightOpen, "<mark>")
+	return strings.ReplaceAll(escaped, highlightClose, "</mark>")
+}
+
+// markTerms wraps case-insensitive occurrences of terms in highlight markers
+func markTerms(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// Lowercasing changed byte offsets; leave the text unmarked
+		return text
+	}
+
+	marked := make([]bool, len(text))
+	for _, term := range terms {
+		term = strings.ToLower(term)
+		if term == "" {
+			continue
+		}
+		for start := 0; ; {
+			idx := strings.Index(lower[start:], term)
+			if idx < 0 {
+				break
+			}
+			for k := start + idx; k < start+idx+len(term) && k < len(marked); k++ {
+				marked[k] = true
+			}
+			start += idx + len(term)
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			b.WriteString(highlightOpen)
+		}
+		b.WriteByte(text[i])
+		if marked[i] && (i == len(text)-1 || !marked[i+1]) {
+			b.WriteString(highlightClose)
+		}
+	}
+	return b.String()
+}
+
+// excerpt trims text to about size bytes around the first highlight
+func excerpt(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+
+	start := strings.Index(text, highlightOpen) - size/4
+	if start < 0 {
+		start = 0
+	}
+	end := int(math.Min(float64(start+size), float64(len(text))))
+
+	// Don't cut through a multi-byte character
+	for start > 0 && !isRuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !isRuneStart(text[end]) {
+		end++
+	}
+
+	result := text[start:end]
+	if start > 0 {
+		result = "…" + result
+	}
+	if end < len(text) {
+		result += "…"
+	}
+	return result
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// WithinBoundingBox is a query scope keeping rows of table whose latitude and
+// longitude fall inside the box around filter, which may cross the
+// antimeridian; callers refine by exact distance. On Postgres table's PostGIS
+// location is matched with ST_DWithin instead.
+func WithinBoundingBox(table string, filter GeoFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if database.IsPostgres(db) {
+			return db.Where("ST_DWithin("+table+".location, ST_MakePoint(?, ?)::geography, ?)",
+				filter.Longitude, filter.Latitude, filter.RadiusKm*1000)
+		}
+		return db.Scopes(coordinatesIn(table, RegionAround(filter)))
+	}
+}
+
+// GeofencesWithin keeps the fences found with WithinBoundingBox whose centre
+// is within filter's radius. PostGIS has already matched them exactly.
+func GeofencesWithin(geofences []models.Geofence, filter GeoFilter) []models.Geofence {
+	if database.IsPostgres(database.DB) {
+		return geofences
+	}
+
+	validator := &GeofenceValidationService{}
+	within := make([]models.Geofence, 0, len(geofences))
+	for _, geofence := range geofences {
+		if validator.CalculateDistance(filter.Latitude, filter.Longitude, geofence.Latitude, geofence.Longitude) <= filter.RadiusKm {
+			within = append(within, geofence)
+		}
+	}
+	return within
+}
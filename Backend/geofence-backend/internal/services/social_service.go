@@ -0,0 +1,216 @@
+// internal/services/social_service.go
+package services
+
+import (
+	"errors"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrSelfRelation       = errors.New("cannot follow, block or mute yourself")
+	ErrBlocked            = errors.New("interaction blocked")
+	ErrInvalidRestriction = errors.New("invalid restriction kind")
+)
+
+// SocialService manages the follow graph and block/mute restrictions
+type SocialService struct{}
+
+// Follow makes followerID follow followingID. Following twice is a no-op.
+func (s *SocialService) Follow(followerID, followingID uint) error {
+	if followerID == followingID {
+		return ErrSelfRelation
+	}
+
+	if err := requireUser(followingID); err != nil {
+		return err
+	}
+
+	// Neither side of a block can follow the other
+	if s.IsBlockedEitherWay(followerID, followingID) {
+		return ErrBlocked
+	}
+
+	follow := models.Follow{FollowerID: followerID, FollowingID: followingID}
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow).Error
+}
+
+// Unfollow removes the follow edge if it exists
+func (s *SocialService) Unfollow(followerID, followingID uint) error {
+	if err := requireUser(followingID); err != nil {
+		return err
+	}
+
+	return database.DB.Where("follower_id = ? AND following_id = ?", followerID, followingID).
+		Delete(&models.Follow{}).Error
+}
+
+// IsFollowing reports whether followerID follows followingID
+func (s *SocialService) IsFollowing(followerID, followingID uint) bool {
+	var count int64
+	database.DB.Model(&models.Follow{}).
+		Where("follower_id = ? AND following_id = ?", followerID, followingID).
+		Count(&count)
+	return count > 0
+}
+
+// CountFollows returns how many users follow userID and how many userID follows
+func (s *SocialService) CountFollows(userID uint) (followers int64, following int64, err error) {
+	if err = database.DB.Model(&models.Follow{}).Where("following_id = ?", userID).Count(&followers).Error; err != nil {
+		return 0, 0, err
+	}
+	if err = database.DB.Model(&models.Follow{}).Where("follower_id = ?", userID).Count(&following).Error; err != nil {
+		return 0, 0, err
+	}
+	return followers, following, nil
+}
+
+// ListFollowers returns the users following userID, newest first
+func (s *SocialService) ListFollowers(userID uint, limit, offset int) ([]models.User, int64, error) {
+	return listFollowEdge(userID, "follows.following_id = ?", "follows.follower_id", limit, offset)
+}
+
+// ListFollowing returns the users userID follows, newest first
+func (s *SocialService) ListFollowing(userID uint, limit, offset int) ([]models.User, int64, error) {
+	return listFollowEdge(userID, "follows.follower_id = ?", "follows.following_id", limit, offset)
+}
+
+// Restrict blocks or mutes targetID on behalf of userID. Blocking also
+// removes any follow edges between the two users.
+func (s *SocialService) Restrict(userID, targetID uint, kind string) error {
+	if kind != models.RestrictionBlock && kind != models.RestrictionMute {
+		return ErrInvalidRestriction
+	}
+
+	if userID == targetID {
+		return ErrSelfRelation
+	}
+
+	if err := requireUser(targetID); err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		restriction := models.UserRestriction{UserID: userID, TargetID: targetID, Kind: kind}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&restriction).Error; err != nil {
+			return err
+		}
+
+		if kind != models.RestrictionBlock {
+			return nil
+		}
+
+		return tx.Where("(follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?)",
+			userID, targetID, targetID, userID).
+			Delete(&models.Follow{}).Error
+	})
+}
+
+// Unrestrict lifts a block or mute
+func (s *SocialService) Unrestrict(userID, targetID uint, kind string) error {
+	if kind != models.RestrictionBlock && kind != models.RestrictionMute {
+		return ErrInvalidRestriction
+	}
+
+	return database.DB.Where("user_id = ? AND target_id = ? AND kind = ?", userID, targetID, kind).
+		Delete(&models.UserRestriction{}).Error
+}
+
+// ListRestricted returns the users userID has blocked or muted
+func (s *SocialService) ListRestricted(userID uint, kind string) ([]models.User, error) {
+	var users []models.User
+	err := database.DB.
+		Joins("JOIN user_restrictions ON user_restrictions.target_id = users.id").
+		Where("user_restrictions.user_id = ? AND user_restrictions.kind = ?", userID, kind).
+		Order("user_restrictions.created_at DESC").
+		Find(&users).Error
+	return users, err
+}
+
+// IsBlocked reports whether ownerID has blocked viewerID
+func (s *SocialService) IsBlocked(ownerID, viewerID uint) bool {
+	if ownerID == 0 || viewerID == 0 || ownerID == viewerID {
+		return false
+	}
+
+	var count int64
+	database.DB.Model(&models.UserRestriction{}).
+		Where("user_id = ? AND target_id = ? AND kind = ?", ownerID, viewerID, models.RestrictionBlock).
+		Count(&count)
+	return count > 0
+}
+
+// IsBlockedEitherWay reports whether either user has blocked the other
+func (s *SocialService) IsBlockedEitherWay(a, b uint) bool {
+	return s.IsBlocked(a, b) || s.IsBlocked(b, a)
+}
+
+// VisibleGeofences is a query scope that drops geofences owned by users on
+// either side of a block with viewerID, or muted by viewerID. Anonymous
+// viewers (0) see everything.
+func VisibleGeofences(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == 0 {
+			return db
+		}
+		return db.Where("geofences.user_id NOT IN (?)", hiddenOwners(viewerID))
+	}
+}
+
+// VisibleContents is the VisibleGeofences scope for content, keyed on the
+// owner of the content's geofence
+func VisibleContents(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == 0 {
+			return db
+		}
+		return db.Where("contents.geofence_id NOT IN (?)",
+			database.DB.Model(&models.Geofence{}).Select("id").Where("user_id IN (?)", hiddenOwners(viewerID)))
+	}
+}
+
+// hiddenOwners selects the IDs of users whose fences viewerID shouldn't see:
+// everyone viewerID blocked or muted, and everyone who blocked viewerID
+func hiddenOwners(viewerID uint) *gorm.DB {
+	return database.DB.Model(&models.UserRestriction{}).
+		Select("CASE WHEN user_id = ? THEN target_id ELSE user_id END", viewerID).
+		Where("user_id = ? OR (target_id = ? AND kind = ?)", viewerID, viewerID, models.RestrictionBlock)
+}
+
+func listFollowEdge(userID uint, condition, joinColumn string, limit, offset int) ([]models.User, int64, error) {
+	query := database.DB.Model(&models.User{}).
+		Joins("JOIN follows ON "+joinColumn+" = users.id").
+		Where(condition, userID).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	err := query.Select("users.*").
+		Order("follows.created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func requireUser(userID uint) error {
+	var count int64
+	database.DB.Model(&models.User{}).Where("id = ?", userID).Count(&count)
+	if count == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
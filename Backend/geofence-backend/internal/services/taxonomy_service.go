@@ -0,0 +1,335 @@
+// internal/services/taxonomy_service.go
+package services
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxTagsPerItem caps how many tags a single geofence or content can carry
+	MaxTagsPerItem = 20
+
+	maxTagLength = 50
+)
+
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryCycle    = errors.New("a category can't be its own ancestor")
+	ErrCategoryInUse    = errors.New("category has subcategories")
+	ErrTooManyTags      = errors.New("too many tags")
+)
+
+// TaxonomyService manages categories and tags
+type TaxonomyService struct{}
+
+// CategoryTree returns all categories nested under their parents
+func (s *TaxonomyService) CategoryTree() ([]models.Category, error) {
+	var all []models.Category
+	if err := database.DB.Order("name").Find(&all).Error; err != nil {
+		return nil, err
+	}
+
+	children := map[uint][]models.Category{}
+	var roots []models.Category
+	for _, category := range all {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var attach func(nodes []models.Category) []models.Category
+	attach = func(nodes []models.Category) []models.Category {
+		for i := range nodes {
+			nodes[i].Children = attach(children[nodes[i].ID])
+		}
+		return nodes
+	}
+
+	if roots == nil {
+		roots = []models.Category{}
+	}
+	return attach(roots), nil
+}
+
+// SaveCategory creates or updates a category after checking its parent
+func (s *TaxonomyService) SaveCategory(category *models.Category) error {
+	if category.Slug == "" {
+		category.Slug = NormalizeTag(category.Name)
+	}
+
+	if category.ParentID != nil {
+		ancestors, err := s.ancestorIDs(*category.ParentID)
+		if err != nil {
+			return err
+		}
+		for _, id := range append(ancestors, *category.ParentID) {
+			if category.ID != 0 && id == category.ID {
+				return ErrCategoryCycle
+			}
+		}
+	}
+
+	return database.DB.Omit("Children").Save(category).Error
+}
+
+// DeleteCategory removes a leaf category and detaches it from geofences
+func (s *TaxonomyService) DeleteCategory(id uint) error {
+	var count int64
+	database.DB.Model(&models.Category{}).Where("parent_id = ?", id).Count(&count)
+	if count > 0 {
+		return ErrCategoryInUse
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM geofence_categories WHERE category_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Category{}, id).Error
+	})
+}
+
+// DescendantIDs returns id together with the IDs of every category below it
+func (s *TaxonomyService) DescendantIDs(id uint) ([]uint, error) {
+	var all []models.Category
+	if err := database.DB.Select("id", "parent_id").Find(&all).Error; err != nil {
+		return nil, err
+	}
+
+	children := map[uint][]uint{}
+	for _, category := range all {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids, nil
+}
+
+// SetGeofenceCategories replaces the categories assigned to a geofence
+func (s *TaxonomyService) SetGeofenceCategories(geofence *models.Geofence, categoryIDs []uint) error {
+	var categories []models.Category
+	if len(categoryIDs) > 0 {
+		if err := database.DB.Where("id IN ?", categoryIDs).Find(&categories).Error; err != nil {
+			return err
+		}
+		if len(categories) != len(uniqueIDs(categoryIDs)) {
+			return ErrCategoryNotFound
+		}
+	}
+
+	return database.DB.Model(geofence).Association("Categories").Replace(categories)
+}
+
+// SetGeofenceTags replaces the tags on a geofence, creating new tags as needed
+func (s *TaxonomyService) SetGeofenceTags(geofence *models.Geofence, names []string) error {
+	tags, err := s.findOrCreateTags(names)
+	if err != nil {
+		return err
+	}
+	return database.DB.Model(geofence).Association("Tags").Replace(tags)
+}
+
+// SetContentTags replaces the tags on a content item, creating new tags as needed
+func (s *TaxonomyService) SetContentTags(content *models.Content, names []string) error {
+	tags, err := s.findOrCreateTags(names)
+	if err != nil {
+		return err
+	}
+	return database.DB.Model(content).Association("Tags").Replace(tags)
+}
+
+// TagSuggestion is an autocomplete entry with how often the tag is used
+type TagSuggestion struct {
+	ID         uint   `json:"id"`
+	Name       string `json:"name"`
+	UsageCount int64  `json:"usage_count"`
+}
+
+// AutocompleteTags returns tags starting with prefix, most used first
+func (s *TaxonomyService) AutocompleteTags(prefix string, limit int) ([]TagSuggestion, error) {
+	prefix = NormalizeTag(prefix)
+
+	suggestions := []TagSuggestion{}
+	err := database.DB.Model(&models.Tag{}).
+		Select(`tags.id, tags.name,
+			(SELECT COUNT(*) FROM geofence_tags WHERE geofence_tags.tag_id = tags.id) +
+			(SELECT COUNT(*) FROM content_tags WHERE content_tags.tag_id = tags.id) AS usage_count`).
+		// substr counts characters, not bytes
+		Where("substr(tags.name, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix).
+		Order("usage_count DESC, tags.name").
+		Limit(limit).
+		Scan(&suggestions).Error
+	return suggestions, err
+}
+
+// FilterByCategories is a query scope on geofences. With matchAll a fence must
+// be in every category (or one of its subcategories); otherwise in any of them.
+func (s *TaxonomyService) FilterByCategories(categoryIDs []uint, matchAll bool) (func(*gorm.DB) *gorm.DB, error) {
+	var groups [][]uint
+	for _, id := range categoryIDs {
+		ids, err := s.DescendantIDs(id)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, ids)
+	}
+
+	if !matchAll && len(groups) > 1 {
+		var any []uint
+		for _, group := range groups {
+			any = append(any, group...)
+		}
+		groups = [][]uint{any}
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		for _, group := range groups {
+			db = db.Where("geofences.id IN (?)",
+				database.DB.Table("geofence_categories").Select("geofence_id").Where("category_id IN ?", group))
+		}
+		return db
+	}, nil
+}
+
+// FilterGeofencesByTags is a query scope on geofences matching all or any of the tags
+func FilterGeofencesByTags(names []string, matchAll bool) func(*gorm.DB) *gorm.DB {
+	return filterByTags("geofences", "geofence_tags", "geofence_id", names, matchAll)
+}
+
+// FilterContentsByTags is a query scope on contents matching all or any of the tags
+func FilterContentsByTags(names []string, matchAll bool) func(*gorm.DB) *gorm.DB {
+	return filterByTags("contents", "content_tags", "content_id", names, matchAll)
+}
+
+func filterByTags(table, joinTable, column string, names []string, matchAll bool) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		var normalized []string
+		for _, name := range names {
+			if name = NormalizeTag(name); name != "" {
+				normalized = append(normalized, name)
+			}
+		}
+		if len(normalized) == 0 {
+			return db
+		}
+
+		groups := [][]string{normalized}
+		if matchAll {
+			groups = nil
+			for _, name := range normalized {
+				groups = append(groups, []string{name})
+			}
+		}
+
+		for _, group := range groups {
+			db = db.Where(table+".id IN (?)",
+				database.DB.Table(joinTable).Select(joinTable+"."+column).
+					Joins("JOIN tags ON tags.id = "+joinTable+".tag_id").
+					Where("tags.name IN ?", group))
+		}
+		return db
+	}
+}
+
+// NormalizeTag lowercases a tag, drops a leading #, turns whitespace into
+// hyphens and strips anything other than letters, digits, - and _
+func NormalizeTag(name string) string {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "#")
+
+	var b strings.Builder
+	lastHyphen := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			b.WriteRune(r)
+			lastHyphen = false
+		case (unicode.IsSpace(r) || r == '-') && b.Len() > 0 && !lastHyphen:
+			b.WriteRune('-')
+			lastHyphen = true
+		}
+	}
+
+	result := strings.TrimRight(b.String(), "-")
+	if runes := []rune(result); len(runes) > maxTagLength {
+		result = strings.TrimRight(string(runes[:maxTagLength]), "-")
+	}
+	return result
+}
+
+func (s *TaxonomyService) findOrCreateTags(names []string) ([]models.Tag, error) {
+	seen := map[string]bool{}
+	var normalized []string
+	for _, name := range names {
+		if name = NormalizeTag(name); name != "" && !seen[name] {
+			seen[name] = true
+			normalized = append(normalized, name)
+		}
+	}
+
+	if len(normalized) > MaxTagsPerItem {
+		return nil, ErrTooManyTags
+	}
+
+	tags := []models.Tag{}
+	if len(normalized) == 0 {
+		return tags, nil
+	}
+
+	for _, name := range normalized {
+		tag := models.Tag{Name: name}
+		if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&tag).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	err := database.DB.Where("name IN ?", normalized).Find(&tags).Error
+	return tags, err
+}
+
+func (s *TaxonomyService) ancestorIDs(id uint) ([]uint, error) {
+	var ids []uint
+	seen := map[uint]bool{}
+	for current := &id; current != nil; {
+		if seen[*current] {
+			return nil, ErrCategoryCycle
+		}
+		seen[*current] = true
+
+		var category models.Category
+		if err := database.DB.Select("id", "parent_id").First(&category, *current).Error; err != nil {
+			return nil, ErrCategoryNotFound
+		}
+		if *current != id {
+			ids = append(ids, *current)
+		}
+		current = category.ParentID
+	}
+	return ids, nil
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := map[uint]bool{}
+	var result []uint
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
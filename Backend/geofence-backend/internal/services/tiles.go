@@ -0,0 +1,148 @@
+// internal/services/tiles.go
+package services
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+const (
+	// TileSize is the width and height of a map tile in pixels
+	TileSize = 256
+
+	// MaxTileZoom is the deepest slippy-map zoom level served
+	MaxTileZoom = 22
+
+	// MaxGeohashPrecision is the longest geohash density cells use
+	MaxGeohashPrecision = 9
+
+	// maxMercatorLat is where the Web Mercator projection is cut off
+	maxMercatorLat = 85.05112878
+)
+
+var ErrInvalidTile = errors.New("invalid tile coordinates")
+
+// Tile is a slippy-map (Web Mercator, XYZ) tile
+type Tile struct {
+	Z int `json:"z"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Valid reports whether the tile exists at its zoom level
+func (t Tile) Valid() bool {
+	n := 1 << uint(t.Z)
+	return t.Z >= 0 && t.Z <= MaxTileZoom && t.X >= 0 && t.X < n && t.Y >= 0 && t.Y < n
+}
+
+// Bounds returns the latitude/longitude box the tile covers
+func (t Tile) Bounds() Region {
+	n := float64(int(1) << uint(t.Z))
+	return Region{
+		MinLng: float64(t.X)/n*360 - 180,
+		MaxLng: float64(t.X+1)/n*360 - 180,
+		MinLat: tileLat(float64(t.Y+1), n),
+		MaxLat: tileLat(float64(t.Y), n),
+	}
+}
+
+// Pixel projects a point into the tile's pixel space. Points outside the
+// tile get coordinates outside 0..TileSize.
+func (t Tile) Pixel(lat, lng float64) (float64, float64) {
+	worldX, worldY := worldPixel(lat, lng, t.Z)
+	return worldX - float64(t.X*TileSize), worldY - float64(t.Y*TileSize)
+}
+
+// TileAt returns the tile containing a point at zoom z
+func TileAt(lat, lng float64, z int) Tile {
+	worldX, worldY := worldPixel(lat, lng, z)
+	n := 1 << uint(z)
+	clamp := func(v int) int {
+		return int(math.Max(0, math.Min(float64(n-1), float64(v))))
+	}
+	return Tile{Z: z, X: clamp(int(worldX) / TileSize), Y: clamp(int(worldY) / TileSize)}
+}
+
+// worldPixel projects a point to Web Mercator pixels at zoom z
+func worldPixel(lat, lng float64, z int) (float64, float64) {
+	lat = math.Max(-maxMercatorLat, math.Min(maxMercatorLat, lat))
+	scale := float64(TileSize) * float64(int(1)<<uint(z))
+	x := (lng + 180) / 360 * scale
+	sin := math.Sin(toRadians(lat))
+	y := (0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi)) * scale
+	return x, y
+}
+
+func tileLat(y, n float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+}
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Geohash encodes a point as a geohash of the given length
+func Geohash(lat, lng float64, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLng, maxLng := -180.0, 180.0
+
+	hash := make([]byte, 0, precision)
+	bits, ch := 0, 0
+	even := true
+	for len(hash) < precision {
+		if even {
+			mid := (minLng + maxLng) / 2
+			if lng >= mid {
+				ch = ch<<1 | 1
+				minLng = mid
+			} else {
+				ch <<= 1
+				maxLng = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if lat >= mid {
+				ch = ch<<1 | 1
+				minLat = mid
+			} else {
+				ch <<= 1
+				maxLat = mid
+			}
+		}
+		even = !even
+
+		if bits++; bits == 5 {
+			hash = append(hash, geohashAlphabet[ch])
+			bits, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// GeohashBounds returns the box a geohash covers
+func GeohashBounds(hash string) Region {
+	region := Region{MinLat: -90, MaxLat: 90, MinLng: -180, MaxLng: 180}
+	even := true
+	for i := 0; i < len(hash); i++ {
+		value := strings.IndexByte(geohashAlphabet, hash[i])
+		for bit := 4; bit >= 0; bit-- {
+			on := value>>uint(bit)&1 == 1
+			if even {
+				mid := (region.MinLng + region.MaxLng) / 2
+				if on {
+					region.MinLng = mid
+				} else {
+					region.MaxLng = mid
+				}
+			} else {
+				mid := (region.MinLat + region.MaxLat) / 2
+				if on {
+					region.MinLat = mid
+				} else {
+					region.MaxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return region
+}
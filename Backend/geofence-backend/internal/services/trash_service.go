@@ -0,0 +1,306 @@
+// internal/services/trash_service.go
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Trash item kinds
+const (
+	TrashGeofence = "geofence"
+	TrashContent  = "content"
+)
+
+var (
+	ErrNotInTrash      = errors.New("item not found in trash")
+	ErrGeofenceInTrash = errors.New("the content's geofence is in the trash; restore it first")
+)
+
+// TrashService keeps deleted geofences and content restorable until they're
+// purged
+type TrashService struct{}
+
+// TrashItem is a deleted geofence or piece of content. Contents counts the
+// content that went to the trash with a geofence and comes back with it.
+type TrashItem struct {
+	Kind       string    `json:"kind"`
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	GeofenceID uint      `json:"geofence_id,omitempty"`
+	Contents   int64     `json:"contents,omitempty"`
+	DeletedAt  time.Time `json:"deleted_at"`
+	PurgeAt    time.Time `json:"purge_at"`
+}
+
+// TrashRetention returns how long deleted items stay in the trash before
+// they're purged, from TRASH_RETENTION_DAYS (default 30 days)
+func TrashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days < 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Trash deletes a geofence together with its content and shares. They're
+// all marked with the same time, which is how a restore tells them apart
+// from content deleted on its own.
+func (s *TrashService) Trash(tx *gorm.DB, fence *models.Geofence) error {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if err := tx.Model(&models.Content{}).Where("geofence_id = ?", fence.ID).Update("deleted_at", now).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.GeofenceShare{}).Where("geofence_id = ?", fence.ID).Update("deleted_at", now).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(fence).Update("deleted_at", now).Error; err != nil {
+		return err
+	}
+	fence.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	return nil
+}
+
+// List returns what a user has in the trash, most recently deleted first:
+// their deleted geofences and the content deleted on its own from their
+// geofences
+func (s *TrashService) List(userID uint) ([]TrashItem, error) {
+	retention := TrashRetention()
+	items := []TrashItem{}
+
+	var fences []models.Geofence
+	if err := database.DB.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID).Find(&fences).Error; err != nil {
+		return nil, err
+	}
+	for _, fence := range fences {
+		item := TrashItem{Kind: TrashGeofence, ID: fence.ID, Name: fence.Name, DeletedAt: fence.DeletedAt.Time, PurgeAt: fence.DeletedAt.Time.Add(retention)}
+		err := database.DB.Unscoped().Model(&models.Content{}).
+			Where("geofence_id = ? AND deleted_at = ?", fence.ID, fence.DeletedAt.Time).
+			Count(&item.Contents).Error
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	var contents []models.Content
+	err := database.DB.Unscoped().
+		Joins("JOIN geofences ON geofences.id = contents.geofence_id").
+		Where("geofences.user_id = ? AND contents.deleted_at IS NOT NULL", userID).
+		Where("geofences.deleted_at IS NULL OR geofences.deleted_at <> contents.deleted_at").
+		Find(&contents).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, content := range contents {
+		items = append(items, TrashItem{
+			Kind:       TrashContent,
+			ID:         content.ID,
+			Name:       content.Title,
+			GeofenceID: content.GeofenceID,
+			DeletedAt:  content.DeletedAt.Time,
+			PurgeAt:    content.DeletedAt.Time.Add(retention),
+		})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+// trashedGeofence loads one of a user's deleted geofences
+func (s *TrashService) trashedGeofence(userID, geofenceID uint) (*models.Geofence, error) {
+	var fence models.Geofence
+	err := database.DB.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID).First(&fence, geofenceID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotInTrash
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fence, nil
+}
+
+// trashedContent loads a deleted piece of content from one of a user's
+// geofences, along with that geofence, which may be deleted too
+func (s *TrashService) trashedContent(userID, contentID uint) (*models.Content, *models.Geofence, error) {
+	var content models.Content
+	err := database.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&content, contentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrNotInTrash
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var fence models.Geofence
+	err = database.DB.Unscoped().Where("user_id = ?", userID).First(&fence, content.GeofenceID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrNotInTrash
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &content, &fence, nil
+}
+
+// RestoreGeofence brings back a deleted geofence with the content and shares
+// that were deleted with it. Children it had were moved up when it was
+// deleted and stay where they are. If its parent is gone or it no longer
+// fits inside it, it comes back at the top level.
+func (s *TrashService) RestoreGeofence(userID, geofenceID uint) (*models.Geofence, error) {
+	fence, err := s.trashedGeofence(userID, geofenceID)
+	if err != nil {
+		return nil, err
+	}
+	deletedAt := fence.DeletedAt.Time
+
+	if fence.ParentID != nil {
+		var parent models.Geofence
+		if err := database.DB.First(&parent, *fence.ParentID).Error; err != nil || !GeofenceWithin(*fence, parent) {
+			fence.ParentID = nil
+		}
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Content{}).Where("geofence_id = ? AND deleted_at = ?", fence.ID, deletedAt).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.GeofenceShare{}).Where("geofence_id = ? AND deleted_at = ?", fence.ID, deletedAt).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(fence).Updates(map[string]interface{}{"deleted_at": nil, "parent_id": fence.ParentID}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	fence.DeletedAt = gorm.DeletedAt{}
+	return fence, nil
+}
+
+// RestoreContent brings back a piece of content deleted on its own. Content
+// of a deleted geofence comes back with the geofence.
+func (s *TrashService) RestoreContent(userID, contentID uint) (*models.Content, error) {
+	content, fence, err := s.trashedContent(userID, contentID)
+	if err != nil {
+		return nil, err
+	}
+	if fence.DeletedAt.Valid {
+		return nil, ErrGeofenceInTrash
+	}
+
+	if err := database.DB.Unscoped().Model(content).Update("deleted_at", nil).Error; err != nil {
+		return nil, err
+	}
+	content.DeletedAt = gorm.DeletedAt{}
+	return content, nil
+}
+
+// PurgeGeofence permanently deletes a geofence from the trash
+func (s *TrashService) PurgeGeofence(userID, geofenceID uint) error {
+	fence, err := s.trashedGeofence(userID, geofenceID)
+	if err != nil {
+		return err
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return purgeGeofences(tx, []uint{fence.ID})
+	})
+}
+
+// PurgeContent permanently deletes a piece of content from the trash
+func (s *TrashService) PurgeContent(userID, contentID uint) error {
+	content, _, err := s.trashedContent(userID, contentID)
+	if err != nil {
+		return err
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return purgeContents(tx, []uint{content.ID})
+	})
+}
+
+// PurgeExpired permanently deletes everything that has been in the trash for
+// longer than the retention period. It's run as a scheduled job.
+func (s *TrashService) PurgeExpired() error {
+	cutoff := time.Now().Add(-TrashRetention())
+
+	var geofenceIDs []uint
+	if err := database.DB.Unscoped().Model(&models.Geofence{}).Where("deleted_at < ?", cutoff).Pluck("id", &geofenceIDs).Error; err != nil {
+		return err
+	}
+
+	var contentIDs []uint
+	if err := database.DB.Unscoped().Model(&models.Content{}).Where("deleted_at < ?", cutoff).Pluck("id", &contentIDs).Error; err != nil {
+		return err
+	}
+	if len(geofenceIDs) == 0 && len(contentIDs) == 0 {
+		return nil
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := purgeGeofences(tx, geofenceIDs); err != nil {
+			return err
+		}
+		return purgeContents(tx, contentIDs)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Purged %d geofences and %d contents from the trash", len(geofenceIDs), len(contentIDs))
+	return nil
+}
+
+// purgeGeofences permanently deletes geofences with their content and
+// everything else attached to them
+func purgeGeofences(tx *gorm.DB, geofenceIDs []uint) error {
+	if len(geofenceIDs) == 0 {
+		return nil
+	}
+
+	var contentIDs []uint
+	if err := tx.Unscoped().Model(&models.Content{}).Where("geofence_id IN ?", geofenceIDs).Pluck("id", &contentIDs).Error; err != nil {
+		return err
+	}
+	if err := purgeContents(tx, contentIDs); err != nil {
+		return err
+	}
+	for _, model := range []interface{}{&models.GeofenceVisit{}, &models.RouteDeviation{}, &models.GeofenceSchedule{}, &models.GeofenceRevision{}, &models.GroupEvent{}} {
+		if err := tx.Where("geofence_id IN ?", geofenceIDs).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Unscoped().Where("geofence_id IN ?", geofenceIDs).Delete(&models.GeofenceShare{}).Error; err != nil {
+		return err
+	}
+	for _, table := range []string{"geofence_group_members", "geofence_categories", "geofence_tags"} {
+		if err := tx.Exec("DELETE FROM "+table+" WHERE geofence_id IN ?", geofenceIDs).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Unscoped().Model(&models.Geofence{}).Where("parent_id IN ?", geofenceIDs).Update("parent_id", nil).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", geofenceIDs).Delete(&models.Geofence{}).Error
+}
+
+// purgeContents permanently deletes content with its interactions and tags
+func purgeContents(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := tx.Unscoped().Where("content_id IN ?", ids).Delete(&models.ContentInteraction{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM content_tags WHERE content_id IN ?", ids).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Content{}).Error
+}
@@ -0,0 +1,300 @@
+// internal/services/trending_service.go
+package services
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TrendingTypeGeofence = models.ItemTypeGeofence
+	TrendingTypeContent  = models.ItemTypeContent
+)
+
+var ErrInvalidWindow = errors.New("invalid trending window")
+
+// trendingWindows are the windows scores are computed for. An event's weight
+// halves every half of the window, so recent engagement dominates.
+var trendingWindows = map[string]time.Duration{
+	models.PopularityWindowDay:   24 * time.Hour,
+	models.PopularityWindowWeek:  7 * 24 * time.Hour,
+	models.PopularityWindowMonth: 30 * 24 * time.Hour,
+}
+
+// trendingWeights is what each kind of engagement is worth before decay
+var trendingWeights = map[string]float64{
+	"visit":                    1,
+	"unique_visitor":           2,
+	models.InteractionView:     0.5,
+	models.InteractionLike:     2,
+	models.InteractionFavorite: 3,
+	models.InteractionRepost:   3,
+}
+
+// TrendingService precomputes and serves popularity scores
+type TrendingService struct{}
+
+// Region is a latitude/longitude box results must fall inside
+type Region struct {
+	MinLat float64
+	MinLng float64
+	MaxLat float64
+	MaxLng float64
+}
+
+// RegionAround returns the box enclosing a circle of radiusKm around a point
+func RegionAround(filter GeoFilter) Region {
+	latRange := filter.RadiusKm / 111.0
+	lngRange := filter.RadiusKm / (111.0 * math.Max(math.Cos(toRadians(filter.Latitude)), 0.01))
+	region := Region{
+		MinLat: filter.Latitude - latRange,
+		MinLng: -180,
+		MaxLat: filter.Latitude + latRange,
+		MaxLng: 180,
+	}
+	// A box reaching past the antimeridian wraps round to the other side
+	if lngRange < 180 {
+		region.MinLng, region.MaxLng = wrapLng(filter.Longitude-lngRange), wrapLng(filter.Longitude+lngRange)
+	}
+	return region
+}
+
+// TrendingItem is a ranked geofence or content item with its engagement
+type TrendingItem struct {
+	models.PopularityScore
+	Geofence *models.Geofence `json:"geofence,omitempty"`
+	Content  *models.Content  `json:"content,omitempty"`
+}
+
+// IsValidWindow reports whether window is one scores are computed for
+func IsValidWindow(window string) bool {
+	_, ok := trendingWindows[window]
+	return ok
+}
+
+// trendingEvent is one visit or interaction attributed to a fence and,
+// for interactions, a content item
+type trendingEvent struct {
+	Kind       string
+	UserID     uint
+	GeofenceID uint
+	ContentID  uint
+	CreatedAt  time.Time
+}
+
+// ComputeScores rebuilds every popularity score from the last 30 days of
+// visits and interactions. It's run periodically.
+func (s *TrendingService) ComputeScores() error {
+	now := time.Now()
+	since := now.Add(-trendingWindows[models.PopularityWindowMonth])
+
+	var events []trendingEvent
+	err := database.DB.Model(&models.GeofenceVisit{}).
+		Select("'visit' AS kind, geofence_visits.user_id, geofence_visits.geofence_id, 0 AS content_id, geofence_visits.created_at").
+		Joins("JOIN geofences ON geofences.id = geofence_visits.geofence_id AND geofences.deleted_at IS NULL").
+		Where("geofence_visits.created_at >= ?", since).
+		Scan(&events).Error
+	if err != nil {
+		return err
+	}
+
+	var interactions []trendingEvent
+	err = database.DB.Model(&models.ContentInteraction{}).
+		Select("content_interactions.interaction_type AS kind, content_interactions.user_id, contents.geofence_id, content_interactions.content_id, content_interactions.created_at").
+		Joins("JOIN contents ON contents.id = content_interactions.content_id AND contents.deleted_at IS NULL").
+		Joins("JOIN geofences ON geofences.id = contents.geofence_id AND geofences.deleted_at IS NULL").
+		Where("content_interactions.created_at >= ?", since).
+		Scan(&interactions).Error
+	if err != nil {
+		return err
+	}
+	events = append(events, interactions...)
+
+	var fences []models.Geofence
+	if err := database.DB.Select("id", "latitude", "longitude").Find(&fences).Error; err != nil {
+		return err
+	}
+	locations := map[uint][2]float64{}
+	for _, fence := range fences {
+		locations[fence.ID] = [2]float64{fence.Latitude, fence.Longitude}
+	}
+
+	var rows []models.PopularityScore
+	for window, length := range trendingWindows {
+		rows = append(rows, scoreWindow(events, window, length, now, locations)...)
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.PopularityScore{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, 500).Error
+	})
+}
+
+// scoreWindow scores every fence and content item with engagement in one window.
+// A fence's score includes the engagement on its content.
+func scoreWindow(events []trendingEvent, window string, length time.Duration, now time.Time, locations map[uint][2]float64) []models.PopularityScore {
+	halfLife := length / 2
+	start := now.Add(-length)
+
+	type key struct {
+		itemType string
+		id       uint
+	}
+	scores := map[key]*models.PopularityScore{}
+	score := func(itemType string, id, geofenceID uint) *models.PopularityScore {
+		k := key{itemType, id}
+		if scores[k] == nil {
+			location := locations[geofenceID]
+			scores[k] = &models.PopularityScore{
+				ItemType:   itemType,
+				ItemID:     id,
+				Window:     window,
+				Latitude:   location[0],
+				Longitude:  location[1],
+				ComputedAt: now,
+			}
+		}
+		return scores[k]
+	}
+
+	// Each visitor's most recent visit to each fence
+	lastVisit := map[uint]map[uint]time.Time{}
+
+	for _, event := range events {
+		if event.CreatedAt.Before(start) {
+			continue
+		}
+		decay := math.Pow(0.5, float64(now.Sub(event.CreatedAt))/float64(halfLife))
+		points := trendingWeights[event.Kind] * decay
+
+		fence := score(TrendingTypeGeofence, event.GeofenceID, event.GeofenceID)
+		fence.Score += points
+
+		if event.Kind == "visit" {
+			fence.Visits++
+			if event.UserID != 0 {
+				if lastVisit[event.GeofenceID] == nil {
+					lastVisit[event.GeofenceID] = map[uint]time.Time{}
+				}
+				if event.CreatedAt.After(lastVisit[event.GeofenceID][event.UserID]) {
+					lastVisit[event.GeofenceID][event.UserID] = event.CreatedAt
+				}
+			}
+			continue
+		}
+
+		content := score(TrendingTypeContent, event.ContentID, event.GeofenceID)
+		content.Score += points
+		for _, item := range []*models.PopularityScore{fence, content} {
+			switch event.Kind {
+			case models.InteractionView:
+				item.Views++
+			case models.InteractionLike:
+				item.Likes++
+			case models.InteractionFavorite:
+				item.Favorites++
+			case models.InteractionRepost:
+				item.Reposts++
+			}
+		}
+	}
+
+	for geofenceID, visitors := range lastVisit {
+		fence := score(TrendingTypeGeofence, geofenceID, geofenceID)
+		for _, at := range visitors {
+			fence.UniqueVisitors++
+			fence.Score += trendingWeights["unique_visitor"] * math.Pow(0.5, float64(now.Sub(at))/float64(halfLife))
+		}
+	}
+
+	rows := make([]models.PopularityScore, 0, len(scores))
+	for _, item := range scores {
+		if item.Score > 0 {
+			rows = append(rows, *item)
+		}
+	}
+	return rows
+}
+
+// Top returns the highest scoring items of itemType in window, optionally
+// inside region, hiding what viewerID shouldn't see, plus the total
+func (s *TrendingService) Top(itemType, window string, region *Region, viewerID uint, limit, offset int) ([]TrendingItem, int64, error) {
+	if !IsValidWindow(window) {
+		return nil, 0, ErrInvalidWindow
+	}
+
+	query := database.DB.Model(&models.PopularityScore{}).
+		Where("popularity_scores.item_type = ? AND popularity_scores.time_window = ?", itemType, window)
+
+	if itemType == TrendingTypeGeofence {
+		query = query.Joins("JOIN geofences ON geofences.id = popularity_scores.item_id AND geofences.deleted_at IS NULL").
+			Scopes(VisibleGeofences(viewerID))
+	} else {
+		query = query.Joins("JOIN contents ON contents.id = popularity_scores.item_id AND contents.deleted_at IS NULL").
+			Scopes(VisibleContents(viewerID))
+	}
+
+	if region != nil {
+		query = query.Scopes(coordinatesIn("popularity_scores", *region))
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var scores []models.PopularityScore
+	err := query.Select("popularity_scores.*").
+		Order("popularity_scores.score DESC, popularity_scores.item_id").
+		Limit(limit).
+		Offset(offset).
+		Find(&scores).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]uint, len(scores))
+	for i, score := range scores {
+		ids[i] = score.ItemID
+	}
+
+	items := make([]TrendingItem, len(scores))
+	if itemType == TrendingTypeGeofence {
+		var geofences []models.Geofence
+		if err := database.DB.Where("id IN ?", ids).Find(&geofences).Error; err != nil {
+			return nil, 0, err
+		}
+		byID := map[uint]*models.Geofence{}
+		for i := range geofences {
+			byID[geofences[i].ID] = &geofences[i]
+		}
+		for i, score := range scores {
+			items[i] = TrendingItem{PopularityScore: score, Geofence: byID[score.ItemID]}
+		}
+	} else {
+		var contents []models.Content
+		if err := database.DB.Where("id IN ?", ids).Find(&contents).Error; err != nil {
+			return nil, 0, err
+		}
+		byID := map[uint]*models.Content{}
+		for i := range contents {
+			byID[contents[i].ID] = &contents[i]
+		}
+		for i, score := range scores {
+			items[i] = TrendingItem{PopularityScore: score, Content: byID[score.ItemID]}
+		}
+	}
+
+	return items, total, nil
+}
@@ -0,0 +1,240 @@
+// internal/services/vector_tile_service.go
+package services
+
+import (
+	"math"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+	"geofence/internal/utils"
+)
+
+const (
+	// TileExtent is the coordinate range of a vector tile
+	TileExtent = 4096
+
+	// tileBuffer is how far (in tile units) geometry is kept past the tile
+	// edge so polygons don't show seams between tiles
+	tileBuffer = 64
+
+	// MaxTileFeatures caps the fences drawn on one vector tile
+	MaxTileFeatures = 10000
+
+	// GeofenceTileLayer is the name of the layer fences are drawn on
+	GeofenceTileLayer = "geofences"
+
+	// metersPerPixelAtEquator is the ground resolution of a zoom 0 tile pixel
+	metersPerPixelAtEquator = 2 * math.Pi * 6378137 / TileSize
+)
+
+// VectorTileService renders geofences as Mapbox Vector Tiles
+type VectorTileService struct{}
+
+// GeofenceTile renders the fences on a tile. Circles are drawn with fewer
+// vertices the further out the zoom, and fences smaller than a pixel become
+// points. Everyone sees a fence's name and radius; its owner and the users
+// it's shared with also get its description, owner and their access level.
+func (s *VectorTileService) GeofenceTile(tile Tile, viewerID uint) ([]byte, error) {
+	if !tile.Valid() {
+		return nil, ErrInvalidTile
+	}
+
+	bounds := tile.Bounds()
+	n := float64(int(1) << uint(tile.Z))
+	margin := float64(tileBuffer) / TileExtent
+	minLat := tileLat(math.Min(float64(tile.Y+1)+margin, n), n)
+	maxLat := tileLat(math.Max(float64(tile.Y)-margin, 0), n)
+	lngMargin := margin / n * 360
+
+	// A fence's longitude span grows towards the poles; using the tile's
+	// highest latitude keeps the filter conservative
+	metersPerLngDegree := 111320 * math.Max(math.Cos(toRadians(math.Max(math.Abs(minLat), math.Abs(maxLat)))), 0.01)
+
+	var fences []models.Geofence
+	err := database.DB.Model(&models.Geofence{}).
+		Select("id", "name", "description", "latitude", "longitude", "radius", "user_id", "type", "path", "buffer_width").
+		Scopes(VisibleGeofences(viewerID)).
+		Where("latitude + radius / 111320.0 >= ? AND latitude - radius / 111320.0 <= ?", minLat, maxLat).
+		Where("longitude + radius / ? >= ? AND longitude - radius / ? <= ?",
+			metersPerLngDegree, bounds.MinLng-lngMargin, metersPerLngDegree, bounds.MaxLng+lngMargin).
+		Order("id").
+		Limit(MaxTileFeatures).
+		Find(&fences).Error
+	if err != nil {
+		return nil, err
+	}
+
+	access := map[uint]string{}
+	if viewerID != 0 && len(fences) > 0 {
+		ids := make([]uint, len(fences))
+		for i, fence := range fences {
+			ids[i] = fence.ID
+		}
+		var shares []models.GeofenceShare
+		if err := database.DB.Where("user_id = ? AND geofence_id IN ?", viewerID, ids).Find(&shares).Error; err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			access[share.GeofenceID] = share.Permission
+		}
+	}
+
+	layer := utils.MVTLayer{Name: GeofenceTileLayer, Extent: TileExtent}
+	for _, fence := range fences {
+		feature, ok := s.fenceFeature(tile, fence)
+		if !ok {
+			continue
+		}
+
+		feature.Properties = map[string]interface{}{
+			"name":   fence.Name,
+			"radius": fence.Radius,
+			"type":   fence.Type,
+		}
+		if fence.Type == models.GeofenceTypeCorridor {
+			feature.Properties["buffer_width"] = fence.BufferWidth
+		}
+		level := access[fence.ID]
+		if viewerID != 0 && fence.UserID == viewerID {
+			level = "owner"
+		}
+		if level != "" {
+			feature.Properties["description"] = fence.Description
+			feature.Properties["user_id"] = fence.UserID
+			feature.Properties["access"] = level
+		}
+		layer.Features = append(layer.Features, feature)
+	}
+
+	return utils.EncodeMVT([]utils.MVTLayer{layer})
+}
+
+// fenceFeature draws a fence in tile coordinates, or reports false if none
+// of it lands on the buffered tile
+func (s *VectorTileService) fenceFeature(tile Tile, fence models.Geofence) (utils.MVTFeature, bool) {
+	if fence.Type == models.GeofenceTypeCorridor {
+		return s.corridorFeature(tile, fence)
+	}
+	feature := utils.MVTFeature{ID: uint64(fence.ID)}
+
+	px, py := tile.Pixel(fence.Latitude, fence.Longitude)
+	scale := float64(TileExtent) / TileSize
+	cx, cy := px*scale, py*scale
+
+	metersPerPixel := metersPerPixelAtEquator * math.Cos(toRadians(fence.Latitude)) / float64(int(1)<<uint(tile.Z))
+	radiusPx := fence.Radius / metersPerPixel
+
+	if radiusPx < 1 {
+		if cx < -tileBuffer || cx > TileExtent+tileBuffer || cy < -tileBuffer || cy > TileExtent+tileBuffer {
+			return feature, false
+		}
+		feature.Type = utils.MVTPoint
+		feature.Geometry = [][][2]int{{{int(math.Round(cx)), int(math.Round(cy))}}}
+		return feature, true
+	}
+
+	// Roughly one vertex every four pixels of circumference
+	segments := int(math.Ceil(2 * math.Pi * radiusPx / 4))
+	segments = int(math.Max(8, math.Min(64, float64(segments))))
+
+	// Mercator is conformal, so a small circle stays a circle on the tile.
+	// Increasing angles run clockwise with y pointing down.
+	ring := make([][2]float64, segments)
+	for i := range ring {
+		angle := 2 * math.Pi * float64(i) / float64(segments)
+		ring[i] = [2]float64{cx + radiusPx*scale*math.Cos(angle), cy + radiusPx*scale*math.Sin(angle)}
+	}
+	ring = clipRing(ring, -tileBuffer, TileExtent+tileBuffer)
+
+	var points [][2]int
+	for _, point := range ring {
+		p := [2]int{int(math.Round(point[0])), int(math.Round(point[1]))}
+		if len(points) == 0 || points[len(points)-1] != p {
+			points = append(points, p)
+		}
+	}
+	if len(points) > 1 && points[0] == points[len(points)-1] {
+		points = points[:len(points)-1]
+	}
+	if len(points) < 3 {
+		return feature, false
+	}
+
+	feature.Type = utils.MVTPolygon
+	feature.Geometry = [][][2]int{points}
+	return feature, true
+}
+
+// corridorFeature draws a corridor as its path; clients style the line with
+// its buffer_width. Lines aren't clipped, as renderers handle coordinates
+// past the tile edge.
+func (s *VectorTileService) corridorFeature(tile Tile, fence models.Geofence) (utils.MVTFeature, bool) {
+	feature := utils.MVTFeature{ID: uint64(fence.ID), Type: utils.MVTLineString}
+
+	scale := float64(TileExtent) / TileSize
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	var line [][2]int
+	for _, point := range fence.Path {
+		px, py := tile.Pixel(point.Latitude, point.Longitude)
+		x, y := px*scale, py*scale
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+
+		p := [2]int{int(math.Round(x)), int(math.Round(y))}
+		if len(line) == 0 || line[len(line)-1] != p {
+			line = append(line, p)
+		}
+	}
+
+	if maxX < -tileBuffer || minX > TileExtent+tileBuffer || maxY < -tileBuffer || minY > TileExtent+tileBuffer {
+		return feature, false
+	}
+	if len(line) < 2 {
+		// Less than a unit long at this zoom
+		if len(line) == 0 {
+			return feature, false
+		}
+		feature.Type = utils.MVTPoint
+	}
+	feature.Geometry = [][][2]int{line}
+	return feature, true
+}
+
+// clipRing clips a polygon ring to the square [lo, hi] on both axes
+// (Sutherland–Hodgman)
+func clipRing(ring [][2]float64, lo, hi float64) [][2]float64 {
+	edges := []struct {
+		inside func(p [2]float64) bool
+		axis   int
+		bound  float64
+	}{
+		{func(p [2]float64) bool { return p[0] >= lo }, 0, lo},
+		{func(p [2]float64) bool { return p[0] <= hi }, 0, hi},
+		{func(p [2]float64) bool { return p[1] >= lo }, 1, lo},
+		{func(p [2]float64) bool { return p[1] <= hi }, 1, hi},
+	}
+
+	for _, edge := range edges {
+		if len(ring) == 0 {
+			break
+		}
+		var clipped [][2]float64
+		prev := ring[len(ring)-1]
+		for _, point := range ring {
+			if edge.inside(point) != edge.inside(prev) {
+				t := (edge.bound - prev[edge.axis]) / (point[edge.axis] - prev[edge.axis])
+				clipped = append(clipped, [2]float64{
+					prev[0] + (point[0]-prev[0])*t,
+					prev[1] + (point[1]-prev[1])*t,
+				})
+			}
+			if edge.inside(point) {
+				clipped = append(clipped, point)
+			}
+			prev = point
+		}
+		ring = clipped
+	}
+	return ring
+}
@@ -0,0 +1,221 @@
+// internal/services/viewport_service.go
+package services
+
+import (
+	"math"
+
+	"geofence/internal/database"
+	"geofence/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// viewportBatchSize is how many prefiltered fences are checked exactly per
+// query while filling a page
+const viewportBatchSize = 200
+
+// ViewportService finds the geofences that show up in a map viewport
+type ViewportService struct{}
+
+// Crosses reports whether the region wraps around the antimeridian, i.e. its
+// west edge is east of its east edge
+func (r Region) Crosses() bool {
+	return r.MinLng > r.MaxLng
+}
+
+// lngSpans splits the region's longitudes into spans that don't wrap
+func (r Region) lngSpans() [][2]float64 {
+	if r.Crosses() {
+		return [][2]float64{{r.MinLng, 180}, {-180, r.MaxLng}}
+	}
+	return [][2]float64{{r.MinLng, r.MaxLng}}
+}
+
+// Geofences returns up to limit fences with IDs after afterID, in ID order,
+// whose area intersects the region, even when their centre lies outside it.
+// scopes narrow the fences considered (visibility, filters). The returned ID
+// is where the next page starts, or 0 when there are no more.
+func (s *ViewportService) Geofences(region Region, afterID uint, limit int, scopes ...func(*gorm.DB) *gorm.DB) ([]models.Geofence, uint, error) {
+	query := database.DB.Scopes(scopes...).Scopes(regionPrefilter(region)).
+		Order("geofences.id").
+		Session(&gorm.Session{})
+
+	page := []models.Geofence{}
+	for len(page) <= limit {
+		var batch []models.Geofence
+		if err := query.Where("geofences.id > ?", afterID).Limit(viewportBatchSize).Find(&batch).Error; err != nil {
+			return nil, 0, err
+		}
+		for _, fence := range batch {
+			if GeofenceIntersectsRegion(fence, region) {
+				page = append(page, fence)
+				if len(page) > limit {
+					break
+				}
+			}
+		}
+		if len(batch) < viewportBatchSize {
+			break
+		}
+		afterID = batch[len(batch)-1].ID
+	}
+
+	// The extra fence only tells us there's another page
+	if len(page) > limit {
+		page = page[:limit]
+		return page, page[limit-1].ID, nil
+	}
+	return page, 0, nil
+}
+
+// postgisBoxWidth caps the longitudes covered by each box a region is split
+// into for PostGIS, whose geography edges must stay well short of half the
+// globe
+const postgisBoxWidth = 90.0
+
+// postgisEdgeSlack is added to distances from region boxes in metres. The
+// boxes are segmentized every 0.1° so their geodesic edges follow the
+// parallels to within a metre or two.
+const postgisEdgeSlack = 10.0
+
+// regionGeography is a lat/lng box as a geography; degenerate boxes (a point
+// or a line) come out as such rather than as empty polygons
+const regionGeography = "ST_Segmentize(ST_Envelope(ST_MakeLine(ST_MakePoint(?, ?), ST_MakePoint(?, ?))), 0.1)::geography"
+
+// regionPrefilter narrows fences to those whose bounding box touches the
+// region. Fences near the antimeridian are also tested shifted a full turn
+// east and west so circles that wrap around it aren't missed. On Postgres
+// the fence circles are tested against the region with ST_DWithin, which
+// wraps by itself.
+func regionPrefilter(region Region) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if database.IsPostgres(db) {
+			var near *gorm.DB
+			for _, span := range region.lngSpans() {
+				for west := span[0]; ; west += postgisBoxWidth {
+					east := math.Min(west+postgisBoxWidth, span[1])
+					condition := database.DB.Where("ST_DWithin(geofences.location, "+regionGeography+", geofences.radius + ?)",
+						west, region.MinLat, east, region.MaxLat, postgisEdgeSlack)
+					if near == nil {
+						near = condition
+					} else {
+						near = near.Or(condition)
+					}
+					if east >= span[1] {
+						break
+					}
+				}
+			}
+			return db.Where(near)
+		}
+
+		// A fence's longitude span grows towards the poles; using the region's
+		// highest latitude keeps the filter conservative
+		metersPerLngDegree := 111320 * math.Max(math.Cos(toRadians(math.Max(math.Abs(region.MinLat), math.Abs(region.MaxLat)))), 0.01)
+
+		var lngFilter *gorm.DB
+		for _, span := range region.lngSpans() {
+			for _, shift := range []float64{-360, 0, 360} {
+				condition := database.DB.Where("geofences.longitude + ? + geofences.radius / ? >= ? AND geofences.longitude + ? - geofences.radius / ? <= ?",
+					shift, metersPerLngDegree, span[0], shift, metersPerLngDegree, span[1])
+				if lngFilter == nil {
+					lngFilter = condition
+				} else {
+					lngFilter = lngFilter.Or(condition)
+				}
+			}
+		}
+
+		return db.Where("geofences.latitude + geofences.radius / 111320.0 >= ? AND geofences.latitude - geofences.radius / 111320.0 <= ?", region.MinLat, region.MaxLat).
+			Where(lngFilter)
+	}
+}
+
+// Contains reports whether a point lies in the region, edges included
+func (r Region) Contains(lat, lng float64) bool {
+	if lat < r.MinLat || lat > r.MaxLat {
+		return false
+	}
+	for _, span := range r.lngSpans() {
+		if lngWithin(lng, span[0], span[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// geofenceCentresIn keeps fences whose centre lies in the region, which may
+// cross the antimeridian. PostGIS uses ST_Covers rather than ST_Contains so
+// centres on the edge count, as they do with BETWEEN.
+func geofenceCentresIn(region Region) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !database.IsPostgres(db) {
+			return db.Scopes(coordinatesIn("geofences", region))
+		}
+
+		var inside *gorm.DB
+		for _, span := range region.lngSpans() {
+			condition := database.DB.Where("ST_Covers(ST_MakeEnvelope(?, ?, ?, ?, 4326), geofences.location::geometry)",
+				span[0], region.MinLat, span[1], region.MaxLat)
+			if inside == nil {
+				inside = condition
+			} else {
+				inside = inside.Or(condition)
+			}
+		}
+		return db.Where(inside)
+	}
+}
+
+// coordinatesIn keeps rows of table whose latitude and longitude lie in the
+// region, which may cross the antimeridian
+func coordinatesIn(table string, region Region) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		var lngFilter *gorm.DB
+		for _, span := range region.lngSpans() {
+			condition := database.DB.Where(table+".longitude BETWEEN ? AND ?", span[0], span[1])
+			if lngFilter == nil {
+				lngFilter = condition
+			} else {
+				lngFilter = lngFilter.Or(condition)
+			}
+		}
+		return db.Where(table+".latitude BETWEEN ? AND ?", region.MinLat, region.MaxLat).
+			Where(lngFilter)
+	}
+}
+
+// CircleIntersectsRegion reports whether a circle of radius metres around a
+// point overlaps the region. It measures from the centre to the nearest
+// point of the box, so it works across the antimeridian.
+func CircleIntersectsRegion(lat, lng, radius float64, region Region) bool {
+	nearestLat := math.Max(region.MinLat, math.Min(region.MaxLat, lat))
+
+	validator := &GeofenceValidationService{}
+	for _, span := range region.lngSpans() {
+		nearestLng := lng
+		if !lngWithin(lng, span[0], span[1]) {
+			// Whichever edge is closer going round the globe
+			if lngDistance(lng, span[0]) < lngDistance(lng, span[1]) {
+				nearestLng = span[0]
+			} else {
+				nearestLng = span[1]
+			}
+		}
+		if validator.CalculateDistance(lat, lng, nearestLat, nearestLng)*1000 <= radius {
+			return true
+		}
+	}
+	return false
+}
+
+// lngWithin reports whether lng lies in the non-wrapping span [west, east]
+func lngWithin(lng, west, east float64) bool {
+	return lng >= west && lng <= east
+}
+
+// lngDistance is the angle between two longitudes the short way round
+func lngDistance(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	return math.Min(d, 360-d)
+}
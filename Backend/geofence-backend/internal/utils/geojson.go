@@ -0,0 +1,39 @@
+// internal/utils/geojson.go
+package utils
+
+import "encoding/json"
+
+// GeoJSON geometry types the API reads and writes
+const (
+	GeoJSONPoint      = "Point"
+	GeoJSONLineString = "LineString"
+	GeoJSONPolygon    = "Polygon"
+
+	GeoJSONMultiPolygon = "MultiPolygon"
+)
+
+// GeoJSONFeatureCollection is a GeoJSON (RFC 7946) FeatureCollection
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature is a GeoJSON Feature
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id,omitempty"`
+	Geometry   *GeoJSONGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONGeometry is a GeoJSON geometry. Coordinates are left raw since
+// their shape depends on Type; positions are [longitude, latitude].
+type GeoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// NewFeatureCollection returns an empty FeatureCollection
+func NewFeatureCollection() GeoJSONFeatureCollection {
+	return GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []GeoJSONFeature{}}
+}
@@ -0,0 +1,192 @@
+// internal/utils/mvt.go
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// MVTGeomType is a Mapbox Vector Tile geometry type
+type MVTGeomType int
+
+const (
+	MVTPoint      MVTGeomType = 1
+	MVTLineString MVTGeomType = 2
+	MVTPolygon    MVTGeomType = 3
+)
+
+// MVTFeature is one feature of a vector tile layer. Geometry is in tile
+// coordinates (0 to the layer extent, y down): one part with a single point
+// for points, and for polygons one closed ring per part without repeating
+// the first point, exterior rings clockwise. Property values may be strings,
+// bools, signed or unsigned integers and floats.
+type MVTFeature struct {
+	ID         uint64
+	Type       MVTGeomType
+	Geometry   [][][2]int
+	Properties map[string]interface{}
+}
+
+// MVTLayer is a named layer of features
+type MVTLayer struct {
+	Name     string
+	Extent   int
+	Features []MVTFeature
+}
+
+// Geometry commands (see the vector tile specification, version 2)
+const (
+	mvtMoveTo    = 1
+	mvtLineTo    = 2
+	mvtClosePath = 7
+)
+
+// EncodeMVT encodes layers as a version 2 Mapbox Vector Tile. The output is
+// deterministic, so it can be hashed for caching.
+func EncodeMVT(layers []MVTLayer) ([]byte, error) {
+	var tile []byte
+	for _, layer := range layers {
+		encoded, err := encodeMVTLayer(layer)
+		if err != nil {
+			return nil, err
+		}
+		tile = protoBytes(tile, 3, encoded)
+	}
+	return tile, nil
+}
+
+func encodeMVTLayer(layer MVTLayer) ([]byte, error) {
+	var keys []string
+	keyIndex := map[string]int{}
+	var values [][]byte
+	valueIndex := map[string]int{}
+
+	var out []byte
+	out = protoVarint(out, 15, 2)
+	out = protoBytes(out, 1, []byte(layer.Name))
+
+	for _, feature := range layer.Features {
+		names := make([]string, 0, len(feature.Properties))
+		for name := range feature.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var tags []uint64
+		for _, name := range names {
+			value, err := encodeMVTValue(feature.Properties[name])
+			if err != nil {
+				return nil, fmt.Errorf("mvt: property %s: %w", name, err)
+			}
+			if _, ok := keyIndex[name]; !ok {
+				keyIndex[name] = len(keys)
+				keys = append(keys, name)
+			}
+			if _, ok := valueIndex[string(value)]; !ok {
+				valueIndex[string(value)] = len(values)
+				values = append(values, value)
+			}
+			tags = append(tags, uint64(keyIndex[name]), uint64(valueIndex[string(value)]))
+		}
+
+		var encoded []byte
+		encoded = protoVarint(encoded, 1, feature.ID)
+		if len(tags) > 0 {
+			encoded = protoPacked(encoded, 2, tags)
+		}
+		encoded = protoVarint(encoded, 3, uint64(feature.Type))
+		encoded = protoPacked(encoded, 4, encodeMVTGeometry(feature.Type, feature.Geometry))
+		out = protoBytes(out, 2, encoded)
+	}
+
+	for _, key := range keys {
+		out = protoBytes(out, 3, []byte(key))
+	}
+	for _, value := range values {
+		out = protoBytes(out, 4, value)
+	}
+	return protoVarint(out, 5, uint64(layer.Extent)), nil
+}
+
+// encodeMVTValue encodes a property as a Value message
+func encodeMVTValue(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return protoBytes(nil, 1, []byte(v)), nil
+	case float64:
+		buf := append(protoKey(nil, 3, 1), make([]byte, 8)...)
+		binary.LittleEndian.PutUint64(buf[len(buf)-8:], math.Float64bits(v))
+		return buf, nil
+	case int:
+		return protoVarint(nil, 6, zigzag(int64(v))), nil
+	case int64:
+		return protoVarint(nil, 6, zigzag(v)), nil
+	case uint:
+		return protoVarint(nil, 5, uint64(v)), nil
+	case uint64:
+		return protoVarint(nil, 5, v), nil
+	case bool:
+		if v {
+			return protoVarint(nil, 7, 1), nil
+		}
+		return protoVarint(nil, 7, 0), nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
+
+// encodeMVTGeometry encodes parts as MoveTo/LineTo/ClosePath commands with
+// zigzag-encoded deltas from the previous point
+func encodeMVTGeometry(geomType MVTGeomType, parts [][][2]int) []uint64 {
+	var commands []uint64
+	var x, y int
+	command := func(id, count int) uint64 {
+		return uint64(id&0x7 | count<<3)
+	}
+	moveBy := func(point [2]int) {
+		commands = append(commands, zigzag(int64(point[0]-x)), zigzag(int64(point[1]-y)))
+		x, y = point[0], point[1]
+	}
+
+	for _, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+		commands = append(commands, command(mvtMoveTo, 1))
+		moveBy(part[0])
+		if len(part) > 1 {
+			commands = append(commands, command(mvtLineTo, len(part)-1))
+			for _, point := range part[1:] {
+				moveBy(point)
+			}
+		}
+		if geomType == MVTPolygon {
+			commands = append(commands, command(mvtClosePath, 1))
+		}
+	}
+	return commands
+}
+
+// Protocol buffer wire format helpers
+
+func protoKey(buf []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(buf, uint64(field<<3|wireType))
+}
+
+func protoVarint(buf []byte, field int, v uint64) []byte {
+	return binary.AppendUvarint(protoKey(buf, field, 0), v)
+}
+
+func protoBytes(buf []byte, field int, v []byte) []byte {
+	buf = binary.AppendUvarint(protoKey(buf, field, 2), uint64(len(v)))
+	return append(buf, v...)
+}
+
+func protoPacked(buf []byte, field int, values []uint64) []byte {
+	var packed []byte
+	for _, v := range values {
+		packed = binary.AppendUvarint(packed, v)
+	}
+	return protoBytes(buf, field, packed)
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+)
+
+// Pagination holds the page window requested by the client
+type Pagination struct {
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+}
+
+// Offset returns the number of rows to skip for the page
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// ParsePagination reads page and per_page query parameters, falling back to
+// defaults for missing or invalid values and capping per_page at MaxPerPage
+func ParsePagination(r *http.Request) Pagination {
+	p := Pagination{Page: 1, PerPage: DefaultPerPage}
+
+	if page, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && page > 0 {
+		p.Page = page
+	}
+
+	if perPage, err := strconv.Atoi(r.URL.Query().Get("per_page")); err == nil && perPage > 0 {
+		p.PerPage = perPage
+	}
+
+	if p.PerPage > MaxPerPage {
+		p.PerPage = MaxPerPage
+	}
+
+	return p
+}
+
+// RespondWithPage sends a success response wrapping a page of items with its metadata
+func RespondWithPage(w http.ResponseWriter, items interface{}, p Pagination, total int64) {
+	RespondWithSuccess(w, http.StatusOK, map[string]interface{}{
+		"items":    items,
+		"page":     p.Page,
+		"per_page": p.PerPage,
+		"total":    total,
+	})
+}
+
+// ErrInvalidCursor is returned for cursors the server didn't hand out
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CursorPagination holds a keyset page request: up to Limit items with IDs
+// after After
+type CursorPagination struct {
+	After uint
+	Limit int
+}
+
+// ParseCursorPagination reads cursor and limit query parameters. Limit falls
+// back to DefaultPerPage and is capped at MaxPerPage.
+func ParseCursorPagination(r *http.Request) (CursorPagination, error) {
+	p := CursorPagination{Limit: DefaultPerPage}
+
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit > 0 {
+		p.Limit = limit
+	}
+	if p.Limit > MaxPerPage {
+		p.Limit = MaxPerPage
+	}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return p, ErrInvalidCursor
+		}
+		after, err := strconv.ParseUint(string(decoded), 10, 64)
+		if err != nil {
+			return p, ErrInvalidCursor
+		}
+		p.After = uint(after)
+	}
+
+	return p, nil
+}
+
+// EncodeCursor returns the opaque cursor for the page after id
+func EncodeCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+// RespondWithCursorPage sends a success response wrapping a page of items and
+// the cursor for the next one, empty on the last page
+func RespondWithCursorPage(w http.ResponseWriter, items interface{}, p CursorPagination, nextCursor string) {
+	RespondWithSuccess(w, http.StatusOK, map[string]interface{}{
+		"items":       items,
+		"limit":       p.Limit,
+		"next_cursor": nextCursor,
+	})
+}
@@ -0,0 +1,418 @@
+// internal/utils/parquet.go
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// ParquetType is the logical type of a Parquet column
+type ParquetType int
+
+const (
+	ParquetInt64 ParquetType = iota
+	ParquetDouble
+	ParquetString
+	ParquetBool
+	ParquetTimestamp // stored as milliseconds since the epoch, UTC
+)
+
+// ParquetColumn describes one flat column. Only optional columns accept nil.
+type ParquetColumn struct {
+	Name     string
+	Type     ParquetType
+	Optional bool
+}
+
+// parquetRowGroupSize is how many rows are buffered before a row group is written
+const parquetRowGroupSize = 10000
+
+// Parquet format constants (see parquet.thrift)
+const (
+	parquetPhysicalBoolean   = 0
+	parquetPhysicalInt64     = 2
+	parquetPhysicalDouble    = 5
+	parquetPhysicalByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+)
+
+var parquetMagic = []byte("PAR1")
+
+// ParquetWriter writes rows as an uncompressed, plain-encoded Parquet file with
+// a flat schema. Rows are buffered and written one row group at a time, so
+// memory use doesn't grow with the size of the file.
+type ParquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []ParquetColumn
+	buffered  [][]interface{}
+	rows      int
+	totalRows int64
+	rowGroups []parquetRowGroup
+}
+
+type parquetRowGroup struct {
+	chunks   []parquetChunk
+	rows     int64
+	byteSize int64
+}
+
+type parquetChunk struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+// NewParquetWriter starts a Parquet file with the given columns on w
+func NewParquetWriter(w io.Writer, columns []ParquetColumn) (*ParquetWriter, error) {
+	pw := &ParquetWriter{w: w, columns: columns, buffered: make([][]interface{}, len(columns))}
+	return pw, pw.write(parquetMagic)
+}
+
+// WriteRow buffers one row. Values must be int64, float64, string, bool or
+// time.Time to match their column's type, or nil in optional columns.
+func (pw *ParquetWriter) WriteRow(values []interface{}) error {
+	if len(values) != len(pw.columns) {
+		return fmt.Errorf("parquet: row has %d values, want %d", len(values), len(pw.columns))
+	}
+	for i, value := range values {
+		if value == nil && !pw.columns[i].Optional {
+			return fmt.Errorf("parquet: column %s is required", pw.columns[i].Name)
+		}
+		pw.buffered[i] = append(pw.buffered[i], value)
+	}
+
+	pw.rows++
+	if pw.rows >= parquetRowGroupSize {
+		return pw.flush()
+	}
+	return nil
+}
+
+// Close writes any buffered rows and the file footer. It doesn't close the
+// underlying writer.
+func (pw *ParquetWriter) Close() error {
+	if err := pw.flush(); err != nil {
+		return err
+	}
+
+	footer := pw.footer()
+	if err := pw.write(footer); err != nil {
+		return err
+	}
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(len(footer)))
+	if err := pw.write(length); err != nil {
+		return err
+	}
+	return pw.write(parquetMagic)
+}
+
+func (pw *ParquetWriter) write(p []byte) error {
+	n, err := pw.w.Write(p)
+	pw.offset += int64(n)
+	return err
+}
+
+// flush writes the buffered rows as a row group of one page per column
+func (pw *ParquetWriter) flush() error {
+	if pw.rows == 0 {
+		return nil
+	}
+
+	group := parquetRowGroup{rows: int64(pw.rows)}
+	for i, column := range pw.columns {
+		page, err := encodeParquetPage(column, pw.buffered[i])
+		if err != nil {
+			return err
+		}
+
+		header := &thriftWriter{}
+		header.beginStruct()
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(page)))
+		header.beginStructField(5)
+		header.i32(1, int32(pw.rows))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.endStruct()
+		header.endStruct()
+
+		chunk := parquetChunk{offset: pw.offset, size: int64(header.buf.Len() + len(page)), values: int64(pw.rows)}
+		if err := pw.write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := pw.write(page); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.byteSize += chunk.size
+		pw.buffered[i] = pw.buffered[i][:0]
+	}
+
+	pw.rowGroups = append(pw.rowGroups, group)
+	pw.totalRows += int64(pw.rows)
+	pw.rows = 0
+	return nil
+}
+
+// footer encodes the FileMetaData struct
+func (pw *ParquetWriter) footer() []byte {
+	t := &thriftWriter{}
+	t.beginStruct()
+	t.i32(1, 1)
+
+	t.listField(2, thriftStruct, len(pw.columns)+1)
+	t.beginStruct()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(pw.columns)))
+	t.endStruct()
+	for _, column := range pw.columns {
+		physical, converted := parquetTypes(column.Type)
+		repetition := int32(parquetRequired)
+		if column.Optional {
+			repetition = parquetOptional
+		}
+		t.beginStruct()
+		t.i32(1, physical)
+		t.i32(3, repetition)
+		t.binary(4, column.Name)
+		if converted >= 0 {
+			t.i32(6, converted)
+		}
+		t.endStruct()
+	}
+
+	t.i64(3, pw.totalRows)
+
+	t.listField(4, thriftStruct, len(pw.rowGroups))
+	for _, group := range pw.rowGroups {
+		t.beginStruct()
+		t.listField(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			physical, _ := parquetTypes(pw.columns[i].Type)
+			t.beginStruct()
+			t.i64(2, chunk.offset)
+			t.beginStructField(3)
+			t.i32(1, physical)
+			t.listField(2, thriftI32, 2)
+			t.varint(zigzag(parquetEncodingPlain))
+			t.varint(zigzag(parquetEncodingRLE))
+			t.listField(3, thriftBinary, 1)
+			t.rawBinary(pw.columns[i].Name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, chunk.values)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.endStruct()
+			t.endStruct()
+		}
+		t.i64(2, group.byteSize)
+		t.i64(3, group.rows)
+		t.endStruct()
+	}
+
+	t.binary(6, "geofence-backend")
+	t.endStruct()
+	return t.buf.Bytes()
+}
+
+// parquetTypes maps a column type to its physical and converted type;
+// converted is -1 when there is none
+func parquetTypes(columnType ParquetType) (physical int32, converted int32) {
+	switch columnType {
+	case ParquetDouble:
+		return parquetPhysicalDouble, -1
+	case ParquetString:
+		return parquetPhysicalByteArray, parquetConvertedUTF8
+	case ParquetBool:
+		return parquetPhysicalBoolean, -1
+	case ParquetTimestamp:
+		return parquetPhysicalInt64, parquetConvertedTimestampMillis
+	}
+	return parquetPhysicalInt64, -1
+}
+
+// encodeParquetPage encodes a column's definition levels (for optional
+// columns) followed by its non-null values
+func encodeParquetPage(column ParquetColumn, values []interface{}) ([]byte, error) {
+	var page bytes.Buffer
+
+	if column.Optional {
+		levels := encodeDefinitionLevels(values)
+		length := make([]byte, 4)
+		binary.LittleEndian.PutUint32(length, uint32(len(levels)))
+		page.Write(length)
+		page.Write(levels)
+	}
+
+	var bools []bool
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		var ok bool
+		switch column.Type {
+		case ParquetInt64:
+			var v int64
+			if v, ok = value.(int64); ok {
+				binary.Write(&page, binary.LittleEndian, v)
+			}
+		case ParquetDouble:
+			var v float64
+			if v, ok = value.(float64); ok {
+				binary.Write(&page, binary.LittleEndian, math.Float64bits(v))
+			}
+		case ParquetString:
+			var v string
+			if v, ok = value.(string); ok {
+				binary.Write(&page, binary.LittleEndian, uint32(len(v)))
+				page.WriteString(v)
+			}
+		case ParquetBool:
+			var v bool
+			if v, ok = value.(bool); ok {
+				bools = append(bools, v)
+			}
+		case ParquetTimestamp:
+			var v time.Time
+			if v, ok = value.(time.Time); ok {
+				binary.Write(&page, binary.LittleEndian, v.UnixMilli())
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("parquet: column %s can't hold %T", column.Name, value)
+		}
+	}
+
+	// Booleans are bit-packed, least significant bit first
+	if len(bools) > 0 {
+		packed := make([]byte, (len(bools)+7)/8)
+		for i, v := range bools {
+			if v {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		page.Write(packed)
+	}
+
+	return page.Bytes(), nil
+}
+
+// encodeDefinitionLevels run-length encodes which values are present
+// (level 1) or null (level 0), with a bit width of one
+func encodeDefinitionLevels(values []interface{}) []byte {
+	t := &thriftWriter{}
+	for start := 0; start < len(values); {
+		present := values[start] != nil
+		end := start + 1
+		for end < len(values) && (values[end] != nil) == present {
+			end++
+		}
+		t.varint(uint64(end-start) << 1)
+		if present {
+			t.buf.WriteByte(1)
+		} else {
+			t.buf.WriteByte(0)
+		}
+		start = end
+	}
+	return t.buf.Bytes()
+}
+
+// Thrift compact protocol type IDs
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the subset of the Thrift compact protocol the Parquet
+// footer and page headers need. Fields must be written in increasing ID order.
+type thriftWriter struct {
+	buf       bytes.Buffer
+	lastField []int16
+}
+
+func (t *thriftWriter) beginStruct() {
+	t.lastField = append(t.lastField, 0)
+}
+
+func (t *thriftWriter) beginStructField(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.beginStruct()
+}
+
+func (t *thriftWriter) endStruct() {
+	t.buf.WriteByte(0)
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
+
+func (t *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	last := &t.lastField[len(t.lastField)-1]
+	if delta := id - *last; delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		t.buf.WriteByte(fieldType)
+		t.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.fieldHeader(id, thriftBinary)
+	t.rawBinary(v)
+}
+
+func (t *thriftWriter) rawBinary(v string) {
+	t.varint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
+
+// listField writes a list header; the caller then writes size elements
+func (t *thriftWriter) listField(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xf0 | elemType)
+		t.varint(uint64(size))
+	}
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], v)
+	t.buf.Write(scratch[:n])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
@@ -0,0 +1,54 @@
+// internal/utils/polyline.go
+package utils
+
+import "errors"
+
+// DefaultPolylinePrecision is the number of decimal places Google's encoded
+// polylines use unless told otherwise
+const DefaultPolylinePrecision = 5
+
+// ErrInvalidPolyline is returned for malformed encoded polylines
+var ErrInvalidPolyline = errors.New("invalid encoded polyline")
+
+// DecodePolyline decodes an encoded polyline (Google's algorithm) into
+// [latitude, longitude] pairs
+func DecodePolyline(encoded string, precision int) ([][2]float64, error) {
+	factor := 1.0
+	for i := 0; i < precision; i++ {
+		factor *= 10
+	}
+
+	var points [][2]float64
+	var lat, lng int64
+	for i := 0; i < len(encoded); {
+		var deltas [2]int64
+		for j := range deltas {
+			var result int64
+			var shift uint
+			for {
+				if i >= len(encoded) || shift > 60 {
+					return nil, ErrInvalidPolyline
+				}
+				b := int64(encoded[i]) - 63
+				i++
+				if b < 0 || b > 63 {
+					return nil, ErrInvalidPolyline
+				}
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[j] = ^(result >> 1)
+			} else {
+				deltas[j] = result >> 1
+			}
+		}
+		lat += deltas[0]
+		lng += deltas[1]
+		points = append(points, [2]float64{float64(lat) / factor, float64(lng) / factor})
+	}
+	return points, nil
+}